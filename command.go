@@ -17,9 +17,14 @@ package eventhorizon
 import (
 	"errors"
 	"fmt"
+	"net/mail"
 	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 )
@@ -30,8 +35,8 @@ import (
 // (MoveCustomer vs CorrectCustomerAddress).
 //
 // The command should contain all the data needed when handling it as fields.
-// These fields can take an optional "eh" tag, which adds properties. For now
-// only "optional" is a valid tag: `eh:"optional"`.
+// These fields can take an optional "eh" tag with validation rules, like
+// `eh:"optional"` or `eh:"min=1,max=10"`, see CheckCommand for all rules.
 type Command interface {
 	// AggregateID returns the ID of the aggregate that the command should be
 	// handled by.
@@ -55,11 +60,14 @@ var commandsMu sync.RWMutex
 var ErrCommandNotRegistered = errors.New("command not registered")
 
 // RegisterCommand registers an command factory for a type. The factory is
-// used to create concrete command types.
+// used to create concrete command types. The "eh" tags of the command fields
+// are parsed once when registered, and an error is returned if they are
+// invalid, see CheckCommand. The command is registered also when the tags
+// are invalid, but CheckCommand will return the same error for it.
 //
 // An example would be:
 //     RegisterCommand(func() Command { return &MyCommand{} })
-func RegisterCommand(factory func() Command) {
+func RegisterCommand(factory func() Command) error {
 	// TODO: Explore the use of reflect/gob for creating concrete types without
 	// a factory func.
 
@@ -79,6 +87,14 @@ func RegisterCommand(factory func() Command) {
 		panic(fmt.Sprintf("eventhorizon: registering duplicate types for %q", commandType))
 	}
 	commands[commandType] = factory
+
+	// Parse and cache the rules of the command fields.
+	if rt := reflect.Indirect(reflect.ValueOf(cmd)).Type(); rt.Kind() == reflect.Struct {
+		if _, err := structRules(rt); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // UnregisterCommand removes the registration of the command factory for
@@ -108,36 +124,320 @@ func CreateCommand(commandType CommandType) (Command, error) {
 	return nil, ErrCommandNotRegistered
 }
 
-// CommandFieldError is returned by Dispatch when a field is incorrect.
+// RegisteredCommands returns the types of all commands registered with
+// RegisterCommand, in no particular order.
+func RegisteredCommands() []CommandType {
+	commandsMu.RLock()
+	defer commandsMu.RUnlock()
+	types := make([]CommandType, 0, len(commands))
+	for commandType := range commands {
+		types = append(types, commandType)
+	}
+	return types
+}
+
+// CommandFieldError is returned by CheckCommand with the first field that
+// failed the checks, use Fields to get all of them. Field is the path to the
+// field, with nested fields separated by dots and slice elements indexed, like
+// "Items[0].Name". Rule is the tag rule that failed, or empty if the field was
+// missing.
 type CommandFieldError struct {
 	Field string
+	Rule  string
+
+	// more is the rest of the fields that failed, a pointer to keep the error
+	// comparable.
+	more *CommandFieldErrors
 }
 
 func (c CommandFieldError) Error() string {
-	return "missing field: " + c.Field
+	fields := c.Fields()
+	errs := make([]string, len(fields))
+	for i, f := range fields {
+		if f.Rule == "" {
+			errs[i] = "missing field: " + f.Field
+		} else {
+			errs[i] = "invalid field: " + f.Field + " (" + f.Rule + ")"
+		}
+	}
+	return strings.Join(errs, ", ")
+}
+
+// Fields returns all fields that failed the checks, starting with this one.
+func (c CommandFieldError) Fields() CommandFieldErrors {
+	fields := CommandFieldErrors{{Field: c.Field, Rule: c.Rule}}
+	if c.more != nil {
+		fields = append(fields, *c.more...)
+	}
+	return fields
+}
+
+// CommandFieldErrors is a list of fields that failed the checks in
+// CheckCommand, as returned by CommandFieldError.Fields.
+type CommandFieldErrors []CommandFieldError
+
+// FieldError returns a CommandFieldError with all the fields, like the one
+// returned by CheckCommand.
+func (c CommandFieldErrors) FieldError() CommandFieldError {
+	if len(c) == 0 {
+		return CommandFieldError{}
+	}
+	err := CommandFieldError{Field: c[0].Field, Rule: c[0].Rule}
+	if len(c) > 1 {
+		more := append(CommandFieldErrors{}, c[1:]...)
+		err.more = &more
+	}
+	return err
 }
 
-// CheckCommand checks a command for errors.
+// CheckCommand checks a command for errors. All exported fields are required
+// to have non zero values unless tagged as optional, and must pass the rules
+// in their "eh" tags. All fields that fail are returned as a CommandFieldError.
+//
+// The rules are separated by commas:
+//     optional     the field can have a zero value, in which case the
+//                  other rules are not checked
+//     min=N        numbers must be at least N, strings, slices and maps
+//                  must have a length of at least N
+//     max=N        like min but at most N
+//     len=N        strings, slices and maps must have a length of exactly N
+//     enum=A|B     the field must be one of the values, as formatted by fmt
+//     email        strings must be an email address
+//     nested       structs, and structs in slices and arrays, are checked
+//                  with their own fields and tags
+//     regex=EXPR   strings must match the regular expression, must be the
+//                  last rule as the expression can contain commas
+//
+// An example would be:
+//     Name  string `eh:"min=2,max=64"`
+//     Email string `eh:"optional,email"`
+//     Items []Item `eh:"nested"`
+//
+// Invalid tags are programming errors, they are returned as an error both by
+// RegisterCommand and CheckCommand.
 func CheckCommand(cmd Command) error {
 	rv := reflect.Indirect(reflect.ValueOf(cmd))
-	rt := rv.Type()
+	rules, err := structRules(rv.Type())
+	if err != nil {
+		return err
+	}
+	var errs CommandFieldErrors
+	checkStruct(rv, rules, "", &errs)
+	if len(errs) > 0 {
+		return errs.FieldError()
+	}
+	return nil
+}
+
+func checkStruct(rv reflect.Value, rules []fieldRules, prefix string, errs *CommandFieldErrors) {
+	for _, f := range rules {
+		checkField(rv.Field(f.index), prefix+f.name, f, errs)
+	}
+}
+
+func checkField(v reflect.Value, name string, f fieldRules, errs *CommandFieldErrors) {
+	if isZero(v) {
+		if !f.optional {
+			*errs = append(*errs, CommandFieldError{Field: name})
+		}
+		return
+	}
+
+	for _, r := range f.rules {
+		if r.name == "nested" {
+			checkNested(v, name, f.nested, errs)
+		} else if !r.check(v) {
+			*errs = append(*errs, CommandFieldError{Field: name, Rule: r.String()})
+		}
+	}
+}
 
+func checkNested(v reflect.Value, name string, t reflect.Type, errs *CommandFieldErrors) {
+	// The rules of nested types are parsed with the parent.
+	rules, _ := structRules(t)
+	if v.Kind() == reflect.Struct {
+		checkStruct(v, rules, name+".", errs)
+		return
+	}
+	for i := 0; i < v.Len(); i++ {
+		checkStruct(v.Index(i), rules, fmt.Sprintf("%s[%d].", name, i), errs)
+	}
+}
+
+// fieldRules are the parsed rules of a field.
+type fieldRules struct {
+	index    int
+	name     string
+	optional bool
+	rules    []tagRule
+	// nested is the struct type to check with the nested rule.
+	nested reflect.Type
+}
+
+// tagRule is a single rule from an "eh" tag, like "min=1".
+type tagRule struct {
+	name  string
+	param string
+	n     float64
+	re    *regexp.Regexp
+}
+
+func (r tagRule) String() string {
+	if r.param == "" {
+		return r.name
+	}
+	return r.name + "=" + r.param
+}
+
+// commandRules is the cached []fieldRules per struct type, parsing is
+// serialized by commandRulesMu.
+var commandRules sync.Map
+var commandRulesMu sync.Mutex
+
+// structRules returns the parsed rules of the fields of a struct type, they are
+// parsed once and then cached. Types with invalid tags are not cached.
+func structRules(rt reflect.Type) ([]fieldRules, error) {
+	if r, ok := commandRules.Load(rt); ok {
+		return r.([]fieldRules), nil
+	}
+
+	commandRulesMu.Lock()
+	defer commandRulesMu.Unlock()
+	return parseStruct(rt, map[reflect.Type]bool{})
+}
+
+func parseStruct(rt reflect.Type, parsing map[reflect.Type]bool) ([]fieldRules, error) {
+	if r, ok := commandRules.Load(rt); ok {
+		return r.([]fieldRules), nil
+	} else if parsing[rt] {
+		return nil, nil
+	}
+	if rt.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("eventhorizon: %s is not a struct", rt)
+	}
+	parsing[rt] = true
+
+	var fields []fieldRules
 	for i := 0; i < rt.NumField(); i++ {
 		field := rt.Field(i)
 		if field.PkgPath != "" {
 			continue // Skip private field.
 		}
+		f, err := parseField(field, parsing)
+		if err != nil {
+			return nil, err
+		}
+		f.index = i
+		fields = append(fields, f)
+	}
 
-		tag := field.Tag.Get("eh")
-		if tag == "optional" {
-			continue // Optional field.
+	commandRules.Store(rt, fields)
+	return fields, nil
+}
+
+func parseField(field reflect.StructField, parsing map[reflect.Type]bool) (fieldRules, error) {
+	f := fieldRules{name: field.Name}
+	tag := field.Tag.Get("eh")
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regex=") {
+			part, tag = tag, "" // The rest of the tag is the expression.
+		} else if i := strings.Index(tag, ","); i >= 0 {
+			part, tag = tag[:i], tag[i+1:]
+		} else {
+			part, tag = tag, ""
+		}
+		r := tagRule{name: part}
+		if i := strings.Index(part, "="); i >= 0 {
+			r.name, r.param = part[:i], part[i+1:]
 		}
 
-		if isZero(rv.Field(i)) {
-			return CommandFieldError{field.Name}
+		invalid := fmt.Errorf("eventhorizon: invalid rule %q for field %s", r, field.Name)
+		k := field.Type.Kind()
+		isLen := k == reflect.String || k == reflect.Slice || k == reflect.Map || k == reflect.Array
+		isNum := k >= reflect.Int && k <= reflect.Float64 && k != reflect.Uintptr
+		switch r.name {
+		case "optional":
+			f.optional = true
+		case "min", "max", "len":
+			n, err := strconv.ParseFloat(r.param, 64)
+			if err != nil || !isLen && (r.name == "len" || !isNum) {
+				return f, invalid
+			}
+			r.n = n
+		case "enum":
+		case "email":
+			if k != reflect.String {
+				return f, invalid
+			}
+		case "regex":
+			re, err := regexp.Compile(r.param)
+			if err != nil || k != reflect.String {
+				return f, invalid
+			}
+			r.re = re
+		case "nested":
+			t := field.Type
+			if k == reflect.Slice || k == reflect.Array {
+				t = t.Elem()
+			}
+			if t.Kind() != reflect.Struct {
+				return f, invalid
+			}
+			if _, err := parseStruct(t, parsing); err != nil {
+				return f, err
+			}
+			f.nested = t
+		default:
+			return f, fmt.Errorf("eventhorizon: unknown rule %q for field %s", r, field.Name)
 		}
+		f.rules = append(f.rules, r)
+	}
+	return f, nil
+}
+
+// check returns false if the value does not pass the rule, which has been
+// checked to be valid for the value when parsed.
+func (r tagRule) check(v reflect.Value) bool {
+	switch r.name {
+	case "min", "max", "len":
+		var x float64
+		switch v.Kind() {
+		case reflect.String:
+			x = float64(utf8.RuneCountInString(v.String()))
+		case reflect.Slice, reflect.Map, reflect.Array:
+			x = float64(v.Len())
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			x = float64(v.Int())
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			x = float64(v.Uint())
+		case reflect.Float32, reflect.Float64:
+			x = v.Float()
+		}
+		switch r.name {
+		case "min":
+			return x >= r.n
+		case "max":
+			return x <= r.n
+		default:
+			return x == r.n
+		}
+	case "enum":
+		s := fmt.Sprint(v.Interface())
+		for _, e := range strings.Split(r.param, "|") {
+			if s == e {
+				return true
+			}
+		}
+		return false
+	case "email":
+		addr, err := mail.ParseAddress(v.String())
+		return err == nil && addr.Address == v.String()
+	case "regex":
+		return r.re.MatchString(v.String())
+	default:
+		return true
 	}
-	return nil
 }
 
 func isZero(v reflect.Value) bool {
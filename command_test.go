@@ -15,6 +15,7 @@
 package eventhorizon
 
 import (
+	"reflect"
 	"testing"
 	"time"
 
@@ -36,6 +37,16 @@ func TestCreateCommand(t *testing.T) {
 	if cmd.CommandType() != TestCommandRegisterType {
 		t.Error("the command type should be correct:", cmd.CommandType())
 	}
+
+	found := false
+	for _, commandType := range RegisteredCommands() {
+		if commandType == TestCommandRegisterType {
+			found = true
+		}
+	}
+	if !found {
+		t.Error("the command type should be listed as registered")
+	}
 }
 
 func TestRegisterCommandEmptyName(t *testing.T) {
@@ -166,6 +177,193 @@ func TestCheckCommand(t *testing.T) {
 	}
 }
 
+func TestCheckCommand_Rules(t *testing.T) {
+	valid := func() *TestCommandRules {
+		return &TestCommandRules{
+			TestID: uuid.New(),
+			Name:   "name",
+			Age:    42,
+			Email:  "test@example.com",
+			Color:  "red",
+			Code:   "AB-12",
+			Tags:   []string{"a", "b"},
+			Items:  []TestCommandRulesItem{{Name: "item"}},
+			Item:   TestCommandRulesItem{Name: "item"},
+		}
+	}
+
+	if err := CheckCommand(valid()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// Optional fields with zero values skip the other rules.
+	cmd := valid()
+	cmd.Email = ""
+	if err := CheckCommand(cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	testCases := map[string]struct {
+		change func(*TestCommandRules)
+		err    string
+	}{
+		"min string": {
+			func(c *TestCommandRules) { c.Name = "n" },
+			"invalid field: Name (min=2)",
+		},
+		"max string": {
+			func(c *TestCommandRules) { c.Name = "a very long name" },
+			"invalid field: Name (max=8)",
+		},
+		"min int": {
+			func(c *TestCommandRules) { c.Age = 17 },
+			"invalid field: Age (min=18)",
+		},
+		"max int": {
+			func(c *TestCommandRules) { c.Age = 200 },
+			"invalid field: Age (max=150)",
+		},
+		"email": {
+			func(c *TestCommandRules) { c.Email = "not an email" },
+			"invalid field: Email (email)",
+		},
+		"enum": {
+			func(c *TestCommandRules) { c.Color = "yellow" },
+			"invalid field: Color (enum=red|green|blue)",
+		},
+		"regex": {
+			func(c *TestCommandRules) { c.Code = "ab12" },
+			"invalid field: Code (regex=^[A-Z]{2,3}-[0-9]+$)",
+		},
+		"len": {
+			func(c *TestCommandRules) { c.Tags = []string{"a"} },
+			"invalid field: Tags (len=2)",
+		},
+		"nested slice": {
+			func(c *TestCommandRules) { c.Items = append(c.Items, TestCommandRulesItem{Name: "x"}) },
+			"invalid field: Items[1].Name (min=2)",
+		},
+		"nested missing": {
+			func(c *TestCommandRules) { c.Item = TestCommandRulesItem{Count: 1} },
+			"missing field: Item.Name",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			cmd := valid()
+			tc.change(cmd)
+			err := CheckCommand(cmd)
+			if err == nil || err.Error() != tc.err {
+				t.Error("there should be a field error:", err)
+			}
+		})
+	}
+}
+
+func TestCheckCommand_AllFields(t *testing.T) {
+	cmd := &TestCommandRules{
+		TestID: uuid.New(),
+		Name:   "n",
+		Age:    1,
+		Color:  "red",
+		Code:   "AB-12",
+		Items:  []TestCommandRulesItem{{Name: "item"}},
+		Item:   TestCommandRulesItem{Name: "item"},
+	}
+	err := CheckCommand(cmd)
+	fErr, ok := err.(CommandFieldError)
+	if !ok {
+		t.Fatal("there should be a field error:", err)
+	}
+	if fErr.Field != "Name" || fErr.Rule != "min=2" {
+		t.Error("the first field should be correct:", fErr)
+	}
+	errs := fErr.Fields()
+	expected := CommandFieldErrors{
+		{Field: "Name", Rule: "min=2"},
+		{Field: "Age", Rule: "min=18"},
+		{Field: "Tags"},
+	}
+	if len(errs) != len(expected) {
+		t.Fatal("there should be all field errors:", errs)
+	}
+	for i := range errs {
+		if errs[i] != expected[i] {
+			t.Error("the field error should be correct:", errs[i])
+		}
+	}
+	if err.Error() != "invalid field: Name (min=2), invalid field: Age (min=18), missing field: Tags" {
+		t.Error("the error message should be correct:", err)
+	}
+}
+
+func TestCheckCommand_FieldError(t *testing.T) {
+	// A single field error should be comparable and assertable, as before
+	// all fields were checked.
+	err := CheckCommand(&TestCommandStringValue{TestID: uuid.New()})
+	if err != (CommandFieldError{Field: "Content"}) {
+		t.Error("there should be a field error:", err)
+	}
+	if f, ok := err.(CommandFieldError); !ok || f.Field != "Content" {
+		t.Error("the error should be a field error:", err)
+	}
+}
+
+func TestCheckCommand_InvalidTag(t *testing.T) {
+	err := CheckCommand(&TestCommandInvalidTag{TestID: uuid.New(), Content: "content"})
+	if err == nil || err.Error() != "eventhorizon: unknown rule \"unknown\" for field Content" {
+		t.Error("there should be an invalid tag error:", err)
+	}
+
+	testCases := map[string]interface{}{
+		"min on bool": struct {
+			A bool `eh:"min=1"`
+		}{},
+		"invalid min": struct {
+			A int `eh:"min=a"`
+		}{},
+		"len on int": struct {
+			A int `eh:"len=1"`
+		}{},
+		"email on int": struct {
+			A int `eh:"email"`
+		}{},
+		"invalid regex": struct {
+			A string `eh:"regex=["`
+		}{},
+		"regex on int": struct {
+			A int `eh:"regex=^a$"`
+		}{},
+		"nested on string": struct {
+			A string `eh:"nested"`
+		}{},
+		"nested on strings": struct {
+			A []string `eh:"nested"`
+		}{},
+		"invalid nested": struct {
+			A struct {
+				B int `eh:"unknown"`
+			} `eh:"nested"`
+		}{},
+	}
+	for name, v := range testCases {
+		if _, err := structRules(reflect.TypeOf(v)); err == nil {
+			t.Error("there should be an invalid tag error:", name)
+		}
+	}
+}
+
+func TestRegisterCommandInvalidTag(t *testing.T) {
+	err := RegisterCommand(func() Command { return &TestCommandInvalidTag{} })
+	defer UnregisterCommand(TestCommandInvalidTag{}.CommandType())
+	if err == nil || err.Error() != "eventhorizon: unknown rule \"unknown\" for field Content" {
+		t.Error("there should be an invalid tag error:", err)
+	}
+	if _, err := CreateCommand(TestCommandInvalidTag{}.CommandType()); err != nil {
+		t.Error("the command should be registered:", err)
+	}
+}
+
 // Mocks for Register/Unregister.
 
 const (
@@ -361,3 +559,37 @@ var _ = Command(TestCommandArray{})
 func (t TestCommandArray) AggregateID() uuid.UUID       { return t.TestID }
 func (t TestCommandArray) AggregateType() AggregateType { return AggregateType("Test") }
 func (t TestCommandArray) CommandType() CommandType     { return CommandType("TestCommandArray") }
+
+type TestCommandRules struct {
+	TestID uuid.UUID
+	Name   string                 `eh:"min=2,max=8"`
+	Age    int                    `eh:"min=18,max=150"`
+	Email  string                 `eh:"optional,email"`
+	Color  string                 `eh:"enum=red|green|blue"`
+	Code   string                 `eh:"regex=^[A-Z]{2,3}-[0-9]+$"`
+	Tags   []string               `eh:"len=2"`
+	Items  []TestCommandRulesItem `eh:"min=1,nested"`
+	Item   TestCommandRulesItem   `eh:"nested"`
+}
+
+type TestCommandRulesItem struct {
+	Name  string `eh:"min=2"`
+	Count int    `eh:"optional"`
+}
+
+var _ = Command(TestCommandRules{})
+
+func (t TestCommandRules) AggregateID() uuid.UUID       { return t.TestID }
+func (t TestCommandRules) AggregateType() AggregateType { return AggregateType("Test") }
+func (t TestCommandRules) CommandType() CommandType     { return CommandType("TestCommandRules") }
+
+type TestCommandInvalidTag struct {
+	TestID  uuid.UUID
+	Content string `eh:"unknown"`
+}
+
+var _ = Command(TestCommandInvalidTag{})
+
+func (t TestCommandInvalidTag) AggregateID() uuid.UUID       { return t.TestID }
+func (t TestCommandInvalidTag) AggregateType() AggregateType { return AggregateType("Test") }
+func (t TestCommandInvalidTag) CommandType() CommandType     { return CommandType("TestCommandInvalidTag") }
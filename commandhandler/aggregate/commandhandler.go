@@ -17,6 +17,8 @@ package aggregate
 import (
 	"context"
 	"errors"
+	"math/rand"
+	"time"
 
 	eh "github.com/looplab/eventhorizon"
 )
@@ -33,9 +35,15 @@ var ErrNilAggregateStore = errors.New("aggregate store is nil")
 // 4. The aggregate stores events in response to the command.
 // 5. The new events are stored in the event store.
 // 6. The events are published on the event bus after a successful store.
+//
+// The aggregate ID, version and created events are set on the result of the
+// command when it is handled with eh.HandleCommandWithResult.
 type CommandHandler struct {
 	t     eh.AggregateType
 	store eh.AggregateStore
+
+	retries int
+	backoff time.Duration
 }
 
 // NewCommandHandler creates a new CommandHandler for an aggregate type.
@@ -51,6 +59,16 @@ func NewCommandHandler(t eh.AggregateType, store eh.AggregateStore) (*CommandHan
 	return h, nil
 }
 
+// SetConflictRetries sets the number of times a command is retried when the
+// aggregate could not be saved because of a concurrency conflict, see
+// eh.ErrConcurrencyConflict. The aggregate is reloaded and the command is
+// handled again after a random wait of up to the backoff, which is doubled
+// for each retry. The default is no retries.
+func (h *CommandHandler) SetConflictRetries(retries int, backoff time.Duration) {
+	h.retries = retries
+	h.backoff = backoff
+}
+
 // HandleCommand handles a command with the registered aggregate.
 // Returns ErrAggregateNotFound if no aggregate could be found.
 func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) error {
@@ -59,6 +77,31 @@ func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) erro
 		return err
 	}
 
+	for i := 0; ; i++ {
+		err := h.handleCommand(ctx, cmd)
+		if i >= h.retries || !eh.IsConcurrencyConflict(err) {
+			return err
+		}
+
+		// Wait with jitter to spread out the retries of competing commands.
+		backoff := h.backoff << uint(i)
+		if backoff < h.backoff {
+			// Overflow, keep the original backoff.
+			backoff = h.backoff
+		}
+		var wait time.Duration
+		if backoff > 0 {
+			wait = time.Duration(rand.Int63n(int64(backoff)))
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return err
+		}
+	}
+}
+
+func (h *CommandHandler) handleCommand(ctx context.Context, cmd eh.Command) error {
 	a, err := h.store.Load(ctx, h.t, cmd.AggregateID())
 	if err != nil {
 		return err
@@ -70,5 +113,37 @@ func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) erro
 		return err
 	}
 
-	return h.store.Save(ctx, a)
+	// Get the events before they are cleared when saving.
+	var events []eh.Event
+	if a, ok := a.(uncommittedEvents); ok {
+		events = a.Events()
+	}
+
+	if err := h.store.Save(ctx, a); err != nil {
+		return err
+	}
+
+	if r, ok := eh.CommandResultFromContext(ctx); ok {
+		r.AggregateID = a.EntityID()
+		r.Events = events
+		if len(events) > 0 {
+			r.Version = events[len(events)-1].Version()
+		} else if a, ok := a.(versioned); ok {
+			r.Version = a.Version()
+		} else if a, ok := a.(eh.Versionable); ok {
+			r.Version = a.AggregateVersion()
+		}
+	}
+
+	return nil
+}
+
+// uncommittedEvents is an aggregate with events, as in events.Aggregate.
+type uncommittedEvents interface {
+	Events() []eh.Event
+}
+
+// versioned is an aggregate with a version, as in events.Aggregate.
+type versioned interface {
+	Version() int
 }
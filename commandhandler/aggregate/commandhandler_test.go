@@ -19,9 +19,11 @@ import (
 	"errors"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/google/uuid"
 	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/aggregatestore/events"
 	"github.com/looplab/eventhorizon/mocks"
 )
 
@@ -67,6 +69,76 @@ func TestCommandHandler(t *testing.T) {
 	}
 }
 
+func TestCommandHandler_Result(t *testing.T) {
+	id := uuid.New()
+	a := &resultAggregate{
+		AggregateBase: events.NewAggregateBase(mocks.AggregateType, id),
+	}
+	a.IncrementVersion()
+	store := &mocks.AggregateStore{
+		Aggregates: map[uuid.UUID]eh.Aggregate{
+			id: a,
+		},
+	}
+	h, err := NewCommandHandler(mocks.AggregateType, store)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	cmd := &mocks.Command{
+		ID:      id,
+		Content: "command1",
+	}
+	result, err := eh.HandleCommandWithResult(context.Background(), h, cmd)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result.AggregateID != id {
+		t.Error("the aggregate ID should be correct:", result.AggregateID)
+	}
+	if result.Version != 2 {
+		t.Error("the version should be correct:", result.Version)
+	}
+	if len(result.Events) != 1 || result.Events[0].Version() != 2 ||
+		result.Events[0].EventType() != mocks.EventType {
+		t.Error("the events should be correct:", result.Events)
+	}
+	if result.Payload != "command1" {
+		t.Error("the payload should be correct:", result.Payload)
+	}
+
+	t.Log("no result without events")
+	a.ClearEvents()
+	a.noEvents = true
+	result, err = eh.HandleCommandWithResult(context.Background(), h, cmd)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result.Version != 1 || len(result.Events) != 0 {
+		t.Error("the result should be correct:", result)
+	}
+}
+
+type resultAggregate struct {
+	*events.AggregateBase
+	noEvents bool
+}
+
+func (a *resultAggregate) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	if a.noEvents {
+		return nil
+	}
+	a.StoreEvent(mocks.EventType, nil, time.Now())
+	if r, ok := eh.CommandResultFromContext(ctx); ok {
+		r.Payload = cmd.(*mocks.Command).Content
+	}
+	return nil
+}
+
+func (a *resultAggregate) ApplyEvent(ctx context.Context, event eh.Event) error {
+	return nil
+}
+
 func TestCommandHandler_AggregateNotFound(t *testing.T) {
 	store := &mocks.AggregateStore{
 		Aggregates: map[uuid.UUID]eh.Aggregate{},
@@ -120,6 +192,85 @@ func TestCommandHandler_ErrorWhenSaving(t *testing.T) {
 	}
 }
 
+func TestCommandHandler_ConflictRetries(t *testing.T) {
+	a, h, _ := createAggregateAndHandler(t)
+	conflictErr := eh.EventStoreError{Err: eh.ErrConcurrencyConflict}
+	store := &conflictStore{
+		AggregateStore: &mocks.AggregateStore{
+			Aggregates: map[uuid.UUID]eh.Aggregate{
+				a.EntityID(): a,
+			},
+		},
+		errs: []error{conflictErr, conflictErr},
+	}
+	h.store = store
+
+	cmd := &mocks.Command{
+		ID:      a.EntityID(),
+		Content: "command1",
+	}
+	err := h.HandleCommand(context.Background(), cmd)
+	if err != conflictErr {
+		t.Error("there should be a conflict error:", err)
+	}
+	if store.saves != 1 {
+		t.Error("there should be no retries:", store.saves)
+	}
+
+	t.Log("retry until saved")
+	store.saves = 0
+	store.errs = []error{conflictErr, conflictErr}
+	a.Commands = []eh.Command{}
+	h.SetConflictRetries(2, time.Millisecond)
+	if err := h.HandleCommand(context.Background(), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if store.saves != 3 {
+		t.Error("the command should be retried:", store.saves)
+	}
+	if len(a.Commands) != 3 {
+		t.Error("the command should be handled again:", a.Commands)
+	}
+
+	t.Log("give up after retries")
+	store.saves = 0
+	store.errs = []error{conflictErr, conflictErr, conflictErr}
+	if err := h.HandleCommand(context.Background(), cmd); err != conflictErr {
+		t.Error("there should be a conflict error:", err)
+	}
+	if store.saves != 3 {
+		t.Error("the command should be retried:", store.saves)
+	}
+
+	t.Log("no retries for other errors")
+	store.saves = 0
+	saveErr := errors.New("save error")
+	store.errs = []error{saveErr}
+	if err := h.HandleCommand(context.Background(), cmd); err != saveErr {
+		t.Error("there should be a save error:", err)
+	}
+	if store.saves != 1 {
+		t.Error("there should be no retries:", store.saves)
+	}
+}
+
+// conflictStore is an aggregate store that fails saves with the errors.
+type conflictStore struct {
+	*mocks.AggregateStore
+	errs  []error
+	saves int
+}
+
+func (s *conflictStore) Save(ctx context.Context, a eh.Aggregate) error {
+	s.saves++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return err
+	}
+	return s.AggregateStore.Save(ctx, a)
+}
+
 func TestCommandHandler_NoHandlers(t *testing.T) {
 	_, h, _ := createAggregateAndHandler(t)
 
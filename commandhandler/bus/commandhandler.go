@@ -17,28 +17,69 @@ package bus
 import (
 	"context"
 	"errors"
+	"sort"
 	"sync"
 
 	eh "github.com/looplab/eventhorizon"
 )
 
+func init() {
+	eh.RegisterErrorCode("handler_not_found", ErrHandlerNotFound)
+}
+
 // ErrHandlerAlreadySet is when a handler is already registered for a command.
 var ErrHandlerAlreadySet = errors.New("handler is already set")
 
 // ErrHandlerNotFound is when no handler can be found.
 var ErrHandlerNotFound = errors.New("no handlers for command")
 
+// ErrConflictingRoutes is when a command is routed both by a handler set with
+// SetHandler and by a handler for its aggregate type.
+var ErrConflictingRoutes = errors.New("conflicting routes for command")
+
+// RouteError is an error with the route for a command.
+type RouteError struct {
+	Err           error
+	CommandType   eh.CommandType
+	AggregateType eh.AggregateType
+}
+
+// Error implements the Error method of the errors.Error interface.
+func (e RouteError) Error() string {
+	return e.Err.Error() + ": " + string(e.CommandType) +
+		" (" + string(e.AggregateType) + ")"
+}
+
+// Route is how a command type is routed by the CommandHandler.
+type Route struct {
+	CommandType eh.CommandType
+	// AggregateType is the aggregate type of the command, if registered with
+	// eventhorizon.RegisterCommand.
+	AggregateType eh.AggregateType
+	Handler       eh.CommandHandler
+	// Override is true if the route is set with SetOverrideHandler.
+	Override bool
+	// ByAggregate is true if the route is by a handler for the aggregate type.
+	ByAggregate bool
+}
+
 // CommandHandler is a command handler that handles commands by routing to the
-// registered CommandHandlers.
+// registered CommandHandlers. Commands are routed by their command type to
+// handlers set with SetHandler or SetOverrideHandler, or else by their
+// aggregate type to handlers set with SetAggregateHandler.
 type CommandHandler struct {
-	handlers   map[eh.CommandType]eh.CommandHandler
-	handlersMu sync.RWMutex
+	handlers          map[eh.CommandType]eh.CommandHandler
+	overrides         map[eh.CommandType]bool
+	aggregateHandlers map[eh.AggregateType]eh.CommandHandler
+	handlersMu        sync.RWMutex
 }
 
 // NewCommandHandler creates a CommandHandler.
 func NewCommandHandler() *CommandHandler {
 	return &CommandHandler{
-		handlers: make(map[eh.CommandType]eh.CommandHandler),
+		handlers:          make(map[eh.CommandType]eh.CommandHandler),
+		overrides:         make(map[eh.CommandType]bool),
+		aggregateHandlers: make(map[eh.AggregateType]eh.CommandHandler),
 	}
 }
 
@@ -50,12 +91,26 @@ func (h *CommandHandler) HandleCommand(ctx context.Context, cmd eh.Command) erro
 	if handler, ok := h.handlers[cmd.CommandType()]; ok {
 		return handler.HandleCommand(ctx, cmd)
 	}
+	if handler, ok := h.aggregateHandlers[cmd.AggregateType()]; ok {
+		return handler.HandleCommand(ctx, cmd)
+	}
 
 	return ErrHandlerNotFound
 }
 
 // SetHandler adds a handler for a specific command.
 func (h *CommandHandler) SetHandler(handler eh.CommandHandler, cmdType eh.CommandType) error {
+	return h.setHandler(handler, cmdType, false)
+}
+
+// SetOverrideHandler adds a handler for a specific command that overrides the
+// handler for its aggregate type, without being reported as a conflict by
+// CheckRoutes.
+func (h *CommandHandler) SetOverrideHandler(handler eh.CommandHandler, cmdType eh.CommandType) error {
+	return h.setHandler(handler, cmdType, true)
+}
+
+func (h *CommandHandler) setHandler(handler eh.CommandHandler, cmdType eh.CommandType, override bool) error {
 	h.handlersMu.Lock()
 	defer h.handlersMu.Unlock()
 
@@ -64,5 +119,92 @@ func (h *CommandHandler) SetHandler(handler eh.CommandHandler, cmdType eh.Comman
 	}
 
 	h.handlers[cmdType] = handler
+	h.overrides[cmdType] = override
+	return nil
+}
+
+// SetAggregateHandler adds a handler for all commands of an aggregate type,
+// typically an aggregate.CommandHandler. Handlers set for specific commands
+// take precedence.
+func (h *CommandHandler) SetAggregateHandler(handler eh.CommandHandler, aggregateType eh.AggregateType) error {
+	h.handlersMu.Lock()
+	defer h.handlersMu.Unlock()
+
+	if _, ok := h.aggregateHandlers[aggregateType]; ok {
+		return ErrHandlerAlreadySet
+	}
+
+	h.aggregateHandlers[aggregateType] = handler
+	return nil
+}
+
+// Routes returns the routes for all commands with a handler set for their
+// command type, and all commands registered with eventhorizon.RegisterCommand
+// that are routed by their aggregate type. The routes are sorted by command
+// type.
+func (h *CommandHandler) Routes() []Route {
+	h.handlersMu.RLock()
+	defer h.handlersMu.RUnlock()
+
+	aggregateTypes := map[eh.CommandType]eh.AggregateType{}
+	for _, cmdType := range eh.RegisteredCommands() {
+		if cmd, err := eh.CreateCommand(cmdType); err == nil {
+			aggregateTypes[cmdType] = cmd.AggregateType()
+		}
+	}
+
+	var routes []Route
+	for cmdType, handler := range h.handlers {
+		routes = append(routes, Route{
+			CommandType:   cmdType,
+			AggregateType: aggregateTypes[cmdType],
+			Handler:       handler,
+			Override:      h.overrides[cmdType],
+		})
+	}
+	for cmdType, aggregateType := range aggregateTypes {
+		if _, ok := h.handlers[cmdType]; ok {
+			continue
+		}
+		if handler, ok := h.aggregateHandlers[aggregateType]; ok {
+			routes = append(routes, Route{
+				CommandType:   cmdType,
+				AggregateType: aggregateType,
+				Handler:       handler,
+				ByAggregate:   true,
+			})
+		}
+	}
+
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].CommandType < routes[j].CommandType
+	})
+	return routes
+}
+
+// CheckRoutes checks that no registered command is routed both by a handler set
+// with SetHandler and by a handler for its aggregate type. It should be called
+// at startup when all handlers have been set, and returns a RouteError for the
+// first conflict found. Use SetOverrideHandler for intended overrides.
+//
+// Only commands registered with eh.RegisterCommand are checked, as the routes
+// are resolved from the registered commands.
+func (h *CommandHandler) CheckRoutes() error {
+	for _, r := range h.Routes() {
+		if r.ByAggregate || r.Override || r.AggregateType == "" {
+			continue
+		}
+
+		h.handlersMu.RLock()
+		_, ok := h.aggregateHandlers[r.AggregateType]
+		h.handlersMu.RUnlock()
+		if ok {
+			return RouteError{
+				Err:           ErrConflictingRoutes,
+				CommandType:   r.CommandType,
+				AggregateType: r.AggregateType,
+			}
+		}
+	}
 	return nil
 }
@@ -63,3 +63,82 @@ func TestCommandHandler(t *testing.T) {
 		t.Error("there should be a ErrHandlerAlreadySet error:", err)
 	}
 }
+
+func TestCommandHandler_AggregateRouting(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+	eh.RegisterCommand(func() eh.Command { return &mocks.CommandOther{} })
+	defer eh.UnregisterCommand(mocks.CommandOtherType)
+
+	bus := NewCommandHandler()
+	ctx := context.Background()
+
+	aggregateHandler := &mocks.CommandHandler{}
+	if err := bus.SetAggregateHandler(aggregateHandler, mocks.AggregateType); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := bus.SetAggregateHandler(aggregateHandler, mocks.AggregateType); err != ErrHandlerAlreadySet {
+		t.Error("there should be a ErrHandlerAlreadySet error:", err)
+	}
+
+	t.Log("handle by aggregate type")
+	cmd := &mocks.Command{ID: uuid.New(), Content: "command1"}
+	if err := bus.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(aggregateHandler.Commands, []eh.Command{cmd}) {
+		t.Error("the handled command should be correct:", aggregateHandler.Commands)
+	}
+	if err := bus.CheckRoutes(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("handle with override")
+	overrideHandler := &mocks.CommandHandler{}
+	if err := bus.SetOverrideHandler(overrideHandler, mocks.CommandOtherType); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	other := &mocks.CommandOther{ID: uuid.New(), Content: "command2"}
+	if err := bus.HandleCommand(ctx, other); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(overrideHandler.Commands, []eh.Command{other}) {
+		t.Error("the handled command should be correct:", overrideHandler.Commands)
+	}
+	if err := bus.CheckRoutes(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	routes := bus.Routes()
+	expectedRoutes := []Route{
+		{
+			CommandType:   mocks.CommandType,
+			AggregateType: mocks.AggregateType,
+			Handler:       aggregateHandler,
+			ByAggregate:   true,
+		},
+		{
+			CommandType:   mocks.CommandOtherType,
+			AggregateType: mocks.AggregateType,
+			Handler:       overrideHandler,
+			Override:      true,
+		},
+	}
+	if !reflect.DeepEqual(routes, expectedRoutes) {
+		t.Error("the routes should be correct:", routes)
+	}
+
+	t.Log("detect conflicts")
+	if err := bus.SetHandler(&mocks.CommandHandler{}, mocks.CommandType); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	err := bus.CheckRoutes()
+	expectedErr := RouteError{
+		Err:           ErrConflictingRoutes,
+		CommandType:   mocks.CommandType,
+		AggregateType: mocks.AggregateType,
+	}
+	if !reflect.DeepEqual(err, expectedErr) {
+		t.Error("there should be a route error:", err)
+	}
+}
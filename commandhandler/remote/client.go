@@ -0,0 +1,96 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Client is a command handler that sends commands to a Server. Commands must
+// be registered with eventhorizon.RegisterCommand() on both sides. The values
+// in the context that can be marshaled are sent with the command, and the
+// result of the command is set on the context if it was created by
+// eventhorizon.HandleCommandWithResult.
+type Client struct {
+	url    string
+	client *http.Client
+}
+
+// NewClient creates a Client that sends commands to the server at the URL,
+// http.DefaultClient is used if the client is nil.
+func NewClient(url string, client *http.Client) *Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Client{
+		url:    url,
+		client: client,
+	}
+}
+
+// HandleCommand implements the HandleCommand method of the
+// eventhorizon.CommandHandler interface.
+func (c *Client) HandleCommand(ctx context.Context, cmd eh.Command) error {
+	if _, err := eh.CreateCommand(cmd.CommandType()); err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		return Error{Err: ErrCouldNotSendCommand, BaseErr: err, CommandType: cmd.CommandType()}
+	}
+	b, err = json.Marshal(request{
+		CommandType: cmd.CommandType(),
+		Command:     b,
+		Context:     eh.MarshalContext(ctx),
+	})
+	if err != nil {
+		return Error{Err: ErrCouldNotSendCommand, BaseErr: err, CommandType: cmd.CommandType()}
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(b))
+	if err != nil {
+		return Error{Err: ErrCouldNotSendCommand, BaseErr: err, CommandType: cmd.CommandType()}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return Error{Err: ErrCouldNotSendCommand, BaseErr: err, CommandType: cmd.CommandType()}
+	}
+	defer resp.Body.Close()
+
+	var res response
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return Error{Err: ErrInvalidResponse, BaseErr: err, CommandType: cmd.CommandType()}
+	}
+	if res.Error != nil {
+		return res.Error.err(ctx, cmd)
+	}
+
+	if r, ok := eh.CommandResultFromContext(ctx); ok && res.Result != nil {
+		result, err := res.Result.commandResult()
+		if err != nil {
+			return Error{Err: ErrInvalidResponse, BaseErr: err, CommandType: cmd.CommandType()}
+		}
+		*r = *result
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func init() {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+}
+
+var errTest = errors.New("test error")
+
+func init() {
+	eh.RegisterErrorCode("test_error", errTest)
+}
+
+func TestClient(t *testing.T) {
+	id := uuid.New()
+	now := time.Now().UTC().Truncate(time.Millisecond)
+	inner := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		if val, ok := mocks.ContextOne(ctx); !ok || val != "testval" {
+			t.Error("the context should be correct:", ctx)
+		}
+		if !reflect.DeepEqual(cmd, &mocks.Command{ID: id, Content: "content"}) {
+			t.Error("the command should be correct:", cmd)
+		}
+		if r, ok := eh.CommandResultFromContext(ctx); ok {
+			r.AggregateID = id
+			r.Version = 1
+			r.Events = []eh.Event{eh.NewEventForAggregate(mocks.EventType,
+				&mocks.EventData{Content: "event"}, now, mocks.AggregateType, id, 1)}
+			r.Payload = "payload"
+		}
+		return nil
+	})
+	server := httptest.NewServer(NewServer(inner, WithTrustedKeys("context_one")))
+	defer server.Close()
+
+	c := NewClient(server.URL, nil)
+	ctx := mocks.WithContextOne(context.Background(), "testval")
+	cmd := mocks.Command{ID: id, Content: "content"}
+	result, err := eh.HandleCommandWithResult(ctx, c, cmd)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if result.AggregateID != id || result.Version != 1 {
+		t.Error("the result should be correct:", result)
+	}
+	if payload, ok := result.Payload.(json.RawMessage); !ok || string(payload) != `"payload"` {
+		t.Error("the payload should be correct:", result.Payload)
+	}
+	expectedEvent := eh.NewEventForAggregate(mocks.EventType,
+		&mocks.EventData{Content: "event"}, now, mocks.AggregateType, id, 1)
+	if len(result.Events) != 1 {
+		t.Fatal("there should be an event:", result.Events)
+	}
+	if !mocks.EqualEvents(result.Events, []eh.Event{expectedEvent}) {
+		t.Error("the event should be correct:", result.Events[0])
+	}
+
+	// Without a result.
+	if err := c.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestClient_Errors(t *testing.T) {
+	inner := &mocks.CommandHandler{}
+	server := httptest.NewServer(NewServer(inner))
+	defer server.Close()
+	c := NewClient(server.URL, nil)
+
+	ctx := context.Background()
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+
+	testCases := map[string]struct {
+		err      error
+		expected error
+	}{
+		"registered": {
+			errTest,
+			errTest,
+		},
+		"aggregate not found": {
+			eh.ErrAggregateNotFound,
+			eh.ErrAggregateNotFound,
+		},
+		"concurrency conflict": {
+			eh.EventStoreError{Err: eh.ErrConcurrencyConflict, Namespace: "ns"},
+			eh.ErrConcurrencyConflict,
+		},
+		"field errors": {
+			eh.CommandFieldErrors{{Field: "Content"}, {Field: "Age", Rule: "min=1"}}.FieldError(),
+			eh.CommandFieldErrors{{Field: "Content"}, {Field: "Age", Rule: "min=1"}}.FieldError(),
+		},
+		"unknown": {
+			errors.New("unknown error"),
+			errors.New("unknown error"),
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inner.Err = tc.err
+			err := c.HandleCommand(ctx, cmd)
+			if !reflect.DeepEqual(err, tc.expected) {
+				t.Error("the error should be correct:", err)
+			}
+		})
+	}
+}
+
+func TestClient_NotRegistered(t *testing.T) {
+	c := NewClient("http://localhost:0", nil)
+	cmd := &mocks.CommandOther{ID: uuid.New(), Content: "content"}
+	if err := c.HandleCommand(context.Background(), cmd); err != eh.ErrCommandNotRegistered {
+		t.Error("there should be a command not registered error:", err)
+	}
+}
+
+func TestClient_CouldNotSend(t *testing.T) {
+	server := httptest.NewServer(NewServer(&mocks.CommandHandler{}))
+	server.Close()
+	c := NewClient(server.URL, nil)
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	err := c.HandleCommand(context.Background(), cmd)
+	if rErr, ok := err.(Error); !ok || rErr.Err != ErrCouldNotSendCommand {
+		t.Error("there should be a could not send error:", err)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package remote is a transport for handling commands in another service, the
+// one owning the aggregate. The Client is a command handler that sends the
+// commands, with the marshaled context, to a Server which handles them with a
+// local command handler. Errors from the remote handler that are registered
+// with eventhorizon.RegisterErrorCode or eventhorizon.RegisterErrorCodec are
+// returned as the same errors by the Client.
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrCouldNotSendCommand is when a command could not be sent to the server.
+var ErrCouldNotSendCommand = errors.New("could not send command")
+
+// ErrInvalidResponse is when the response from the server could not be read.
+var ErrInvalidResponse = errors.New("invalid response")
+
+// Error is an error when sending a command to the server.
+type Error struct {
+	// Err is the error, ErrCouldNotSendCommand or ErrInvalidResponse.
+	Err error
+	// BaseErr is an optional underlying error, for example from the HTTP client.
+	BaseErr error
+	// CommandType is the type of the command that was sent.
+	CommandType eh.CommandType
+}
+
+// Error implements the Error method of the errors.Error interface.
+func (e Error) Error() string {
+	errStr := e.Err.Error()
+	if e.BaseErr != nil {
+		errStr += ": " + e.BaseErr.Error()
+	}
+	return errStr + " (" + string(e.CommandType) + ")"
+}
+
+// request is the wire form of a command and its context.
+type request struct {
+	CommandType eh.CommandType         `json:"command_type"`
+	Command     json.RawMessage        `json:"command"`
+	Context     map[string]interface{} `json:"context,omitempty"`
+}
+
+// response is the wire form of the outcome of a command.
+type response struct {
+	Result *result      `json:"result,omitempty"`
+	Error  *remoteError `json:"error,omitempty"`
+}
+
+// remoteError is the wire form of an error.
+type remoteError struct {
+	Code    string          `json:"code,omitempty"`
+	Message string          `json:"message"`
+	Details json.RawMessage `json:"details,omitempty"`
+}
+
+// result is the wire form of a eh.CommandResult.
+type result struct {
+	AggregateID uuid.UUID       `json:"aggregate_id"`
+	Version     int             `json:"version"`
+	Events      []event         `json:"events,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+// event is the wire form of an event in a result.
+type event struct {
+	EventType     eh.EventType     `json:"event_type"`
+	AggregateType eh.AggregateType `json:"aggregate_type"`
+	AggregateID   uuid.UUID        `json:"aggregate_id"`
+	Version       int              `json:"version"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Data          json.RawMessage  `json:"data,omitempty"`
+}
+
+// newRemoteError creates the wire form of an error, with the code of the
+// error if it is registered with eh.RegisterErrorCode or eh.RegisterErrorCodec.
+func newRemoteError(err error) *remoteError {
+	code, details := eh.EncodeErrorCode(err)
+	return &remoteError{
+		Code:    code,
+		Message: err.Error(),
+		Details: details,
+	}
+}
+
+// err recreates the error, as the registered error or with the registered
+// codec for the code if any.
+func (e *remoteError) err(ctx context.Context, cmd eh.Command) error {
+	if err, ok := eh.DecodeErrorCode(ctx, cmd, e.Code, e.Details); ok {
+		return err
+	}
+	return errors.New(e.Message)
+}
+
+func newResult(r *eh.CommandResult) (*result, error) {
+	res := &result{
+		AggregateID: r.AggregateID,
+		Version:     r.Version,
+	}
+	if r.Payload != nil {
+		b, err := json.Marshal(r.Payload)
+		if err != nil {
+			return nil, err
+		}
+		res.Payload = b
+	}
+	for _, e := range r.Events {
+		ev := event{
+			EventType:     e.EventType(),
+			AggregateType: e.AggregateType(),
+			AggregateID:   e.AggregateID(),
+			Version:       e.Version(),
+			Timestamp:     e.Timestamp(),
+		}
+		if e.Data() != nil {
+			b, err := json.Marshal(e.Data())
+			if err != nil {
+				return nil, err
+			}
+			ev.Data = b
+		}
+		res.Events = append(res.Events, ev)
+	}
+	return res, nil
+}
+
+// commandResult recreates the result, the event data is created with
+// eh.CreateEventData and the payload is kept as a json.RawMessage.
+func (res *result) commandResult() (*eh.CommandResult, error) {
+	r := &eh.CommandResult{
+		AggregateID: res.AggregateID,
+		Version:     res.Version,
+	}
+	if len(res.Payload) > 0 {
+		r.Payload = res.Payload
+	}
+	for _, e := range res.Events {
+		var data eh.EventData
+		if len(e.Data) > 0 {
+			var err error
+			if data, err = eh.CreateEventData(e.EventType); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(e.Data, data); err != nil {
+				return nil, err
+			}
+		}
+		r.Events = append(r.Events, eh.NewEventForAggregate(e.EventType, data,
+			e.Timestamp, e.AggregateType, e.AggregateID, e.Version))
+	}
+	return r, nil
+}
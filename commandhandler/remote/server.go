@@ -0,0 +1,172 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// DefaultMaxBodySize is the max size in bytes of a request body, if not set
+// with WithMaxBodySize.
+var DefaultMaxBodySize int64 = 1 << 20
+
+// Server is a HTTP handler that handles commands sent by a Client with a local
+// command handler.
+//
+// The endpoint will handle any registered command that is sent to it, so it
+// must only be reachable by trusted services or be authenticated, for example
+// with WithContext. Context values registered with
+// eventhorizon.RegisterProtectedContextKey, like the principal of the
+// authorization middleware, are dropped from the requests unless trusted with
+// WithTrustedKeys.
+type Server struct {
+	handler     eh.CommandHandler
+	contextFunc func(*http.Request, context.Context) context.Context
+	trustedKeys map[string]bool
+	maxBodySize int64
+}
+
+// Option is an option for a Server.
+type Option func(*Server)
+
+// WithContext sets a function that is called with the request and the context
+// sent by the client, and returns the context to handle the command with. It
+// can be used to authenticate the request and add the principal to the context.
+func WithContext(f func(*http.Request, context.Context) context.Context) Option {
+	return func(s *Server) {
+		s.contextFunc = f
+	}
+}
+
+// WithTrustedKeys keeps the values of protected context keys that are sent by
+// the clients. It should only be used if all clients are trusted.
+func WithTrustedKeys(keys ...string) Option {
+	return func(s *Server) {
+		for _, key := range keys {
+			s.trustedKeys[key] = true
+		}
+	}
+}
+
+// WithMaxBodySize sets the max size in bytes of a request body.
+func WithMaxBodySize(n int64) Option {
+	return func(s *Server) {
+		s.maxBodySize = n
+	}
+}
+
+// NewServer creates a Server that handles commands with the handler.
+func NewServer(handler eh.CommandHandler, options ...Option) *Server {
+	s := &Server{
+		handler:     handler,
+		trustedKeys: map[string]bool{},
+		maxBodySize: DefaultMaxBodySize,
+	}
+	for _, option := range options {
+		option(s)
+	}
+	return s
+}
+
+// ServeHTTP implements the ServeHTTP method of the http.Handler interface.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "unsuported method: "+r.Method, http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req request
+	body := http.MaxBytesReader(w, r.Body, s.maxBodySize)
+	if err := json.NewDecoder(body).Decode(&req); err != nil {
+		writeResponse(w, http.StatusBadRequest, response{
+			Error: &remoteError{Message: "could not decode request: " + err.Error()},
+		})
+		return
+	}
+	cmd, err := eh.CreateCommand(req.CommandType)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, response{Error: newRemoteError(err)})
+		return
+	}
+	if err := json.Unmarshal(req.Command, &cmd); err != nil {
+		writeResponse(w, http.StatusBadRequest, response{
+			Error: &remoteError{Message: "could not decode command: " + err.Error()},
+		})
+		return
+	}
+
+	// Drop values that the client can not be trusted to set.
+	for key := range req.Context {
+		if eh.IsProtectedContextKey(key) && !s.trustedKeys[key] {
+			delete(req.Context, key)
+		}
+	}
+
+	// NOTE: Use a new context when handling, else it will be cancelled with
+	// the HTTP request which will cause projectors etc to fail if they run
+	// async in goroutines past the request.
+	ctx := eh.UnmarshalContext(req.Context)
+	if s.contextFunc != nil {
+		ctx = s.contextFunc(r, ctx)
+	}
+
+	result, err := eh.HandleCommandWithResult(ctx, s.handler, cmd)
+	if err != nil {
+		writeResponse(w, statusCode(err), response{Error: newRemoteError(err)})
+		return
+	}
+
+	res, err := newResult(result)
+	if err != nil {
+		writeResponse(w, http.StatusInternalServerError, response{
+			Error: &remoteError{Message: "could not encode result: " + err.Error()},
+		})
+		return
+	}
+	writeResponse(w, http.StatusOK, response{Result: res})
+}
+
+func writeResponse(w http.ResponseWriter, status int, res response) {
+	b, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, "could not encode response: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// statusCode returns the HTTP status for an error, the Client uses the error
+// code in the response and not the status.
+func statusCode(err error) int {
+	if _, ok := err.(eh.CommandFieldError); ok {
+		return http.StatusBadRequest
+	}
+	if f, ok := err.(interface{ Forbidden() bool }); ok && f.Forbidden() {
+		return http.StatusForbidden
+	}
+	switch {
+	case err == eh.ErrAggregateNotFound:
+		return http.StatusNotFound
+	case eh.IsConcurrencyConflict(err):
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
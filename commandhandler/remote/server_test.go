@@ -0,0 +1,148 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package remote
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func init() {
+	// Protect the context value of the mocks, it is trusted when needed.
+	eh.RegisterProtectedContextKey("context_one")
+}
+
+func TestServer(t *testing.T) {
+	inner := &mocks.CommandHandler{}
+	s := NewServer(inner)
+	id := uuid.New()
+
+	testCases := map[string]struct {
+		method string
+		body   string
+		err    error
+		status int
+		resp   string
+	}{
+		"method": {
+			http.MethodGet, "", nil,
+			http.StatusMethodNotAllowed,
+			"unsuported method: GET\n",
+		},
+		"invalid request": {
+			http.MethodPost, "{", nil,
+			http.StatusBadRequest,
+			`{"error":{"message":"could not decode request: unexpected EOF"}}`,
+		},
+		"not registered": {
+			http.MethodPost, `{"command_type":"CommandOther","command":{}}`, nil,
+			http.StatusBadRequest,
+			`{"error":{"code":"command_not_registered","message":"command not registered"}}`,
+		},
+		"handled": {
+			http.MethodPost, `{"command_type":"Command","command":{"ID":"` + id.String() + `","Content":"content"}}`, nil,
+			http.StatusOK,
+			`{"result":{"aggregate_id":"00000000-0000-0000-0000-000000000000","version":0}}`,
+		},
+		"field errors": {
+			http.MethodPost, `{"command_type":"Command","command":{}}`, eh.CommandFieldError{Field: "Content"},
+			http.StatusBadRequest,
+			`{"error":{"code":"invalid_command","message":"missing field: Content","details":[{"field":"Content"}]}}`,
+		},
+		"conflict": {
+			http.MethodPost, `{"command_type":"Command","command":{}}`, eh.ErrConcurrencyConflict,
+			http.StatusConflict,
+			`{"error":{"code":"concurrency_conflict","message":"concurrency conflict"}}`,
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			inner.Err = tc.err
+			r := httptest.NewRequest(tc.method, "/", strings.NewReader(tc.body))
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, r)
+			if w.Code != tc.status {
+				t.Error("the status should be correct:", w.Code)
+			}
+			if w.Body.String() != tc.resp {
+				t.Error("the response should be correct:", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestServer_Context(t *testing.T) {
+	inner := &mocks.CommandHandler{}
+	body := `{"command_type":"Command","command":{"ID":"` + uuid.New().String() +
+		`","Content":"content"},"context":{"context_one":"client","eh_namespace":"ns"}}`
+
+	t.Log("drop protected keys")
+	s := NewServer(inner)
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Error("the status should be correct:", w.Code, w.Body.String())
+	}
+	if _, ok := mocks.ContextOne(inner.Context); ok {
+		t.Error("the protected value should be dropped")
+	}
+	if ns := eh.NamespaceFromContext(inner.Context); ns != "ns" {
+		t.Error("the namespace should be kept:", ns)
+	}
+
+	t.Log("set context values from the request")
+	s = NewServer(inner, WithContext(func(r *http.Request, ctx context.Context) context.Context {
+		return mocks.WithContextOne(ctx, r.Header.Get("X-User"))
+	}))
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	r.Header.Set("X-User", "server")
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if val, ok := mocks.ContextOne(inner.Context); !ok || val != "server" {
+		t.Error("the context value should be set from the request:", val)
+	}
+
+	t.Log("trust protected keys")
+	s = NewServer(inner, WithTrustedKeys("context_one"))
+	r = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if val, ok := mocks.ContextOne(inner.Context); !ok || val != "client" {
+		t.Error("the trusted value should be kept:", val)
+	}
+}
+
+func TestServer_MaxBodySize(t *testing.T) {
+	inner := &mocks.CommandHandler{}
+	s := NewServer(inner, WithMaxBodySize(10))
+	body := `{"command_type":"Command","command":{"ID":"` + uuid.New().String() + `"}}`
+	r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != http.StatusBadRequest {
+		t.Error("the status should be correct:", w.Code)
+	}
+	if len(inner.Commands) != 0 {
+		t.Error("the command should not be handled:", inner.Commands)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// CommandResult is the result of handling a command. It is collected through
+// the context by the handlers that support it, for example the aggregate
+// command handler, and returned by HandleCommandWithResult.
+type CommandResult struct {
+	// AggregateID is the ID of the aggregate that handled the command.
+	AggregateID uuid.UUID
+	// Version is the version of the aggregate after handling the command, it
+	// can be used with NewContextWithMinVersion to read the changes.
+	Version int
+	// Events are the events that were created by the command.
+	Events []Event
+	// Payload is a custom result that can be set by the aggregate.
+	Payload interface{}
+}
+
+// HandleCommandWithResult handles a command with a handler and returns the
+// result of the command. The result is collected through the context and
+// passes any middleware that uses the same context. If no handler in the chain
+// sets the result, for example when the command is handled async, an empty
+// result is returned.
+func HandleCommandWithResult(ctx context.Context, h CommandHandler, cmd Command) (*CommandResult, error) {
+	r := &CommandResult{}
+	ctx = context.WithValue(ctx, commandResultKey, r)
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// CommandResultFromContext returns the result of the command being handled,
+// if it was requested with HandleCommandWithResult. Command handlers and
+// aggregates can set the fields of the result.
+func CommandResultFromContext(ctx context.Context) (*CommandResult, bool) {
+	r, ok := ctx.Value(commandResultKey).(*CommandResult)
+	return r, ok && r != nil
+}
+
+// NewContextWithoutCommandResult returns a context where no result is
+// requested. It should be used when handling commands after the result has
+// been returned, for example when handling them async.
+func NewContextWithoutCommandResult(ctx context.Context) context.Context {
+	return context.WithValue(ctx, commandResultKey, (*CommandResult)(nil))
+}
@@ -0,0 +1,74 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestHandleCommandWithResult(t *testing.T) {
+	id := uuid.New()
+	handler := CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+		r, ok := CommandResultFromContext(ctx)
+		if !ok {
+			return errors.New("no result")
+		}
+		r.AggregateID = id
+		r.Version = 3
+		return nil
+	})
+	middleware := func(h CommandHandler) CommandHandler {
+		return CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+			return h.HandleCommand(ctx, cmd)
+		})
+	}
+	h := UseCommandHandlerMiddleware(handler, middleware)
+
+	result, err := HandleCommandWithResult(context.Background(), h, TestCommand{})
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result.AggregateID != id || result.Version != 3 {
+		t.Error("the result should be correct:", result)
+	}
+
+	t.Log("handle without result")
+	if err := h.HandleCommand(context.Background(), TestCommand{}); err == nil ||
+		err.Error() != "no result" {
+		t.Error("there should be a no result error:", err)
+	}
+	ctx := NewContextWithoutCommandResult(context.Background())
+	if _, err := HandleCommandWithResult(ctx, CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+		return h.HandleCommand(NewContextWithoutCommandResult(ctx), cmd)
+	}), TestCommand{}); err == nil || err.Error() != "no result" {
+		t.Error("there should be a no result error:", err)
+	}
+
+	t.Log("handle with error")
+	handlerErr := errors.New("handler error")
+	result, err = HandleCommandWithResult(context.Background(), CommandHandlerFunc(func(ctx context.Context, cmd Command) error {
+		return handlerErr
+	}), TestCommand{})
+	if err != handlerErr {
+		t.Error("there should be a handler error:", err)
+	}
+	if result != nil {
+		t.Error("there should be no result:", result)
+	}
+}
@@ -61,10 +61,11 @@ func init() {
 
 type contextKey int
 
-// Context keys for namespace and min version.
+// Context keys for namespace, min version and command results.
 const (
 	namespaceKey contextKey = iota
 	minVersionKey
+	commandResultKey
 )
 
 // Strings used to marshal context values.
@@ -159,6 +160,29 @@ func RegisterContextUnmarshaler(f ContextUnmarshalFunc) {
 	contextUnmarshalFuncs = append(contextUnmarshalFuncs, f)
 }
 
+// Private protected context keys.
+var (
+	protectedContextKeys   = map[string]bool{}
+	protectedContextKeysMu = sync.RWMutex{}
+)
+
+// RegisterProtectedContextKey registers a key of a marshaled context value that
+// can not be trusted when received from another service, like a principal.
+// Transports should drop the values unless the sender is trusted.
+func RegisterProtectedContextKey(key string) {
+	protectedContextKeysMu.Lock()
+	defer protectedContextKeysMu.Unlock()
+	protectedContextKeys[key] = true
+}
+
+// IsProtectedContextKey returns true if the key of a marshaled context value
+// has been registered with RegisterProtectedContextKey.
+func IsProtectedContextKey(key string) bool {
+	protectedContextKeysMu.RLock()
+	defer protectedContextKeysMu.RUnlock()
+	return protectedContextKeys[key]
+}
+
 // UnmarshalContext unmarshals a context from a map.
 func UnmarshalContext(vals map[string]interface{}) context.Context {
 	contextUnmarshalFuncsMu.RLock()
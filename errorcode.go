@@ -0,0 +1,173 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+func init() {
+	RegisterErrorCode("command_not_registered", ErrCommandNotRegistered)
+	RegisterErrorCode("aggregate_not_found", ErrAggregateNotFound)
+	RegisterErrorCode("aggregate_not_registered", ErrAggregateNotRegistered)
+	RegisterErrorCode("concurrency_conflict", ErrConcurrencyConflict)
+	RegisterErrorCode("deadline_exceeded", context.DeadlineExceeded)
+	RegisterErrorCode("canceled", context.Canceled)
+	RegisterErrorCodec("invalid_command", fieldErrorsCodec{})
+}
+
+// Private error code registries.
+var (
+	errorCodes   = make(map[string]error)
+	errorCodecs  = make(map[string]ErrorCodec)
+	errorCodesMu sync.RWMutex
+)
+
+// RegisterErrorCode registers an error with a code, which is used by transports
+// to send the error to another service and return the same error there. Both
+// sides must register the error with the same code, packages with errors that
+// should be kept register them in their init.
+//
+// An example would be:
+//     RegisterErrorCode("out_of_stock", ErrOutOfStock)
+func RegisterErrorCode(code string, err error) {
+	if err == nil {
+		panic("eventhorizon: attempt to register nil error")
+	}
+
+	errorCodesMu.Lock()
+	defer errorCodesMu.Unlock()
+	checkErrorCode(code)
+	errorCodes[code] = err
+}
+
+// ErrorCodec encodes and decodes errors of a type, for errors that can not be
+// registered as a single value with RegisterErrorCode.
+type ErrorCodec interface {
+	// EncodeError returns the details of the error, or false if the error is
+	// not of the type of the codec.
+	EncodeError(err error) (details []byte, ok bool)
+
+	// DecodeError recreates the error from the details, with the context and
+	// command of the receiving side.
+	DecodeError(ctx context.Context, cmd Command, details []byte) error
+}
+
+// RegisterErrorCodec registers a codec for errors of a type with a code. Both
+// sides must register the codec with the same code.
+func RegisterErrorCodec(code string, codec ErrorCodec) {
+	if codec == nil {
+		panic("eventhorizon: attempt to register nil error codec")
+	}
+
+	errorCodesMu.Lock()
+	defer errorCodesMu.Unlock()
+	checkErrorCode(code)
+	errorCodecs[code] = codec
+}
+
+func checkErrorCode(code string) {
+	if code == "" {
+		panic("eventhorizon: attempt to register empty error code")
+	}
+	_, isErr := errorCodes[code]
+	_, isCodec := errorCodecs[code]
+	if isErr || isCodec {
+		panic(fmt.Sprintf("eventhorizon: registering duplicate error code %q", code))
+	}
+}
+
+// EncodeErrorCode returns the code of a registered error, and the details if
+// it is encoded by a registered codec. The code is empty for other errors.
+func EncodeErrorCode(err error) (code string, details []byte) {
+	errorCodesMu.RLock()
+	defer errorCodesMu.RUnlock()
+
+	for code, codec := range errorCodecs {
+		if details, ok := codec.EncodeError(err); ok {
+			return code, details
+		}
+	}
+
+	if esErr, ok := err.(EventStoreError); ok && IsConcurrencyConflict(esErr) {
+		err = ErrConcurrencyConflict
+	}
+	for code, registered := range errorCodes {
+		if registered == err {
+			return code, nil
+		}
+	}
+
+	return "", nil
+}
+
+// DecodeErrorCode recreates an error from its code and details, as the
+// registered error or with the registered codec. It returns false if there is
+// no error or codec registered with the code.
+func DecodeErrorCode(ctx context.Context, cmd Command, code string, details []byte) (error, bool) {
+	errorCodesMu.RLock()
+	defer errorCodesMu.RUnlock()
+
+	if codec, ok := errorCodecs[code]; ok {
+		return codec.DecodeError(ctx, cmd, details), true
+	}
+	if err, ok := errorCodes[code]; ok {
+		return err, true
+	}
+	return nil, false
+}
+
+// fieldErrorsCodec is the codec for CommandFieldError, with all its fields.
+type fieldErrorsCodec struct{}
+
+// fieldError is the encoded form of a CommandFieldError.
+type fieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule,omitempty"`
+}
+
+// EncodeError implements the EncodeError method of the ErrorCodec interface.
+func (fieldErrorsCodec) EncodeError(err error) ([]byte, bool) {
+	f, ok := err.(CommandFieldError)
+	if !ok {
+		return nil, false
+	}
+	errs := f.Fields()
+	fields := make([]fieldError, len(errs))
+	for i, f := range errs {
+		fields[i] = fieldError{Field: f.Field, Rule: f.Rule}
+	}
+	b, err := json.Marshal(fields)
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// DecodeError implements the DecodeError method of the ErrorCodec interface.
+func (fieldErrorsCodec) DecodeError(ctx context.Context, cmd Command, details []byte) error {
+	var fields []fieldError
+	if err := json.Unmarshal(details, &fields); err != nil {
+		return err
+	}
+	errs := make(CommandFieldErrors, len(fields))
+	for i, f := range fields {
+		errs[i] = CommandFieldError{Field: f.Field, Rule: f.Rule}
+	}
+	return errs.FieldError()
+}
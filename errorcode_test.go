@@ -0,0 +1,85 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package eventhorizon
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestErrorCode(t *testing.T) {
+	errTest := errors.New("test error")
+	RegisterErrorCode("test_error_code", errTest)
+	defer func() {
+		errorCodesMu.Lock()
+		delete(errorCodes, "test_error_code")
+		errorCodesMu.Unlock()
+	}()
+
+	code, details := EncodeErrorCode(errTest)
+	if code != "test_error_code" || details != nil {
+		t.Error("the code should be correct:", code, details)
+	}
+	err, ok := DecodeErrorCode(context.Background(), nil, code, details)
+	if !ok || err != errTest {
+		t.Error("the error should be correct:", err, ok)
+	}
+
+	// Concurrency conflicts from the event store.
+	code, _ = EncodeErrorCode(EventStoreError{Err: ErrConcurrencyConflict})
+	if code != "concurrency_conflict" {
+		t.Error("the code should be correct:", code)
+	}
+
+	// Errors with a codec.
+	fieldErrs := CommandFieldErrors{{Field: "Content"}, {Field: "Age", Rule: "min=1"}}.FieldError()
+	code, details = EncodeErrorCode(fieldErrs)
+	if code != "invalid_command" {
+		t.Error("the code should be correct:", code)
+	}
+	err, ok = DecodeErrorCode(context.Background(), nil, code, details)
+	if !ok || !reflect.DeepEqual(err, fieldErrs) {
+		t.Error("the error should be correct:", err, ok)
+	}
+
+	// Errors that are not registered.
+	if code, _ := EncodeErrorCode(errors.New("other")); code != "" {
+		t.Error("there should be no code:", code)
+	}
+	if err, ok := DecodeErrorCode(context.Background(), nil, "other", nil); ok {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestRegisterErrorCodeTwice(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil || r.(string) != `eventhorizon: registering duplicate error code "canceled"` {
+			t.Error("there should have been a panic:", r)
+		}
+	}()
+	RegisterErrorCode("canceled", errors.New("other"))
+}
+
+func TestProtectedContextKey(t *testing.T) {
+	if IsProtectedContextKey("test_protected") {
+		t.Error("the key should not be protected")
+	}
+	RegisterProtectedContextKey("test_protected")
+	if !IsProtectedContextKey("test_protected") {
+		t.Error("the key should be protected")
+	}
+}
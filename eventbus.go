@@ -25,13 +25,32 @@ type EventBusError struct {
 	Err   error
 	Ctx   context.Context
 	Event Event
+	// HandlerType is the type of the handler or observer that returned the
+	// error, it is empty for errors that are not from a handler.
+	HandlerType EventHandlerType
+	// Observer is true if the error was returned from an observer.
+	Observer bool
+	// Attempt is the number of times that the event has been delivered to the
+	// handler, starting at 1. It is 0 if the bus does not know.
+	Attempt int
+	// BusName is the name of the bus implementation, i.e "local".
+	BusName string
 }
 
 // Error implements the Error method of the error interface.
 func (e EventBusError) Error() string {
+	if e.HandlerType != "" {
+		return fmt.Sprintf("could not handle event (%s): %s: (%s)", e.HandlerType, e.Err, e.Event)
+	}
 	return fmt.Sprintf("%s: (%s)", e.Err, e.Event)
 }
 
+// EventBusErrorHandler is a function that handles errors from an event bus. It
+// can be set on the bus implementations as an alternative to the channel from
+// Errors, and is called for every error, which means that no errors are
+// dropped when nobody is reading from the channel.
+type EventBusErrorHandler func(EventBusError)
+
 // EventBus sends published events to one of each handler type and all observers.
 // That means that if the same handler is registered on multiple nodes only one
 // of them will receive the event. In contrast all observers registered on multiple
@@ -52,3 +71,97 @@ type EventBus interface {
 	// Errors returns an error channel where async handling errors are sent.
 	Errors() <-chan EventBusError
 }
+
+// PublishEventFunc is a function that can be used to publish events, the
+// signature of the PublishEvent method of the EventBus.
+type PublishEventFunc func(context.Context, Event) error
+
+// PublishEventMiddleware is a function that middlewares can implement to wrap
+// the publishing of events on an event bus.
+type PublishEventMiddleware func(PublishEventFunc) PublishEventFunc
+
+// EventBusMiddleware is a function that middlewares can implement to be
+// able to chain.
+type EventBusMiddleware func(EventBus) EventBus
+
+// UseEventBusMiddleware wraps a EventBus in one or more middleware. Publishing
+// goes through the middleware in order, while dispatching to handlers goes
+// through the middleware in reverse order.
+func UseEventBusMiddleware(b EventBus, middleware ...EventBusMiddleware) EventBus {
+	// Apply in reverse order.
+	for i := len(middleware) - 1; i >= 0; i-- {
+		m := middleware[i]
+		b = m(b)
+	}
+	return b
+}
+
+// NewEventBusMiddleware creates an EventBusMiddleware from a middleware for
+// publishing and a middleware for dispatching events, either can be nil. The
+// publish middleware wraps PublishEvent. The dispatch middleware wraps all
+// handlers and observers that are added to the bus, the wrapped handlers keep
+// their handler types so that any bus implementation can be used without
+// changing the handlers.
+func NewEventBusMiddleware(publish PublishEventMiddleware, dispatch EventHandlerMiddleware) EventBusMiddleware {
+	return EventBusMiddleware(func(b EventBus) EventBus {
+		mb := &middlewareEventBus{
+			EventBus:    b,
+			publishFunc: b.PublishEvent,
+			dispatch:    dispatch,
+		}
+		if publish != nil {
+			mb.publishFunc = publish(b.PublishEvent)
+		}
+		return mb
+	})
+}
+
+// middlewareEventBus is an EventBus wrapped with publish and dispatch middleware.
+type middlewareEventBus struct {
+	EventBus
+	publishFunc PublishEventFunc
+	dispatch    EventHandlerMiddleware
+}
+
+// PublishEvent implements the PublishEvent method of the EventBus interface.
+func (b *middlewareEventBus) PublishEvent(ctx context.Context, event Event) error {
+	return b.publishFunc(ctx, event)
+}
+
+// AddHandler implements the AddHandler method of the EventBus interface.
+func (b *middlewareEventBus) AddHandler(m EventMatcher, h EventHandler) {
+	b.EventBus.AddHandler(m, b.wrap(h))
+}
+
+// AddObserver implements the AddObserver method of the EventBus interface.
+func (b *middlewareEventBus) AddObserver(m EventMatcher, h EventHandler) {
+	b.EventBus.AddObserver(m, b.wrap(h))
+}
+
+func (b *middlewareEventBus) wrap(h EventHandler) EventHandler {
+	// Let the bus check for nil handlers.
+	if h == nil || b.dispatch == nil {
+		return h
+	}
+	return &middlewareEventHandler{
+		handlerType: h.HandlerType(),
+		handler:     b.dispatch(h),
+	}
+}
+
+// middlewareEventHandler is a handler wrapped with middleware, that keeps the
+// handler type of the original handler.
+type middlewareEventHandler struct {
+	handlerType EventHandlerType
+	handler     EventHandler
+}
+
+// HandlerType implements the HandlerType method of the EventHandler interface.
+func (h *middlewareEventHandler) HandlerType() EventHandlerType {
+	return h.handlerType
+}
+
+// HandleEvent implements the HandleEvent method of the EventHandler interface.
+func (h *middlewareEventHandler) HandleEvent(ctx context.Context, event Event) error {
+	return h.handler.HandleEvent(ctx, event)
+}
@@ -186,5 +186,14 @@ func AcceptanceTest(t *testing.T, bus1, bus2 eh.EventBus, timeout time.Duration)
 		if err.Error() != "could not handle event (error_handler): handler error: (Event@1)" {
 			t.Error(err, "wrong error sent on event bus")
 		}
+		if err.Err == nil || err.Err.Error() != "handler error" {
+			t.Error("the handler error should be correct:", err.Err)
+		}
+		if err.HandlerType != "error_handler" || err.Observer {
+			t.Error("the handler should be correct:", err.HandlerType, err.Observer)
+		}
+		if err.BusName == "" {
+			t.Error("there should be a bus name")
+		}
 	}
 }
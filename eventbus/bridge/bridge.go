@@ -0,0 +1,142 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+func init() {
+	// Register the bridge context, to keep the marker when the event is
+	// sent over the wire by the target bus.
+	eh.RegisterContextMarshaler(func(ctx context.Context, vals map[string]interface{}) {
+		if ids, ok := ctx.Value(bridgesKey).([]string); ok {
+			vals[bridgesKeyStr] = ids
+		}
+	})
+	eh.RegisterContextUnmarshaler(func(ctx context.Context, vals map[string]interface{}) context.Context {
+		switch ids := vals[bridgesKeyStr].(type) {
+		case []string:
+			return context.WithValue(ctx, bridgesKey, ids)
+		case []interface{}:
+			// Support BSON/JSON-like marshaling of slices.
+			strs := make([]string, 0, len(ids))
+			for _, id := range ids {
+				if s, ok := id.(string); ok {
+					strs = append(strs, s)
+				}
+			}
+			return context.WithValue(ctx, bridgesKey, strs)
+		}
+		return ctx
+	})
+}
+
+type contextKey int
+
+const bridgesKey contextKey = iota
+
+const bridgesKeyStr = "eh_bridges"
+
+// BridgesFromContext returns the IDs of the bridges that an event has been
+// forwarded through, in order.
+func BridgesFromContext(ctx context.Context) []string {
+	if ids, ok := ctx.Value(bridgesKey).([]string); ok {
+		return ids
+	}
+	return nil
+}
+
+// TransformFunc is a function that can transform or filter events before they
+// are published on the target bus. Returning a nil event skips the event.
+type TransformFunc func(context.Context, eh.Event) (eh.Event, error)
+
+// ErrTargetPublish is when an event could not be published on the target bus.
+var ErrTargetPublish = errors.New("could not publish event on target")
+
+// Bridge forwards events from one event bus to another. It marks the context
+// of forwarded events with its ID and never forwards events that it has
+// already forwarded once, which prevents loops when bridging in both
+// directions. Bridges that connect the same two buses in both directions
+// should therefore use the same ID.
+//
+// Errors when forwarding are returned to the source bus, which reports them
+// and retries or redelivers the event as it does for other handlers.
+type Bridge struct {
+	id        string
+	target    eh.EventBus
+	transform TransformFunc
+}
+
+var _ = eh.EventHandler(&Bridge{})
+
+// NewBridge creates a bridge that forwards all events matching m from the
+// source bus to the target bus. The bridge is added as a handler on the
+// source bus, which means that each event is forwarded by only one of the
+// instances that runs a bridge with the same ID. The transform func is
+// optional.
+func NewBridge(id string, source, target eh.EventBus, m eh.EventMatcher, transform TransformFunc) *Bridge {
+	b := &Bridge{
+		id:        id,
+		target:    target,
+		transform: transform,
+	}
+	source.AddHandler(m, b)
+
+	return b
+}
+
+// HandlerType implements the HandlerType method of the eventhorizon.EventHandler interface.
+func (b *Bridge) HandlerType() eh.EventHandlerType {
+	return eh.EventHandlerType("bridge_" + b.id)
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler interface.
+// It forwards the event to the target bus.
+func (b *Bridge) HandleEvent(ctx context.Context, event eh.Event) error {
+	// Skip events that already has been forwarded by this bridge.
+	ids := BridgesFromContext(ctx)
+	for _, id := range ids {
+		if id == b.id {
+			return nil
+		}
+	}
+
+	if b.transform != nil {
+		var err error
+		if event, err = b.transform(ctx, event); err != nil {
+			return fmt.Errorf("could not transform event: %s", err)
+		}
+		if event == nil {
+			return nil
+		}
+	}
+
+	// Copy to not modify the slice of the original context.
+	marked := make([]string, len(ids), len(ids)+1)
+	copy(marked, ids)
+	marked = append(marked, b.id)
+	ctx = context.WithValue(ctx, bridgesKey, marked)
+
+	if err := b.target.PublishEvent(ctx, event); err != nil {
+		return fmt.Errorf("%s: %s", ErrTargetPublish, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,198 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package bridge
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/local"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestBridge(t *testing.T) {
+	bus1 := local.NewEventBus(nil)
+	bus2 := local.NewEventBus(nil)
+
+	// Bridge in both directions, with the same ID.
+	b1 := NewBridge("bridge", bus1, bus2, eh.MatchAny(), nil)
+	NewBridge("bridge", bus2, bus1, eh.MatchAny(), nil)
+	if b1.HandlerType() != "bridge_bridge" {
+		t.Error("the handler type should be correct:", b1.HandlerType())
+	}
+
+	handler1 := mocks.NewEventHandler("handler1")
+	handler2 := mocks.NewEventHandler("handler2")
+	bus1.AddObserver(eh.MatchAny(), handler1)
+	bus2.AddObserver(eh.MatchAny(), handler2)
+
+	ctx := mocks.WithContextOne(context.Background(), "testval")
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	event1 := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		timestamp, mocks.AggregateType, id, 1)
+	if err := bus1.PublishEvent(ctx, event1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !handler2.Wait(time.Second) {
+		t.Fatal("did not receive event in time")
+	}
+	if !mocks.EqualEvents(handler2.Events, []eh.Event{event1}) {
+		t.Error("the events should be correct:", handler2.Events)
+	}
+	if val, ok := mocks.ContextOne(handler2.Context); !ok || val != "testval" {
+		t.Error("the context should be correct:", handler2.Context)
+	}
+	if ids := BridgesFromContext(handler2.Context); !reflect.DeepEqual(ids, []string{"bridge"}) {
+		t.Error("the bridges should be correct:", ids)
+	}
+
+	// The event should not be forwarded back.
+	if !handler1.Wait(time.Second) {
+		t.Fatal("did not receive event in time")
+	}
+	if handler1.Wait(10 * time.Millisecond) {
+		t.Error("the event should not be forwarded back:", handler1.Events)
+	}
+
+	// Events should be forwarded in the other direction.
+	event2 := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event2"},
+		timestamp, mocks.AggregateType, id, 2)
+	handler1.Reset()
+	handler2.Reset()
+	if err := bus2.PublishEvent(context.Background(), event2); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !handler1.Wait(time.Second) {
+		t.Fatal("did not receive event in time")
+	}
+	if !mocks.EqualEvents(handler1.Events, []eh.Event{event2}) {
+		t.Error("the events should be correct:", handler1.Events)
+	}
+
+	select {
+	case err := <-bus1.Errors():
+		t.Error("there should be no error:", err)
+	case err := <-bus2.Errors():
+		t.Error("there should be no error:", err)
+	default:
+	}
+}
+
+func TestBridge_Transform(t *testing.T) {
+	bus1 := local.NewEventBus(nil)
+	bus2 := local.NewEventBus(nil)
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	transformed := eh.NewEventForAggregate(mocks.EventOtherType, nil,
+		timestamp, mocks.AggregateType, id, 1)
+	NewBridge("bridge", bus1, bus2, eh.MatchAny(), func(ctx context.Context, event eh.Event) (eh.Event, error) {
+		// Filter out the first version.
+		if event.Version() == 1 {
+			return nil, nil
+		}
+		return transformed, nil
+	})
+
+	handler := mocks.NewEventHandler("handler")
+	bus2.AddObserver(eh.MatchAny(), handler)
+
+	event1 := eh.NewEventForAggregate(mocks.EventType, nil, timestamp, mocks.AggregateType, id, 1)
+	event2 := eh.NewEventForAggregate(mocks.EventType, nil, timestamp, mocks.AggregateType, id, 2)
+	for _, event := range []eh.Event{event1, event2} {
+		if err := bus1.PublishEvent(context.Background(), event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if !handler.Wait(time.Second) {
+		t.Fatal("did not receive event in time")
+	}
+	if !mocks.EqualEvents(handler.Events, []eh.Event{transformed}) {
+		t.Error("the events should be correct:", handler.Events)
+	}
+}
+
+func TestBridge_Errors(t *testing.T) {
+	source := &mocks.EventBus{}
+	target := &mocks.EventBus{}
+	b := NewBridge("bridge", source, target, eh.MatchAny(), nil)
+
+	// Publish error.
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp, mocks.AggregateType, uuid.New(), 1)
+	target.Err = errors.New("publish error")
+	if err := b.HandleEvent(context.Background(), event); err == nil ||
+		err.Error() != "could not publish event on target: publish error" {
+		t.Error("the error should be correct:", err)
+	}
+
+	// Transform error.
+	target.Err = nil
+	b.transform = func(ctx context.Context, event eh.Event) (eh.Event, error) {
+		return nil, errors.New("transform error")
+	}
+	if err := b.HandleEvent(context.Background(), event); err == nil ||
+		err.Error() != "could not transform event: transform error" {
+		t.Error("the error should be correct:", err)
+	}
+	if len(target.Events) != 0 {
+		t.Error("there should be no events published:", target.Events)
+	}
+}
+
+func TestBridge_SourceErrors(t *testing.T) {
+	source := local.NewEventBus(nil)
+	target := &mocks.EventBus{Err: errors.New("publish error")}
+	NewBridge("bridge", source, target, eh.MatchAny(), nil)
+
+	// Forwarding errors should be reported once, by the source bus.
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp, mocks.AggregateType, uuid.New(), 1)
+	if err := source.PublishEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	select {
+	case err := <-source.Errors():
+		if err.Err == nil || err.Err.Error() != "could not publish event on target: publish error" ||
+			err.HandlerType != "bridge_bridge" {
+			t.Error("the error should be correct:", err)
+		}
+	case <-time.After(time.Second):
+		t.Error("there should be an error")
+	}
+}
+
+func TestBridgesContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), bridgesKey, []string{"a", "b"})
+	vals := eh.MarshalContext(ctx)
+	if ids, ok := vals[bridgesKeyStr].([]string); !ok || !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Error("the marshaled bridges should be correct:", vals)
+	}
+
+	// Decoded BSON and JSON uses []interface{}.
+	ctx = eh.UnmarshalContext(map[string]interface{}{
+		bridgesKeyStr: []interface{}{"a", "b"},
+	})
+	if ids := BridgesFromContext(ctx); !reflect.DeepEqual(ids, []string{"a", "b"}) {
+		t.Error("the unmarshaled bridges should be correct:", ids)
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package codec contains the event envelope that is shared by the event bus
+// implementations that send events over the wire. The envelope contains the
+// event type, data, timestamp, aggregate info and version together with the
+// marshaled context, and is encoded as BSON.
+package codec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// MarshalEvent marshals an event and its context into a BSON envelope.
+func MarshalEvent(ctx context.Context, event eh.Event) ([]byte, error) {
+	e := evt{
+		AggregateID:   event.AggregateID().String(),
+		AggregateType: event.AggregateType(),
+		EventType:     event.EventType(),
+		Version:       event.Version(),
+		Timestamp:     event.Timestamp(),
+		Context:       eh.MarshalContext(ctx),
+	}
+
+	// Marshal event data if there is any.
+	if event.Data() != nil {
+		rawData, err := bson.Marshal(event.Data())
+		if err != nil {
+			return nil, errors.New("could not marshal event data: " + err.Error())
+		}
+		e.RawData = bson.Raw{Kind: 3, Data: rawData}
+	}
+
+	// Marshal the event (using BSON for now).
+	b, err := bson.Marshal(e)
+	if err != nil {
+		return nil, errors.New("could not marshal event: " + err.Error())
+	}
+
+	return b, nil
+}
+
+// UnmarshalEvent unmarshals an event and its context from a BSON envelope.
+// The event data is created with eh.CreateEventData if it is registered.
+func UnmarshalEvent(b []byte) (eh.Event, context.Context, error) {
+	// Manually decode the raw BSON event.
+	data := bson.Raw{
+		Kind: 3,
+		Data: b,
+	}
+	var e evt
+	if err := data.Unmarshal(&e); err != nil {
+		return nil, nil, errors.New("could not unmarshal event: " + err.Error())
+	}
+
+	// Create an event of the correct type.
+	if data, err := eh.CreateEventData(e.EventType); err == nil {
+		// Manually decode the raw BSON event.
+		if err := e.RawData.Unmarshal(data); err != nil {
+			return nil, nil, errors.New("could not unmarshal event data: " + err.Error())
+		}
+
+		// Set concrete event and zero out the decoded event.
+		e.data = data
+		e.RawData = bson.Raw{}
+	}
+
+	return event{evt: e}, eh.UnmarshalContext(e.Context), nil
+}
+
+// evt is the internal event used on the wire only.
+type evt struct {
+	EventType     eh.EventType           `bson:"event_type"`
+	RawData       bson.Raw               `bson:"data,omitempty"`
+	data          eh.EventData           `bson:"-"`
+	Timestamp     time.Time              `bson:"timestamp"`
+	AggregateType eh.AggregateType       `bson:"aggregate_type"`
+	AggregateID   string                 `bson:"_id"`
+	Version       int                    `bson:"version"`
+	Context       map[string]interface{} `bson:"context"`
+}
+
+// event is the private implementation of the eventhorizon.Event interface
+// for events received over the wire.
+type event struct {
+	evt
+}
+
+// EventType implements the EventType method of the eventhorizon.Event interface.
+func (e event) EventType() eh.EventType {
+	return e.evt.EventType
+}
+
+// Data implements the Data method of the eventhorizon.Event interface.
+func (e event) Data() eh.EventData {
+	return e.evt.data
+}
+
+// Timestamp implements the Timestamp method of the eventhorizon.Event interface.
+func (e event) Timestamp() time.Time {
+	return e.evt.Timestamp
+}
+
+// AggregateType implements the AggregateType method of the eventhorizon.Event interface.
+func (e event) AggregateType() eh.AggregateType {
+	return e.evt.AggregateType
+}
+
+// AggrgateID implements the AggrgateID method of the eventhorizon.Event interface.
+func (e event) AggregateID() uuid.UUID {
+	id, err := uuid.Parse(e.evt.AggregateID)
+	if err != nil {
+		return uuid.Nil
+	}
+	return id
+}
+
+// Version implements the Version method of the eventhorizon.Event interface.
+func (e event) Version() int {
+	return e.evt.Version
+}
+
+// String implements the String method of the eventhorizon.Event interface.
+func (e event) String() string {
+	return fmt.Sprintf("%s@%d", e.evt.EventType, e.evt.Version)
+}
@@ -0,0 +1,83 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package codec
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestMarshalUnmarshalEvent(t *testing.T) {
+	ctx := mocks.WithContextOne(context.Background(), "testval")
+	ctx = eh.NewContextWithNamespace(ctx, "ns")
+
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		timestamp, mocks.AggregateType, id, 3)
+
+	b, err := MarshalEvent(ctx, event)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	decoded, decodedCtx, err := UnmarshalEvent(b)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !mocks.EqualEvents([]eh.Event{decoded}, []eh.Event{event}) {
+		t.Error("the event should be correct:", decoded)
+	}
+	if decoded.String() != "Event@3" {
+		t.Error("the string representation should be correct:", decoded.String())
+	}
+	if val, ok := mocks.ContextOne(decodedCtx); !ok || val != "testval" {
+		t.Error("the context should be correct:", decodedCtx)
+	}
+	if ns := eh.NamespaceFromContext(decodedCtx); ns != "ns" {
+		t.Error("the namespace should be correct:", ns)
+	}
+}
+
+func TestMarshalUnmarshalEvent_NoData(t *testing.T) {
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventOtherType, nil,
+		timestamp, mocks.AggregateType, uuid.New(), 1)
+
+	b, err := MarshalEvent(context.Background(), event)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	decoded, _, err := UnmarshalEvent(b)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if !mocks.EqualEvents([]eh.Event{decoded}, []eh.Event{event}) {
+		t.Error("the event should be correct:", decoded)
+	}
+}
+
+func TestUnmarshalEvent_Invalid(t *testing.T) {
+	if _, _, err := UnmarshalEvent([]byte("invalid")); err == nil {
+		t.Error("there should be an error")
+	}
+}
@@ -22,11 +22,11 @@ import (
 	"time"
 
 	"cloud.google.com/go/pubsub"
-	"github.com/globalsign/mgo/bson"
 	"github.com/google/uuid"
 	"google.golang.org/api/option"
 
 	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/codec"
 )
 
 // DefaultQueueSize is the default queue size per handler for publishing events.
@@ -41,6 +41,8 @@ type EventBus struct {
 	registered   map[eh.EventHandlerType]struct{}
 	registeredMu sync.RWMutex
 	errCh        chan eh.EventBusError
+	errHandler   eh.EventBusErrorHandler
+	errHandlerMu sync.RWMutex
 }
 
 // NewEventBus creates an EventBus, with optional GCP connection settings.
@@ -73,28 +75,9 @@ func NewEventBus(projectID, appID string, opts ...option.ClientOption) (*EventBu
 
 // PublishEvent implements the PublishEvent method of the eventhorizon.EventBus interface.
 func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
-	e := evt{
-		AggregateID:   event.AggregateID().String(),
-		AggregateType: event.AggregateType(),
-		EventType:     event.EventType(),
-		Version:       event.Version(),
-		Timestamp:     event.Timestamp(),
-		Context:       eh.MarshalContext(ctx),
-	}
-
-	// Marshal event data if there is any.
-	if event.Data() != nil {
-		rawData, err := bson.Marshal(event.Data())
-		if err != nil {
-			return errors.New("could not marshal event data: " + err.Error())
-		}
-		e.RawData = bson.Raw{Kind: 3, Data: rawData}
-	}
-
-	// Marshal the event (using BSON for now).
-	data, err := bson.Marshal(e)
+	data, err := codec.MarshalEvent(ctx, event)
 	if err != nil {
-		return errors.New("could not marshal event: " + err.Error())
+		return err
 	}
 
 	// NOTE: Using a new context here.
@@ -113,13 +96,13 @@ func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
 // AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
 func (b *EventBus) AddHandler(m eh.EventMatcher, h eh.EventHandler) {
 	sub := b.subscription(m, h, false)
-	go b.handle(m, h, sub)
+	go b.handle(m, h, sub, false)
 }
 
 // AddObserver implements the AddObserver method of the eventhorizon.EventBus interface.
 func (b *EventBus) AddObserver(m eh.EventMatcher, h eh.EventHandler) {
 	sub := b.subscription(m, h, true)
-	go b.handle(m, h, sub)
+	go b.handle(m, h, sub, true)
 }
 
 // Errors implements the Errors method of the eventhorizon.EventBus interface.
@@ -127,6 +110,31 @@ func (b *EventBus) Errors() <-chan eh.EventBusError {
 	return b.errCh
 }
 
+// SetErrorHandler sets a handler that is called for all errors, instead of
+// sending them on the Errors channel.
+func (b *EventBus) SetErrorHandler(f eh.EventBusErrorHandler) {
+	b.errHandlerMu.Lock()
+	defer b.errHandlerMu.Unlock()
+	b.errHandler = f
+}
+
+func (b *EventBus) error(err eh.EventBusError) {
+	err.BusName = "gcp"
+
+	b.errHandlerMu.RLock()
+	f := b.errHandler
+	b.errHandlerMu.RUnlock()
+	if f != nil {
+		f(err)
+		return
+	}
+
+	select {
+	case b.errCh <- err:
+	default:
+	}
+}
+
 // Checks the matcher and handler and gets the event subscription.
 func (b *EventBus) subscription(m eh.EventMatcher, h eh.EventHandler, observer bool) *pubsub.Subscription {
 	b.registeredMu.Lock()
@@ -170,55 +178,26 @@ func (b *EventBus) subscription(m eh.EventMatcher, h eh.EventHandler, observer b
 }
 
 // Handles all events coming in on the channel.
-func (b *EventBus) handle(m eh.EventMatcher, h eh.EventHandler, sub *pubsub.Subscription) {
+func (b *EventBus) handle(m eh.EventMatcher, h eh.EventHandler, sub *pubsub.Subscription, observer bool) {
 	for {
 		ctx := context.Background()
-		if err := sub.Receive(ctx, b.handler(m, h)); err != context.Canceled {
-			select {
-			case b.errCh <- eh.EventBusError{Ctx: ctx, Err: errors.New("could not receive: " + err.Error())}:
-			default:
-			}
+		if err := sub.Receive(ctx, b.handler(m, h, observer)); err != context.Canceled {
+			b.error(eh.EventBusError{Ctx: ctx, Err: errors.New("could not receive: " + err.Error())})
 		}
 		time.Sleep(time.Second)
 	}
 }
 
-func (b *EventBus) handler(m eh.EventMatcher, h eh.EventHandler) func(ctx context.Context, msg *pubsub.Message) {
+func (b *EventBus) handler(m eh.EventMatcher, h eh.EventHandler, observer bool) func(ctx context.Context, msg *pubsub.Message) {
 	return func(ctx context.Context, msg *pubsub.Message) {
-		// Manually decode the raw BSON event.
-		data := bson.Raw{
-			Kind: 3,
-			Data: msg.Data,
-		}
-		var e evt
-		if err := data.Unmarshal(&e); err != nil {
-			select {
-			case b.errCh <- eh.EventBusError{Err: errors.New("could not unmarshal event: " + err.Error()), Ctx: ctx}:
-			default:
-			}
+		event, eventCtx, err := codec.UnmarshalEvent(msg.Data)
+		if err != nil {
+			b.error(eh.EventBusError{Err: err, Ctx: ctx})
 			msg.Nack()
 			return
 		}
 
-		// Create an event of the correct type.
-		if data, err := eh.CreateEventData(e.EventType); err == nil {
-			// Manually decode the raw BSON event.
-			if err := e.RawData.Unmarshal(data); err != nil {
-				select {
-				case b.errCh <- eh.EventBusError{Err: errors.New("could not unmarshal event data: " + err.Error()), Ctx: ctx}:
-				default:
-				}
-				msg.Nack()
-				return
-			}
-
-			// Set concrete event and zero out the decoded event.
-			e.data = data
-			e.RawData = bson.Raw{}
-		}
-
-		event := event{evt: e}
-		ctx = eh.UnmarshalContext(e.Context)
+		ctx = eventCtx
 
 		if !m(event) {
 			msg.Ack()
@@ -227,10 +206,14 @@ func (b *EventBus) handler(m eh.EventMatcher, h eh.EventHandler) func(ctx contex
 
 		// Notify all observers about the event.
 		if err := h.HandleEvent(ctx, event); err != nil {
-			select {
-			case b.errCh <- eh.EventBusError{Err: fmt.Errorf("could not handle event (%s): %s", h.HandlerType(), err.Error()), Ctx: ctx, Event: event}:
-			default:
-			}
+			// The number of delivery attempts is not known.
+			b.error(eh.EventBusError{
+				Err:         err,
+				Ctx:         ctx,
+				Event:       event,
+				HandlerType: h.HandlerType(),
+				Observer:    observer,
+			})
 			msg.Nack()
 			return
 		}
@@ -238,60 +221,3 @@ func (b *EventBus) handler(m eh.EventMatcher, h eh.EventHandler) func(ctx contex
 		msg.Ack()
 	}
 }
-
-// evt is the internal event used on the wire only.
-type evt struct {
-	EventType     eh.EventType           `bson:"event_type"`
-	RawData       bson.Raw               `bson:"data,omitempty"`
-	data          eh.EventData           `bson:"-"`
-	Timestamp     time.Time              `bson:"timestamp"`
-	AggregateType eh.AggregateType       `bson:"aggregate_type"`
-	AggregateID   string                 `bson:"_id"`
-	Version       int                    `bson:"version"`
-	Context       map[string]interface{} `bson:"context"`
-}
-
-// event is the private implementation of the eventhorizon.Event interface
-// for a MongoDB event store.
-type event struct {
-	evt
-}
-
-// EventType implements the EventType method of the eventhorizon.Event interface.
-func (e event) EventType() eh.EventType {
-	return e.evt.EventType
-}
-
-// Data implements the Data method of the eventhorizon.Event interface.
-func (e event) Data() eh.EventData {
-	return e.evt.data
-}
-
-// Timestamp implements the Timestamp method of the eventhorizon.Event interface.
-func (e event) Timestamp() time.Time {
-	return e.evt.Timestamp
-}
-
-// AggregateType implements the AggregateType method of the eventhorizon.Event interface.
-func (e event) AggregateType() eh.AggregateType {
-	return e.evt.AggregateType
-}
-
-// AggrgateID implements the AggrgateID method of the eventhorizon.Event interface.
-func (e event) AggregateID() uuid.UUID {
-	id, err := uuid.Parse(e.evt.AggregateID)
-	if err != nil {
-		return uuid.Nil
-	}
-	return id
-}
-
-// Version implements the Version method of the eventhorizon.Event interface.
-func (e event) Version() int {
-	return e.evt.Version
-}
-
-// String implements the String method of the eventhorizon.Event interface.
-func (e event) String() string {
-	return fmt.Sprintf("%s@%d", e.evt.EventType, e.evt.Version)
-}
@@ -0,0 +1,454 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package kafka
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jpillora/backoff"
+	"github.com/segmentio/kafka-go"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/codec"
+)
+
+// DefaultPartitions is the number of partitions used when creating the topic.
+var DefaultPartitions = 4
+
+// DefaultHeartbeatInterval is the heartbeat interval of the consumer groups,
+// it also controls how fast a consumer notices a rebalance of its group.
+var DefaultHeartbeatInterval = time.Second
+
+// DefaultMaxAttempts is the default number of times a failing handler is
+// called with an event before the event is skipped.
+var DefaultMaxAttempts = 10
+
+// ErrCouldNotDialBroker is when the Kafka broker could not be dialed.
+var ErrCouldNotDialBroker = errors.New("could not dial broker")
+
+// EventBus is an event bus using Kafka. All events are published on a single
+// topic per app, partitioned by aggregate ID to keep the order of the events
+// for each aggregate. Each handler type is a consumer group of the topic, which
+// means that only one of the handlers with the same type will receive an
+// event. Each observer gets a unique consumer group.
+// Offsets are committed only when the handler has handled an event, failed
+// events are retried with backoff up to the max attempts, see SetMaxAttempts.
+// All failed attempts are reported as errors, after the last one the event is
+// skipped and its offset committed to not block the partition.
+// Errors when joining a consumer group are reported and the group is joined
+// again, if a generation can not be set up the group is left and joined anew.
+type EventBus struct {
+	appID        string
+	brokers      []string
+	topic        string
+	writer       *kafka.Writer
+	registered   map[eh.EventHandlerType]struct{}
+	registeredMu sync.RWMutex
+	groups       map[string]*kafka.ConsumerGroup
+	errCh        chan eh.EventBusError
+	errHandler   eh.EventBusErrorHandler
+	errHandlerMu sync.RWMutex
+	maxAttempts  int
+	ctx          context.Context
+	cancel       context.CancelFunc
+	wg           sync.WaitGroup
+}
+
+// NewEventBus creates an EventBus connected to a Kafka cluster. The appID is
+// used as a namespace for the topic and consumer groups. The topic is created
+// if it does not exist.
+func NewEventBus(brokers []string, appID string) (*EventBus, error) {
+	if len(brokers) == 0 {
+		return nil, ErrCouldNotDialBroker
+	}
+	topic := appID + "_events"
+
+	// Create the topic using the controller of the cluster.
+	conn, err := kafka.Dial("tcp", brokers[0])
+	if err != nil {
+		return nil, ErrCouldNotDialBroker
+	}
+	defer conn.Close()
+	controller, err := conn.Controller()
+	if err != nil {
+		return nil, errors.New("could not get controller: " + err.Error())
+	}
+	controllerConn, err := kafka.Dial("tcp", net.JoinHostPort(controller.Host, strconv.Itoa(controller.Port)))
+	if err != nil {
+		return nil, ErrCouldNotDialBroker
+	}
+	defer controllerConn.Close()
+	if err := controllerConn.CreateTopics(kafka.TopicConfig{
+		Topic:             topic,
+		NumPartitions:     DefaultPartitions,
+		ReplicationFactor: 1,
+	}); err != nil && err != kafka.TopicAlreadyExists {
+		return nil, errors.New("could not create topic: " + err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EventBus{
+		appID:   appID,
+		brokers: brokers,
+		topic:   topic,
+		writer: kafka.NewWriter(kafka.WriterConfig{
+			Brokers:      brokers,
+			Topic:        topic,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    1,
+			BatchTimeout: time.Millisecond,
+		}),
+		registered:  map[eh.EventHandlerType]struct{}{},
+		groups:      map[string]*kafka.ConsumerGroup{},
+		errCh:       make(chan eh.EventBusError, 100),
+		maxAttempts: DefaultMaxAttempts,
+		ctx:         ctx,
+		cancel:      cancel,
+	}, nil
+}
+
+// PublishEvent implements the PublishEvent method of the eventhorizon.EventBus interface.
+func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
+	data, err := codec.MarshalEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	// Use the aggregate ID as key to keep the order of events per aggregate.
+	if err := b.writer.WriteMessages(ctx, kafka.Message{
+		Key:   []byte(event.AggregateID().String()),
+		Value: data,
+	}); err != nil {
+		return errors.New("could not publish event: " + err.Error())
+	}
+
+	return nil
+}
+
+// AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
+func (b *EventBus) AddHandler(m eh.EventMatcher, h eh.EventHandler) {
+	b.add(m, h, false)
+}
+
+// AddObserver implements the AddObserver method of the eventhorizon.EventBus interface.
+func (b *EventBus) AddObserver(m eh.EventMatcher, h eh.EventHandler) {
+	b.add(m, h, true)
+}
+
+// Registers the handler and joins the first generation of its consumer group
+// before returning, to not miss any events that are published directly after
+// adding a handler. Errors when joining are reported, the handler then keeps
+// trying to join in the background.
+func (b *EventBus) add(m eh.EventMatcher, h eh.EventHandler, observer bool) {
+	id := b.register(m, h, observer)
+
+	cg, gen, err := b.join(id, nil)
+	if err != nil {
+		b.error(eh.EventBusError{
+			Err:         err,
+			Ctx:         context.Background(),
+			HandlerType: h.HandlerType(),
+			Observer:    observer,
+		})
+	}
+
+	b.wg.Add(1)
+	go b.handle(m, h, id, cg, gen, observer)
+}
+
+// Errors implements the Errors method of the eventhorizon.EventBus interface.
+func (b *EventBus) Errors() <-chan eh.EventBusError {
+	return b.errCh
+}
+
+// SetErrorHandler sets a handler that is called for all errors, instead of
+// sending them on the Errors channel.
+func (b *EventBus) SetErrorHandler(f eh.EventBusErrorHandler) {
+	b.errHandlerMu.Lock()
+	defer b.errHandlerMu.Unlock()
+	b.errHandler = f
+}
+
+// SetMaxAttempts sets the number of times a failing handler is called with an
+// event before the event is skipped. It must be set before adding handlers.
+func (b *EventBus) SetMaxAttempts(n int) {
+	b.maxAttempts = n
+}
+
+func (b *EventBus) error(err eh.EventBusError) {
+	err.BusName = "kafka"
+
+	b.errHandlerMu.RLock()
+	f := b.errHandler
+	b.errHandlerMu.RUnlock()
+	if f != nil {
+		f(err)
+		return
+	}
+
+	select {
+	case b.errCh <- err:
+	default:
+	}
+}
+
+// Close stops all handlers and closes the connections to Kafka.
+func (b *EventBus) Close() error {
+	b.cancel()
+
+	b.registeredMu.Lock()
+	groups := b.groups
+	b.groups = map[string]*kafka.ConsumerGroup{}
+	b.registeredMu.Unlock()
+	for _, cg := range groups {
+		cg.Close()
+	}
+
+	b.wg.Wait()
+	return b.writer.Close()
+}
+
+// Checks the matcher and handler and returns the ID of its consumer group.
+func (b *EventBus) register(m eh.EventMatcher, h eh.EventHandler, observer bool) string {
+	b.registeredMu.Lock()
+	defer b.registeredMu.Unlock()
+
+	if m == nil {
+		panic("matcher can't be nil")
+	}
+	if h == nil {
+		panic("handler can't be nil")
+	}
+	if _, ok := b.registered[h.HandlerType()]; ok {
+		panic(fmt.Sprintf("multiple registrations for %s", h.HandlerType()))
+	}
+	b.registered[h.HandlerType()] = struct{}{}
+
+	id := string(h.HandlerType())
+	if observer { // Generate unique ID for each observer.
+		id = fmt.Sprintf("%s-%s", id, uuid.New())
+	}
+
+	return b.appID + "_" + id
+}
+
+// join joins the next generation of a consumer group, the consumer group is
+// created if it is nil. Partitions without a committed offset are resolved to
+// their current last offset and committed directly, to not skip or repeat
+// events in later generations. If that fails the consumer group is closed to
+// end the generation and leave the group, and nil is returned for it so that
+// the next join creates a new one.
+func (b *EventBus) join(id string, cg *kafka.ConsumerGroup) (*kafka.ConsumerGroup, *kafka.Generation, error) {
+	if cg == nil {
+		var err error
+		if cg, err = b.consumerGroup(id); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	gen, err := cg.Next(b.ctx)
+	if err != nil {
+		return cg, nil, errors.New("could not join consumer group: " + err.Error())
+	}
+
+	if err := b.resolveOffsets(gen); err != nil {
+		b.registeredMu.Lock()
+		if b.groups[id] == cg {
+			delete(b.groups, id)
+		}
+		b.registeredMu.Unlock()
+		cg.Close()
+		return nil, nil, err
+	}
+
+	return cg, gen, nil
+}
+
+// consumerGroup creates a consumer group, starting with new events only. An
+// already existing group is shared with the other handlers of the type.
+func (b *EventBus) consumerGroup(id string) (*kafka.ConsumerGroup, error) {
+	b.registeredMu.Lock()
+	defer b.registeredMu.Unlock()
+
+	// Don't create new groups after Close has closed them.
+	if err := b.ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	cg, err := kafka.NewConsumerGroup(kafka.ConsumerGroupConfig{
+		ID:                id,
+		Brokers:           b.brokers,
+		Topics:            []string{b.topic},
+		HeartbeatInterval: DefaultHeartbeatInterval,
+		StartOffset:       kafka.LastOffset,
+	})
+	if err != nil {
+		return nil, errors.New("could not create consumer group: " + err.Error())
+	}
+	b.groups[id] = cg
+
+	return cg, nil
+}
+
+// resolveOffsets sets and commits the last offset of all partitions that are
+// assigned to the generation without an offset.
+func (b *EventBus) resolveOffsets(gen *kafka.Generation) error {
+	offsets := map[int]int64{}
+	for i, a := range gen.Assignments[b.topic] {
+		if a.Offset >= 0 {
+			continue
+		}
+		conn, err := kafka.DialLeader(b.ctx, "tcp", b.brokers[0], b.topic, a.ID)
+		if err != nil {
+			return errors.New("could not dial partition leader: " + err.Error())
+		}
+		offset, err := conn.ReadLastOffset()
+		conn.Close()
+		if err != nil {
+			return errors.New("could not read last offset: " + err.Error())
+		}
+		gen.Assignments[b.topic][i].Offset = offset
+		offsets[a.ID] = offset
+	}
+	if err := gen.CommitOffsets(map[string]map[int]int64{b.topic: offsets}); err != nil {
+		return errors.New("could not commit offsets: " + err.Error())
+	}
+
+	return nil
+}
+
+// Handles all events coming in on the topic for a consumer group, for each
+// generation of the group until the bus is closed.
+func (b *EventBus) handle(m eh.EventMatcher, h eh.EventHandler, id string, cg *kafka.ConsumerGroup, gen *kafka.Generation, observer bool) {
+	defer b.wg.Done()
+
+	delay := &backoff.Backoff{
+		Min: 100 * time.Millisecond,
+		Max: 10 * time.Second,
+	}
+	for {
+		if gen != nil {
+			delay.Reset()
+			g := gen
+			for _, a := range g.Assignments[b.topic] {
+				partition, offset := a.ID, a.Offset
+				g.Start(func(ctx context.Context) {
+					b.handlePartition(ctx, m, h, observer, g, partition, offset)
+				})
+			}
+		} else if cg == nil {
+			// Wait before creating the consumer group again.
+			select {
+			case <-b.ctx.Done():
+				return
+			case <-time.After(delay.Duration()):
+			}
+		}
+
+		var err error
+		if cg, gen, err = b.join(id, cg); err != nil {
+			if b.ctx.Err() != nil {
+				return
+			}
+			b.error(eh.EventBusError{
+				Err:         err,
+				Ctx:         context.Background(),
+				HandlerType: h.HandlerType(),
+				Observer:    observer,
+			})
+		}
+	}
+}
+
+// Handles the events of a single partition for a generation of the group.
+func (b *EventBus) handlePartition(ctx context.Context, m eh.EventMatcher, h eh.EventHandler, observer bool, gen *kafka.Generation, partition int, offset int64) {
+	r := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   b.brokers,
+		Topic:     b.topic,
+		Partition: partition,
+		MaxWait:   DefaultHeartbeatInterval,
+	})
+	defer r.Close()
+	if err := r.SetOffset(offset); err != nil {
+		b.error(eh.EventBusError{Err: errors.New("could not set offset: " + err.Error()), Ctx: context.Background()})
+		return
+	}
+
+	for {
+		msg, err := r.ReadMessage(ctx)
+		if err != nil {
+			// The generation has ended or the bus is closed.
+			return
+		}
+
+		// Retry failed events to keep the order, until they are handled or
+		// the max attempts is reached and they are skipped.
+		delay := &backoff.Backoff{
+			Min: 100 * time.Millisecond,
+			Max: 10 * time.Second,
+		}
+		for attempt := 1; !b.handleMessage(m, h, observer, msg, attempt) &&
+			attempt < b.maxAttempts; attempt++ {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(delay.Duration()):
+			}
+		}
+
+		if err := gen.CommitOffsets(map[string]map[int]int64{
+			b.topic: {partition: msg.Offset + 1},
+		}); err != nil {
+			b.error(eh.EventBusError{Err: errors.New("could not commit offset: " + err.Error()), Ctx: context.Background()})
+			return
+		}
+	}
+}
+
+// handleMessage handles a single message, it returns false if it should be
+// retried.
+func (b *EventBus) handleMessage(m eh.EventMatcher, h eh.EventHandler, observer bool, msg kafka.Message, attempt int) bool {
+	event, ctx, err := codec.UnmarshalEvent(msg.Value)
+	if err != nil {
+		// Invalid events will never be handled, skip them.
+		b.error(eh.EventBusError{Err: err, Ctx: context.Background()})
+		return true
+	}
+
+	if !m(event) {
+		return true
+	}
+
+	if err := h.HandleEvent(ctx, event); err != nil {
+		b.error(eh.EventBusError{
+			Err:         err,
+			Ctx:         ctx,
+			Event:       event,
+			HandlerType: h.HandlerType(),
+			Observer:    observer,
+			Attempt:     attempt,
+		})
+		return false
+	}
+
+	return true
+}
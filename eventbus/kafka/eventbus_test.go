@@ -0,0 +1,134 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build integration
+// +build integration
+
+// The tests need a Kafka broker, they are run with the integration tag:
+//
+//     docker-compose up -d kafka
+//     KAFKA_HOST=localhost:9092 go test -tags integration ./eventbus/kafka/...
+//
+// See also make test_integration.
+
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventBus(t *testing.T) {
+	addr, appID := testBroker(t)
+
+	bus1, err := NewEventBus([]string{addr}, appID)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus1.Close()
+
+	bus2, err := NewEventBus([]string{addr}, appID)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus2.Close()
+
+	// Rebalancing of the consumer groups can take some time.
+	eventbus.AcceptanceTest(t, bus1, bus2, 10*time.Second)
+}
+
+func TestEventBus_MaxAttempts(t *testing.T) {
+	addr, appID := testBroker(t)
+
+	bus, err := NewEventBus([]string{addr}, appID)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	bus.SetMaxAttempts(2)
+
+	// The failing event should be skipped after the last attempt.
+	handler := mocks.NewEventHandler("handler")
+	handler.Err = errors.New("handler error")
+	bus.AddHandler(eh.MatchAny(), handler)
+	ctx := context.Background()
+	timestamp := time.Now()
+	event1 := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		timestamp, mocks.AggregateType, uuid.New(), 1)
+	if err := bus.PublishEvent(ctx, event1); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	for i := 1; i <= 2; i++ {
+		select {
+		case err := <-bus.Errors():
+			if err.Err != handler.Err || err.Attempt != i {
+				t.Error("the error should be correct:", err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal("there should be an error")
+		}
+	}
+
+	// The next event on the same partition should be handled.
+	handler.Err = nil
+	event2 := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event2"},
+		timestamp, mocks.AggregateType, event1.AggregateID(), 2)
+	if err := bus.PublishEvent(ctx, event2); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	select {
+	case <-handler.Recv:
+	case err := <-bus.Errors():
+		t.Fatal("there should be no error:", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("the event should be handled")
+	}
+	if !mocks.EqualEvents(handler.Events, []eh.Event{event2}) {
+		t.Error("only the second event should be handled:", handler.Events)
+	}
+}
+
+// testBroker returns the address of the test broker and a random app ID. The
+// test fails if there is no broker to connect to.
+func testBroker(t *testing.T) (string, string) {
+	// Connect to localhost if not running inside docker
+	addr := os.Getenv("KAFKA_HOST")
+	if addr == "" {
+		addr = "localhost:9092"
+	}
+	conn, err := net.DialTimeout("tcp", addr, time.Second)
+	if err != nil {
+		t.Fatal("could not connect to Kafka broker at "+addr+":", err)
+	}
+	conn.Close()
+
+	// Get a random app ID.
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return addr, "app-" + hex.EncodeToString(b)
+}
@@ -33,6 +33,8 @@ type EventBus struct {
 	registered   map[eh.EventHandlerType]struct{}
 	registeredMu sync.RWMutex
 	errCh        chan eh.EventBusError
+	errHandler   eh.EventBusErrorHandler
+	errHandlerMu sync.RWMutex
 	wg           sync.WaitGroup
 }
 
@@ -57,13 +59,13 @@ func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
 // AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
 func (b *EventBus) AddHandler(m eh.EventMatcher, h eh.EventHandler) {
 	ch := b.channel(m, h, false)
-	go b.handle(m, h, ch)
+	go b.handle(m, h, ch, false)
 }
 
 // AddObserver implements the AddObserver method of the eventhorizon.EventBus interface.
 func (b *EventBus) AddObserver(m eh.EventMatcher, h eh.EventHandler) {
 	ch := b.channel(m, h, true)
-	go b.handle(m, h, ch)
+	go b.handle(m, h, ch, true)
 }
 
 // Errors implements the Errors method of the eventhorizon.EventBus interface.
@@ -71,8 +73,33 @@ func (b *EventBus) Errors() <-chan eh.EventBusError {
 	return b.errCh
 }
 
+// SetErrorHandler sets a handler that is called for all errors, instead of
+// sending them on the Errors channel.
+func (b *EventBus) SetErrorHandler(f eh.EventBusErrorHandler) {
+	b.errHandlerMu.Lock()
+	defer b.errHandlerMu.Unlock()
+	b.errHandler = f
+}
+
+func (b *EventBus) error(err eh.EventBusError) {
+	err.BusName = "local"
+
+	b.errHandlerMu.RLock()
+	f := b.errHandler
+	b.errHandlerMu.RUnlock()
+	if f != nil {
+		f(err)
+		return
+	}
+
+	select {
+	case b.errCh <- err:
+	default:
+	}
+}
+
 // Handles all events coming in on the channel.
-func (b *EventBus) handle(m eh.EventMatcher, h eh.EventHandler, ch <-chan evt) {
+func (b *EventBus) handle(m eh.EventMatcher, h eh.EventHandler, ch <-chan evt, observer bool) {
 	b.wg.Add(1)
 	defer b.wg.Done()
 
@@ -81,10 +108,14 @@ func (b *EventBus) handle(m eh.EventMatcher, h eh.EventHandler, ch <-chan evt) {
 			continue
 		}
 		if err := h.HandleEvent(e.ctx, e.event); err != nil {
-			select {
-			case b.errCh <- eh.EventBusError{Err: fmt.Errorf("could not handle event (%s): %s", h.HandlerType(), err.Error()), Ctx: e.ctx, Event: e.event}:
-			default:
-			}
+			b.error(eh.EventBusError{
+				Err:         err,
+				Ctx:         e.ctx,
+				Event:       e.event,
+				HandlerType: h.HandlerType(),
+				Observer:    observer,
+				Attempt:     1,
+			})
 		}
 	}
 }
@@ -15,10 +15,17 @@
 package local
 
 import (
+	"context"
+	"errors"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/eventbus"
+	"github.com/looplab/eventhorizon/mocks"
 )
 
 func TestEventBus(t *testing.T) {
@@ -44,3 +51,93 @@ func TestEventBus(t *testing.T) {
 	bus1.Wait()
 	bus2.Wait()
 }
+
+func TestEventBus_Middleware(t *testing.T) {
+	var published, dispatched int32
+	m := eh.NewEventBusMiddleware(
+		func(publish eh.PublishEventFunc) eh.PublishEventFunc {
+			return func(ctx context.Context, event eh.Event) error {
+				atomic.AddInt32(&published, 1)
+				return publish(ctx, event)
+			}
+		},
+		func(h eh.EventHandler) eh.EventHandler {
+			return eh.EventHandlerFunc(func(ctx context.Context, event eh.Event) error {
+				atomic.AddInt32(&dispatched, 1)
+				return h.HandleEvent(ctx, event)
+			})
+		},
+	)
+
+	group := NewGroup()
+	bus1 := NewEventBus(group)
+	bus2 := NewEventBus(group)
+
+	eventbus.AcceptanceTest(t,
+		eh.UseEventBusMiddleware(bus1, m),
+		eh.UseEventBusMiddleware(bus2, m),
+		time.Second,
+	)
+
+	bus1.Close()
+	bus2.Close()
+	bus1.Wait()
+	bus2.Wait()
+
+	if atomic.LoadInt32(&published) == 0 {
+		t.Error("the publish middleware should have been used")
+	}
+	if atomic.LoadInt32(&dispatched) == 0 {
+		t.Error("the dispatch middleware should have been used")
+	}
+}
+
+func TestEventBus_ErrorHandler(t *testing.T) {
+	bus := NewEventBus(nil)
+
+	errCh := make(chan eh.EventBusError)
+	bus.SetErrorHandler(func(err eh.EventBusError) {
+		errCh <- err
+	})
+
+	observer := mocks.NewEventHandler("observer")
+	observer.Err = errors.New("observer error")
+	bus.AddObserver(eh.MatchAny(), observer)
+
+	// More errors than fits in the error channel should be handled.
+	const numEvents = 150
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	go func() {
+		for i := 1; i <= numEvents; i++ {
+			event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp, mocks.AggregateType, id, i)
+			bus.PublishEvent(context.Background(), event)
+			// Don't fill the queue of the observer.
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	for i := 1; i <= numEvents; i++ {
+		select {
+		case err := <-errCh:
+			if err.Err != observer.Err || err.Event.Version() != i {
+				t.Fatal("the error should be correct:", err)
+			}
+			if err.HandlerType != "observer" || !err.Observer ||
+				err.Attempt != 1 || err.BusName != "local" {
+				t.Fatal("the error info should be correct:", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("there should be an error:", i)
+		}
+	}
+
+	select {
+	case err := <-bus.Errors():
+		t.Error("there should be no errors on the channel:", err)
+	default:
+	}
+
+	bus.Close()
+	bus.Wait()
+}
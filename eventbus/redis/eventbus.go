@@ -0,0 +1,403 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus/codec"
+)
+
+// DefaultBlockTime is the time that a handler blocks while waiting for new
+// events, it is also the max time it takes for Close to stop the handlers.
+var DefaultBlockTime = time.Second
+
+// DefaultClaimIdleTime is the time that an event must have been pending
+// without being acked before another consumer claims it. This is used to
+// recover events from crashed consumers and to retry failed events.
+var DefaultClaimIdleTime = 60 * time.Second
+
+// DefaultMaxAttempts is the default number of times a failing handler is
+// called with an event before the event is acked and skipped.
+var DefaultMaxAttempts = 10
+
+// DefaultMaxLen is the default approximate max number of events kept in the
+// stream, older events are trimmed when publishing. Zero disables trimming.
+var DefaultMaxLen int64 = 100000
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBClient is when no database client is set.
+var ErrNoDBClient = errors.New("no database client")
+
+// EventBus is an event bus using Redis Streams. Each handler type is a consumer
+// group of the stream, which means that only one of the handlers with the
+// same type will receive an event. Each observer gets a unique consumer group.
+// Events are acked when the handler has handled them, any non-acked events are
+// claimed by a consumer after DefaultClaimIdleTime and handled again, up to the
+// max attempts, see SetMaxAttempts. All failed attempts are reported as errors,
+// after the last one the event is acked to not be claimed forever. Events that
+// can not be decoded are reported and acked directly.
+//
+// The stream is trimmed to approximately the max length when publishing, see
+// SetMaxLen, and the consumer groups of observers are destroyed on Close.
+type EventBus struct {
+	appID         string
+	clientID      string
+	stream        string
+	client        *redis.Client
+	claimIdleTime time.Duration
+	maxAttempts   int
+	maxLen        int64
+	registered    map[eh.EventHandlerType]struct{}
+	observers     []string
+	registeredMu  sync.RWMutex
+	errCh         chan eh.EventBusError
+	errHandler    eh.EventBusErrorHandler
+	errHandlerMu  sync.RWMutex
+	done          chan struct{}
+	wg            sync.WaitGroup
+}
+
+// NewEventBus creates an EventBus connected to a Redis server. The appID is
+// used as a namespace for the stream and consumer groups, the clientID must be
+// unique for each instance of the app.
+func NewEventBus(addr, appID, clientID string) (*EventBus, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr: addr,
+	})
+	if err := client.Ping().Err(); err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	return NewEventBusWithClient(client, appID, clientID)
+}
+
+// NewEventBusWithClient creates an EventBus with a Redis client.
+func NewEventBusWithClient(client *redis.Client, appID, clientID string) (*EventBus, error) {
+	if client == nil {
+		return nil, ErrNoDBClient
+	}
+
+	return &EventBus{
+		appID:         appID,
+		clientID:      clientID,
+		stream:        appID + "_events",
+		client:        client,
+		claimIdleTime: DefaultClaimIdleTime,
+		maxAttempts:   DefaultMaxAttempts,
+		maxLen:        DefaultMaxLen,
+		registered:    map[eh.EventHandlerType]struct{}{},
+		errCh:         make(chan eh.EventBusError, 100),
+		done:          make(chan struct{}),
+	}, nil
+}
+
+// PublishEvent implements the PublishEvent method of the eventhorizon.EventBus interface.
+func (b *EventBus) PublishEvent(ctx context.Context, event eh.Event) error {
+	data, err := codec.MarshalEvent(ctx, event)
+	if err != nil {
+		return err
+	}
+
+	if err := b.client.XAdd(&redis.XAddArgs{
+		Stream:       b.stream,
+		MaxLenApprox: b.maxLen,
+		Values: map[string]interface{}{
+			"event": data,
+		},
+	}).Err(); err != nil {
+		return errors.New("could not publish event: " + err.Error())
+	}
+
+	return nil
+}
+
+// AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
+func (b *EventBus) AddHandler(m eh.EventMatcher, h eh.EventHandler) {
+	group := b.group(m, h, false)
+	b.wg.Add(1)
+	go b.handle(m, h, group, false)
+}
+
+// AddObserver implements the AddObserver method of the eventhorizon.EventBus interface.
+func (b *EventBus) AddObserver(m eh.EventMatcher, h eh.EventHandler) {
+	group := b.group(m, h, true)
+	b.wg.Add(1)
+	go b.handle(m, h, group, true)
+}
+
+// Errors implements the Errors method of the eventhorizon.EventBus interface.
+func (b *EventBus) Errors() <-chan eh.EventBusError {
+	return b.errCh
+}
+
+// SetErrorHandler sets a handler that is called for all errors, instead of
+// sending them on the Errors channel.
+func (b *EventBus) SetErrorHandler(f eh.EventBusErrorHandler) {
+	b.errHandlerMu.Lock()
+	defer b.errHandlerMu.Unlock()
+	b.errHandler = f
+}
+
+// SetMaxAttempts sets the number of times a failing handler is called with an
+// event before the event is acked and skipped. It must be set before adding
+// handlers.
+func (b *EventBus) SetMaxAttempts(n int) {
+	b.maxAttempts = n
+}
+
+// SetMaxLen sets the approximate max number of events kept in the stream,
+// older events are trimmed when publishing. Zero disables trimming. It must be
+// set before publishing events.
+func (b *EventBus) SetMaxLen(n int64) {
+	b.maxLen = n
+}
+
+func (b *EventBus) error(err eh.EventBusError) {
+	err.BusName = "redis"
+
+	b.errHandlerMu.RLock()
+	f := b.errHandler
+	b.errHandlerMu.RUnlock()
+	if f != nil {
+		f(err)
+		return
+	}
+
+	select {
+	case b.errCh <- err:
+	default:
+	}
+}
+
+// Close stops all handlers, destroys the consumer groups of the observers and
+// closes the Redis client. The first error is returned, the client is always
+// closed.
+func (b *EventBus) Close() error {
+	close(b.done)
+	b.wg.Wait()
+
+	b.registeredMu.RLock()
+	observers := b.observers
+	b.registeredMu.RUnlock()
+
+	var err error
+	for _, group := range observers {
+		if e := b.client.XGroupDestroy(b.stream, group).Err(); e != nil && err == nil {
+			err = errors.New("could not destroy consumer group: " + e.Error())
+		}
+	}
+
+	if e := b.client.Close(); e != nil && err == nil {
+		err = e
+	}
+	return err
+}
+
+// Checks the matcher and handler and creates the consumer group.
+func (b *EventBus) group(m eh.EventMatcher, h eh.EventHandler, observer bool) string {
+	b.registeredMu.Lock()
+	defer b.registeredMu.Unlock()
+
+	if m == nil {
+		panic("matcher can't be nil")
+	}
+	if h == nil {
+		panic("handler can't be nil")
+	}
+	if _, ok := b.registered[h.HandlerType()]; ok {
+		panic(fmt.Sprintf("multiple registrations for %s", h.HandlerType()))
+	}
+	b.registered[h.HandlerType()] = struct{}{}
+
+	id := string(h.HandlerType())
+	if observer { // Generate unique ID for each observer.
+		id = fmt.Sprintf("%s-%s", id, uuid.New())
+	}
+
+	// Create the consumer group, starting with new events only. An already
+	// existing group is fine, it is shared with the other handlers of the type.
+	group := b.appID + "_" + id
+	if err := b.client.XGroupCreateMkStream(b.stream, group, "$").Err(); err != nil &&
+		!strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		panic("could not create consumer group: " + err.Error())
+	}
+	if observer {
+		b.observers = append(b.observers, group)
+	}
+
+	return group
+}
+
+// Handles all events coming in on the stream for a consumer group.
+func (b *EventBus) handle(m eh.EventMatcher, h eh.EventHandler, group string, observer bool) {
+	defer b.wg.Done()
+
+	handler := b.handler(m, h, group, observer)
+	var lastClaim time.Time
+	for {
+		select {
+		case <-b.done:
+			return
+		default:
+		}
+
+		// Claim and handle events from crashed consumers, or events that
+		// previously failed.
+		if time.Since(lastClaim) >= b.claimIdleTime {
+			b.claim(group, handler)
+			lastClaim = time.Now()
+		}
+
+		streams, err := b.client.XReadGroup(&redis.XReadGroupArgs{
+			Group:    group,
+			Consumer: b.clientID,
+			Streams:  []string{b.stream, ">"},
+			Block:    DefaultBlockTime,
+		}).Result()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			select {
+			case <-b.done:
+				return
+			default:
+			}
+			b.error(eh.EventBusError{Err: errors.New("could not receive: " + err.Error()), Ctx: context.Background()})
+			time.Sleep(time.Second)
+			continue
+		}
+
+		for _, stream := range streams {
+			for _, msg := range stream.Messages {
+				handler(msg, 1)
+			}
+		}
+	}
+}
+
+// claim takes over pending events that have been idle for too long and
+// handles them again.
+func (b *EventBus) claim(group string, handler func(redis.XMessage, int)) {
+	pending, err := b.client.XPendingExt(&redis.XPendingExtArgs{
+		Stream: b.stream,
+		Group:  group,
+		Start:  "-",
+		End:    "+",
+		Count:  100,
+	}).Result()
+	if err == redis.Nil {
+		return
+	} else if err != nil {
+		b.error(eh.EventBusError{Err: errors.New("could not list pending events: " + err.Error()), Ctx: context.Background()})
+		return
+	}
+
+	ids := []string{}
+	deliveries := map[string]int{}
+	for _, p := range pending {
+		if p.Idle >= b.claimIdleTime {
+			ids = append(ids, p.Id)
+			deliveries[p.Id] = int(p.RetryCount)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	msgs, err := b.client.XClaim(&redis.XClaimArgs{
+		Stream:   b.stream,
+		Group:    group,
+		Consumer: b.clientID,
+		MinIdle:  b.claimIdleTime,
+		Messages: ids,
+	}).Result()
+	if err == redis.Nil {
+		return
+	} else if err != nil {
+		b.error(eh.EventBusError{Err: errors.New("could not claim pending events: " + err.Error()), Ctx: context.Background()})
+		return
+	}
+
+	// Claiming is a new delivery of the event.
+	for _, msg := range msgs {
+		handler(msg, deliveries[msg.ID]+1)
+	}
+}
+
+func (b *EventBus) handler(m eh.EventMatcher, h eh.EventHandler, group string, observer bool) func(msg redis.XMessage, attempt int) {
+	return func(msg redis.XMessage, attempt int) {
+		ctx := context.Background()
+
+		// Invalid events will never be handled, skip them.
+		raw, ok := msg.Values["event"].(string)
+		if !ok {
+			b.error(eh.EventBusError{Err: errors.New("could not unmarshal event: missing event data"), Ctx: ctx})
+			b.ack(ctx, group, msg.ID)
+			return
+		}
+
+		event, eventCtx, err := codec.UnmarshalEvent([]byte(raw))
+		if err != nil {
+			b.error(eh.EventBusError{Err: err, Ctx: ctx})
+			b.ack(ctx, group, msg.ID)
+			return
+		}
+
+		ctx = eventCtx
+
+		// Ack non-matching events directly, they will never be handled.
+		if !m(event) {
+			b.ack(ctx, group, msg.ID)
+			return
+		}
+
+		// Leave the event as pending on errors, it will be claimed again
+		// later, unless it was the last attempt.
+		if err := h.HandleEvent(ctx, event); err != nil {
+			b.error(eh.EventBusError{
+				Err:         err,
+				Ctx:         ctx,
+				Event:       event,
+				HandlerType: h.HandlerType(),
+				Observer:    observer,
+				Attempt:     attempt,
+			})
+			if attempt >= b.maxAttempts {
+				b.ack(ctx, group, msg.ID)
+			}
+			return
+		}
+
+		b.ack(ctx, group, msg.ID)
+	}
+}
+
+func (b *EventBus) ack(ctx context.Context, group, id string) {
+	if err := b.client.XAck(b.stream, group, id).Err(); err != nil {
+		b.error(eh.EventBusError{Err: errors.New("could not ack event: " + err.Error()), Ctx: ctx})
+	}
+}
@@ -0,0 +1,282 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package redis
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventbus"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventBus(t *testing.T) {
+	addr, closeRedis := redisAddr(t)
+	defer closeRedis()
+	appID := randomAppID(t)
+
+	bus1, err := NewEventBus(addr, appID, "client1")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus1.Close()
+
+	bus2, err := NewEventBus(addr, appID, "client2")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus2.Close()
+
+	eventbus.AcceptanceTest(t, bus1, bus2, time.Second)
+}
+
+func TestEventBus_ClaimPending(t *testing.T) {
+	addr, closeRedis := redisAddr(t)
+	defer closeRedis()
+	appID := randomAppID(t)
+
+	defaultClaimIdleTime := DefaultClaimIdleTime
+	DefaultClaimIdleTime = 10 * time.Millisecond
+	defer func() { DefaultClaimIdleTime = defaultClaimIdleTime }()
+
+	bus, err := NewEventBus(addr, appID, "client")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+
+	// Simulate a consumer that receives the event but crashes before acking.
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	stream := appID + "_events"
+	group := appID + "_handler"
+	if err := client.XGroupCreateMkStream(stream, group, "$").Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	ctx := context.Background()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"}, timestamp,
+		mocks.AggregateType, uuid.New(), 1)
+	if err := bus.PublishEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := client.XReadGroup(&redis.XReadGroupArgs{
+		Group:    group,
+		Consumer: "crashed",
+		Streams:  []string{stream, ">"},
+		Block:    -1,
+	}).Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	// The handler should claim the pending event.
+	time.Sleep(20 * time.Millisecond)
+	handler := mocks.NewEventHandler("handler")
+	bus.AddHandler(eh.MatchAny(), handler)
+	if !handler.Wait(time.Second) {
+		t.Fatal("did not receive event in time")
+	}
+	if !mocks.EqualEvents(handler.Events, []eh.Event{event}) {
+		t.Error("the events were incorrect:", handler.Events)
+	}
+
+	// The event should be acked after handling.
+	time.Sleep(10 * time.Millisecond)
+	pending, err := client.XPending(stream, group).Result()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if pending.Count != 0 {
+		t.Error("there should be no pending events:", pending.Count)
+	}
+}
+
+func TestEventBus_MaxAttempts(t *testing.T) {
+	addr, closeRedis := redisAddr(t)
+	defer closeRedis()
+	appID := randomAppID(t)
+
+	defaultClaimIdleTime := DefaultClaimIdleTime
+	DefaultClaimIdleTime = 10 * time.Millisecond
+	defer func() { DefaultClaimIdleTime = defaultClaimIdleTime }()
+	defaultBlockTime := DefaultBlockTime
+	DefaultBlockTime = 10 * time.Millisecond
+	defer func() { DefaultBlockTime = defaultBlockTime }()
+
+	bus, err := NewEventBus(addr, appID, "client")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	bus.SetMaxAttempts(2)
+
+	handler := mocks.NewEventHandler("handler")
+	handler.Err = errors.New("handler error")
+	bus.AddHandler(eh.MatchAny(), handler)
+
+	// The failing event should be acked after the last attempt.
+	ctx := context.Background()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"}, timestamp,
+		mocks.AggregateType, uuid.New(), 1)
+	if err := bus.PublishEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	for i := 1; i <= 2; i++ {
+		select {
+		case err := <-bus.Errors():
+			if err.Err != handler.Err || err.Attempt != i {
+				t.Error("the error should be correct:", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("there should be an error")
+		}
+	}
+
+	// Invalid events should be acked directly.
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	stream := appID + "_events"
+	if err := client.XAdd(&redis.XAddArgs{
+		Stream: stream,
+		Values: map[string]interface{}{"event": "invalid"},
+	}).Err(); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	select {
+	case err := <-bus.Errors():
+		if err.Event != nil {
+			t.Error("the error should be correct:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("there should be an error")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	pending, err := client.XPending(stream, appID+"_handler").Result()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if pending.Count != 0 {
+		t.Error("there should be no pending events:", pending.Count)
+	}
+	select {
+	case err := <-bus.Errors():
+		t.Error("there should be no more errors:", err)
+	default:
+	}
+}
+
+func TestEventBus_CloseObservers(t *testing.T) {
+	addr, closeRedis := redisAddr(t)
+	defer closeRedis()
+	appID := randomAppID(t)
+
+	bus, err := NewEventBus(addr, appID, "client")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	bus.AddHandler(eh.MatchAny(), mocks.NewEventHandler("handler"))
+	bus.AddObserver(eh.MatchAny(), mocks.NewEventHandler("observer"))
+
+	if len(bus.observers) != 1 {
+		t.Fatal("there should be one observer group:", bus.observers)
+	}
+	observerGroup := bus.observers[0]
+
+	// Only the consumer group of the handler should be kept.
+	if err := bus.Close(); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	stream := appID + "_events"
+	if err := client.XPending(stream, appID+"_handler").Err(); err != nil {
+		t.Error("the handler group should be kept:", err)
+	}
+	if err := client.XPending(stream, observerGroup).Err(); err == nil ||
+		!strings.HasPrefix(err.Error(), "NOGROUP") {
+		t.Error("the observer group should be destroyed:", err)
+	}
+}
+
+func TestEventBus_MaxLen(t *testing.T) {
+	addr, closeRedis := redisAddr(t)
+	defer closeRedis()
+	appID := randomAppID(t)
+
+	bus, err := NewEventBus(addr, appID, "client")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer bus.Close()
+	bus.SetMaxLen(10)
+
+	ctx := context.Background()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	for i := 0; i < 1000; i++ {
+		event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event"}, timestamp,
+			mocks.AggregateType, uuid.New(), 1)
+		if err := bus.PublishEvent(ctx, event); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}
+
+	// The trimming is approximate, but the stream should not keep all events.
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	defer client.Close()
+	n, err := client.XLen(appID + "_events").Result()
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if n >= 1000 {
+		t.Error("the stream should be trimmed:", n)
+	}
+}
+
+// redisAddr returns the address of the Redis server to use, starting an in
+// process server if REDIS_HOST is not set.
+func redisAddr(t *testing.T) (string, func()) {
+	if addr := os.Getenv("REDIS_HOST"); addr != "" {
+		return addr, func() {}
+	}
+
+	s, err := miniredis.Run()
+	if err != nil {
+		t.Fatal("could not start Redis server:", err)
+	}
+	return s.Addr(), s.Close
+}
+
+// randomAppID returns a random app ID, to not share streams between tests.
+func randomAppID(t *testing.T) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return "app-" + hex.EncodeToString(b)
+}
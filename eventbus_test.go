@@ -15,7 +15,9 @@
 package eventhorizon
 
 import (
+	"context"
 	"errors"
+	"reflect"
 	"testing"
 	"time"
 )
@@ -25,24 +27,28 @@ func TestEventBusError(t *testing.T) {
 		name              string
 		err               error
 		event             Event
+		handlerType       EventHandlerType
 		expectedErrorText string
 	}{
 		{
 			"both non-nil",
 			errors.New("some error"),
 			NewEvent("some event type", nil, time.Time{}),
+			"",
 			"some error: (some event type@0)",
 		},
 		{
 			"error nil",
 			nil,
 			NewEvent("some event type", nil, time.Time{}),
+			"",
 			"%!s(<nil>): (some event type@0)",
 		},
 		{
 			"event nil",
 			errors.New("some error"),
 			nil,
+			"",
 			"some error: (%!s(<nil>))",
 		},
 
@@ -50,15 +56,24 @@ func TestEventBusError(t *testing.T) {
 			"both nil",
 			nil,
 			nil,
+			"",
 			"%!s(<nil>): (%!s(<nil>))",
 		},
+		{
+			"with handler type",
+			errors.New("some error"),
+			NewEvent("some event type", nil, time.Time{}),
+			"some_handler",
+			"could not handle event (some_handler): some error: (some event type@0)",
+		},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			busError := EventBusError{
-				Err:   tc.err,
-				Event: tc.event,
+				Err:         tc.err,
+				Event:       tc.event,
+				HandlerType: tc.handlerType,
 			}
 
 			if busError.Error() != tc.expectedErrorText {
@@ -70,3 +85,103 @@ func TestEventBusError(t *testing.T) {
 		})
 	}
 }
+
+func TestEventBusMiddleware(t *testing.T) {
+	order := []string{}
+	publishMiddleware := func(s string) PublishEventMiddleware {
+		return PublishEventMiddleware(func(publish PublishEventFunc) PublishEventFunc {
+			return func(ctx context.Context, e Event) error {
+				order = append(order, "publish-"+s)
+				return publish(ctx, e)
+			}
+		})
+	}
+	dispatchMiddleware := func(s string) EventHandlerMiddleware {
+		return EventHandlerMiddleware(func(h EventHandler) EventHandler {
+			return EventHandlerFunc(func(ctx context.Context, e Event) error {
+				order = append(order, "dispatch-"+s)
+				return h.HandleEvent(ctx, e)
+			})
+		})
+	}
+
+	// Events are dispatched in the reverse order, the events goes out
+	// through the middleware chain.
+	inner := &testEventBus{}
+	b := UseEventBusMiddleware(inner,
+		NewEventBusMiddleware(publishMiddleware("first"), dispatchMiddleware("first")),
+		NewEventBusMiddleware(publishMiddleware("second"), nil),
+		NewEventBusMiddleware(nil, dispatchMiddleware("second")),
+	)
+
+	handler := &testEventHandler{handlerType: "handler"}
+	b.AddHandler(MatchAny(), handler)
+	observer := &testEventHandler{handlerType: "observer"}
+	b.AddObserver(MatchAny(), observer)
+	if len(inner.handlers) != 2 {
+		t.Fatal("there should be two handlers:", inner.handlers)
+	}
+	if inner.handlers[0].HandlerType() != "handler" {
+		t.Error("the handler type should be kept:", inner.handlers[0].HandlerType())
+	}
+	if inner.handlers[1].HandlerType() != "observer" {
+		t.Error("the observer type should be kept:", inner.handlers[1].HandlerType())
+	}
+
+	e := NewEvent("test", nil, time.Now())
+	if err := b.PublishEvent(context.Background(), e); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(order, []string{
+		"publish-first", "publish-second",
+		"dispatch-second", "dispatch-first",
+		"dispatch-second", "dispatch-first",
+	}) {
+		t.Error("the order of middleware should be correct:", order)
+	}
+	if !reflect.DeepEqual(handler.events, []Event{e}) {
+		t.Error("the handler events should be correct:", handler.events)
+	}
+	if !reflect.DeepEqual(observer.events, []Event{e}) {
+		t.Error("the observer events should be correct:", observer.events)
+	}
+}
+
+type testEventBus struct {
+	handlers []EventHandler
+}
+
+func (b *testEventBus) PublishEvent(ctx context.Context, e Event) error {
+	for _, h := range b.handlers {
+		if err := h.HandleEvent(ctx, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *testEventBus) AddHandler(m EventMatcher, h EventHandler) {
+	b.handlers = append(b.handlers, h)
+}
+
+func (b *testEventBus) AddObserver(m EventMatcher, h EventHandler) {
+	b.handlers = append(b.handlers, h)
+}
+
+func (b *testEventBus) Errors() <-chan EventBusError {
+	return nil
+}
+
+type testEventHandler struct {
+	handlerType EventHandlerType
+	events      []Event
+}
+
+func (h *testEventHandler) HandlerType() EventHandlerType {
+	return h.handlerType
+}
+
+func (h *testEventHandler) HandleEvent(ctx context.Context, e Event) error {
+	h.events = append(h.events, e)
+	return nil
+}
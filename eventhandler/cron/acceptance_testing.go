@@ -0,0 +1,126 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// LeaseStoreAcceptanceTest is the acceptance test that all implementations of
+// LeaseStore should pass. It should manually be called from a test case in each
+// implementation:
+//
+//   func TestLeaseStore(t *testing.T) {
+//       store := NewLeaseStore()
+//       cron.LeaseStoreAcceptanceTest(t, store)
+//   }
+//
+func LeaseStoreAcceptanceTest(t *testing.T, store LeaseStore) {
+	ctx := context.Background()
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	t.Log("acquire a new lease")
+	last, ok, err := store.AcquireLease(ctx, "schedule", "owner1", now, now.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !ok {
+		t.Error("the lease should be acquired")
+	}
+	if !last.IsZero() {
+		t.Error("there should be no last tick:", last)
+	}
+
+	t.Log("acquire a held lease by another owner")
+	_, ok, err = store.AcquireLease(ctx, "schedule", "owner2", now.Add(time.Second), now.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if ok {
+		t.Error("the lease should not be acquired")
+	}
+
+	t.Log("acquire a lease for another schedule")
+	_, ok, err = store.AcquireLease(ctx, "other", "owner2", now, now.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !ok {
+		t.Error("the lease should be acquired")
+	}
+
+	t.Log("save a tick")
+	tick := now.Add(10 * time.Second)
+	if err := store.SaveTick(ctx, "schedule", "owner1", tick); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.SaveTick(ctx, "schedule", "owner2", tick); err != ErrLeaseLost {
+		t.Error("there should be a lease lost error:", err)
+	}
+
+	t.Log("acquire a held lease by the same owner")
+	last, ok, err = store.AcquireLease(ctx, "schedule", "owner1", now.Add(time.Second), now.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !ok {
+		t.Error("the lease should be acquired")
+	}
+	if !last.Equal(tick) {
+		t.Error("the last tick should be correct:", last)
+	}
+
+	t.Log("release the lease")
+	if err := store.ReleaseLease(ctx, "schedule", "owner2"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	_, ok, err = store.AcquireLease(ctx, "schedule", "owner2", now.Add(time.Second), now.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if ok {
+		t.Error("the lease should not be released by another owner")
+	}
+	if err := store.ReleaseLease(ctx, "schedule", "owner1"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	last, ok, err = store.AcquireLease(ctx, "schedule", "owner2", now.Add(time.Second), now.Add(time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !ok {
+		t.Error("the lease should be acquired")
+	}
+	if !last.Equal(tick) {
+		t.Error("the last tick should be correct:", last)
+	}
+
+	t.Log("acquire an expired lease")
+	last, ok, err = store.AcquireLease(ctx, "schedule", "owner1", now.Add(2*time.Minute), now.Add(3*time.Minute))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !ok {
+		t.Error("the lease should be acquired")
+	}
+	if !last.Equal(tick) {
+		t.Error("the last tick should be correct:", last)
+	}
+	if err := store.SaveTick(ctx, "schedule", "owner2", tick); err != ErrLeaseLost {
+		t.Error("there should be a lease lost error:", err)
+	}
+}
@@ -16,8 +16,10 @@ package cron
 
 import (
 	"context"
+	"sync"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/gorhill/cronexpr"
 
 	eh "github.com/looplab/eventhorizon"
@@ -30,6 +32,12 @@ type EventHandler struct {
 
 	eventsCh chan data
 	errCh    chan error
+
+	// The ID of the instance, used as owner of leases.
+	id          string
+	leases      LeaseStore
+	schedules   map[string]*schedule
+	schedulesMu sync.RWMutex
 }
 
 var _ = eh.EventHandler(&EventHandler{})
@@ -40,6 +48,8 @@ func NewEventHandler(eventHandler eh.EventHandler) *EventHandler {
 		EventHandler: eventHandler,
 		eventsCh:     make(chan data),
 		errCh:        make(chan error, 1),
+		id:           uuid.New().String(),
+		schedules:    map[string]*schedule{},
 	}
 
 	go h.run()
@@ -50,7 +60,8 @@ func NewEventHandler(eventHandler eh.EventHandler) *EventHandler {
 // ScheduleEvent schedules an event to be sent on regular intervals, using
 // a line in the crontab format to setup the timing. The eventFunc should create
 // the event to send given the triggered time as input. Cancelling the context
-// will stop the triggering of more events.
+// will stop the triggering of more events. The events are sent by each
+// instance, use Schedule to send them from one instance per tick.
 func (h *EventHandler) ScheduleEvent(ctx context.Context, cronLine string, eventFunc func(time.Time) eh.Event) error {
 	expr, err := cronexpr.Parse(cronLine)
 	if err != nil {
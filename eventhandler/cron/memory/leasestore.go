@@ -0,0 +1,90 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/looplab/eventhorizon/eventhandler/cron"
+)
+
+// LeaseStore implements cron.LeaseStore as an in memory structure. It can
+// only be shared by handlers in the same process.
+type LeaseStore struct {
+	leases   map[string]*entry
+	leasesMu sync.Mutex
+}
+
+var _ = cron.LeaseStore(&LeaseStore{})
+
+type entry struct {
+	owner    string
+	until    time.Time
+	lastTick time.Time
+}
+
+// NewLeaseStore creates a new LeaseStore using memory as storage.
+func NewLeaseStore() *LeaseStore {
+	return &LeaseStore{
+		leases: map[string]*entry{},
+	}
+}
+
+// AcquireLease implements the AcquireLease method of the cron.LeaseStore interface.
+func (s *LeaseStore) AcquireLease(ctx context.Context, scheduleID, owner string, now, until time.Time) (time.Time, bool, error) {
+	s.leasesMu.Lock()
+	defer s.leasesMu.Unlock()
+
+	e, ok := s.leases[scheduleID]
+	if !ok {
+		e = &entry{}
+		s.leases[scheduleID] = e
+	} else if e.owner != owner && e.until.After(now) {
+		return time.Time{}, false, nil
+	}
+	e.owner = owner
+	e.until = until
+
+	return e.lastTick, true, nil
+}
+
+// SaveTick implements the SaveTick method of the cron.LeaseStore interface.
+func (s *LeaseStore) SaveTick(ctx context.Context, scheduleID, owner string, tick time.Time) error {
+	s.leasesMu.Lock()
+	defer s.leasesMu.Unlock()
+
+	e, ok := s.leases[scheduleID]
+	if !ok || e.owner != owner {
+		return cron.ErrLeaseLost
+	}
+	e.lastTick = tick
+
+	return nil
+}
+
+// ReleaseLease implements the ReleaseLease method of the cron.LeaseStore interface.
+func (s *LeaseStore) ReleaseLease(ctx context.Context, scheduleID, owner string) error {
+	s.leasesMu.Lock()
+	defer s.leasesMu.Unlock()
+
+	if e, ok := s.leases[scheduleID]; ok && e.owner == owner {
+		e.owner = ""
+		e.until = time.Time{}
+	}
+
+	return nil
+}
@@ -0,0 +1,152 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+
+	"github.com/looplab/eventhorizon/eventhandler/cron"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// LeaseStore implements a cron.LeaseStore for MongoDB. The leases are stored
+// in the "cron_leases" collection in the DB with the DB prefix as name. Leases
+// are acquired atomically, so handlers in several processes can share the
+// store.
+type LeaseStore struct {
+	session *mgo.Session
+	dbName  string
+}
+
+var _ = cron.LeaseStore(&LeaseStore{})
+
+// NewLeaseStore creates a new LeaseStore.
+func NewLeaseStore(url, dbPrefix string) (*LeaseStore, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewLeaseStoreWithSession(session, dbPrefix)
+}
+
+// NewLeaseStoreWithSession creates a new LeaseStore with a session.
+func NewLeaseStoreWithSession(session *mgo.Session, dbPrefix string) (*LeaseStore, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &LeaseStore{
+		session: session,
+		dbName:  dbPrefix,
+	}
+
+	return s, nil
+}
+
+// AcquireLease implements the AcquireLease method of the cron.LeaseStore interface.
+func (s *LeaseStore) AcquireLease(ctx context.Context, scheduleID, owner string, now, until time.Time) (time.Time, bool, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	// The upsert fails with a duplicate key if the lease is held by another
+	// owner, as the query will not match the existing document.
+	query := bson.M{
+		"_id": scheduleID,
+		"$or": []bson.M{
+			{"until": bson.M{"$lte": now}},
+			{"owner": owner},
+		},
+	}
+	change := mgo.Change{
+		Update:    bson.M{"$set": bson.M{"owner": owner, "until": until}},
+		Upsert:    true,
+		ReturnNew: true,
+	}
+
+	var l dbLease
+	_, err := sess.DB(s.dbName).C("cron_leases").Find(query).Apply(change, &l)
+	if mgo.IsDup(err) {
+		return time.Time{}, false, nil
+	} else if err != nil {
+		return time.Time{}, false, err
+	}
+
+	if l.LastTick.IsZero() {
+		return time.Time{}, true, nil
+	}
+	return l.LastTick.UTC(), true, nil
+}
+
+// SaveTick implements the SaveTick method of the cron.LeaseStore interface.
+func (s *LeaseStore) SaveTick(ctx context.Context, scheduleID, owner string, tick time.Time) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.dbName).C("cron_leases").Update(
+		bson.M{"_id": scheduleID, "owner": owner},
+		bson.M{"$set": bson.M{"last_tick": tick}},
+	)
+	if err == mgo.ErrNotFound {
+		return cron.ErrLeaseLost
+	}
+	return err
+}
+
+// ReleaseLease implements the ReleaseLease method of the cron.LeaseStore interface.
+func (s *LeaseStore) ReleaseLease(ctx context.Context, scheduleID, owner string) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.dbName).C("cron_leases").Update(
+		bson.M{"_id": scheduleID, "owner": owner},
+		bson.M{"$set": bson.M{"owner": "", "until": time.Time{}}},
+	)
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+	return err
+}
+
+// Clear clears the lease storage.
+func (s *LeaseStore) Clear(ctx context.Context) error {
+	return s.session.DB(s.dbName).C("cron_leases").DropCollection()
+}
+
+// Close closes the database session.
+func (s *LeaseStore) Close() {
+	s.session.Close()
+}
+
+// dbLease is the DB representation of a lease.
+type dbLease struct {
+	ID       string    `bson:"_id"`
+	Owner    string    `bson:"owner"`
+	Until    time.Time `bson:"until"`
+	LastTick time.Time `bson:"last_tick"`
+}
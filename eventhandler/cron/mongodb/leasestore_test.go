@@ -0,0 +1,50 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/looplab/eventhorizon/eventhandler/cron"
+)
+
+func TestLeaseStore(t *testing.T) {
+	// Local Mongo testing with Docker
+	url := os.Getenv("MONGO_HOST")
+
+	if url == "" {
+		// Default to localhost
+		url = "localhost:27017"
+	}
+
+	store, err := NewLeaseStore(url, "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+	defer store.Close()
+
+	defer func() {
+		t.Log("clearing db")
+		if err = store.Clear(context.Background()); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+	cron.LeaseStoreAcceptanceTest(t, store)
+}
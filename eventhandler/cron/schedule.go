@@ -0,0 +1,271 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// LeaseStore stores leases and the last fired ticks of schedules, to fire
+// each tick of a schedule from only one instance.
+type LeaseStore interface {
+	// AcquireLease acquires the lease of a schedule for the owner until a
+	// time, if the lease is free, has expired at now or is already held by
+	// the owner. It returns the last fired tick, or the zero time if there is
+	// none, and if the lease was acquired.
+	AcquireLease(ctx context.Context, scheduleID, owner string, now, until time.Time) (time.Time, bool, error)
+
+	// SaveTick saves the last fired tick of a schedule. It returns
+	// ErrLeaseLost if the lease is not held by the owner.
+	SaveTick(ctx context.Context, scheduleID, owner string, tick time.Time) error
+
+	// ReleaseLease releases the lease of a schedule if it is held by the owner.
+	ReleaseLease(ctx context.Context, scheduleID, owner string) error
+}
+
+// CatchUpPolicy is the policy for ticks that were missed, for example when
+// all instances were down.
+type CatchUpPolicy int
+
+const (
+	// CatchUpSkip skips all missed ticks.
+	CatchUpSkip CatchUpPolicy = iota
+	// CatchUpOnce fires the last missed tick once.
+	CatchUpOnce
+	// CatchUpAll fires all missed ticks, up to MaxCatchUpTicks.
+	CatchUpAll
+)
+
+// Schedule is a schedule that is fired by the EventHandler.
+type Schedule struct {
+	ID       string
+	CronLine string
+	CatchUp  CatchUpPolicy
+	// Next is the time of the next tick.
+	Next time.Time
+}
+
+// ErrLeaseStoreNotSet is when a schedule is added without a lease store.
+var ErrLeaseStoreNotSet = errors.New("lease store not set")
+
+// ErrLeaseLost is when a lease is not held by the owner anymore.
+var ErrLeaseLost = errors.New("lease lost")
+
+// ErrScheduleExists is when a schedule with the same ID already exists.
+var ErrScheduleExists = errors.New("schedule already exists")
+
+// ErrScheduleNotFound is when a schedule could not be found.
+var ErrScheduleNotFound = errors.New("schedule not found")
+
+// DefaultLeaseDuration is the default duration of the leases for firing a
+// tick, it should be longer than the time to handle the events.
+var DefaultLeaseDuration = time.Minute
+
+// MaxCatchUpTicks is the max number of missed ticks that are fired with the
+// CatchUpAll policy, the oldest ticks are skipped.
+var MaxCatchUpTicks = 1000
+
+type schedule struct {
+	Schedule
+	expr      *cronexpr.Expression
+	eventFunc func(time.Time) eh.Event
+	cancel    context.CancelFunc
+}
+
+// SetLeaseStore sets the store for leases, which is needed by Schedule.
+func (h *EventHandler) SetLeaseStore(s LeaseStore) {
+	h.leases = s
+}
+
+// Schedule schedules an event to be sent on regular intervals in the same way
+// as ScheduleEvent, but only from one of the instances that have the schedule
+// for each tick, using leases from the lease store. The ID should be the same
+// for the schedule in all instances. The last fired tick is kept in the lease
+// store, and ticks that were missed when no instance was running are handled
+// with the catch up policy when the schedule is added.
+func (h *EventHandler) Schedule(ctx context.Context, id, cronLine string, catchUp CatchUpPolicy, eventFunc func(time.Time) eh.Event) error {
+	if h.leases == nil {
+		return ErrLeaseStoreNotSet
+	}
+	expr, err := cronexpr.Parse(cronLine)
+	if err != nil {
+		return err
+	}
+
+	h.schedulesMu.Lock()
+	defer h.schedulesMu.Unlock()
+	if _, ok := h.schedules[id]; ok {
+		return ErrScheduleExists
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	s := &schedule{
+		Schedule: Schedule{
+			ID:       id,
+			CronLine: cronLine,
+			CatchUp:  catchUp,
+		},
+		expr:      expr,
+		eventFunc: eventFunc,
+		cancel:    cancel,
+	}
+	h.schedules[id] = s
+
+	go func() {
+		defer h.remove(s)
+
+		// Catch up on missed ticks.
+		if err := h.fire(ctx, s, time.Now(), false); err != nil {
+			h.error(err)
+		}
+
+		for {
+			nextTime := expr.Next(time.Now())
+			h.schedulesMu.Lock()
+			s.Next = nextTime
+			h.schedulesMu.Unlock()
+
+			select {
+			case <-time.After(nextTime.Sub(time.Now())):
+				if err := h.fire(ctx, s, nextTime, true); err != nil {
+					h.error(err)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Schedules returns the schedules added with Schedule, ordered by ID.
+func (h *EventHandler) Schedules() []Schedule {
+	h.schedulesMu.RLock()
+	defer h.schedulesMu.RUnlock()
+
+	schedules := make([]Schedule, 0, len(h.schedules))
+	for _, s := range h.schedules {
+		schedules = append(schedules, s.Schedule)
+	}
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].ID < schedules[j].ID
+	})
+
+	return schedules
+}
+
+// Cancel cancels a schedule added with Schedule.
+func (h *EventHandler) Cancel(id string) error {
+	h.schedulesMu.Lock()
+	defer h.schedulesMu.Unlock()
+
+	s, ok := h.schedules[id]
+	if !ok {
+		return ErrScheduleNotFound
+	}
+	s.cancel()
+	delete(h.schedules, id)
+
+	return nil
+}
+
+// fire fires the ticks up to now if the lease can be acquired. The current
+// tick is fired if now is a tick, the missed ticks before according to the
+// catch up policy.
+func (h *EventHandler) fire(ctx context.Context, s *schedule, now time.Time, current bool) error {
+	last, ok, err := h.leases.AcquireLease(ctx, s.ID, h.id, time.Now(), time.Now().Add(DefaultLeaseDuration))
+	if err != nil {
+		return err
+	} else if !ok {
+		return nil
+	}
+	defer func() {
+		if err := h.leases.ReleaseLease(ctx, s.ID, h.id); err != nil {
+			h.error(err)
+		}
+	}()
+
+	// Start from now for new schedules.
+	if last.IsZero() {
+		if current {
+			return h.fireTicks(ctx, s, []time.Time{now})
+		}
+		return h.leases.SaveTick(ctx, s.ID, h.id, now)
+	}
+
+	// Find the missed ticks, the tick has already been fired if it is not
+	// after the last tick.
+	var missed []time.Time
+	for t := s.expr.Next(last); !t.IsZero() && t.Before(now); t = s.expr.Next(t) {
+		missed = append(missed, t)
+		if len(missed) > MaxCatchUpTicks {
+			missed = missed[1:]
+		}
+	}
+	if current && !now.After(last) {
+		current = false
+	}
+
+	var ticks []time.Time
+	switch s.CatchUp {
+	case CatchUpOnce:
+		if len(missed) > 0 {
+			ticks = append(ticks, missed[len(missed)-1])
+		}
+	case CatchUpAll:
+		ticks = append(ticks, missed...)
+	}
+	if current {
+		ticks = append(ticks, now)
+	}
+
+	return h.fireTicks(ctx, s, ticks)
+}
+
+// fireTicks handles the events of the ticks and saves the last tick after
+// each event.
+func (h *EventHandler) fireTicks(ctx context.Context, s *schedule, ticks []time.Time) error {
+	for _, t := range ticks {
+		if err := h.HandleEvent(ctx, s.eventFunc(t)); err != nil {
+			return err
+		}
+		if err := h.leases.SaveTick(ctx, s.ID, h.id, t); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (h *EventHandler) remove(s *schedule) {
+	h.schedulesMu.Lock()
+	defer h.schedulesMu.Unlock()
+	if h.schedules[s.ID] == s {
+		delete(h.schedules, s.ID)
+	}
+}
+
+func (h *EventHandler) error(err error) {
+	select {
+	case h.errCh <- err:
+	default:
+	}
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cron
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorhill/cronexpr"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler_Schedule(t *testing.T) {
+	h := mocks.NewEventHandler("test")
+	store := &testLeaseStore{leases: map[string]*testLease{}}
+	cron1 := NewEventHandler(h)
+	cron2 := NewEventHandler(h)
+
+	eventFunc := func(t time.Time) eh.Event {
+		return eh.NewEvent(mocks.EventType, nil, t)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := cron1.Schedule(ctx, "schedule", "* * * * * * *", CatchUpSkip, eventFunc); err != ErrLeaseStoreNotSet {
+		t.Error("there should be a lease store not set error:", err)
+	}
+
+	cron1.SetLeaseStore(store)
+	cron2.SetLeaseStore(store)
+	if err := cron1.Schedule(ctx, "schedule", "* * * * * * *", CatchUpSkip, eventFunc); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := cron1.Schedule(ctx, "schedule", "* * * * * * *", CatchUpSkip, eventFunc); err != ErrScheduleExists {
+		t.Error("there should be a schedule exists error:", err)
+	}
+	if err := cron2.Schedule(ctx, "schedule", "* * * * * * *", CatchUpSkip, eventFunc); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("each tick should be fired once")
+	ticks := map[time.Time]int{}
+	timeout := time.After(3 * time.Second)
+	for len(ticks) < 2 {
+		select {
+		case e := <-h.Recv:
+			ticks[e.Timestamp()]++
+		case <-timeout:
+			t.Fatal("there should be events:", ticks)
+		}
+	}
+	for tick, n := range ticks {
+		if n != 1 {
+			t.Error("the tick should be fired once:", tick, n)
+		}
+	}
+
+	t.Log("list and cancel schedules")
+	schedules := cron1.Schedules()
+	if len(schedules) != 1 || schedules[0].ID != "schedule" ||
+		schedules[0].CronLine != "* * * * * * *" || schedules[0].CatchUp != CatchUpSkip {
+		t.Error("the schedules should be correct:", schedules)
+	}
+	if err := cron1.Cancel("schedule"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := cron1.Cancel("schedule"); err != ErrScheduleNotFound {
+		t.Error("there should be a schedule not found error:", err)
+	}
+	if schedules := cron1.Schedules(); len(schedules) != 0 {
+		t.Error("there should be no schedules:", schedules)
+	}
+	if err := cron2.Cancel("schedule"); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	select {
+	case err := <-cron1.Error():
+		t.Error("there should be no error:", err)
+	case err := <-cron2.Error():
+		t.Error("there should be no error:", err)
+	default:
+	}
+}
+
+func TestEventHandler_CatchUp(t *testing.T) {
+	last := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	now := last.Add(5 * time.Second)
+
+	testCases := map[string]struct {
+		policy   CatchUpPolicy
+		current  bool
+		expected []time.Time
+	}{
+		"skip": {
+			CatchUpSkip,
+			false,
+			nil,
+		},
+		"skip with current tick": {
+			CatchUpSkip,
+			true,
+			[]time.Time{now},
+		},
+		"once": {
+			CatchUpOnce,
+			false,
+			[]time.Time{last.Add(4 * time.Second)},
+		},
+		"once with current tick": {
+			CatchUpOnce,
+			true,
+			[]time.Time{last.Add(4 * time.Second), now},
+		},
+		"all": {
+			CatchUpAll,
+			false,
+			[]time.Time{
+				last.Add(1 * time.Second),
+				last.Add(2 * time.Second),
+				last.Add(3 * time.Second),
+				last.Add(4 * time.Second),
+			},
+		},
+		"all with current tick": {
+			CatchUpAll,
+			true,
+			[]time.Time{
+				last.Add(1 * time.Second),
+				last.Add(2 * time.Second),
+				last.Add(3 * time.Second),
+				last.Add(4 * time.Second),
+				now,
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			h := mocks.NewEventHandler("test")
+			store := &testLeaseStore{leases: map[string]*testLease{
+				"schedule": {lastTick: last},
+			}}
+			cron := NewEventHandler(h)
+			cron.SetLeaseStore(store)
+
+			s := &schedule{
+				Schedule: Schedule{ID: "schedule", CatchUp: tc.policy},
+				expr:     cronexpr.MustParse("* * * * * * *"),
+				eventFunc: func(t time.Time) eh.Event {
+					return eh.NewEvent(mocks.EventType, nil, t)
+				},
+			}
+			if err := cron.fire(context.Background(), s, now, tc.current); err != nil {
+				t.Error("there should be no error:", err)
+			}
+
+			var ticks []time.Time
+			for _, e := range h.Events {
+				ticks = append(ticks, e.Timestamp())
+			}
+			if !reflect.DeepEqual(ticks, tc.expected) {
+				t.Error("the ticks should be correct:", ticks)
+			}
+			expectedLast := last
+			if len(tc.expected) > 0 {
+				expectedLast = tc.expected[len(tc.expected)-1]
+			}
+			if l := store.leases["schedule"]; !l.lastTick.Equal(expectedLast) || l.owner != "" {
+				t.Error("the lease should be correct:", l)
+			}
+		})
+	}
+}
+
+type testLease struct {
+	owner    string
+	until    time.Time
+	lastTick time.Time
+}
+
+type testLeaseStore struct {
+	leases map[string]*testLease
+	mu     sync.Mutex
+}
+
+func (s *testLeaseStore) AcquireLease(ctx context.Context, scheduleID, owner string, now, until time.Time) (time.Time, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leases[scheduleID]
+	if !ok {
+		l = &testLease{}
+		s.leases[scheduleID] = l
+	} else if l.owner != owner && l.until.After(now) {
+		return time.Time{}, false, nil
+	}
+	l.owner, l.until = owner, until
+	return l.lastTick, true, nil
+}
+
+func (s *testLeaseStore) SaveTick(ctx context.Context, scheduleID, owner string, tick time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.leases[scheduleID]
+	if !ok || l.owner != owner {
+		return ErrLeaseLost
+	}
+	l.lastTick = tick
+	return nil
+}
+
+func (s *testLeaseStore) ReleaseLease(ctx context.Context, scheduleID, owner string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l, ok := s.leases[scheduleID]; ok && l.owner == owner {
+		l.owner, l.until = "", time.Time{}
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projector
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// CheckpointStore stores how far projectors have processed the events of each
+// aggregate. The event stores have no global position for events, so the
+// checkpoints are the last processed version per aggregate, which also works
+// when events are appended to old aggregates.
+type CheckpointStore interface {
+	// LoadCheckpoint returns the last processed version of an aggregate for a
+	// projector type in the namespace of the context, or 0 if there is none.
+	LoadCheckpoint(ctx context.Context, projectorType Type, id uuid.UUID) (int, error)
+
+	// SaveCheckpoint saves the last processed version of an aggregate for a
+	// projector type in the namespace of the context.
+	SaveCheckpoint(ctx context.Context, projectorType Type, id uuid.UUID, version int) error
+}
+
+// ErrCheckpointStoreNotSet is when a checkpoint store is not set on the EventHandler.
+var ErrCheckpointStoreNotSet = errors.New("checkpoint store not set")
+
+// SetCheckpointStore sets a store for checkpoints. The EventHandler will then
+// skip events that already have been processed and save a checkpoint after
+// each projected event.
+func (h *EventHandler) SetCheckpointStore(s CheckpointStore) {
+	h.checkpoints = s
+}
+
+// CatchUp projects all events from the event store that have not yet been
+// processed according to the checkpoints, in the namespace of the context.
+// It is used to resume projecting after downtime, before or while handling
+// events from the event bus. The events of each aggregate are processed in
+// order, and the checkpoint is saved after each event.
+func (h *EventHandler) CatchUp(ctx context.Context, store eh.EventStoreStreamer) error {
+	return catchUp(ctx, store, h.checkpoints, h.projector.ProjectorType(), h.HandleEvent)
+}
+
+// catchUp streams all events and handles those that have not been processed.
+func catchUp(ctx context.Context, store eh.EventStoreStreamer, checkpoints CheckpointStore,
+	projectorType Type, handle func(context.Context, eh.Event) error) error {
+	if checkpoints == nil {
+		return Error{
+			Err:       ErrCheckpointStoreNotSet,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	err := store.StreamEvents(ctx, uuid.Nil, func(ctx context.Context, events []eh.Event) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+		version, err := checkpoints.LoadCheckpoint(ctx, projectorType, events[0].AggregateID())
+		if err != nil {
+			return err
+		}
+		for _, event := range events {
+			if event.Version() <= version {
+				continue
+			}
+			if err := handle(ctx, event); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if _, ok := err.(Error); err != nil && !ok {
+		return Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return err
+}
+
+// processed checks if an event already has been processed according to the
+// checkpoints, if there is a checkpoint store.
+func processed(ctx context.Context, checkpoints CheckpointStore, projectorType Type, event eh.Event) (bool, error) {
+	if checkpoints == nil {
+		return false, nil
+	}
+
+	version, err := checkpoints.LoadCheckpoint(ctx, projectorType, event.AggregateID())
+	if _, ok := err.(Error); ok {
+		return false, err
+	} else if err != nil {
+		return false, Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return event.Version() <= version, nil
+}
+
+// saveCheckpoint saves the version of the event as the checkpoint, if there is
+// a checkpoint store.
+func saveCheckpoint(ctx context.Context, checkpoints CheckpointStore, projectorType Type, event eh.Event) error {
+	if checkpoints == nil {
+		return nil
+	}
+
+	err := checkpoints.SaveCheckpoint(ctx, projectorType, event.AggregateID(), event.Version())
+	if _, ok := err.(Error); ok {
+		return err
+	} else if err != nil {
+		return Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return nil
+}
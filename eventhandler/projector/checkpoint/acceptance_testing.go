@@ -0,0 +1,104 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package checkpoint contains the acceptance test for implementations of the
+// projector.CheckpointStore, which are in the sub packages.
+package checkpoint
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/projector"
+)
+
+// AcceptanceTest is the acceptance test that all implementations of
+// projector.CheckpointStore should pass. It should manually be called from a
+// test case in each implementation:
+//
+//   func TestCheckpointStore(t *testing.T) {
+//       ctx := context.Background() // Or other when testing namespaces.
+//       store := NewCheckpointStore()
+//       checkpoint.AcceptanceTest(t, ctx, store)
+//   }
+//
+func AcceptanceTest(t *testing.T, ctx context.Context, store projector.CheckpointStore) {
+	projectorType := projector.Type("projector")
+	otherProjectorType := projector.Type("other_projector")
+	id := uuid.New()
+
+	t.Log("load missing checkpoint")
+	version, err := store.LoadCheckpoint(ctx, projectorType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 0 {
+		t.Error("the version should be 0:", version)
+	}
+
+	t.Log("save checkpoint")
+	if err := store.SaveCheckpoint(ctx, projectorType, id, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	version, err = store.LoadCheckpoint(ctx, projectorType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 1 {
+		t.Error("the version should be correct:", version)
+	}
+
+	t.Log("update checkpoint")
+	if err := store.SaveCheckpoint(ctx, projectorType, id, 3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	version, err = store.LoadCheckpoint(ctx, projectorType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 3 {
+		t.Error("the version should be correct:", version)
+	}
+
+	t.Log("checkpoint for other projector type")
+	version, err = store.LoadCheckpoint(ctx, otherProjectorType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 0 {
+		t.Error("the version should be 0:", version)
+	}
+
+	t.Log("checkpoint for other aggregate")
+	version, err = store.LoadCheckpoint(ctx, projectorType, uuid.New())
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 0 {
+		t.Error("the version should be 0:", version)
+	}
+
+	t.Log("checkpoint in other namespace")
+	otherCtx := eh.NewContextWithNamespace(ctx, "other_ns")
+	version, err = store.LoadCheckpoint(otherCtx, projectorType, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if version != 0 {
+		t.Error("the version should be 0:", version)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/projector"
+)
+
+// CheckpointStore implements projector.CheckpointStore as an in memory structure.
+type CheckpointStore struct {
+	// The outer map is with namespace as key.
+	db   map[string]map[key]int
+	dbMu sync.RWMutex
+}
+
+var _ = projector.CheckpointStore(&CheckpointStore{})
+
+type key struct {
+	projectorType projector.Type
+	id            uuid.UUID
+}
+
+// NewCheckpointStore creates a new CheckpointStore using memory as storage.
+func NewCheckpointStore() *CheckpointStore {
+	return &CheckpointStore{
+		db: map[string]map[key]int{},
+	}
+}
+
+// LoadCheckpoint implements the LoadCheckpoint method of the projector.CheckpointStore interface.
+func (s *CheckpointStore) LoadCheckpoint(ctx context.Context, projectorType projector.Type, id uuid.UUID) (int, error) {
+	s.dbMu.RLock()
+	defer s.dbMu.RUnlock()
+
+	return s.db[eh.NamespaceFromContext(ctx)][key{projectorType, id}], nil
+}
+
+// SaveCheckpoint implements the SaveCheckpoint method of the projector.CheckpointStore interface.
+func (s *CheckpointStore) SaveCheckpoint(ctx context.Context, projectorType projector.Type, id uuid.UUID, version int) error {
+	s.dbMu.Lock()
+	defer s.dbMu.Unlock()
+
+	ns := eh.NamespaceFromContext(ctx)
+	if _, ok := s.db[ns]; !ok {
+		s.db[ns] = map[key]int{}
+	}
+	s.db[ns][key{projectorType, id}] = version
+
+	return nil
+}
@@ -0,0 +1,154 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+
+	"github.com/globalsign/mgo"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/projector"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// ErrCouldNotClearDB is when the database could not be cleared.
+var ErrCouldNotClearDB = errors.New("could not clear database")
+
+// ErrCouldNotLoadCheckpoint is when a checkpoint could not be loaded.
+var ErrCouldNotLoadCheckpoint = errors.New("could not load checkpoint")
+
+// ErrCouldNotSaveCheckpoint is when a checkpoint could not be saved.
+var ErrCouldNotSaveCheckpoint = errors.New("could not save checkpoint")
+
+// CheckpointStore implements a projector.CheckpointStore for MongoDB.
+type CheckpointStore struct {
+	session  *mgo.Session
+	dbPrefix string
+}
+
+var _ = projector.CheckpointStore(&CheckpointStore{})
+
+// NewCheckpointStore creates a new CheckpointStore.
+func NewCheckpointStore(url, dbPrefix string) (*CheckpointStore, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewCheckpointStoreWithSession(session, dbPrefix)
+}
+
+// NewCheckpointStoreWithSession creates a new CheckpointStore with a session.
+func NewCheckpointStoreWithSession(session *mgo.Session, dbPrefix string) (*CheckpointStore, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &CheckpointStore{
+		session:  session,
+		dbPrefix: dbPrefix,
+	}
+
+	return s, nil
+}
+
+// LoadCheckpoint implements the LoadCheckpoint method of the projector.CheckpointStore interface.
+func (s *CheckpointStore) LoadCheckpoint(ctx context.Context, projectorType projector.Type, id uuid.UUID) (int, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	var c dbCheckpoint
+	err := sess.DB(s.dbName(ctx)).C("checkpoints").FindId(checkpointID(projectorType, id)).One(&c)
+	if err == mgo.ErrNotFound {
+		return 0, nil
+	} else if err != nil {
+		return 0, projector.Error{
+			Err:       ErrCouldNotLoadCheckpoint,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return c.Version, nil
+}
+
+// SaveCheckpoint implements the SaveCheckpoint method of the projector.CheckpointStore interface.
+func (s *CheckpointStore) SaveCheckpoint(ctx context.Context, projectorType projector.Type, id uuid.UUID, version int) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	cid := checkpointID(projectorType, id)
+	if _, err := sess.DB(s.dbName(ctx)).C("checkpoints").UpsertId(cid, dbCheckpoint{
+		ID:            cid,
+		ProjectorType: projectorType,
+		AggregateID:   id.String(),
+		Version:       version,
+	}); err != nil {
+		return projector.Error{
+			Err:       ErrCouldNotSaveCheckpoint,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return nil
+}
+
+// Clear clears the checkpoint storage.
+func (s *CheckpointStore) Clear(ctx context.Context) error {
+	if err := s.session.DB(s.dbName(ctx)).C("checkpoints").DropCollection(); err != nil {
+		return projector.Error{
+			Err:       ErrCouldNotClearDB,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+	return nil
+}
+
+// Close closes the database session.
+func (s *CheckpointStore) Close() {
+	s.session.Close()
+}
+
+// dbName appends the namespace, if one is set, to the DB prefix to
+// get the name of the DB to use.
+func (s *CheckpointStore) dbName(ctx context.Context) string {
+	ns := eh.NamespaceFromContext(ctx)
+	return s.dbPrefix + "_" + ns
+}
+
+// dbCheckpoint is the DB representation of a checkpoint.
+type dbCheckpoint struct {
+	ID            string         `bson:"_id"`
+	ProjectorType projector.Type `bson:"projector_type"`
+	AggregateID   string         `bson:"aggregate_id"`
+	Version       int            `bson:"version"`
+}
+
+func checkpointID(projectorType projector.Type, id uuid.UUID) string {
+	return string(projectorType) + "_" + id.String()
+}
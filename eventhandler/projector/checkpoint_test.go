@@ -0,0 +1,139 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+	"github.com/looplab/eventhorizon/mocks"
+	memoryrepo "github.com/looplab/eventhorizon/repo/memory"
+)
+
+func TestEventHandler_Checkpoints(t *testing.T) {
+	ctx := context.Background()
+	repo := memoryrepo.NewRepo()
+	projector := &replayProjector{}
+	handler := NewEventHandler(projector, repo)
+	handler.SetEntityFactory(func() eh.Entity {
+		return &mocks.Model{}
+	})
+	checkpoints := &testCheckpointStore{}
+	handler.SetCheckpointStore(checkpoints)
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "a"},
+		timestamp, mocks.AggregateType, id, 1)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if v, _ := checkpoints.LoadCheckpoint(ctx, projector.ProjectorType(), id); v != 1 {
+		t.Error("the checkpoint should be saved:", v)
+	}
+	checkReplayModel(t, ctx, repo, id, 1, "a")
+
+	// Already processed events should be skipped.
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if projector.projected != 1 {
+		t.Error("the event should only be projected once:", projector.projected)
+	}
+
+	// Checkpoint errors.
+	checkpointErr := errors.New("checkpoint error")
+	checkpoints.err = checkpointErr
+	event = eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "b"},
+		timestamp, mocks.AggregateType, id, 2)
+	if err := handler.HandleEvent(ctx, event); err == nil || err.(Error).Err != checkpointErr {
+		t.Error("there should be a checkpoint error:", err)
+	}
+}
+
+func TestEventHandler_CatchUp(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore()
+	id1 := uuid.New()
+	id2 := uuid.New()
+	saveReplayEvents(t, ctx, store, id1, 0, "a", "b")
+	saveReplayEvents(t, ctx, store, id2, 0, "c")
+
+	repo := memoryrepo.NewRepo()
+	projector := &replayProjector{}
+	handler := NewEventHandler(projector, repo)
+	handler.SetEntityFactory(func() eh.Entity {
+		return &mocks.Model{}
+	})
+	if err := handler.CatchUp(ctx, store); err == nil || err.(Error).Err != ErrCheckpointStoreNotSet {
+		t.Error("there should be a checkpoint store not set error:", err)
+	}
+
+	handler.SetCheckpointStore(&testCheckpointStore{})
+	if err := handler.CatchUp(ctx, store); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	checkReplayModel(t, ctx, repo, id1, 2, "ab")
+	checkReplayModel(t, ctx, repo, id2, 1, "c")
+
+	// Catching up again should only project new events.
+	saveReplayEvents(t, ctx, store, id1, 2, "d")
+	projector.projected = 0
+	if err := handler.CatchUp(ctx, store); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if projector.projected != 1 {
+		t.Error("only new events should be projected:", projector.projected)
+	}
+	checkReplayModel(t, ctx, repo, id1, 3, "abd")
+
+	// Projection errors should stop the catch up.
+	saveReplayEvents(t, ctx, store, id2, 1, "e")
+	projector.failOn = "e"
+	if err := handler.CatchUp(ctx, store); err == nil || err.(Error).Err != errReplay {
+		t.Error("there should be a replay error:", err)
+	}
+}
+
+// testCheckpointStore is a minimal checkpoint store, the real ones can not be
+// used here as they import this package.
+type testCheckpointStore struct {
+	checkpoints map[string]int
+	err         error
+}
+
+func (s *testCheckpointStore) LoadCheckpoint(ctx context.Context, projectorType Type, id uuid.UUID) (int, error) {
+	if s.err != nil {
+		return 0, s.err
+	}
+	return s.checkpoints[string(projectorType)+id.String()], nil
+}
+
+func (s *testCheckpointStore) SaveCheckpoint(ctx context.Context, projectorType Type, id uuid.UUID, version int) error {
+	if s.err != nil {
+		return s.err
+	}
+	if s.checkpoints == nil {
+		s.checkpoints = map[string]int{}
+	}
+	s.checkpoints[string(projectorType)+id.String()] = version
+	return nil
+}
@@ -23,9 +23,10 @@ import (
 
 // EventHandler is a CQRS projection handler to run a Projector implementation.
 type EventHandler struct {
-	projector Projector
-	repo      eh.ReadWriteRepo
-	factoryFn func() eh.Entity
+	projector   Projector
+	repo        eh.ReadWriteRepo
+	factoryFn   func() eh.Entity
+	checkpoints CheckpointStore
 }
 
 var _ = eh.EventHandler(&EventHandler{})
@@ -81,6 +82,13 @@ func (h *EventHandler) HandlerType() eh.EventHandlerType {
 // HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler interface.
 // It will try to find the correct version of the model, waiting for it if needed.
 func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	// Skip events that already have been processed.
+	if ok, err := processed(ctx, h.checkpoints, h.projector.ProjectorType(), event); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+
 	// Get or create the model, trying to use a waiting find with a min version
 	// if the underlying repo supports it.
 	findCtx, cancel := eh.NewContextWithMinVersionWait(ctx, event.Version()-1)
@@ -147,7 +155,7 @@ func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
 		}
 	}
 
-	return nil
+	return saveCheckpoint(ctx, h.checkpoints, h.projector.ProjectorType(), event)
 }
 
 // SetEntityFactory sets a factory function that creates concrete entity types.
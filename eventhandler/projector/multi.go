@@ -0,0 +1,309 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projector
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// MultiProjector is a projector of events onto several models, which can be
+// keyed by other IDs than the aggregate ID of the event. It is useful for
+// summary views, like totals per customer or global counters.
+type MultiProjector interface {
+	// EntityIDs returns the IDs of the models that are affected by an event.
+	EntityIDs(context.Context, eh.Event) ([]uuid.UUID, error)
+
+	// Project projects an event onto the models, keyed by their IDs, and
+	// returns the models to update. Models that are returned as nil are
+	// removed and models that are left out are not changed.
+	Project(context.Context, eh.Event, map[uuid.UUID]eh.Entity) (map[uuid.UUID]eh.Entity, error)
+
+	// ProjectorType returns the type of the projector.
+	ProjectorType() Type
+}
+
+// ErrUnknownEntity is when a projector returns a model that it did not
+// resolve the ID of.
+var ErrUnknownEntity = errors.New("unknown entity")
+
+// DefaultConflictRetries is the default number of times that an event is
+// projected again when a model has been saved concurrently.
+var DefaultConflictRetries = 3
+
+// errConflict is when a model could not be saved because it has been saved
+// concurrently.
+var errConflict = errors.New("conflict")
+
+// MultiEventHandler is a projection handler to run a MultiProjector
+// implementation.
+//
+// Models that implement eventhorizon.Versionable are version checked per
+// model. A model keyed by the aggregate ID of the event should be at the
+// version of the event after the projection, in the same way as for the
+// EventHandler. Other models have their own versions, which should be
+// incremented by one for each projected event.
+//
+// If the repo implements eventhorizon.VersionedWriteRepo the versioned models
+// are saved with optimistic concurrency, and when a model has been saved
+// concurrently the event is projected again onto the new models, up to
+// DefaultConflictRetries times. Models that were already saved are then not
+// saved again. Otherwise the models are saved in one request if the repo
+// implements eventhorizon.BatchWriteRepo, or one by one, which is not safe
+// with several handlers updating the same models. Neither is atomic for all
+// repos, if saving fails some of the models can already be saved and must be
+// repaired, for example by replaying the projection.
+//
+// Only the model keyed by the aggregate ID is protected from projecting an
+// event twice by its version, a CheckpointStore should be set to not project
+// events that are delivered again onto the other models.
+type MultiEventHandler struct {
+	projector   MultiProjector
+	repo        eh.ReadWriteRepo
+	factoryFn   func() eh.Entity
+	checkpoints CheckpointStore
+}
+
+var _ = eh.EventHandler(&MultiEventHandler{})
+
+// NewMultiEventHandler creates a new MultiEventHandler.
+func NewMultiEventHandler(projector MultiProjector, repo eh.ReadWriteRepo) *MultiEventHandler {
+	return &MultiEventHandler{
+		projector: projector,
+		repo:      repo,
+	}
+}
+
+// HandlerType implements the HandlerType method of the eventhorizon.EventHandler interface.
+func (h *MultiEventHandler) HandlerType() eh.EventHandlerType {
+	return eh.EventHandlerType("projector_" + h.projector.ProjectorType())
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler interface.
+// It will try to find the correct version of the model keyed by the aggregate
+// ID, waiting for it if needed.
+func (h *MultiEventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	// Skip events that already have been processed.
+	if ok, err := processed(ctx, h.checkpoints, h.projector.ProjectorType(), event); err != nil {
+		return err
+	} else if ok {
+		return nil
+	}
+
+	ids, err := h.projector.EntityIDs(ctx, event)
+	if err != nil {
+		return Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	// Project the event again on conflicts, without saving the models that
+	// already has been saved with it.
+	saved := map[uuid.UUID]bool{}
+	for i := 0; i <= DefaultConflictRetries; i++ {
+		if err = h.project(ctx, event, ids, saved); err != errConflict {
+			break
+		}
+	}
+	if err == errConflict {
+		return Error{
+			Err:       eh.ErrIncorrectEntityVersion,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	} else if err != nil {
+		return err
+	}
+
+	return saveCheckpoint(ctx, h.checkpoints, h.projector.ProjectorType(), event)
+}
+
+// project loads the models, projects the event and saves the models that are
+// not already saved. It returns errConflict if a model was saved concurrently.
+func (h *MultiEventHandler) project(ctx context.Context, event eh.Event, ids []uuid.UUID, saved map[uuid.UUID]bool) error {
+	// Get or create the models and remember their versions.
+	entities := make(map[uuid.UUID]eh.Entity, len(ids))
+	versions := make(map[uuid.UUID]int, len(ids))
+	for _, id := range ids {
+		if _, ok := entities[id]; ok {
+			continue
+		}
+
+		entity, err := h.find(ctx, event, id)
+		if err != nil {
+			return err
+		}
+
+		if entity, ok := entity.(eh.Versionable); ok {
+			versions[id] = entity.AggregateVersion()
+			// The aggregate's model should be one version behind the event.
+			if id == event.AggregateID() && !saved[id] && versions[id]+1 != event.Version() {
+				return Error{
+					Err:       eh.ErrIncorrectEntityVersion,
+					Namespace: eh.NamespaceFromContext(ctx),
+				}
+			}
+		}
+		entities[id] = entity
+	}
+
+	// Run the projection, which will possibly increment the versions.
+	newEntities, err := h.projector.Project(ctx, event, entities)
+	if err != nil {
+		return Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	var save []eh.Entity
+	var remove []uuid.UUID
+	for id, newEntity := range newEntities {
+		if _, ok := entities[id]; !ok {
+			return Error{
+				Err:       ErrUnknownEntity,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+		if saved[id] {
+			continue
+		}
+
+		if newEntity == nil {
+			remove = append(remove, id)
+			continue
+		}
+
+		// The models should now be at the next version.
+		if newEntity, ok := newEntity.(eh.Versionable); ok {
+			version := versions[id] + 1
+			if id == event.AggregateID() {
+				version = event.Version()
+			}
+			if newEntity.AggregateVersion() != version {
+				return Error{
+					Err:       eh.ErrIncorrectEntityVersion,
+					Namespace: eh.NamespaceFromContext(ctx),
+				}
+			}
+		}
+		save = append(save, newEntity)
+	}
+
+	if err := h.save(ctx, save, remove, versions, saved); err == errConflict {
+		return err
+	} else if err != nil {
+		return Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return nil
+}
+
+// CatchUp projects all events from the event store that have not yet been
+// processed according to the checkpoints, in the same way as for the
+// EventHandler.
+func (h *MultiEventHandler) CatchUp(ctx context.Context, store eh.EventStoreStreamer) error {
+	return catchUp(ctx, store, h.checkpoints, h.projector.ProjectorType(), h.HandleEvent)
+}
+
+// SetEntityFactory sets a factory function that creates concrete entity types.
+func (h *MultiEventHandler) SetEntityFactory(f func() eh.Entity) {
+	h.factoryFn = f
+}
+
+// SetCheckpointStore sets a store for checkpoints, in the same way as for the
+// EventHandler.
+func (h *MultiEventHandler) SetCheckpointStore(s CheckpointStore) {
+	h.checkpoints = s
+}
+
+// find gets or creates a model. The model keyed by the aggregate ID is found
+// with a waiting find with a min version if the underlying repo supports it.
+func (h *MultiEventHandler) find(ctx context.Context, event eh.Event, id uuid.UUID) (eh.Entity, error) {
+	findCtx := ctx
+	if id == event.AggregateID() {
+		var cancel func()
+		findCtx, cancel = eh.NewContextWithMinVersionWait(ctx, event.Version()-1)
+		defer cancel()
+	}
+
+	entity, err := h.repo.Find(findCtx, id)
+	if rrErr, ok := err.(eh.RepoError); ok && rrErr.Err == eh.ErrEntityNotFound {
+		if h.factoryFn == nil {
+			return nil, Error{
+				Err:       ErrModelNotSet,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+		return h.factoryFn(), nil
+	} else if err != nil {
+		return nil, Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return entity, nil
+}
+
+// save saves and removes the models. Versioned models are saved with their
+// loaded versions as expected versions if the repo supports it, otherwise the
+// models are saved in one request if the repo supports it. The saved models
+// are marked as saved.
+func (h *MultiEventHandler) save(ctx context.Context, save []eh.Entity, remove []uuid.UUID,
+	versions map[uuid.UUID]int, saved map[uuid.UUID]bool) error {
+	versionedRepo, versioned := h.repo.(eh.VersionedWriteRepo)
+	if repo, ok := h.repo.(eh.BatchWriteRepo); ok && !versioned {
+		if err := repo.SaveBatch(ctx, save, remove); err != nil {
+			return err
+		}
+		for _, entity := range save {
+			saved[entity.EntityID()] = true
+		}
+		return nil
+	}
+
+	for _, entity := range save {
+		var err error
+		if _, ok := entity.(eh.Versionable); ok && versioned {
+			err = versionedRepo.SaveVersioned(ctx, entity, versions[entity.EntityID()])
+		} else {
+			err = h.repo.Save(ctx, entity)
+		}
+		if rrErr, ok := err.(eh.RepoError); ok && rrErr.Err == eh.ErrIncorrectEntityVersion {
+			return errConflict
+		} else if err != nil {
+			return err
+		}
+		saved[entity.EntityID()] = true
+	}
+	for _, id := range remove {
+		err := h.repo.Remove(ctx, id)
+		if rrErr, ok := err.(eh.RepoError); ok && rrErr.Err == eh.ErrEntityNotFound {
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
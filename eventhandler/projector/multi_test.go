@@ -0,0 +1,246 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	memoryrepo "github.com/looplab/eventhorizon/repo/memory"
+	"github.com/looplab/eventhorizon/repo/swap"
+)
+
+func TestMultiEventHandler(t *testing.T) {
+	t.Run("versioned", func(t *testing.T) {
+		testMultiEventHandler(t, memoryrepo.NewRepo())
+	})
+	t.Run("batch", func(t *testing.T) {
+		repo := memoryrepo.NewRepo()
+		testMultiEventHandler(t, &batchRepo{ReadWriteRepo: repo, batch: repo})
+	})
+	t.Run("no batch", func(t *testing.T) {
+		testMultiEventHandler(t, swap.NewRepo(memoryrepo.NewRepo()))
+	})
+}
+
+func testMultiEventHandler(t *testing.T, repo eh.ReadWriteRepo) {
+	ctx := context.Background()
+	projector := &summaryProjector{}
+	handler := NewMultiEventHandler(projector, repo)
+	if handler.HandlerType() != "projector_summary_projector" {
+		t.Error("the handler type should be correct:", handler.HandlerType())
+	}
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id1 := uuid.New()
+	id2 := uuid.New()
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "a"},
+		timestamp, mocks.AggregateType, id1, 1)
+	if err := handler.HandleEvent(ctx, event); err == nil || err.(Error).Err != ErrModelNotSet {
+		t.Error("there should be a model not set error:", err)
+	}
+
+	handler.SetEntityFactory(func() eh.Entity {
+		return &mocks.Model{}
+	})
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	checkReplayModel(t, ctx, repo, id1, 1, "a")
+	checkReplayModel(t, ctx, repo, summaryID, 1, "a")
+
+	// Other aggregates should update the same summary.
+	event = eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "b"},
+		timestamp, mocks.AggregateType, id2, 1)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	checkReplayModel(t, ctx, repo, id2, 1, "b")
+	checkReplayModel(t, ctx, repo, summaryID, 2, "ab")
+
+	// The model of the aggregate should be one version behind.
+	event = eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "c"},
+		timestamp, mocks.AggregateType, id1, 3)
+	if err := handler.HandleEvent(ctx, event); err == nil || err.(Error).Err != eh.ErrIncorrectEntityVersion {
+		t.Error("there should be a incorrect entity version error:", err)
+	}
+
+	// Other models should be incremented by one.
+	projector.skipVersion = true
+	event = eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "c"},
+		timestamp, mocks.AggregateType, id1, 2)
+	if err := handler.HandleEvent(ctx, event); err == nil || err.(Error).Err != eh.ErrIncorrectEntityVersion {
+		t.Error("there should be a incorrect entity version error:", err)
+	}
+	checkReplayModel(t, ctx, repo, id1, 1, "a")
+	checkReplayModel(t, ctx, repo, summaryID, 2, "ab")
+	projector.skipVersion = false
+
+	// Models that are not resolved can not be returned.
+	projector.unknown = true
+	if err := handler.HandleEvent(ctx, event); err == nil || err.(Error).Err != ErrUnknownEntity {
+		t.Error("there should be a unknown entity error:", err)
+	}
+	projector.unknown = false
+
+	// Removing models.
+	event = eh.NewEventForAggregate(mocks.EventOtherType, nil,
+		timestamp, mocks.AggregateType, id1, 2)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := repo.Find(ctx, id1); err == nil {
+		t.Error("the model should be removed")
+	}
+	checkReplayModel(t, ctx, repo, summaryID, 3, "ab")
+
+	// Projection errors.
+	projector.err = errors.New("projection error")
+	event = eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "c"},
+		timestamp, mocks.AggregateType, id2, 2)
+	if err := handler.HandleEvent(ctx, event); err == nil || err.(Error).Err != projector.err {
+		t.Error("there should be a projection error:", err)
+	}
+}
+
+func TestMultiEventHandler_Conflict(t *testing.T) {
+	ctx := context.Background()
+	repo := &conflictRepo{Repo: memoryrepo.NewRepo(), conflicts: 1}
+	handler := NewMultiEventHandler(&summaryProjector{}, repo)
+	handler.SetEntityFactory(func() eh.Entity {
+		return &mocks.Model{}
+	})
+
+	// The event should be projected again onto the concurrently saved summary.
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "a"},
+		timestamp, mocks.AggregateType, id, 1)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	checkReplayModel(t, ctx, repo, id, 1, "a")
+	checkReplayModel(t, ctx, repo, summaryID, 2, "xa")
+
+	// Too many conflicts.
+	repo.conflicts = DefaultConflictRetries + 1
+	event = eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "b"},
+		timestamp, mocks.AggregateType, uuid.New(), 1)
+	if err := handler.HandleEvent(ctx, event); err == nil || err.(Error).Err != eh.ErrIncorrectEntityVersion {
+		t.Error("there should be a incorrect entity version error:", err)
+	}
+}
+
+// batchRepo is a repo that can save in batches but not with versions.
+type batchRepo struct {
+	eh.ReadWriteRepo
+	batch eh.BatchWriteRepo
+}
+
+func (r *batchRepo) SaveBatch(ctx context.Context, save []eh.Entity, remove []uuid.UUID) error {
+	return r.batch.SaveBatch(ctx, save, remove)
+}
+
+// conflictRepo saves the summary concurrently before it is saved.
+type conflictRepo struct {
+	*memoryrepo.Repo
+	conflicts int
+}
+
+func (r *conflictRepo) SaveVersioned(ctx context.Context, entity eh.Entity, expectedVersion int) error {
+	if entity.EntityID() == summaryID && r.conflicts > 0 {
+		r.conflicts--
+		m := &mocks.Model{ID: summaryID, Version: expectedVersion + 1, Content: "x"}
+		if s, err := r.Repo.Find(ctx, summaryID); err == nil {
+			m.Content = s.(*mocks.Model).Content + "x"
+		}
+		if err := r.Repo.SaveVersioned(ctx, m, expectedVersion); err != nil {
+			return err
+		}
+	}
+	return r.Repo.SaveVersioned(ctx, entity, expectedVersion)
+}
+
+var summaryID = uuid.MustParse("c1138e5f-f6fb-4dd0-8e79-255c6c8d37ff")
+
+// summaryProjector projects the content of the events onto the model of the
+// aggregate and a summary model of all aggregates. Events of the other type
+// removes the model of the aggregate.
+type summaryProjector struct {
+	skipVersion bool
+	unknown     bool
+	err         error
+}
+
+func (p *summaryProjector) ProjectorType() Type {
+	return Type("summary_projector")
+}
+
+func (p *summaryProjector) EntityIDs(ctx context.Context, event eh.Event) ([]uuid.UUID, error) {
+	return []uuid.UUID{event.AggregateID(), summaryID}, nil
+}
+
+func (p *summaryProjector) Project(ctx context.Context, event eh.Event, entities map[uuid.UUID]eh.Entity) (map[uuid.UUID]eh.Entity, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+
+	// Copy the models, to not modify the models in the memory repo.
+	s, ok := entities[summaryID].(*mocks.Model)
+	if !ok {
+		return nil, errors.New("invalid summary model")
+	}
+	summary := *s
+	summary.ID = summaryID
+	if !p.skipVersion {
+		summary.Version++
+	}
+
+	if event.EventType() == mocks.EventOtherType {
+		return map[uuid.UUID]eh.Entity{
+			event.AggregateID(): nil,
+			summaryID:           &summary,
+		}, nil
+	}
+
+	e, ok := entities[event.AggregateID()].(*mocks.Model)
+	if !ok {
+		return nil, errors.New("invalid model")
+	}
+	m := *e
+	data, ok := event.Data().(*mocks.EventData)
+	if !ok {
+		return nil, errors.New("invalid event data")
+	}
+	m.ID = event.AggregateID()
+	m.Version = event.Version()
+	m.Content += data.Content
+	summary.Content += data.Content
+
+	entities = map[uuid.UUID]eh.Entity{
+		event.AggregateID(): &m,
+		summaryID:           &summary,
+	}
+	if p.unknown {
+		entities[uuid.New()] = &mocks.Model{}
+	}
+	return entities, nil
+}
@@ -0,0 +1,236 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projector
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ReplayProgress is the progress of a replay.
+type ReplayProgress struct {
+	// LastAggregateID is the ID of the last aggregate that has been replayed
+	// completely, it can be used to resume an interrupted replay.
+	LastAggregateID uuid.UUID
+	// Aggregates is the number of replayed aggregates.
+	Aggregates int
+	// Events is the number of projected events.
+	Events int
+}
+
+// Replayer rebuilds the read model of a projector by replaying the events
+// from an event store. The events are replayed one aggregate at a time, in the
+// order of the event store, and each model is saved once per aggregate.
+//
+// Replaying is idempotent for models that implement eventhorizon.Versionable,
+// only events newer than the model are projected. This means that an
+// interrupted replay can be resumed, and that a replay can be run again to
+// catch up on events stored during the last replay. Models without a version
+// are removed and projected from the first event.
+//
+// To rebuild a read model that is in use, replay to a shadow repository and
+// switch to it using a swap.Repo as the repository of the projector's
+// EventHandler and the queries, then replay once more to catch up. Switching
+// is not done by Replay, as only the caller knows when the shadow repository
+// has caught up and which handlers and queries use the repository.
+type Replayer struct {
+	store      eh.EventStoreStreamer
+	projector  Projector
+	repo       eh.ReadWriteRepo
+	factoryFn  func() eh.Entity
+	progressFn func(ReplayProgress)
+}
+
+// NewReplayer creates a new Replayer that projects onto the repo.
+func NewReplayer(store eh.EventStoreStreamer, projector Projector, repo eh.ReadWriteRepo) *Replayer {
+	return &Replayer{
+		store:     store,
+		projector: projector,
+		repo:      repo,
+	}
+}
+
+// SetEntityFactory sets a factory function that creates concrete entity types.
+func (r *Replayer) SetEntityFactory(f func() eh.Entity) {
+	r.factoryFn = f
+}
+
+// SetProgressHandler sets a function that is called with the progress after
+// each replayed aggregate.
+func (r *Replayer) SetProgressHandler(f func(ReplayProgress)) {
+	r.progressFn = f
+}
+
+// Clear removes all models from the repo, using the Clear method of the repo
+// if it has one.
+func (r *Replayer) Clear(ctx context.Context) error {
+	if c, ok := r.repo.(interface {
+		Clear(context.Context) error
+	}); ok {
+		if err := c.Clear(ctx); err != nil {
+			return Error{
+				Err:       err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+		return nil
+	}
+
+	entities, err := r.repo.FindAll(ctx)
+	if err != nil {
+		return Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+	for _, entity := range entities {
+		if err := r.repo.Remove(ctx, entity.EntityID()); err != nil {
+			return Error{
+				Err:       err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+	}
+
+	return nil
+}
+
+// Replay replays the events of all aggregates after the given ID, use uuid.Nil
+// to replay all events. The progress is returned also when there is an error,
+// its LastAggregateID can be used to resume.
+func (r *Replayer) Replay(ctx context.Context, after uuid.UUID) (ReplayProgress, error) {
+	progress := ReplayProgress{
+		LastAggregateID: after,
+	}
+
+	err := r.store.StreamEvents(ctx, after, func(ctx context.Context, events []eh.Event) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		if len(events) == 0 {
+			return nil
+		}
+		n, err := r.replayAggregate(ctx, events)
+		if err != nil {
+			return err
+		}
+
+		progress.LastAggregateID = events[0].AggregateID()
+		progress.Aggregates++
+		progress.Events += n
+		if r.progressFn != nil {
+			r.progressFn(progress)
+		}
+		return nil
+	})
+	if err != nil {
+		if _, ok := err.(Error); ok {
+			return progress, err
+		}
+		return progress, Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return progress, nil
+}
+
+// replayAggregate projects the events of one aggregate and saves the model.
+// It returns the number of projected events.
+func (r *Replayer) replayAggregate(ctx context.Context, events []eh.Event) (int, error) {
+	id := events[0].AggregateID()
+
+	entity, err := r.repo.Find(ctx, id)
+	if rrErr, ok := err.(eh.RepoError); ok && rrErr.Err == eh.ErrEntityNotFound {
+		entity = nil
+	} else if err != nil {
+		return 0, Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+	exists := entity != nil
+
+	// Continue from the version of the model, or start over if it has none.
+	version := 0
+	if entity != nil {
+		if v, ok := entity.(eh.Versionable); ok {
+			version = v.AggregateVersion()
+		} else {
+			entity = nil
+		}
+	}
+
+	n := 0
+	for _, event := range events {
+		if event.Version() <= version {
+			continue
+		}
+
+		if entity == nil {
+			if r.factoryFn == nil {
+				return n, Error{
+					Err:       ErrModelNotSet,
+					Namespace: eh.NamespaceFromContext(ctx),
+				}
+			}
+			entity = r.factoryFn()
+		}
+
+		if entity, err = r.projector.Project(ctx, event, entity); err != nil {
+			return n, Error{
+				Err:       err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+
+		// The model should now be at the same version as the event.
+		if entity, ok := entity.(eh.Versionable); ok {
+			if entity.AggregateVersion() != event.Version() {
+				return n, Error{
+					Err:       eh.ErrIncorrectEntityVersion,
+					Namespace: eh.NamespaceFromContext(ctx),
+				}
+			}
+		}
+		n++
+	}
+
+	// Save or remove the model, if there were any changes.
+	if entity != nil && n > 0 {
+		if err := r.repo.Save(ctx, entity); err != nil {
+			return n, Error{
+				Err:       err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+	} else if entity == nil && exists {
+		if err := r.repo.Remove(ctx, id); err != nil {
+			return n, Error{
+				Err:       err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package projector
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventstore/memory"
+	"github.com/looplab/eventhorizon/mocks"
+	memoryrepo "github.com/looplab/eventhorizon/repo/memory"
+	"github.com/looplab/eventhorizon/repo/swap"
+)
+
+func TestReplayer(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore()
+	id1, _ := uuid.Parse("c1138e5f-f6fb-4dd0-8e79-255c6c8d3751")
+	id2, _ := uuid.Parse("c1138e5f-f6fb-4dd0-8e79-255c6c8d3752")
+	saveReplayEvents(t, ctx, store, id1, 0, "a", "b")
+	saveReplayEvents(t, ctx, store, id2, 0, "c")
+
+	repo := memoryrepo.NewRepo()
+	r := NewReplayer(store, &replayProjector{}, repo)
+	r.SetEntityFactory(func() eh.Entity {
+		return &mocks.Model{}
+	})
+	progresses := []ReplayProgress{}
+	r.SetProgressHandler(func(p ReplayProgress) {
+		progresses = append(progresses, p)
+	})
+
+	progress, err := r.Replay(ctx, uuid.Nil)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if progress != (ReplayProgress{LastAggregateID: id2, Aggregates: 2, Events: 3}) {
+		t.Error("the progress should be correct:", progress)
+	}
+	if len(progresses) != 2 ||
+		progresses[0] != (ReplayProgress{LastAggregateID: id1, Aggregates: 1, Events: 2}) ||
+		progresses[1] != progress {
+		t.Error("the reported progress should be correct:", progresses)
+	}
+	checkReplayModel(t, ctx, repo, id1, 2, "ab")
+	checkReplayModel(t, ctx, repo, id2, 1, "c")
+
+	// Replaying again should only project new events.
+	saveReplayEvents(t, ctx, store, id1, 2, "d")
+	progress, err = r.Replay(ctx, uuid.Nil)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if progress.Aggregates != 2 || progress.Events != 1 {
+		t.Error("the progress should be correct:", progress)
+	}
+	checkReplayModel(t, ctx, repo, id1, 3, "abd")
+	checkReplayModel(t, ctx, repo, id2, 1, "c")
+
+	// Clear the repo.
+	if err := r.Clear(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if entities, err := repo.FindAll(ctx); err != nil || len(entities) != 0 {
+		t.Error("the repo should be cleared:", entities, err)
+	}
+}
+
+func TestReplayer_Resume(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore()
+	id1, _ := uuid.Parse("c1138e5f-f6fb-4dd0-8e79-255c6c8d3751")
+	id2, _ := uuid.Parse("c1138e5f-f6fb-4dd0-8e79-255c6c8d3752")
+	saveReplayEvents(t, ctx, store, id1, 0, "a")
+	saveReplayEvents(t, ctx, store, id2, 0, "b")
+
+	// Interrupt the replay after the first aggregate.
+	repo := memoryrepo.NewRepo()
+	projector := &replayProjector{failOn: "b"}
+	r := NewReplayer(store, projector, repo)
+	r.SetEntityFactory(func() eh.Entity {
+		return &mocks.Model{}
+	})
+	progress, err := r.Replay(ctx, uuid.Nil)
+	if pErr, ok := err.(Error); !ok || pErr.Err != errReplay {
+		t.Error("there should be a replay error:", err)
+	}
+	if progress != (ReplayProgress{LastAggregateID: id1, Aggregates: 1, Events: 1}) {
+		t.Error("the progress should be correct:", progress)
+	}
+
+	// Resume from the last aggregate.
+	projector.failOn = ""
+	projector.projected = 0
+	progress, err = r.Replay(ctx, progress.LastAggregateID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if progress != (ReplayProgress{LastAggregateID: id2, Aggregates: 1, Events: 1}) {
+		t.Error("the progress should be correct:", progress)
+	}
+	if projector.projected != 1 {
+		t.Error("only the remaining events should be projected:", projector.projected)
+	}
+	checkReplayModel(t, ctx, repo, id1, 1, "a")
+	checkReplayModel(t, ctx, repo, id2, 1, "b")
+}
+
+func TestReplayer_Shadow(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore()
+	id := uuid.New()
+	saveReplayEvents(t, ctx, store, id, 0, "a", "b")
+
+	// The current model is broken.
+	oldRepo := memoryrepo.NewRepo()
+	if err := oldRepo.Save(ctx, &mocks.Model{ID: id, Version: 2, Content: "broken"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	repo := swap.NewRepo(oldRepo)
+
+	// Rebuild in a shadow repo and switch to it.
+	shadowRepo := memoryrepo.NewRepo()
+	r := NewReplayer(store, &replayProjector{}, shadowRepo)
+	r.SetEntityFactory(func() eh.Entity {
+		return &mocks.Model{}
+	})
+	if _, err := r.Replay(ctx, uuid.Nil); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	checkReplayModel(t, ctx, repo, id, 2, "broken")
+	repo.Swap(shadowRepo)
+	checkReplayModel(t, ctx, repo, id, 2, "ab")
+}
+
+func TestReplayer_NoVersion(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore()
+	id := uuid.New()
+	saveReplayEvents(t, ctx, store, id, 0, "a")
+
+	// Models without version should be projected from the start.
+	repo := memoryrepo.NewRepo()
+	if err := repo.Save(ctx, &mocks.SimpleModel{ID: id, Content: "old"}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	projector := &replayProjector{}
+	r := NewReplayer(store, projector, repo)
+	r.SetEntityFactory(func() eh.Entity {
+		return &mocks.Model{}
+	})
+	if _, err := r.Replay(ctx, uuid.Nil); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	checkReplayModel(t, ctx, repo, id, 1, "a")
+}
+
+func TestReplayer_ModelNotSet(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewEventStore()
+	saveReplayEvents(t, ctx, store, uuid.New(), 0, "a")
+
+	r := NewReplayer(store, &replayProjector{}, memoryrepo.NewRepo())
+	if _, err := r.Replay(ctx, uuid.Nil); err == nil || err.(Error).Err != ErrModelNotSet {
+		t.Error("there should be a model not set error:", err)
+	}
+}
+
+func TestReplayer_NoEvents(t *testing.T) {
+	ctx := context.Background()
+	store := &emptyStreamer{EventStore: memory.NewEventStore()}
+	r := NewReplayer(store, &replayProjector{}, memoryrepo.NewRepo())
+	progress, err := r.Replay(ctx, uuid.Nil)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if progress != (ReplayProgress{}) {
+		t.Error("the progress should be correct:", progress)
+	}
+}
+
+var errReplay = errors.New("replay error")
+
+// emptyStreamer streams an aggregate without events.
+type emptyStreamer struct {
+	*memory.EventStore
+}
+
+func (s *emptyStreamer) StreamEvents(ctx context.Context, after uuid.UUID, f func(context.Context, []eh.Event) error) error {
+	return f(ctx, []eh.Event{})
+}
+
+// replayProjector projects the content of the events by appending them to
+// the content of the model.
+type replayProjector struct {
+	failOn    string
+	projected int
+}
+
+func (p *replayProjector) ProjectorType() Type {
+	return Type("replay_projector")
+}
+
+func (p *replayProjector) Project(ctx context.Context, event eh.Event, entity eh.Entity) (eh.Entity, error) {
+	data, ok := event.Data().(*mocks.EventData)
+	if !ok {
+		return nil, errors.New("invalid event data")
+	}
+	if data.Content == p.failOn {
+		return nil, errReplay
+	}
+	p.projected++
+
+	m, ok := entity.(*mocks.Model)
+	if !ok {
+		m = &mocks.Model{}
+	}
+	m.ID = event.AggregateID()
+	m.Version = event.Version()
+	m.Content += data.Content
+	return m, nil
+}
+
+func saveReplayEvents(t *testing.T, ctx context.Context, store eh.EventStore, id uuid.UUID, version int, contents ...string) {
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	events := []eh.Event{}
+	for i, content := range contents {
+		events = append(events, eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: content},
+			timestamp, mocks.AggregateType, id, version+i+1))
+	}
+	if err := store.Save(ctx, events, version); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+}
+
+func checkReplayModel(t *testing.T, ctx context.Context, repo eh.ReadRepo, id uuid.UUID, version int, content string) {
+	entity, err := repo.Find(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+		return
+	}
+	m, ok := entity.(*mocks.Model)
+	if !ok || m.ID != id || m.Version != version || m.Content != content {
+		t.Error("the model should be correct:", entity)
+	}
+}
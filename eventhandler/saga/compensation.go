@@ -0,0 +1,164 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saga
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+func init() {
+	eh.RegisterEventData(CompensationEventType, func() eh.EventData {
+		return &CompensationEventData{}
+	})
+}
+
+// CompensationEventType is the event type of the events that are published
+// when the steps of a saga has been compensated. The events have the saga type
+// as aggregate type, and the aggregate ID and version of the event that the
+// saga handled.
+const CompensationEventType eh.EventType = "SagaCompensation"
+
+// CompensationEventData is the event data of compensation events.
+type CompensationEventData struct {
+	SagaType Type `json:"saga_type" bson:"saga_type"`
+	// FailedCommand is the type of the command that failed.
+	FailedCommand eh.CommandType `json:"failed_command" bson:"failed_command"`
+	// Error is the error of the command that failed.
+	Error string `json:"error" bson:"error"`
+	// Compensated is the types of the compensating commands that were handled,
+	// in order.
+	Compensated []eh.CommandType `json:"compensated" bson:"compensated"`
+	// CompensationErrors is the errors of compensating commands that failed.
+	CompensationErrors []string `json:"compensation_errors" bson:"compensation_errors"`
+}
+
+// Step is a command with an optional compensating command, that is handled if
+// a later step of the saga fails.
+type Step struct {
+	Command      eh.Command
+	Compensation eh.Command
+}
+
+// CompensatingSaga is an optional interface for sagas that return steps with
+// compensating commands. The EventHandler uses RunSagaSteps instead of
+// RunSaga for sagas that implement it. When a step fails the handled steps are
+// compensated and the failure is published as a compensation event on the
+// event bus set with SetEventBus, the event is then handled without error so
+// that it is not retried.
+type CompensatingSaga interface {
+	Saga
+
+	// RunSagaSteps handles an event in the saga that can return steps.
+	RunSagaSteps(context.Context, eh.Event) []Step
+}
+
+// CompensationError is the error when a step of a saga failed and the
+// already handled steps have been compensated, but the compensation event
+// could not be published.
+type CompensationError struct {
+	// Err is the error of the failed command.
+	Err error
+	// SagaType is the type of the saga.
+	SagaType Type
+	// Event is the event that the saga handled.
+	Event eh.Event
+	// Command is the command that failed.
+	Command eh.Command
+	// Compensated is the compensating commands that were handled, in order.
+	Compensated []eh.Command
+	// CompensationErrs is the errors of the compensating commands that failed,
+	// the rest of the steps are still compensated.
+	CompensationErrs []error
+	// PublishErr is the error from publishing the compensation event.
+	PublishErr error
+}
+
+// Error implements the Error method of the errors.Error interface.
+func (e CompensationError) Error() string {
+	str := fmt.Sprintf("could not handle command '%s' from saga '%s': %s (compensated %d commands",
+		e.Command.CommandType(), e.SagaType, e.Err, len(e.Compensated))
+	if len(e.CompensationErrs) > 0 {
+		str += fmt.Sprintf(", %d failed", len(e.CompensationErrs))
+	}
+	str += ")"
+	if e.PublishErr != nil {
+		str += ": could not publish compensation event: " + e.PublishErr.Error()
+	}
+	return str
+}
+
+// SetEventBus sets an event bus to publish compensation events on. Without an
+// event bus, failed steps of a CompensatingSaga are only compensated.
+func (h *EventHandler) SetEventBus(bus eh.EventBus) {
+	h.eventBus = bus
+}
+
+// handleSteps handles the steps in order, and compensates the handled steps in
+// reverse order if a step fails. Once compensated the failure is published,
+// and no error is returned unless publishing failed.
+func (h *EventHandler) handleSteps(ctx context.Context, event eh.Event, steps []Step) error {
+	for i, step := range steps {
+		err := h.commandHandler.HandleCommand(ctx, step.Command)
+		if err == nil {
+			continue
+		}
+
+		cErr := CompensationError{
+			Err:      err,
+			SagaType: h.saga.SagaType(),
+			Event:    event,
+			Command:  step.Command,
+		}
+		for j := i - 1; j >= 0; j-- {
+			cmd := steps[j].Compensation
+			if cmd == nil {
+				continue
+			}
+			if err := h.commandHandler.HandleCommand(ctx, cmd); err != nil {
+				cErr.CompensationErrs = append(cErr.CompensationErrs, err)
+				continue
+			}
+			cErr.Compensated = append(cErr.Compensated, cmd)
+		}
+
+		if h.eventBus != nil {
+			data := &CompensationEventData{
+				SagaType:      cErr.SagaType,
+				FailedCommand: step.Command.CommandType(),
+				Error:         err.Error(),
+			}
+			for _, cmd := range cErr.Compensated {
+				data.Compensated = append(data.Compensated, cmd.CommandType())
+			}
+			for _, err := range cErr.CompensationErrs {
+				data.CompensationErrors = append(data.CompensationErrors, err.Error())
+			}
+			e := eh.NewEventForAggregate(CompensationEventType, data, time.Now(),
+				eh.AggregateType(cErr.SagaType), event.AggregateID(), event.Version())
+			if err := h.eventBus.PublishEvent(ctx, e); err != nil {
+				cErr.PublishErr = err
+				return cErr
+			}
+		}
+
+		return nil
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saga
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler_Compensation(t *testing.T) {
+	handled := []eh.Command{}
+	commandErr := errors.New("command error")
+	commandHandler := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		if c, ok := cmd.(*mocks.Command); ok && c.Content == "fail" {
+			return commandErr
+		}
+		handled = append(handled, cmd)
+		return nil
+	})
+	saga := &TestCompensatingSaga{}
+	handler := NewEventHandler(saga, commandHandler)
+	eventBus := &mocks.EventBus{}
+	handler.SetEventBus(eventBus)
+
+	id := uuid.New()
+	cmd1 := &mocks.Command{ID: id, Content: "cmd1"}
+	cmd2 := &mocks.Command{ID: id, Content: "cmd2"}
+	cmd3 := &mocks.Command{ID: id, Content: "cmd3"}
+	undo1 := &mocks.Command{ID: id, Content: "undo1"}
+	undo3 := &mocks.Command{ID: id, Content: "undo3"}
+	failing := &mocks.Command{ID: id, Content: "fail"}
+
+	// All steps succeed.
+	ctx := context.Background()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	saga.steps = []Step{
+		{Command: cmd1, Compensation: undo1},
+		{Command: cmd2},
+	}
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(handled, []eh.Command{cmd1, cmd2}) {
+		t.Error("the handled commands should be correct:", handled)
+	}
+
+	// The handled steps should be compensated in reverse order, and the
+	// failure published without returning an error.
+	handled = []eh.Command{}
+	saga.steps = []Step{
+		{Command: cmd1, Compensation: undo1},
+		{Command: cmd2},
+		{Command: cmd3, Compensation: undo3},
+		{Command: failing, Compensation: undo1},
+	}
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(handled, []eh.Command{cmd1, cmd2, cmd3, undo3, undo1}) {
+		t.Error("the handled commands should be correct:", handled)
+	}
+	if len(eventBus.Events) != 1 {
+		t.Fatal("there should be a compensation event:", eventBus.Events)
+	}
+	e := eventBus.Events[0]
+	if e.EventType() != CompensationEventType ||
+		e.AggregateType() != eh.AggregateType(TestCompensatingSagaType) ||
+		e.AggregateID() != id || e.Version() != 1 {
+		t.Error("the compensation event should be correct:", e)
+	}
+	expectedData := &CompensationEventData{
+		SagaType:      TestCompensatingSagaType,
+		FailedCommand: mocks.CommandType,
+		Error:         "command error",
+		Compensated:   []eh.CommandType{mocks.CommandType, mocks.CommandType},
+	}
+	if !reflect.DeepEqual(e.Data(), expectedData) {
+		t.Error("the event data should be correct:", e.Data())
+	}
+
+	// Failing compensations should be reported, and the rest compensated.
+	handled = []eh.Command{}
+	eventBus.Events = nil
+	saga.steps = []Step{
+		{Command: cmd1, Compensation: undo1},
+		{Command: cmd2, Compensation: failing},
+		{Command: failing},
+	}
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(handled, []eh.Command{cmd1, cmd2, undo1}) {
+		t.Error("the handled commands should be correct:", handled)
+	}
+	expectedData = &CompensationEventData{
+		SagaType:           TestCompensatingSagaType,
+		FailedCommand:      mocks.CommandType,
+		Error:              "command error",
+		Compensated:        []eh.CommandType{mocks.CommandType},
+		CompensationErrors: []string{"command error"},
+	}
+	if len(eventBus.Events) != 1 || !reflect.DeepEqual(eventBus.Events[0].Data(), expectedData) {
+		t.Error("the compensation event should be correct:", eventBus.Events)
+	}
+
+	// An error should be returned if the compensation could not be published.
+	handled = []eh.Command{}
+	publishErr := errors.New("publish error")
+	eventBus.Err = publishErr
+	err := handler.HandleEvent(ctx, event)
+	cErr, ok := err.(CompensationError)
+	if !ok {
+		t.Fatal("there should be a compensation error:", err)
+	}
+	if cErr.Err != commandErr || cErr.Command != failing || cErr.SagaType != TestCompensatingSagaType ||
+		cErr.Event != event || cErr.PublishErr != publishErr {
+		t.Error("the compensation error should be correct:", cErr)
+	}
+	if !reflect.DeepEqual(cErr.Compensated, []eh.Command{undo1}) ||
+		!reflect.DeepEqual(cErr.CompensationErrs, []error{commandErr}) {
+		t.Error("the compensation error should be correct:", cErr)
+	}
+	if cErr.Error() != "could not handle command 'Command' from saga 'TestCompensatingSaga': command error (compensated 1 commands, 1 failed): could not publish compensation event: publish error" {
+		t.Error("the error string should be correct:", cErr.Error())
+	}
+}
+
+const (
+	TestCompensatingSagaType Type = "TestCompensatingSaga"
+)
+
+type TestCompensatingSaga struct {
+	steps []Step
+}
+
+func (m *TestCompensatingSaga) SagaType() Type {
+	return TestCompensatingSagaType
+}
+
+func (m *TestCompensatingSaga) RunSaga(ctx context.Context, event eh.Event) []eh.Command {
+	return nil
+}
+
+func (m *TestCompensatingSaga) RunSagaSteps(ctx context.Context, event eh.Event) []Step {
+	return m.steps
+}
@@ -25,6 +25,7 @@ import (
 type EventHandler struct {
 	saga           Saga
 	commandHandler eh.CommandHandler
+	eventBus       eh.EventBus
 }
 
 var _ = eh.EventHandler(&EventHandler{})
@@ -58,6 +59,11 @@ func (h *EventHandler) HandlerType() eh.EventHandlerType {
 
 // HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler interface.
 func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	// Run the saga with compensations if it supports it.
+	if s, ok := h.saga.(CompensatingSaga); ok {
+		return h.handleSteps(ctx, event, s.RunSagaSteps(ctx, event))
+	}
+
 	// Run the saga and collect commands.
 	cmds := h.saga.RunSaga(ctx, event)
 
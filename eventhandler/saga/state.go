@@ -0,0 +1,504 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// StatefulSaga is a saga, or process manager, that keeps state between the
+// events it handles. The state is loaded from and saved to a repo, keyed by a
+// correlation ID that is derived from each event.
+type StatefulSaga interface {
+	// SagaType returns the type of the saga.
+	SagaType() Type
+
+	// CorrelationID returns the ID of the state that the event belongs to.
+	// Events that return uuid.Nil are ignored.
+	CorrelationID(context.Context, eh.Event) uuid.UUID
+
+	// NewState creates a new state for the correlation ID.
+	NewState(id uuid.UUID) State
+
+	// RunSaga handles an event in the saga with the current state, which it
+	// can modify, and can return commands. The commands are saved as pending
+	// commands with the modified state, and are handled after it has been
+	// saved. Pending commands that could not be handled are handled again the
+	// next time the state is used, which means that commands can be handled
+	// more than once. The commands must be registered with eh.RegisterCommand
+	// and be encodable as JSON.
+	RunSaga(context.Context, eh.Event, State) ([]eh.Command, error)
+}
+
+// State is the state of a stateful saga. It is versioned to detect concurrent
+// modifications, which is done by the StatefulEventHandler. BaseState can be
+// embedded to implement it. The loaded state is copied before the saga is run
+// with it, by encoding it as JSON into a new state, as repos can return the
+// same stored state to all callers. States that can not be copied that way
+// should implement StateCopier.
+type State interface {
+	eh.Entity
+	eh.Versionable
+
+	// SetAggregateVersion sets the version of the state.
+	SetAggregateVersion(int)
+
+	// PendingCommands returns the commands that has not been handled yet.
+	PendingCommands() []PendingCommand
+
+	// SetPendingCommands sets the commands that has not been handled yet.
+	SetPendingCommands([]PendingCommand)
+
+	// PendingTimeouts returns the timeouts that has not been scheduled or
+	// removed yet.
+	PendingTimeouts() []PendingTimeout
+
+	// SetPendingTimeouts sets the timeouts that has not been scheduled or
+	// removed yet.
+	SetPendingTimeouts([]PendingTimeout)
+}
+
+// StateCopier can be implemented by states that need a custom copy.
+type StateCopier interface {
+	// CopyState returns a deep copy of the state.
+	CopyState() State
+}
+
+// BaseState is a base implementation of State, to embed in states.
+// Use `bson:",inline"` when embedding it in states stored in MongoDB.
+type BaseState struct {
+	ID       uuid.UUID        `json:"id"                         bson:"_id"`
+	Version  int              `json:"version"                    bson:"version"`
+	Pending  []PendingCommand `json:"pending_commands,omitempty" bson:"pending_commands,omitempty"`
+	Timeouts []PendingTimeout `json:"pending_timeouts,omitempty" bson:"pending_timeouts,omitempty"`
+}
+
+// EntityID implements the EntityID method of the eventhorizon.Entity interface.
+func (s *BaseState) EntityID() uuid.UUID {
+	return s.ID
+}
+
+// AggregateVersion implements the AggregateVersion method of the
+// eventhorizon.Versionable interface.
+func (s *BaseState) AggregateVersion() int {
+	return s.Version
+}
+
+// SetAggregateVersion implements the SetAggregateVersion method of the State interface.
+func (s *BaseState) SetAggregateVersion(v int) {
+	s.Version = v
+}
+
+// PendingCommands implements the PendingCommands method of the State interface.
+func (s *BaseState) PendingCommands() []PendingCommand {
+	return s.Pending
+}
+
+// SetPendingCommands implements the SetPendingCommands method of the State interface.
+func (s *BaseState) SetPendingCommands(cmds []PendingCommand) {
+	s.Pending = cmds
+}
+
+// PendingTimeouts implements the PendingTimeouts method of the State interface.
+func (s *BaseState) PendingTimeouts() []PendingTimeout {
+	return s.Timeouts
+}
+
+// SetPendingTimeouts implements the SetPendingTimeouts method of the State interface.
+func (s *BaseState) SetPendingTimeouts(timeouts []PendingTimeout) {
+	s.Timeouts = timeouts
+}
+
+// PendingCommand is a command from a saga that is saved with the state until
+// it has been handled.
+type PendingCommand struct {
+	ID          uuid.UUID       `json:"id"           bson:"id"`
+	CommandType eh.CommandType  `json:"command_type" bson:"command_type"`
+	Data        json.RawMessage `json:"data"         bson:"data"`
+}
+
+// newPendingCommand encodes a command as a pending command.
+func newPendingCommand(cmd eh.Command) (PendingCommand, error) {
+	// Check that the command can be created again when it is handled.
+	if _, err := eh.CreateCommand(cmd.CommandType()); err != nil {
+		return PendingCommand{}, err
+	}
+
+	b, err := json.Marshal(cmd)
+	if err != nil {
+		return PendingCommand{}, err
+	}
+
+	return PendingCommand{
+		ID:          uuid.New(),
+		CommandType: cmd.CommandType(),
+		Data:        b,
+	}, nil
+}
+
+// command decodes the pending command.
+func (p PendingCommand) command() (eh.Command, error) {
+	cmd, err := eh.CreateCommand(p.CommandType)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(p.Data, cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// DefaultStateRetries is the default number of times that an event is retried
+// when the state has been modified concurrently.
+var DefaultStateRetries = 3
+
+// ErrStateConflict is when the state has been modified concurrently.
+var ErrStateConflict = errors.New("state modified concurrently")
+
+// ErrInvalidState is when the loaded state is not a State.
+var ErrInvalidState = errors.New("invalid state")
+
+// ErrInvalidCommand is when a command from a saga can not be saved with the
+// state, because it is not registered or can not be encoded.
+var ErrInvalidCommand = errors.New("invalid command")
+
+// Error is an error in the saga, with the namespace.
+type Error struct {
+	// Err is the error.
+	Err error
+	// BaseErr is an optional underlying error, for example from the DB driver.
+	BaseErr error
+	// Namespace is the namespace for the error.
+	Namespace string
+}
+
+// Error implements the Error method of the errors.Error interface.
+func (e Error) Error() string {
+	errStr := e.Err.Error()
+	if e.BaseErr != nil {
+		errStr += ": " + e.BaseErr.Error()
+	}
+	return "saga: " + errStr + " (" + e.Namespace + ")"
+}
+
+// StatefulEventHandler is a CQRS saga handler to run a StatefulSaga
+// implementation. The state is saved with optimistic concurrency if the repo
+// implements eventhorizon.VersionedWriteRepo, otherwise the version is only
+// checked before saving, which is not safe with multiple instances. When the
+// state has been modified concurrently the event is run again with the new
+// state, up to DefaultStateRetries times. The commands and timeouts from the
+// saga are saved with the state and removed from it when they have been
+// handled, so that none are lost if they can not be handled.
+type StatefulEventHandler struct {
+	saga           StatefulSaga
+	repo           eh.ReadWriteRepo
+	commandHandler eh.CommandHandler
+	scheduler      *TimeoutScheduler
+}
+
+var _ = eh.EventHandler(&StatefulEventHandler{})
+
+// NewStatefulEventHandler creates a new StatefulEventHandler.
+func NewStatefulEventHandler(saga StatefulSaga, repo eh.ReadWriteRepo, commandHandler eh.CommandHandler) *StatefulEventHandler {
+	return &StatefulEventHandler{
+		saga:           saga,
+		repo:           repo,
+		commandHandler: commandHandler,
+	}
+}
+
+// HandlerType implements the HandlerType method of the eventhorizon.EventHandler interface.
+func (h *StatefulEventHandler) HandlerType() eh.EventHandlerType {
+	return eh.EventHandlerType("saga_" + h.saga.SagaType())
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler interface.
+func (h *StatefulEventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	id := h.saga.CorrelationID(ctx, event)
+	if id == uuid.Nil {
+		return nil
+	}
+
+	return h.handle(ctx, id, nil, func(ctx context.Context, state State) ([]eh.Command, error) {
+		return h.saga.RunSaga(ctx, event, state)
+	})
+}
+
+// SetTimeoutScheduler sets the scheduler to use for timeouts requested by the
+// saga, and registers the handler with the scheduler.
+func (h *StatefulEventHandler) SetTimeoutScheduler(s *TimeoutScheduler) {
+	h.scheduler = s
+	s.register(h)
+}
+
+// handle runs the saga with the state, retrying on conflicts, and handles the
+// pending commands and timeouts. The fired timeout is removed with the pending
+// timeouts, if set.
+func (h *StatefulEventHandler) handle(ctx context.Context, id uuid.UUID, fired *Timeout,
+	run func(context.Context, State) ([]eh.Command, error)) error {
+	var state State
+	var err error
+	for i := 0; i <= DefaultStateRetries; i++ {
+		if state, err = h.runSaga(ctx, id, fired, run); err == nil {
+			break
+		} else if sErr, ok := err.(Error); !ok || sErr.Err != ErrStateConflict {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	return h.handlePending(ctx, state)
+}
+
+// handlePending applies the pending timeouts and handles the pending commands
+// of a saved state in order, and removes the handled ones from the state.
+func (h *StatefulEventHandler) handlePending(ctx context.Context, state State) error {
+	var handleErr error
+
+	var timeouts []PendingTimeout
+	if h.scheduler != nil {
+		for _, p := range state.PendingTimeouts() {
+			if err := h.scheduler.apply(ctx, p); err != nil {
+				handleErr = err
+				break
+			}
+			timeouts = append(timeouts, p)
+		}
+	}
+
+	var cmds []PendingCommand
+	for _, p := range state.PendingCommands() {
+		cmd, err := p.command()
+		if err == nil {
+			err = h.commandHandler.HandleCommand(ctx, cmd)
+		}
+		if err != nil {
+			if handleErr == nil {
+				handleErr = errors.New("could not handle command '" +
+					string(p.CommandType) + "' from saga '" +
+					string(h.saga.SagaType()) + "': " + err.Error())
+			}
+			break
+		}
+		cmds = append(cmds, p)
+	}
+
+	if len(timeouts) > 0 || len(cmds) > 0 {
+		if err := h.removePending(ctx, state.EntityID(), cmds, timeouts); err != nil && handleErr == nil {
+			handleErr = err
+		}
+	}
+
+	return handleErr
+}
+
+// removePending removes handled commands and timeouts from the stored state,
+// retrying on conflicts.
+func (h *StatefulEventHandler) removePending(ctx context.Context, id uuid.UUID,
+	cmds []PendingCommand, timeouts []PendingTimeout) error {
+	ids := map[uuid.UUID]bool{}
+	for _, p := range cmds {
+		ids[p.ID] = true
+	}
+	for _, p := range timeouts {
+		ids[p.ID] = true
+	}
+
+	var err error
+	for i := 0; i <= DefaultStateRetries; i++ {
+		var state State
+		if state, err = h.load(ctx, id); err != nil {
+			return err
+		}
+
+		var remainingCmds []PendingCommand
+		for _, p := range state.PendingCommands() {
+			if !ids[p.ID] {
+				remainingCmds = append(remainingCmds, p)
+			}
+		}
+		var remainingTimeouts []PendingTimeout
+		for _, p := range state.PendingTimeouts() {
+			if !ids[p.ID] {
+				remainingTimeouts = append(remainingTimeouts, p)
+			}
+		}
+		if len(remainingCmds) == len(state.PendingCommands()) &&
+			len(remainingTimeouts) == len(state.PendingTimeouts()) {
+			return nil
+		}
+
+		version := state.AggregateVersion()
+		state.SetPendingCommands(remainingCmds)
+		state.SetPendingTimeouts(remainingTimeouts)
+		state.SetAggregateVersion(version + 1)
+		if err = h.save(ctx, state, version); err == nil {
+			return nil
+		} else if sErr, ok := err.(Error); !ok || sErr.Err != ErrStateConflict {
+			return err
+		}
+	}
+
+	return err
+}
+
+// runSaga loads the state, runs the saga and saves the state with the
+// commands from the saga added to the pending commands, and the requested
+// timeouts and the fired timeout added to the pending timeouts.
+func (h *StatefulEventHandler) runSaga(ctx context.Context, id uuid.UUID, fired *Timeout,
+	run func(context.Context, State) ([]eh.Command, error)) (State, error) {
+	state, err := h.load(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	version := state.AggregateVersion()
+
+	var requests *timeoutRequests
+	if h.scheduler != nil {
+		requests = &timeoutRequests{}
+	}
+	cmds, err := run(context.WithValue(ctx, timeoutRequestsKey, requests), state)
+	if err != nil {
+		return nil, Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	pending := state.PendingCommands()
+	for _, cmd := range cmds {
+		p, err := newPendingCommand(cmd)
+		if err != nil {
+			return nil, Error{
+				Err:       ErrInvalidCommand,
+				BaseErr:   err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+		pending = append(pending, p)
+	}
+	state.SetPendingCommands(pending)
+
+	if h.scheduler != nil {
+		state.SetPendingTimeouts(append(state.PendingTimeouts(),
+			pendingTimeouts(ctx, h.saga.SagaType(), id, version+1, requests, fired)...))
+	}
+
+	state.SetAggregateVersion(version + 1)
+	if err := h.save(ctx, state, version); err != nil {
+		return nil, err
+	}
+
+	return state, nil
+}
+
+// load loads the state or creates a new one.
+func (h *StatefulEventHandler) load(ctx context.Context, id uuid.UUID) (State, error) {
+	entity, err := h.repo.Find(ctx, id)
+	if rrErr, ok := err.(eh.RepoError); ok && rrErr.Err == eh.ErrEntityNotFound {
+		return h.saga.NewState(id), nil
+	} else if err != nil {
+		return nil, Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	state, ok := entity.(State)
+	if !ok {
+		return nil, Error{
+			Err:       ErrInvalidState,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	// Run the saga with a copy, to not modify the stored state if it can
+	// not be saved, or another handler uses it concurrently.
+	if c, ok := state.(StateCopier); ok {
+		return c.CopyState(), nil
+	}
+	b, err := json.Marshal(state)
+	if err != nil {
+		return nil, Error{
+			Err:       ErrInvalidState,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+	copied := h.saga.NewState(id)
+	if err := json.Unmarshal(b, copied); err != nil {
+		return nil, Error{
+			Err:       ErrInvalidState,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return copied, nil
+}
+
+// save saves the state if it has not been modified since it was loaded.
+func (h *StatefulEventHandler) save(ctx context.Context, state State, version int) error {
+	var err error
+	if repo, ok := h.repo.(eh.VersionedWriteRepo); ok {
+		err = repo.SaveVersioned(ctx, state, version)
+	} else {
+		err = h.checkAndSave(ctx, state, version)
+	}
+
+	if rrErr, ok := err.(eh.RepoError); ok && rrErr.Err == eh.ErrIncorrectEntityVersion {
+		return Error{
+			Err:       ErrStateConflict,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	} else if err != nil {
+		return Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return nil
+}
+
+// checkAndSave checks the version of the stored state before saving.
+func (h *StatefulEventHandler) checkAndSave(ctx context.Context, state State, version int) error {
+	stored := 0
+	entity, err := h.repo.Find(ctx, state.EntityID())
+	if rrErr, ok := err.(eh.RepoError); ok && rrErr.Err == eh.ErrEntityNotFound {
+		// A new state.
+	} else if err != nil {
+		return err
+	} else if s, ok := entity.(eh.Versionable); ok {
+		stored = s.AggregateVersion()
+	}
+
+	if stored != version {
+		return eh.RepoError{
+			Err:       eh.ErrIncorrectEntityVersion,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return h.repo.Save(ctx, state)
+}
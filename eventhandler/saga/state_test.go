@@ -0,0 +1,347 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saga
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/repo/memory"
+)
+
+func TestStatefulEventHandler(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	commandHandler := &mocks.CommandHandler{}
+	repo := memory.NewRepo()
+	saga := &TestStatefulSaga{}
+	handler := NewStatefulEventHandler(saga, repo, commandHandler)
+	if handler.HandlerType() != "saga_TestStatefulSaga" {
+		t.Error("the handler type should be correct:", handler.HandlerType())
+	}
+
+	ctx := context.Background()
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	// The state is saved once with the pending command and once without it.
+	checkTestState(t, ctx, repo, id, 4, 2)
+	expectedCmds := []eh.Command{
+		&mocks.Command{ID: id, Content: "1"},
+		&mocks.Command{ID: id, Content: "2"},
+	}
+	if !reflect.DeepEqual(commandHandler.Commands, expectedCmds) {
+		t.Error("the produced commands should be correct:", commandHandler.Commands)
+	}
+
+	// Events without correlation ID should be ignored.
+	event = eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, uuid.Nil, 1)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if saga.runs != 2 {
+		t.Error("the saga should not be run:", saga.runs)
+	}
+}
+
+func TestStatefulEventHandler_Conflict(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	commandHandler := &mocks.CommandHandler{}
+	repo := &conflictRepo{Repo: memory.NewRepo(), conflicts: 1}
+	saga := &TestStatefulSaga{}
+	handler := NewStatefulEventHandler(saga, repo, commandHandler)
+
+	// The saga should be run again with the new state.
+	ctx := context.Background()
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if saga.runs != 2 {
+		t.Error("the saga should be run again:", saga.runs)
+	}
+	checkTestState(t, ctx, repo, id, 3, 11)
+	expectedCmds := []eh.Command{&mocks.Command{ID: id, Content: "11"}}
+	if !reflect.DeepEqual(commandHandler.Commands, expectedCmds) {
+		t.Error("the produced commands should be correct:", commandHandler.Commands)
+	}
+
+	// Too many conflicts.
+	commandHandler.Commands = nil
+	repo.conflicts = DefaultStateRetries + 1
+	err := handler.HandleEvent(ctx, event)
+	if sErr, ok := err.(Error); !ok || sErr.Err != ErrStateConflict {
+		t.Error("there should be a state conflict error:", err)
+	}
+	if len(commandHandler.Commands) != 0 {
+		t.Error("there should be no commands:", commandHandler.Commands)
+	}
+}
+
+func TestStatefulEventHandler_ConcurrentConflict(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	commandHandler := &mocks.CommandHandler{}
+	repo := memory.NewRepo()
+	saga := &concurrentSaga{}
+	handler := NewStatefulEventHandler(saga, repo, commandHandler)
+	other := NewStatefulEventHandler(&TestStatefulSaga{}, repo, commandHandler)
+
+	ctx := context.Background()
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	if err := other.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// The other handler saves the same state while the saga is running, the
+	// retry should only see the saved state and not the failed modification.
+	saga.other = other
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if saga.runs != 2 {
+		t.Error("the saga should be run again:", saga.runs)
+	}
+	checkTestState(t, ctx, repo, id, 6, 3)
+	expectedCmds := []eh.Command{
+		&mocks.Command{ID: id, Content: "1"},
+		&mocks.Command{ID: id, Content: "2"},
+		&mocks.Command{ID: id, Content: "3"},
+	}
+	if !reflect.DeepEqual(commandHandler.Commands, expectedCmds) {
+		t.Error("the produced commands should be correct:", commandHandler.Commands)
+	}
+}
+
+func TestStatefulEventHandler_PendingCommands(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	handlerErr := errors.New("handler error")
+	commandHandler := &mocks.CommandHandler{Err: handlerErr}
+	repo := memory.NewRepo()
+	saga := &TestStatefulSaga{}
+	handler := NewStatefulEventHandler(saga, repo, commandHandler)
+
+	// The command should be kept with the saved state when it fails.
+	ctx := context.Background()
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	if err := handler.HandleEvent(ctx, event); err == nil {
+		t.Error("there should be an error")
+	}
+	checkTestState(t, ctx, repo, id, 1, 1)
+	entity, err := repo.Find(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if pending := entity.(State).PendingCommands(); len(pending) != 1 || pending[0].CommandType != mocks.CommandType {
+		t.Error("there should be a pending command:", pending)
+	}
+
+	// The pending command should be handled before the new one when the
+	// event is delivered again.
+	commandHandler.Err = nil
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	checkTestState(t, ctx, repo, id, 3, 2)
+	expectedCmds := []eh.Command{
+		&mocks.Command{ID: id, Content: "1"},
+		&mocks.Command{ID: id, Content: "2"},
+	}
+	if !reflect.DeepEqual(commandHandler.Commands, expectedCmds) {
+		t.Error("the produced commands should be correct:", commandHandler.Commands)
+	}
+	if entity, err = repo.Find(ctx, id); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if pending := entity.(State).PendingCommands(); len(pending) != 0 {
+		t.Error("there should be no pending commands:", pending)
+	}
+}
+
+func TestStatefulEventHandler_Errors(t *testing.T) {
+	commandHandler := &mocks.CommandHandler{}
+	saveErr := errors.New("save error")
+	repo := &mocks.Repo{
+		LoadErr: eh.RepoError{Err: eh.ErrEntityNotFound},
+		SaveErr: saveErr,
+	}
+	saga := &TestStatefulSaga{}
+	handler := NewStatefulEventHandler(saga, repo, commandHandler)
+
+	// Commands that are not registered can not be saved.
+	ctx := context.Background()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, uuid.New(), 1)
+	err := handler.HandleEvent(ctx, event)
+	if sErr, ok := err.(Error); !ok || sErr.Err != ErrInvalidCommand {
+		t.Error("there should be a invalid command error:", err)
+	}
+
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	// Commands should not be handled if the state could not be saved.
+	err = handler.HandleEvent(ctx, event)
+	if sErr, ok := err.(Error); !ok || sErr.Err != saveErr {
+		t.Error("there should be a save error:", err)
+	}
+	if len(commandHandler.Commands) != 0 {
+		t.Error("there should be no commands:", commandHandler.Commands)
+	}
+
+	// Saga errors.
+	saga.err = errors.New("saga error")
+	err = handler.HandleEvent(ctx, event)
+	if sErr, ok := err.(Error); !ok || sErr.Err != saga.err {
+		t.Error("there should be a saga error:", err)
+	}
+
+	// Invalid states.
+	repo.LoadErr = nil
+	repo.Entity = &mocks.Model{}
+	err = handler.HandleEvent(ctx, event)
+	if sErr, ok := err.(Error); !ok || sErr.Err != ErrInvalidState {
+		t.Error("there should be a invalid state error:", err)
+	}
+}
+
+const (
+	TestStatefulSagaType Type = "TestStatefulSaga"
+)
+
+type TestState struct {
+	BaseState
+	Count int
+}
+
+// TestStatefulSaga counts the events for each aggregate.
+type TestStatefulSaga struct {
+	runs int
+	err  error
+}
+
+func (m *TestStatefulSaga) SagaType() Type {
+	return TestStatefulSagaType
+}
+
+func (m *TestStatefulSaga) CorrelationID(ctx context.Context, event eh.Event) uuid.UUID {
+	return event.AggregateID()
+}
+
+func (m *TestStatefulSaga) NewState(id uuid.UUID) State {
+	return &TestState{BaseState: BaseState{ID: id}}
+}
+
+func (m *TestStatefulSaga) RunSaga(ctx context.Context, event eh.Event, state State) ([]eh.Command, error) {
+	if m.err != nil {
+		return nil, m.err
+	}
+	m.runs++
+
+	s, ok := state.(*TestState)
+	if !ok {
+		return nil, errors.New("invalid state")
+	}
+	s.Count++
+	return []eh.Command{
+		&mocks.Command{ID: s.ID, Content: strconv.Itoa(s.Count)},
+	}, nil
+}
+
+// concurrentSaga handles the event with another handler the first time it is
+// run, to modify the state concurrently.
+type concurrentSaga struct {
+	TestStatefulSaga
+	other eh.EventHandler
+}
+
+func (m *concurrentSaga) RunSaga(ctx context.Context, event eh.Event, state State) ([]eh.Command, error) {
+	if m.other != nil {
+		other := m.other
+		m.other = nil
+		if err := other.HandleEvent(ctx, event); err != nil {
+			return nil, err
+		}
+	}
+	return m.TestStatefulSaga.RunSaga(ctx, event, state)
+}
+
+// conflictRepo saves a new state concurrently after finding a state.
+type conflictRepo struct {
+	*memory.Repo
+	conflicts int
+}
+
+func (r *conflictRepo) Find(ctx context.Context, id uuid.UUID) (eh.Entity, error) {
+	entity, err := r.Repo.Find(ctx, id)
+	if r.conflicts > 0 {
+		r.conflicts--
+		state := &TestState{BaseState: BaseState{ID: id}, Count: 10}
+		version := 0
+		if s, ok := entity.(*TestState); ok {
+			state.Count = s.Count + 10
+			version = s.Version
+		}
+		state.Version = version + 1
+		if err := r.Repo.SaveVersioned(ctx, state, version); err != nil {
+			return nil, err
+		}
+	}
+	return entity, err
+}
+
+func checkTestState(t *testing.T, ctx context.Context, repo eh.ReadRepo, id uuid.UUID, version, count int) {
+	entity, err := repo.Find(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+		return
+	}
+	s, ok := entity.(*TestState)
+	if !ok || s.ID != id || s.Version != version || s.Count != count {
+		t.Error("the state should be correct:", entity)
+	}
+}
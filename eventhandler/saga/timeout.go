@@ -0,0 +1,337 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saga
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// TimeoutEventType is the event type of the events that are passed to
+// RunSaga when a timeout fires, for sagas that does not implement
+// TimeoutHandler. The events have TimeoutEventData as data.
+const TimeoutEventType eh.EventType = "SagaTimeout"
+
+// TimeoutEventData is the event data of timeout events.
+type TimeoutEventData struct {
+	Name     string    `json:"name"     bson:"name"`
+	Deadline time.Time `json:"deadline" bson:"deadline"`
+}
+
+// TimeoutHandler is an optional interface for stateful sagas that want to
+// handle fired timeouts with a callback instead of with timeout events.
+type TimeoutHandler interface {
+	// HandleTimeout handles a fired timeout with the current state, which it
+	// can modify, and can return commands, in the same way as RunSaga.
+	HandleTimeout(context.Context, Timeout, State) ([]eh.Command, error)
+}
+
+// Timeout is a timeout that has been requested by a saga.
+type Timeout struct {
+	// ID is the ID of the timeout, derived from the namespace, saga type,
+	// correlation ID and name.
+	ID            uuid.UUID
+	SagaType      Type
+	CorrelationID uuid.UUID
+	Name          string
+	Deadline      time.Time
+	// Version is the version of the saga state that requested the timeout,
+	// which is used to not replace or remove newer timeouts.
+	Version int
+	// Context is the marshaled context of the event that requested the
+	// timeout, which is used when the timeout fires.
+	Context map[string]interface{}
+}
+
+// TimeoutStore is a durable store of timeouts. The timeouts of all namespaces
+// are stored together, the namespace is kept in the context of the timeouts.
+type TimeoutStore interface {
+	// SaveTimeout saves a timeout, replacing any timeout with the same ID
+	// unless it has a higher version, in which case nothing is saved.
+	SaveTimeout(ctx context.Context, t Timeout) error
+
+	// RemoveTimeout removes a timeout if its version is at most the given
+	// version, newer timeouts are kept. Removing a timeout that does not
+	// exist is not an error.
+	RemoveTimeout(ctx context.Context, id uuid.UUID, version int) error
+
+	// ClaimDueTimeouts returns timeouts with a deadline before now that are
+	// not claimed, and claims them until now plus the lease, so that other
+	// schedulers skip them. Claimed timeouts that are not removed before the
+	// lease ends are returned again.
+	ClaimDueTimeouts(ctx context.Context, now time.Time, lease time.Duration) ([]Timeout, error)
+}
+
+// ErrTimeoutsNotSupported is when a saga requests a timeout without a timeout
+// scheduler, or outside of a StatefulEventHandler.
+var ErrTimeoutsNotSupported = errors.New("timeouts not supported")
+
+// ErrNoTimeoutHandler is when a timeout fires for a saga type that has no
+// handler registered with the scheduler. The timeout is removed.
+var ErrNoTimeoutHandler = errors.New("no handler for timeout")
+
+// RequestTimeout requests a timeout for the saga that is run with the context.
+// The saga will be run again when the deadline has passed, by calling
+// HandleTimeout or with a timeout event. Requesting a timeout with the same
+// name again replaces the old one. The timeout is saved with the state, and
+// scheduled after the state has been saved.
+func RequestTimeout(ctx context.Context, name string, deadline time.Time) error {
+	r, ok := ctx.Value(timeoutRequestsKey).(*timeoutRequests)
+	if !ok || r == nil {
+		return ErrTimeoutsNotSupported
+	}
+	r.requests = append(r.requests, timeoutRequest{name: name, deadline: deadline})
+	return nil
+}
+
+// CancelTimeout cancels a timeout for the saga that is run with the context.
+// The cancel is saved with the state, and done after the state has been saved.
+func CancelTimeout(ctx context.Context, name string) error {
+	r, ok := ctx.Value(timeoutRequestsKey).(*timeoutRequests)
+	if !ok || r == nil {
+		return ErrTimeoutsNotSupported
+	}
+	r.requests = append(r.requests, timeoutRequest{name: name, cancel: true})
+	return nil
+}
+
+type contextKey int
+
+const timeoutRequestsKey contextKey = iota
+
+// timeoutRequests collects the requests from one run of a saga.
+type timeoutRequests struct {
+	requests []timeoutRequest
+}
+
+type timeoutRequest struct {
+	name     string
+	deadline time.Time
+	cancel   bool
+}
+
+// PendingTimeout is a timeout to schedule, or to remove if Remove is set, that
+// is saved with the state of a saga until it has been applied to the store.
+type PendingTimeout struct {
+	ID      uuid.UUID `json:"id"      bson:"id"`
+	Timeout Timeout   `json:"timeout" bson:"timeout"`
+	Remove  bool      `json:"remove"  bson:"remove"`
+}
+
+// The namespace for the generated timeout IDs.
+var timeoutIDNamespace = uuid.MustParse("8f0b6a6e-4d3c-4b5e-9a55-3c1e6f0d2a71")
+
+// DefaultPollInterval is the default interval that the TimeoutScheduler polls
+// the store with.
+var DefaultPollInterval = time.Second
+
+// DefaultTimeoutLease is the default time that fired timeouts are claimed by
+// a TimeoutScheduler, before they can be fired again by any scheduler.
+var DefaultTimeoutLease = time.Minute
+
+// TimeoutScheduler schedules timeouts that are requested by stateful sagas in
+// a durable store, and polls the store for timeouts to fire. Timeouts are
+// delivered at least once, and are removed after the saga state has been saved
+// after handling them. Timeouts for saga types without a registered handler
+// are removed when they fire, and reported as ErrNoTimeoutHandler. Several schedulers can share a store, if the store
+// supports claiming timeouts across instances.
+type TimeoutScheduler struct {
+	store      TimeoutStore
+	handlers   map[Type]*StatefulEventHandler
+	handlersMu sync.RWMutex
+
+	pollInterval time.Duration
+	lease        time.Duration
+
+	errCh  chan error
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewTimeoutScheduler creates a new TimeoutScheduler, call Start to start
+// polling for timeouts.
+func NewTimeoutScheduler(store TimeoutStore) *TimeoutScheduler {
+	return &TimeoutScheduler{
+		store:        store,
+		handlers:     map[Type]*StatefulEventHandler{},
+		pollInterval: DefaultPollInterval,
+		lease:        DefaultTimeoutLease,
+		errCh:        make(chan error, 100),
+	}
+}
+
+// Start starts polling the store for timeouts in the background.
+func (s *TimeoutScheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.Poll(ctx); err != nil {
+				s.error(err)
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close stops polling the store.
+func (s *TimeoutScheduler) Close() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// Errors returns the error channel, with errors from firing timeouts.
+func (s *TimeoutScheduler) Errors() <-chan error {
+	return s.errCh
+}
+
+// Poll fires all due timeouts once. It is used by Start, and can also be used
+// to poll manually.
+func (s *TimeoutScheduler) Poll(ctx context.Context) error {
+	timeouts, err := s.store.ClaimDueTimeouts(ctx, time.Now(), s.lease)
+	if err != nil {
+		return err
+	}
+
+	for _, t := range timeouts {
+		if err := s.fire(t); err != nil {
+			s.error(err)
+		}
+	}
+
+	return nil
+}
+
+// fire runs the saga of a timeout with the context of the timeout.
+func (s *TimeoutScheduler) fire(t Timeout) error {
+	ctx := eh.UnmarshalContext(t.Context)
+
+	s.handlersMu.RLock()
+	h, ok := s.handlers[t.SagaType]
+	s.handlersMu.RUnlock()
+	if !ok {
+		// Drop the timeout, it would otherwise fire on every poll.
+		if err := s.store.RemoveTimeout(ctx, t.ID, t.Version); err != nil {
+			return Error{
+				Err:       err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+		return Error{
+			Err:       ErrNoTimeoutHandler,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return h.handle(ctx, t.CorrelationID, &t, func(ctx context.Context, state State) ([]eh.Command, error) {
+		if th, ok := h.saga.(TimeoutHandler); ok {
+			return th.HandleTimeout(ctx, t, state)
+		}
+		event := eh.NewEvent(TimeoutEventType, &TimeoutEventData{
+			Name:     t.Name,
+			Deadline: t.Deadline,
+		}, t.Deadline)
+		return h.saga.RunSaga(ctx, event, state)
+	})
+}
+
+// register registers a handler for its saga type.
+func (s *TimeoutScheduler) register(h *StatefulEventHandler) {
+	s.handlersMu.Lock()
+	defer s.handlersMu.Unlock()
+	s.handlers[h.saga.SagaType()] = h
+}
+
+// pendingTimeouts returns the pending timeouts to remove the fired timeout, if
+// any, and to schedule or cancel the timeouts requested by a run of a saga that
+// saves the state with the version. The fired timeout is only removed if it has
+// not been requested again, and requests only replace or remove timeouts from
+// older versions of the state, as other runs of the saga can have saved newer
+// timeouts concurrently.
+func pendingTimeouts(ctx context.Context, sagaType Type, id uuid.UUID, version int, r *timeoutRequests, fired *Timeout) []PendingTimeout {
+	var pending []PendingTimeout
+	if fired != nil {
+		pending = append(pending, PendingTimeout{
+			ID:      uuid.New(),
+			Timeout: *fired,
+			Remove:  true,
+		})
+	}
+
+	ns := eh.NamespaceFromContext(ctx)
+	for _, req := range r.requests {
+		pending = append(pending, PendingTimeout{
+			ID: uuid.New(),
+			Timeout: Timeout{
+				ID: uuid.NewSHA1(timeoutIDNamespace,
+					[]byte(ns+"/"+string(sagaType)+"/"+id.String()+"/"+req.name)),
+				SagaType:      sagaType,
+				CorrelationID: id,
+				Name:          req.name,
+				Deadline:      req.deadline,
+				Version:       version,
+				Context:       eh.MarshalContext(ctx),
+			},
+			Remove: req.cancel,
+		})
+	}
+
+	return pending
+}
+
+// apply schedules or removes a pending timeout.
+func (s *TimeoutScheduler) apply(ctx context.Context, p PendingTimeout) error {
+	var err error
+	if p.Remove {
+		err = s.store.RemoveTimeout(ctx, p.Timeout.ID, p.Timeout.Version)
+	} else {
+		err = s.store.SaveTimeout(ctx, p.Timeout)
+	}
+	if err != nil {
+		return Error{
+			Err:       err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return nil
+}
+
+func (s *TimeoutScheduler) error(err error) {
+	select {
+	case s.errCh <- err:
+	default:
+	}
+}
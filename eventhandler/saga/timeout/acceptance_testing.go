@@ -0,0 +1,149 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package timeout contains the acceptance test for implementations of the
+// saga.TimeoutStore, which are in the sub packages.
+package timeout
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/looplab/eventhorizon/eventhandler/saga"
+)
+
+// AcceptanceTest is the acceptance test that all implementations of
+// saga.TimeoutStore should pass. It should manually be called from a test
+// case in each implementation:
+//
+//   func TestTimeoutStore(t *testing.T) {
+//       store := NewTimeoutStore()
+//       timeout.AcceptanceTest(t, context.Background(), store)
+//   }
+//
+func AcceptanceTest(t *testing.T, ctx context.Context, store saga.TimeoutStore) {
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	t.Log("claim with no timeouts")
+	timeouts, err := store.ClaimDueTimeouts(ctx, now, time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(timeouts) != 0 {
+		t.Error("there should be no timeouts:", timeouts)
+	}
+
+	t.Log("save timeouts")
+	timeout1 := saga.Timeout{
+		ID:            uuid.New(),
+		SagaType:      saga.Type("saga"),
+		CorrelationID: uuid.New(),
+		Name:          "timeout1",
+		Deadline:      now.Add(-time.Second),
+		Context:       map[string]interface{}{"key": "value"},
+	}
+	timeout2 := saga.Timeout{
+		ID:            uuid.New(),
+		SagaType:      saga.Type("saga"),
+		CorrelationID: uuid.New(),
+		Name:          "timeout2",
+		Deadline:      now.Add(time.Hour),
+		Context:       map[string]interface{}{},
+	}
+	for _, timeout := range []saga.Timeout{timeout1, timeout2} {
+		if err := store.SaveTimeout(ctx, timeout); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("claim due timeouts")
+	timeouts, err = store.ClaimDueTimeouts(ctx, now, time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(timeouts, []saga.Timeout{timeout1}) {
+		t.Error("the timeouts should be correct:", timeouts)
+	}
+
+	t.Log("claimed timeouts should be skipped")
+	timeouts, err = store.ClaimDueTimeouts(ctx, now.Add(30*time.Second), time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(timeouts) != 0 {
+		t.Error("there should be no timeouts:", timeouts)
+	}
+
+	t.Log("timeouts should be claimed again after the lease")
+	timeouts, err = store.ClaimDueTimeouts(ctx, now.Add(2*time.Minute), time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(timeouts, []saga.Timeout{timeout1}) {
+		t.Error("the timeouts should be correct:", timeouts)
+	}
+
+	t.Log("replace timeout")
+	timeout1.Deadline = now.Add(3 * time.Minute)
+	if err := store.SaveTimeout(ctx, timeout1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	timeouts, err = store.ClaimDueTimeouts(ctx, now.Add(4*time.Minute), time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(timeouts, []saga.Timeout{timeout1}) {
+		t.Error("the timeouts should be correct:", timeouts)
+	}
+
+	t.Log("keep timeouts with newer versions")
+	timeout1.Version = 2
+	if err := store.SaveTimeout(ctx, timeout1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	older := timeout1
+	older.Version = 1
+	older.Deadline = now.Add(5 * time.Minute)
+	if err := store.SaveTimeout(ctx, older); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.RemoveTimeout(ctx, timeout1.ID, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	timeouts, err = store.ClaimDueTimeouts(ctx, now.Add(6*time.Minute), time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(timeouts, []saga.Timeout{timeout1}) {
+		t.Error("the timeouts should be correct:", timeouts)
+	}
+
+	t.Log("remove timeouts")
+	for _, id := range []uuid.UUID{timeout1.ID, timeout2.ID, uuid.New()} {
+		if err := store.RemoveTimeout(ctx, id, 2); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	timeouts, err = store.ClaimDueTimeouts(ctx, now.Add(24*time.Hour), time.Minute)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(timeouts) != 0 {
+		t.Error("there should be no timeouts:", timeouts)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/looplab/eventhorizon/eventhandler/saga"
+)
+
+// TimeoutStore implements saga.TimeoutStore as an in memory structure.
+type TimeoutStore struct {
+	timeouts   map[uuid.UUID]*entry
+	timeoutsMu sync.Mutex
+}
+
+var _ = saga.TimeoutStore(&TimeoutStore{})
+
+type entry struct {
+	saga.Timeout
+	claimedUntil time.Time
+}
+
+// NewTimeoutStore creates a new TimeoutStore using memory as storage.
+func NewTimeoutStore() *TimeoutStore {
+	return &TimeoutStore{
+		timeouts: map[uuid.UUID]*entry{},
+	}
+}
+
+// SaveTimeout implements the SaveTimeout method of the saga.TimeoutStore interface.
+func (s *TimeoutStore) SaveTimeout(ctx context.Context, t saga.Timeout) error {
+	s.timeoutsMu.Lock()
+	defer s.timeoutsMu.Unlock()
+
+	if old, ok := s.timeouts[t.ID]; ok && old.Version > t.Version {
+		return nil
+	}
+	s.timeouts[t.ID] = &entry{Timeout: t}
+	return nil
+}
+
+// RemoveTimeout implements the RemoveTimeout method of the saga.TimeoutStore interface.
+func (s *TimeoutStore) RemoveTimeout(ctx context.Context, id uuid.UUID, version int) error {
+	s.timeoutsMu.Lock()
+	defer s.timeoutsMu.Unlock()
+
+	if t, ok := s.timeouts[id]; ok && t.Version <= version {
+		delete(s.timeouts, id)
+	}
+	return nil
+}
+
+// ClaimDueTimeouts implements the ClaimDueTimeouts method of the saga.TimeoutStore interface.
+func (s *TimeoutStore) ClaimDueTimeouts(ctx context.Context, now time.Time, lease time.Duration) ([]saga.Timeout, error) {
+	s.timeoutsMu.Lock()
+	defer s.timeoutsMu.Unlock()
+
+	timeouts := []saga.Timeout{}
+	for _, t := range s.timeouts {
+		if t.Deadline.After(now) || t.claimedUntil.After(now) {
+			continue
+		}
+		t.claimedUntil = now.Add(lease)
+		timeouts = append(timeouts, t.Timeout)
+	}
+
+	// Fire the timeouts in order of their deadlines.
+	sort.Slice(timeouts, func(i, j int) bool {
+		return timeouts[i].Deadline.Before(timeouts[j].Deadline)
+	})
+
+	return timeouts, nil
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/eventhandler/saga"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// ErrCouldNotClearDB is when the database could not be cleared.
+var ErrCouldNotClearDB = errors.New("could not clear database")
+
+// ErrCouldNotSaveTimeout is when a timeout could not be saved.
+var ErrCouldNotSaveTimeout = errors.New("could not save timeout")
+
+// ErrCouldNotRemoveTimeout is when a timeout could not be removed.
+var ErrCouldNotRemoveTimeout = errors.New("could not remove timeout")
+
+// ErrCouldNotClaimTimeouts is when timeouts could not be claimed.
+var ErrCouldNotClaimTimeouts = errors.New("could not claim timeouts")
+
+// MaxClaimedTimeouts is the max number of timeouts that are claimed at once.
+var MaxClaimedTimeouts = 100
+
+// TimeoutStore implements a saga.TimeoutStore for MongoDB. The timeouts of
+// all namespaces are stored in the "saga_timeouts" collection in the DB with
+// the DB prefix as name. Timeouts are claimed atomically, so several
+// schedulers can share the store.
+type TimeoutStore struct {
+	session *mgo.Session
+	dbName  string
+}
+
+var _ = saga.TimeoutStore(&TimeoutStore{})
+
+// NewTimeoutStore creates a new TimeoutStore.
+func NewTimeoutStore(url, dbPrefix string) (*TimeoutStore, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewTimeoutStoreWithSession(session, dbPrefix)
+}
+
+// NewTimeoutStoreWithSession creates a new TimeoutStore with a session.
+func NewTimeoutStoreWithSession(session *mgo.Session, dbPrefix string) (*TimeoutStore, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &TimeoutStore{
+		session: session,
+		dbName:  dbPrefix,
+	}
+
+	return s, nil
+}
+
+// SaveTimeout implements the SaveTimeout method of the saga.TimeoutStore interface.
+func (s *TimeoutStore) SaveTimeout(ctx context.Context, t saga.Timeout) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	// The upsert fails with a duplicate key if there is a timeout with a
+	// higher version, as the query will not match the existing document.
+	if _, err := sess.DB(s.dbName).C("saga_timeouts").Upsert(bson.M{
+		"_id":     t.ID.String(),
+		"version": bson.M{"$lte": t.Version},
+	}, dbTimeout{
+		ID:            t.ID.String(),
+		SagaType:      t.SagaType,
+		CorrelationID: t.CorrelationID.String(),
+		Name:          t.Name,
+		Deadline:      t.Deadline,
+		Version:       t.Version,
+		Context:       t.Context,
+	}); mgo.IsDup(err) {
+		return nil
+	} else if err != nil {
+		return saga.Error{
+			Err:       ErrCouldNotSaveTimeout,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return nil
+}
+
+// RemoveTimeout implements the RemoveTimeout method of the saga.TimeoutStore interface.
+func (s *TimeoutStore) RemoveTimeout(ctx context.Context, id uuid.UUID, version int) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	if err := sess.DB(s.dbName).C("saga_timeouts").Remove(bson.M{
+		"_id":     id.String(),
+		"version": bson.M{"$lte": version},
+	}); err != nil && err != mgo.ErrNotFound {
+		return saga.Error{
+			Err:       ErrCouldNotRemoveTimeout,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return nil
+}
+
+// ClaimDueTimeouts implements the ClaimDueTimeouts method of the saga.TimeoutStore interface.
+// At most MaxClaimedTimeouts are claimed at once.
+func (s *TimeoutStore) ClaimDueTimeouts(ctx context.Context, now time.Time, lease time.Duration) ([]saga.Timeout, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	query := bson.M{
+		"deadline":      bson.M{"$lte": now},
+		"claimed_until": bson.M{"$lte": now},
+	}
+	change := mgo.Change{
+		Update:    bson.M{"$set": bson.M{"claimed_until": now.Add(lease)}},
+		ReturnNew: true,
+	}
+
+	timeouts := []saga.Timeout{}
+	for len(timeouts) < MaxClaimedTimeouts {
+		var t dbTimeout
+		_, err := sess.DB(s.dbName).C("saga_timeouts").Find(query).Sort("deadline").Apply(change, &t)
+		if err == mgo.ErrNotFound {
+			break
+		} else if err != nil {
+			return nil, saga.Error{
+				Err:       ErrCouldNotClaimTimeouts,
+				BaseErr:   err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+
+		id, err := uuid.Parse(t.ID)
+		if err != nil {
+			return nil, saga.Error{
+				Err:       ErrCouldNotClaimTimeouts,
+				BaseErr:   err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+		correlationID, err := uuid.Parse(t.CorrelationID)
+		if err != nil {
+			return nil, saga.Error{
+				Err:       ErrCouldNotClaimTimeouts,
+				BaseErr:   err,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+		timeouts = append(timeouts, saga.Timeout{
+			ID:            id,
+			SagaType:      t.SagaType,
+			CorrelationID: correlationID,
+			Name:          t.Name,
+			Deadline:      t.Deadline.UTC(),
+			Version:       t.Version,
+			Context:       t.Context,
+		})
+	}
+
+	return timeouts, nil
+}
+
+// Clear clears the timeout storage.
+func (s *TimeoutStore) Clear(ctx context.Context) error {
+	if err := s.session.DB(s.dbName).C("saga_timeouts").DropCollection(); err != nil {
+		return saga.Error{
+			Err:       ErrCouldNotClearDB,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+	return nil
+}
+
+// Close closes the database session.
+func (s *TimeoutStore) Close() {
+	s.session.Close()
+}
+
+// dbTimeout is the DB representation of a timeout.
+type dbTimeout struct {
+	ID            string                 `bson:"_id"`
+	SagaType      saga.Type              `bson:"saga_type"`
+	CorrelationID string                 `bson:"correlation_id"`
+	Name          string                 `bson:"name"`
+	Deadline      time.Time              `bson:"deadline"`
+	Version       int                    `bson:"version"`
+	Context       map[string]interface{} `bson:"context"`
+	ClaimedUntil  time.Time              `bson:"claimed_until"`
+}
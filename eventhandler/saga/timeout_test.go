@@ -0,0 +1,428 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package saga
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/repo/memory"
+)
+
+func TestTimeoutScheduler_Callback(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	commandHandler := &mocks.CommandHandler{}
+	store := &testTimeoutStore{}
+	scheduler := NewTimeoutScheduler(store)
+	saga := &TestTimeoutSaga{}
+	handler := NewStatefulEventHandler(saga, memory.NewRepo(), commandHandler)
+	handler.SetTimeoutScheduler(scheduler)
+
+	// Request a timeout that has already passed.
+	ctx := eh.NewContextWithNamespace(context.Background(), "ns")
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	saga.deadline = timestamp
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(store.timeouts) != 1 {
+		t.Fatal("there should be a timeout:", store.timeouts)
+	}
+
+	if err := scheduler.Poll(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if saga.timeout.Name != "expire" || saga.timeout.CorrelationID != id ||
+		!saga.timeout.Deadline.Equal(timestamp) {
+		t.Error("the timeout should be correct:", saga.timeout)
+	}
+	expectedCmds := []eh.Command{&mocks.Command{ID: id, Content: "expired"}}
+	if !reflect.DeepEqual(commandHandler.Commands, expectedCmds) {
+		t.Error("the produced commands should be correct:", commandHandler.Commands)
+	}
+	if ns := eh.NamespaceFromContext(commandHandler.Context); ns != "ns" {
+		t.Error("the namespace should be correct:", ns)
+	}
+
+	// The fired timeout should be removed.
+	if len(store.timeouts) != 0 {
+		t.Error("there should be no timeouts:", store.timeouts)
+	}
+}
+
+func TestTimeoutScheduler_Event(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	commandHandler := &mocks.CommandHandler{}
+	store := &testTimeoutStore{}
+	scheduler := NewTimeoutScheduler(store)
+	saga := &TestStatefulSaga{}
+	handler := NewStatefulEventHandler(&TestTimeoutEventSaga{TestStatefulSaga: saga}, memory.NewRepo(), commandHandler)
+	handler.SetTimeoutScheduler(scheduler)
+
+	ctx := context.Background()
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := scheduler.Poll(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// The saga should be run with a timeout event.
+	expectedCmds := []eh.Command{
+		&mocks.Command{ID: id, Content: "1"},
+		&mocks.Command{ID: id, Content: "2"},
+	}
+	if !reflect.DeepEqual(commandHandler.Commands, expectedCmds) {
+		t.Error("the produced commands should be correct:", commandHandler.Commands)
+	}
+	if saga.runs != 2 {
+		t.Error("the saga should be run with the timeout:", saga.runs)
+	}
+	if len(store.timeouts) != 0 {
+		t.Error("there should be no timeouts:", store.timeouts)
+	}
+}
+
+func TestTimeoutScheduler_Cancel(t *testing.T) {
+	store := &testTimeoutStore{}
+	scheduler := NewTimeoutScheduler(store)
+	saga := &TestTimeoutSaga{}
+	handler := NewStatefulEventHandler(saga, memory.NewRepo(), &mocks.CommandHandler{})
+	handler.SetTimeoutScheduler(scheduler)
+
+	ctx := context.Background()
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	saga.deadline = timestamp.Add(time.Hour)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// Requesting again should replace the timeout.
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(store.timeouts) != 1 {
+		t.Error("there should be one timeout:", store.timeouts)
+	}
+
+	saga.cancel = true
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(store.timeouts) != 0 {
+		t.Error("there should be no timeouts:", store.timeouts)
+	}
+}
+
+func TestTimeoutScheduler_Rescheduled(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	commandHandler := &mocks.CommandHandler{}
+	store := &testTimeoutStore{}
+	scheduler := NewTimeoutScheduler(store)
+	saga := &TestTimeoutSaga{}
+	handler := NewStatefulEventHandler(saga, memory.NewRepo(), commandHandler)
+	handler.SetTimeoutScheduler(scheduler)
+
+	ctx := context.Background()
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	saga.deadline = timestamp
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	timeouts, err := store.ClaimDueTimeouts(ctx, time.Now(), time.Minute)
+	if err != nil || len(timeouts) != 1 {
+		t.Fatal("there should be a claimed timeout:", timeouts, err)
+	}
+
+	// The timeout is requested again before the claimed one has been handled,
+	// which should not remove the new one.
+	saga.deadline = timestamp.Add(time.Hour)
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := scheduler.fire(timeouts[0]); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(store.timeouts) != 1 {
+		t.Fatal("the new timeout should be kept:", store.timeouts)
+	}
+	// The state is saved twice for each event, the second time to remove
+	// the pending timeout.
+	for _, timeout := range store.timeouts {
+		if !timeout.Deadline.Equal(saga.deadline) || timeout.Version != 3 {
+			t.Error("the timeout should be correct:", timeout)
+		}
+	}
+}
+
+func TestTimeoutScheduler_StoreError(t *testing.T) {
+	store := &testTimeoutStore{}
+	scheduler := NewTimeoutScheduler(store)
+	saga := &TestTimeoutSaga{}
+	repo := memory.NewRepo()
+	handler := NewStatefulEventHandler(saga, repo, &mocks.CommandHandler{})
+	handler.SetTimeoutScheduler(scheduler)
+
+	ctx := context.Background()
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp,
+		mocks.AggregateType, id, 1)
+	saga.deadline = timestamp
+	storeErr := errors.New("store error")
+	store.err = storeErr
+	err := handler.HandleEvent(ctx, event)
+	if sErr, ok := err.(Error); !ok || sErr.Err != storeErr {
+		t.Error("there should be a store error:", err)
+	}
+
+	// The timeout should be kept with the state.
+	entity, err := repo.Find(ctx, id)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	state := entity.(State)
+	if p := state.PendingTimeouts(); len(p) != 1 || p[0].Timeout.Name != "expire" ||
+		p[0].Timeout.Version != 1 || p[0].Remove {
+		t.Error("the pending timeout should be saved:", p)
+	}
+
+	// The timeout should be scheduled on the next event.
+	store.err = nil
+	saga.cancel = true
+	if err := handler.HandleEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(store.timeouts) != 0 {
+		t.Error("the timeout should be scheduled and cancelled:", store.timeouts)
+	}
+	if entity, _ := repo.Find(ctx, id); len(entity.(State).PendingTimeouts()) != 0 {
+		t.Error("there should be no pending timeouts:", entity.(State).PendingTimeouts())
+	}
+}
+
+func TestTimeoutScheduler_NoHandler(t *testing.T) {
+	store := &testTimeoutStore{}
+	scheduler := NewTimeoutScheduler(store)
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	store.SaveTimeout(context.Background(), Timeout{
+		ID:            uuid.New(),
+		SagaType:      "UnknownSaga",
+		CorrelationID: uuid.New(),
+		Name:          "expire",
+		Deadline:      timestamp,
+		Version:       1,
+	})
+
+	// Timeouts of unknown saga types should be reported and removed.
+	if err := scheduler.Poll(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	select {
+	case err := <-scheduler.Errors():
+		if sErr, ok := err.(Error); !ok || sErr.Err != ErrNoTimeoutHandler {
+			t.Error("there should be a no timeout handler error:", err)
+		}
+	default:
+		t.Error("there should be an error")
+	}
+	if len(store.timeouts) != 0 {
+		t.Error("the timeout should be removed:", store.timeouts)
+	}
+}
+
+func TestTimeoutScheduler_Start(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	cmdCh := make(chan eh.Command, 1)
+	commandHandler := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		cmdCh <- cmd
+		return nil
+	})
+	store := &testTimeoutStore{}
+	scheduler := NewTimeoutScheduler(store)
+	scheduler.pollInterval = 10 * time.Millisecond
+	saga := &TestTimeoutSaga{}
+	handler := NewStatefulEventHandler(saga, memory.NewRepo(), commandHandler)
+	handler.SetTimeoutScheduler(scheduler)
+	scheduler.Start()
+	defer scheduler.Close()
+
+	saga.deadline = time.Now().Add(20 * time.Millisecond)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, time.Now(),
+		mocks.AggregateType, uuid.New(), 1)
+	if err := handler.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	select {
+	case cmd := <-cmdCh:
+		if cmd.(*mocks.Command).Content != "expired" {
+			t.Error("the command should be correct:", cmd)
+		}
+	case <-time.After(time.Second):
+		t.Error("the timeout should fire")
+	}
+	select {
+	case err := <-scheduler.Errors():
+		t.Error("there should be no error:", err)
+	default:
+	}
+}
+
+func TestRequestTimeout_NotSupported(t *testing.T) {
+	if err := RequestTimeout(context.Background(), "name", time.Now()); err != ErrTimeoutsNotSupported {
+		t.Error("there should be a timeouts not supported error:", err)
+	}
+	if err := CancelTimeout(context.Background(), "name"); err != ErrTimeoutsNotSupported {
+		t.Error("there should be a timeouts not supported error:", err)
+	}
+
+	// Handlers without a scheduler.
+	saga := &TestTimeoutSaga{}
+	handler := NewStatefulEventHandler(saga, memory.NewRepo(), &mocks.CommandHandler{})
+	event := eh.NewEventForAggregate(mocks.EventType, nil, time.Now(),
+		mocks.AggregateType, uuid.New(), 1)
+	err := handler.HandleEvent(context.Background(), event)
+	if sErr, ok := err.(Error); !ok || sErr.Err != ErrTimeoutsNotSupported {
+		t.Error("there should be a timeouts not supported error:", err)
+	}
+}
+
+// TestTimeoutSaga requests a timeout for each event and handles it with a
+// callback.
+type TestTimeoutSaga struct {
+	deadline time.Time
+	cancel   bool
+	timeout  Timeout
+}
+
+func (m *TestTimeoutSaga) SagaType() Type {
+	return Type("TestTimeoutSaga")
+}
+
+func (m *TestTimeoutSaga) CorrelationID(ctx context.Context, event eh.Event) uuid.UUID {
+	return event.AggregateID()
+}
+
+func (m *TestTimeoutSaga) NewState(id uuid.UUID) State {
+	return &TestState{BaseState: BaseState{ID: id}}
+}
+
+func (m *TestTimeoutSaga) RunSaga(ctx context.Context, event eh.Event, state State) ([]eh.Command, error) {
+	if m.cancel {
+		return nil, CancelTimeout(ctx, "expire")
+	}
+	return nil, RequestTimeout(ctx, "expire", m.deadline)
+}
+
+func (m *TestTimeoutSaga) HandleTimeout(ctx context.Context, t Timeout, state State) ([]eh.Command, error) {
+	m.timeout = t
+	return []eh.Command{
+		&mocks.Command{ID: state.EntityID(), Content: "expired"},
+	}, nil
+}
+
+// TestTimeoutEventSaga requests a timeout for the first event and handles it
+// as a timeout event.
+type TestTimeoutEventSaga struct {
+	*TestStatefulSaga
+}
+
+func (m *TestTimeoutEventSaga) RunSaga(ctx context.Context, event eh.Event, state State) ([]eh.Command, error) {
+	if event.EventType() == TimeoutEventType {
+		if data, ok := event.Data().(*TimeoutEventData); !ok || data.Name != "expire" {
+			return nil, ErrInvalidState
+		}
+	} else if err := RequestTimeout(ctx, "expire", time.Time{}); err != nil {
+		return nil, err
+	}
+	return m.TestStatefulSaga.RunSaga(ctx, event, state)
+}
+
+// testTimeoutStore is a minimal timeout store, the real ones can not be used
+// here as they import this package.
+type testTimeoutStore struct {
+	timeouts map[uuid.UUID]Timeout
+	err      error
+	mu       sync.Mutex
+}
+
+func (s *testTimeoutStore) SaveTimeout(ctx context.Context, t Timeout) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.timeouts == nil {
+		s.timeouts = map[uuid.UUID]Timeout{}
+	}
+	if old, ok := s.timeouts[t.ID]; !ok || old.Version <= t.Version {
+		s.timeouts[t.ID] = t
+	}
+	return nil
+}
+
+func (s *testTimeoutStore) RemoveTimeout(ctx context.Context, id uuid.UUID, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if t, ok := s.timeouts[id]; ok && t.Version <= version {
+		delete(s.timeouts, id)
+	}
+	return nil
+}
+
+func (s *testTimeoutStore) ClaimDueTimeouts(ctx context.Context, now time.Time, lease time.Duration) ([]Timeout, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	timeouts := []Timeout{}
+	for id, t := range s.timeouts {
+		if !t.Deadline.After(now) {
+			timeouts = append(timeouts, t)
+			// Claim by moving the deadline.
+			t.Deadline = now.Add(lease)
+			s.timeouts[id] = t
+		}
+	}
+	return timeouts, nil
+}
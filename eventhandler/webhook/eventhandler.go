@@ -0,0 +1,478 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jpillora/backoff"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// SignatureHeader is the HTTP header containing the HMAC-SHA256 signature of
+// the timestamp and the request body, in the form "sha256=<hex digest>".
+const SignatureHeader = "X-Eventhorizon-Signature"
+
+// TimestampHeader is the HTTP header containing the time of the delivery
+// attempt as Unix seconds, which is signed together with the body so that
+// receivers can reject old requests.
+const TimestampHeader = "X-Eventhorizon-Timestamp"
+
+// EventTypeHeader is the HTTP header containing the event type.
+const EventTypeHeader = "X-Eventhorizon-Event"
+
+// DeliveryHeader is the HTTP header containing the unique delivery ID, which
+// is the same for all attempts of a delivery.
+const DeliveryHeader = "X-Eventhorizon-Delivery"
+
+// DefaultTimeout is the timeout of the HTTP client that is used when none is
+// set, for each delivery attempt.
+var DefaultTimeout = 10 * time.Second
+
+// DefaultSignatureTolerance is the max age of the timestamp of a request for
+// VerifySignature to accept it.
+var DefaultSignatureTolerance = 5 * time.Minute
+
+// DefaultMaxAttempts is the max number of attempts to deliver an event.
+var DefaultMaxAttempts = 5
+
+// DefaultMinBackoff is the backoff after the first failed attempt.
+var DefaultMinBackoff = time.Second
+
+// DefaultMaxBackoff is the max backoff between attempts.
+var DefaultMaxBackoff = time.Minute
+
+// DefaultQueueSize is the number of events that can be queued per webhook.
+var DefaultQueueSize = 100
+
+// DefaultDeliveryLogSize is the max number of entries kept in the delivery log.
+var DefaultDeliveryLogSize = 1000
+
+// ErrInvalidURL is when a webhook is registered without a valid HTTP or HTTPS
+// URL.
+var ErrInvalidURL = errors.New("invalid webhook URL")
+
+// ErrMissingSecret is when a webhook is registered without a secret and
+// without allowing unsigned deliveries.
+var ErrMissingSecret = errors.New("missing webhook secret")
+
+// ErrWebhookNotFound is when a webhook could not be found.
+var ErrWebhookNotFound = errors.New("webhook not found")
+
+// ErrWebhookAlreadyRegistered is when a webhook with the same ID is registered.
+var ErrWebhookAlreadyRegistered = errors.New("webhook already registered")
+
+// ErrQueueFull is when an event could not be queued for a webhook.
+var ErrQueueFull = errors.New("webhook queue full")
+
+// Webhook is a subscriber endpoint that events are delivered to.
+type Webhook struct {
+	ID  uuid.UUID `json:"id"`
+	URL string    `json:"url"`
+	// Secret is used as key for the signature, it is never returned by the
+	// admin API.
+	Secret string `json:"secret,omitempty"`
+	// Unsigned must be set to register a webhook without a secret, its
+	// deliveries are then sent without the SignatureHeader and TimestampHeader.
+	Unsigned bool `json:"unsigned,omitempty"`
+	// EventTypes is an optional list of event types to deliver, all events
+	// passed to the handler are delivered if it is empty.
+	EventTypes []eh.EventType `json:"event_types,omitempty"`
+}
+
+// Delivery is an entry in the delivery log, one for each attempt.
+type Delivery struct {
+	ID          uuid.UUID    `json:"id"`
+	WebhookID   uuid.UUID    `json:"webhook_id"`
+	EventType   eh.EventType `json:"event_type"`
+	AggregateID uuid.UUID    `json:"aggregate_id"`
+	Version     int          `json:"version"`
+	Attempt     int          `json:"attempt"`
+	StatusCode  int          `json:"status_code,omitempty"`
+	Error       string       `json:"error,omitempty"`
+	Timestamp   time.Time    `json:"timestamp"`
+}
+
+// Payload is the JSON body that is posted to the webhooks.
+type Payload struct {
+	EventType     eh.EventType     `json:"event_type"`
+	Data          eh.EventData     `json:"data,omitempty"`
+	Timestamp     time.Time        `json:"timestamp"`
+	AggregateType eh.AggregateType `json:"aggregate_type"`
+	AggregateID   uuid.UUID        `json:"aggregate_id"`
+	Version       int              `json:"version"`
+}
+
+// EventHandler is an observer that delivers events as signed JSON POSTs to
+// the registered webhooks. Each webhook has its own queue, so that retries
+// for a slow or failing subscriber does not hold back the others.
+// Use an eventhorizon.EventMatcher when adding the handler to the event bus
+// to select which events to deliver.
+type EventHandler struct {
+	client      *http.Client
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+
+	subscribers   map[uuid.UUID]*subscriber
+	subscribersMu sync.RWMutex
+
+	log   []Delivery
+	logMu sync.RWMutex
+
+	errCh chan Error
+}
+
+var _ = eh.EventHandler(&EventHandler{})
+
+// NewEventHandler creates a new EventHandler. The HTTP client is used for all
+// deliveries, a client with DefaultTimeout is used if it is nil. Clients
+// without a timeout should not be used, as a subscriber that does not respond
+// would stop all deliveries to it.
+func NewEventHandler(client *http.Client) *EventHandler {
+	if client == nil {
+		client = &http.Client{Timeout: DefaultTimeout}
+	}
+	return &EventHandler{
+		client:      client,
+		maxAttempts: DefaultMaxAttempts,
+		minBackoff:  DefaultMinBackoff,
+		maxBackoff:  DefaultMaxBackoff,
+		subscribers: map[uuid.UUID]*subscriber{},
+		errCh:       make(chan Error, 100),
+	}
+}
+
+// HandlerType implements the HandlerType method of the eventhorizon.EventHandler interface.
+func (h *EventHandler) HandlerType() eh.EventHandlerType {
+	return eh.EventHandlerType("webhook")
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler interface.
+// It queues the event for delivery to all webhooks that subscribe to it. The
+// event is dropped for webhooks with a full queue, which is reported as an
+// Error with ErrQueueFull on the error channel, as it is queued for the other
+// webhooks.
+func (h *EventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	body, err := json.Marshal(Payload{
+		EventType:     event.EventType(),
+		Data:          event.Data(),
+		Timestamp:     event.Timestamp(),
+		AggregateType: event.AggregateType(),
+		AggregateID:   event.AggregateID(),
+		Version:       event.Version(),
+	})
+	if err != nil {
+		return errors.New("could not marshal event: " + err.Error())
+	}
+
+	h.subscribersMu.RLock()
+	defer h.subscribersMu.RUnlock()
+
+	for _, s := range h.subscribers {
+		if !s.subscribes(event.EventType()) {
+			continue
+		}
+		select {
+		case s.queue <- delivery{id: uuid.New(), event: event, body: body}:
+		default:
+			h.error(Error{Err: ErrQueueFull, Ctx: ctx, Webhook: s.webhook, Event: event})
+		}
+	}
+
+	return nil
+}
+
+// Register registers a webhook and starts delivering events to it. A new ID
+// is generated if it is not set.
+func (h *EventHandler) Register(w Webhook) (Webhook, error) {
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return Webhook{}, ErrInvalidURL
+	}
+	if w.Secret == "" && !w.Unsigned {
+		return Webhook{}, ErrMissingSecret
+	}
+	if w.ID == uuid.Nil {
+		w.ID = uuid.New()
+	}
+
+	h.subscribersMu.Lock()
+	defer h.subscribersMu.Unlock()
+
+	if _, ok := h.subscribers[w.ID]; ok {
+		return Webhook{}, ErrWebhookAlreadyRegistered
+	}
+
+	s := &subscriber{
+		webhook: w,
+		queue:   make(chan delivery, DefaultQueueSize),
+		done:    make(chan struct{}),
+	}
+	h.subscribers[w.ID] = s
+	go h.deliver(s)
+
+	return w, nil
+}
+
+// Unregister stops delivering events to a webhook. Events that are queued or
+// being retried for the webhook are dropped.
+func (h *EventHandler) Unregister(id uuid.UUID) error {
+	h.subscribersMu.Lock()
+	defer h.subscribersMu.Unlock()
+
+	s, ok := h.subscribers[id]
+	if !ok {
+		return ErrWebhookNotFound
+	}
+	delete(h.subscribers, id)
+	close(s.done)
+
+	return nil
+}
+
+// Webhook returns a registered webhook.
+func (h *EventHandler) Webhook(id uuid.UUID) (Webhook, error) {
+	h.subscribersMu.RLock()
+	defer h.subscribersMu.RUnlock()
+
+	s, ok := h.subscribers[id]
+	if !ok {
+		return Webhook{}, ErrWebhookNotFound
+	}
+
+	return s.webhook, nil
+}
+
+// Webhooks returns all registered webhooks.
+func (h *EventHandler) Webhooks() []Webhook {
+	h.subscribersMu.RLock()
+	defer h.subscribersMu.RUnlock()
+
+	webhooks := make([]Webhook, 0, len(h.subscribers))
+	for _, s := range h.subscribers {
+		webhooks = append(webhooks, s.webhook)
+	}
+
+	return webhooks
+}
+
+// Deliveries returns the delivery log for a webhook, oldest first. All entries
+// are returned if the ID is uuid.Nil. The log keeps the last
+// DefaultDeliveryLogSize entries.
+func (h *EventHandler) Deliveries(webhookID uuid.UUID) []Delivery {
+	h.logMu.RLock()
+	defer h.logMu.RUnlock()
+
+	deliveries := []Delivery{}
+	for _, d := range h.log {
+		if webhookID == uuid.Nil || d.WebhookID == webhookID {
+			deliveries = append(deliveries, d)
+		}
+	}
+
+	return deliveries
+}
+
+// Errors returns the error channel, containing deliveries that failed after
+// all attempts and events that were dropped because of a full queue.
+func (h *EventHandler) Errors() <-chan Error {
+	return h.errCh
+}
+
+// Close stops delivering events to all webhooks.
+func (h *EventHandler) Close() {
+	h.subscribersMu.Lock()
+	defer h.subscribersMu.Unlock()
+
+	for id, s := range h.subscribers {
+		delete(h.subscribers, id)
+		close(s.done)
+	}
+}
+
+// Sign returns the signature of a timestamp and body, as used in the
+// SignatureHeader. The timestamp is the value of the TimestampHeader.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature verifies the signature of a timestamp and body, and that the
+// timestamp is not older than DefaultSignatureTolerance, to not accept requests
+// that are sent again. It can be used by receivers of webhooks.
+func VerifySignature(secret string, body []byte, timestamp, signature string) bool {
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature)) {
+		return false
+	}
+
+	t, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := time.Since(time.Unix(t, 0))
+	return age <= DefaultSignatureTolerance && age >= -DefaultSignatureTolerance
+}
+
+// Error is an error for a delivery that failed.
+type Error struct {
+	Err     error
+	Ctx     context.Context
+	Webhook Webhook
+	Event   eh.Event
+}
+
+// Error implements the Error method of the error interface.
+func (e Error) Error() string {
+	return fmt.Sprintf("%s (%s): %s", e.Event.String(), e.Webhook.URL, e.Err.Error())
+}
+
+type subscriber struct {
+	webhook Webhook
+	queue   chan delivery
+	done    chan struct{}
+}
+
+func (s *subscriber) subscribes(t eh.EventType) bool {
+	if len(s.webhook.EventTypes) == 0 {
+		return true
+	}
+	for _, et := range s.webhook.EventTypes {
+		if et == t {
+			return true
+		}
+	}
+	return false
+}
+
+type delivery struct {
+	id    uuid.UUID
+	event eh.Event
+	body  []byte
+}
+
+// deliver sends all queued events to the webhook, in order.
+func (h *EventHandler) deliver(s *subscriber) {
+	for {
+		select {
+		case <-s.done:
+			return
+		case d := <-s.queue:
+			h.deliverWithRetry(s, d)
+		}
+	}
+}
+
+func (h *EventHandler) deliverWithRetry(s *subscriber, d delivery) {
+	delay := &backoff.Backoff{
+		Min: h.minBackoff,
+		Max: h.maxBackoff,
+	}
+
+	var err error
+	for attempt := 1; attempt <= h.maxAttempts; attempt++ {
+		if err = h.post(s.webhook, d, attempt); err == nil {
+			return
+		}
+
+		if attempt == h.maxAttempts {
+			break
+		}
+		select {
+		case <-s.done:
+			return
+		case <-time.After(delay.Duration()):
+		}
+	}
+
+	h.error(Error{
+		Err:     fmt.Errorf("could not deliver event after %d attempts: %s", h.maxAttempts, err),
+		Ctx:     context.Background(),
+		Webhook: s.webhook,
+		Event:   d.event,
+	})
+}
+
+func (h *EventHandler) post(w Webhook, d delivery, attempt int) error {
+	entry := Delivery{
+		ID:          d.id,
+		WebhookID:   w.ID,
+		EventType:   d.event.EventType(),
+		AggregateID: d.event.AggregateID(),
+		Version:     d.event.Version(),
+		Attempt:     attempt,
+		Timestamp:   time.Now(),
+	}
+	err := func() error {
+		req, err := http.NewRequest(http.MethodPost, w.URL, bytes.NewReader(d.body))
+		if err != nil {
+			return errors.New("could not create request: " + err.Error())
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EventTypeHeader, string(d.event.EventType()))
+		req.Header.Set(DeliveryHeader, d.id.String())
+		if w.Secret != "" {
+			timestamp := strconv.FormatInt(entry.Timestamp.Unix(), 10)
+			req.Header.Set(TimestampHeader, timestamp)
+			req.Header.Set(SignatureHeader, Sign(w.Secret, timestamp, d.body))
+		}
+
+		resp, err := h.client.Do(req)
+		if err != nil {
+			return errors.New("could not post event: " + err.Error())
+		}
+		resp.Body.Close()
+
+		entry.StatusCode = resp.StatusCode
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+		return nil
+	}()
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	h.logMu.Lock()
+	h.log = append(h.log, entry)
+	if len(h.log) > DefaultDeliveryLogSize {
+		h.log = h.log[len(h.log)-DefaultDeliveryLogSize:]
+	}
+	h.logMu.Unlock()
+
+	return err
+}
+
+func (h *EventHandler) error(err Error) {
+	select {
+	case h.errCh <- err:
+	default:
+	}
+}
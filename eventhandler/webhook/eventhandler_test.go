@@ -0,0 +1,372 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	received := make(chan *http.Request, 10)
+	bodies := make(chan []byte, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		received <- r
+		bodies <- b
+	}))
+	defer srv.Close()
+
+	h := NewEventHandler(nil)
+	defer h.Close()
+	if h.HandlerType() != "webhook" {
+		t.Error("the handler type should be correct:", h.HandlerType())
+	}
+
+	wh, err := h.Register(Webhook{URL: srv.URL, Secret: "secret"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if wh.ID == uuid.Nil {
+		t.Error("there should be an ID")
+	}
+	if webhooks := h.Webhooks(); len(webhooks) != 1 || webhooks[0].ID != wh.ID {
+		t.Error("the webhooks should be correct:", webhooks)
+	}
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		timestamp, mocks.AggregateType, id, 1)
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	var r *http.Request
+	var b []byte
+	select {
+	case r = <-received:
+		b = <-bodies
+	case <-time.After(time.Second):
+		t.Fatal("did not receive event in time")
+	}
+	if r.Method != "POST" {
+		t.Error("the method should be correct:", r.Method)
+	}
+	if r.Header.Get(EventTypeHeader) != string(mocks.EventType) {
+		t.Error("the event type header should be correct:", r.Header.Get(EventTypeHeader))
+	}
+	ts := r.Header.Get(TimestampHeader)
+	if !VerifySignature("secret", b, ts, r.Header.Get(SignatureHeader)) {
+		t.Error("the signature should be correct:", r.Header.Get(SignatureHeader))
+	}
+	if VerifySignature("other", b, ts, r.Header.Get(SignatureHeader)) {
+		t.Error("the signature should not be valid with another secret")
+	}
+	var p struct {
+		Payload
+		Data mocks.EventData `json:"data"`
+	}
+	if err := json.Unmarshal(b, &p); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if p.EventType != mocks.EventType || p.AggregateID != id || p.Version != 1 ||
+		p.Data.Content != "event1" || !p.Timestamp.Equal(timestamp) {
+		t.Error("the payload should be correct:", p)
+	}
+
+	// The delivery should be logged.
+	time.Sleep(10 * time.Millisecond)
+	deliveries := h.Deliveries(wh.ID)
+	if len(deliveries) != 1 {
+		t.Fatal("there should be one delivery:", deliveries)
+	}
+	if deliveries[0].StatusCode != http.StatusOK || deliveries[0].Attempt != 1 ||
+		deliveries[0].ID.String() != r.Header.Get(DeliveryHeader) {
+		t.Error("the delivery should be correct:", deliveries[0])
+	}
+
+	// Events should not be delivered after unregistering.
+	if err := h.Unregister(wh.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h.Unregister(wh.ID); err != ErrWebhookNotFound {
+		t.Error("the error should be correct:", err)
+	}
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	select {
+	case <-received:
+		t.Error("there should be no event delivered")
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestEventHandler_EventTypes(t *testing.T) {
+	received := make(chan string, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- r.Header.Get(EventTypeHeader)
+	}))
+	defer srv.Close()
+
+	h := NewEventHandler(nil)
+	defer h.Close()
+	if _, err := h.Register(Webhook{URL: srv.URL, Secret: "secret", EventTypes: []eh.EventType{mocks.EventOtherType}}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	event1 := eh.NewEventForAggregate(mocks.EventType, nil, timestamp, mocks.AggregateType, id, 1)
+	event2 := eh.NewEventForAggregate(mocks.EventOtherType, nil, timestamp, mocks.AggregateType, id, 2)
+	for _, event := range []eh.Event{event1, event2} {
+		if err := h.HandleEvent(context.Background(), event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	select {
+	case eventType := <-received:
+		if eventType != string(mocks.EventOtherType) {
+			t.Error("the event type should be correct:", eventType)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("did not receive event in time")
+	}
+	select {
+	case eventType := <-received:
+		t.Error("there should be no more events:", eventType)
+	case <-time.After(10 * time.Millisecond):
+	}
+}
+
+func TestEventHandler_Retry(t *testing.T) {
+	defaultMinBackoff, defaultMaxBackoff := DefaultMinBackoff, DefaultMaxBackoff
+	DefaultMinBackoff, DefaultMaxBackoff = time.Millisecond, 2*time.Millisecond
+	defer func() { DefaultMinBackoff, DefaultMaxBackoff = defaultMinBackoff, defaultMaxBackoff }()
+
+	var mu sync.Mutex
+	failures := 2
+	deliveryIDs := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		deliveryIDs = append(deliveryIDs, r.Header.Get(DeliveryHeader))
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	h := NewEventHandler(nil)
+	defer h.Close()
+	wh, err := h.Register(Webhook{URL: srv.URL, Secret: "secret"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp, mocks.AggregateType, uuid.New(), 1)
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	deliveries := h.Deliveries(wh.ID)
+	if len(deliveries) != 3 {
+		t.Fatal("there should be three attempts:", deliveries)
+	}
+	for i, d := range deliveries {
+		if d.Attempt != i+1 {
+			t.Error("the attempt should be correct:", d.Attempt)
+		}
+		if d.ID != deliveries[0].ID {
+			t.Error("the delivery ID should be the same for all attempts:", d.ID)
+		}
+	}
+	if deliveries[0].StatusCode != http.StatusInternalServerError || deliveries[0].Error == "" {
+		t.Error("the first attempt should have failed:", deliveries[0])
+	}
+	if deliveries[2].StatusCode != http.StatusOK || deliveries[2].Error != "" {
+		t.Error("the last attempt should have succeeded:", deliveries[2])
+	}
+	mu.Lock()
+	if len(deliveryIDs) != 3 || deliveryIDs[0] != deliveryIDs[2] {
+		t.Error("the delivery IDs should be correct:", deliveryIDs)
+	}
+	mu.Unlock()
+}
+
+func TestEventHandler_MaxAttempts(t *testing.T) {
+	defaultMinBackoff, defaultMaxBackoff := DefaultMinBackoff, DefaultMaxBackoff
+	DefaultMinBackoff, DefaultMaxBackoff = time.Millisecond, 2*time.Millisecond
+	defer func() { DefaultMinBackoff, DefaultMaxBackoff = defaultMinBackoff, defaultMaxBackoff }()
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	h := NewEventHandler(nil)
+	defer h.Close()
+	wh, err := h.Register(Webhook{URL: srv.URL, Secret: "secret"})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp, mocks.AggregateType, uuid.New(), 1)
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	select {
+	case err := <-h.Errors():
+		if err.Webhook.ID != wh.ID || err.Event != event {
+			t.Error("the error should be correct:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("there should be an error")
+	}
+	if deliveries := h.Deliveries(wh.ID); len(deliveries) != DefaultMaxAttempts {
+		t.Error("there should be max attempts deliveries:", len(deliveries))
+	}
+}
+
+func TestEventHandler_Register(t *testing.T) {
+	h := NewEventHandler(nil)
+	defer h.Close()
+
+	for _, u := range []string{"", "localhost", "file:///etc/passwd", "gopher://localhost", "http://", "http://%zz"} {
+		if _, err := h.Register(Webhook{URL: u, Secret: "secret"}); err != ErrInvalidURL {
+			t.Error("the error should be correct:", u, err)
+		}
+	}
+
+	if _, err := h.Register(Webhook{URL: "http://localhost"}); err != ErrMissingSecret {
+		t.Error("the error should be correct:", err)
+	}
+	if _, err := h.Register(Webhook{URL: "http://localhost", Unsigned: true}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	id := uuid.New()
+	if _, err := h.Register(Webhook{ID: id, URL: "http://localhost", Secret: "secret"}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := h.Register(Webhook{ID: id, URL: "http://localhost", Secret: "secret"}); err != ErrWebhookAlreadyRegistered {
+		t.Error("the error should be correct:", err)
+	}
+	if wh, err := h.Webhook(id); err != nil || wh.URL != "http://localhost" {
+		t.Error("the webhook should be correct:", wh, err)
+	}
+	if _, err := h.Webhook(uuid.New()); err != ErrWebhookNotFound {
+		t.Error("the error should be correct:", err)
+	}
+}
+
+func TestEventHandler_QueueFull(t *testing.T) {
+	defaultQueueSize := DefaultQueueSize
+	DefaultQueueSize = 1
+	defer func() { DefaultQueueSize = defaultQueueSize }()
+
+	signatures := make(chan string, 10)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures <- r.Header.Get(SignatureHeader)
+		<-release
+	}))
+	defer srv.Close()
+
+	h := NewEventHandler(nil)
+	defer h.Close()
+	wh, err := h.Register(Webhook{URL: srv.URL, Unsigned: true})
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+	for i := 1; i <= 3; i++ {
+		event := eh.NewEventForAggregate(mocks.EventType, nil, timestamp, mocks.AggregateType, id, i)
+		if err := h.HandleEvent(context.Background(), event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	// The dropped event should be reported on the error channel.
+	select {
+	case err := <-h.Errors():
+		if err.Err != ErrQueueFull || err.Webhook.ID != wh.ID {
+			t.Error("the error should be correct:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("there should be an error")
+	}
+
+	select {
+	case signature := <-signatures:
+		if signature != "" {
+			t.Error("there should be no signature:", signature)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("did not receive event in time")
+	}
+	close(release)
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"event_type":"event"}`)
+	now := strconv.FormatInt(time.Now().Unix(), 10)
+	if !VerifySignature("secret", body, now, Sign("secret", now, body)) {
+		t.Error("the signature should be valid")
+	}
+	if VerifySignature("secret", []byte("other"), now, Sign("secret", now, body)) {
+		t.Error("the signature should not be valid for another body")
+	}
+
+	// The timestamp is signed.
+	later := strconv.FormatInt(time.Now().Add(time.Second).Unix(), 10)
+	if VerifySignature("secret", body, later, Sign("secret", now, body)) {
+		t.Error("the signature should not be valid for another timestamp")
+	}
+
+	// Old requests should not be accepted.
+	old := strconv.FormatInt(time.Now().Add(-DefaultSignatureTolerance-time.Minute).Unix(), 10)
+	if VerifySignature("secret", body, old, Sign("secret", old, body)) {
+		t.Error("the signature should not be valid for an old timestamp")
+	}
+}
+
+func TestNewEventHandler_Timeout(t *testing.T) {
+	h := NewEventHandler(nil)
+	if h.client.Timeout != DefaultTimeout {
+		t.Error("the client should have a timeout:", h.client.Timeout)
+	}
+}
@@ -49,9 +49,24 @@ var ErrInvalidEvent = errors.New("invalid event")
 // ErrIncorrectEventVersion is when an event is for an other version of the aggregate.
 var ErrIncorrectEventVersion = errors.New("mismatching event version")
 
+// ErrConcurrencyConflict is when events could not be saved because the
+// aggregate has been changed by another save since it was loaded. The command
+// can be retried with the reloaded aggregate.
+var ErrConcurrencyConflict = errors.New("concurrency conflict")
+
+// IsConcurrencyConflict returns true if the error is, or is an EventStoreError
+// with, ErrConcurrencyConflict.
+func IsConcurrencyConflict(err error) bool {
+	if esErr, ok := err.(EventStoreError); ok {
+		return esErr.Err == ErrConcurrencyConflict
+	}
+	return err == ErrConcurrencyConflict
+}
+
 // EventStore is an interface for an event sourcing event store.
 type EventStore interface {
-	// Save appends all events in the event stream to the store.
+	// Save appends all events in the event stream to the store. Returns
+	// ErrConcurrencyConflict if the aggregate is not at the original version.
 	Save(ctx context.Context, events []Event, originalVersion int) error
 
 	// Load loads all events for the aggregate id from the store.
@@ -70,3 +85,18 @@ type EventStoreMaintainer interface {
 	// RenameEvent renames all instances of the event type.
 	RenameEvent(ctx context.Context, from, to EventType) error
 }
+
+// EventStoreStreamer is an interface for an EventStore that can stream all of
+// its events, useful for replaying events to rebuild read models.
+type EventStoreStreamer interface {
+	EventStore
+
+	// StreamEvents calls the function with the events of all aggregates with
+	// an ID after the given ID, use uuid.Nil to start from the beginning. The
+	// aggregates are ordered by the string form of their IDs, which means
+	// that the ID of the last streamed aggregate can be used to resume. The
+	// events of each aggregate are ordered by version, aggregates without
+	// events are skipped. Streaming is stopped
+	// if the function returns an error, which is then returned.
+	StreamEvents(ctx context.Context, after uuid.UUID, f func(context.Context, []Event) error) error
+}
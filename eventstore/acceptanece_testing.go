@@ -16,6 +16,7 @@ package eventstore
 
 import (
 	"context"
+	"errors"
 	"strings"
 	"testing"
 	"time"
@@ -75,6 +76,16 @@ func AcceptanceTest(t *testing.T, ctx context.Context, store eh.EventStore) []eh
 	}
 	savedEvents = append(savedEvents, event2)
 
+	t.Log("try to save events with a concurrency conflict")
+	err = store.Save(ctx, []eh.Event{event1}, 0)
+	if !eh.IsConcurrencyConflict(err) {
+		t.Error("there should be a ErrConcurrencyConflict error:", err)
+	}
+	err = store.Save(ctx, []eh.Event{event2}, 1)
+	if !eh.IsConcurrencyConflict(err) {
+		t.Error("there should be a ErrConcurrencyConflict error:", err)
+	}
+
 	t.Log("save event without data, version 3")
 	event3 := eh.NewEventForAggregate(mocks.EventOtherType, nil, timestamp,
 		mocks.AggregateType, id, 3)
@@ -264,6 +275,92 @@ func MaintainerAcceptanceTest(t *testing.T, ctx context.Context, store eh.EventS
 	}
 }
 
+// StreamerAcceptanceTest is the acceptance test that all implementations of
+// EventStoreStreamer should pass. The context should use an otherwise empty
+// namespace. It should manually be called from a test case in each
+// implementation:
+//
+//   func TestEventStore(t *testing.T) {
+//       ctx := eh.NewContextWithNamespace(context.Background(), "streamer")
+//       store := NewEventStore()
+//       eventstore.StreamerAcceptanceTest(t, ctx, store)
+//   }
+//
+func StreamerAcceptanceTest(t *testing.T, ctx context.Context, store eh.EventStoreStreamer) {
+	t.Log("stream no events")
+	if err := store.StreamEvents(ctx, uuid.Nil, func(ctx context.Context, events []eh.Event) error {
+		t.Error("there should be no events:", eventsToString(events))
+		return nil
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("save events for some aggregates")
+	id1, _ := uuid.Parse("c1138e5f-f6fb-4dd0-8e79-255c6c8d3751")
+	id2, _ := uuid.Parse("c1138e5f-f6fb-4dd0-8e79-255c6c8d3752")
+	id3, _ := uuid.Parse("c1138e5f-f6fb-4dd0-8e79-255c6c8d3753")
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	savedEvents := map[uuid.UUID][]eh.Event{}
+	// Save out of order to test the ordering.
+	for _, id := range []uuid.UUID{id2, id3, id1} {
+		event1 := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+			timestamp, mocks.AggregateType, id, 1)
+		event2 := eh.NewEventForAggregate(mocks.EventOtherType, nil,
+			timestamp, mocks.AggregateType, id, 2)
+		if err := store.Save(ctx, []eh.Event{event1}, 0); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if err := store.Save(ctx, []eh.Event{event2}, 1); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		savedEvents[id] = []eh.Event{event1, event2}
+	}
+
+	t.Log("stream all events")
+	ids := []uuid.UUID{}
+	if err := store.StreamEvents(ctx, uuid.Nil, func(ctx context.Context, events []eh.Event) error {
+		if len(events) == 0 {
+			t.Fatal("there should be events")
+		}
+		id := events[0].AggregateID()
+		ids = append(ids, id)
+		if !mocks.EqualEvents(events, savedEvents[id]) {
+			t.Error("the events should be correct:", eventsToString(events))
+		}
+		return nil
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(ids) != 3 || ids[0] != id1 || ids[1] != id2 || ids[2] != id3 {
+		t.Error("the aggregates should be streamed in order:", ids)
+	}
+
+	t.Log("stream events after an aggregate")
+	ids = []uuid.UUID{}
+	if err := store.StreamEvents(ctx, id1, func(ctx context.Context, events []eh.Event) error {
+		ids = append(ids, events[0].AggregateID())
+		return nil
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(ids) != 2 || ids[0] != id2 || ids[1] != id3 {
+		t.Error("the aggregates should be streamed in order:", ids)
+	}
+
+	t.Log("stop streaming on error")
+	streamErr := errors.New("stream error")
+	ids = []uuid.UUID{}
+	if err := store.StreamEvents(ctx, uuid.Nil, func(ctx context.Context, events []eh.Event) error {
+		ids = append(ids, events[0].AggregateID())
+		return streamErr
+	}); err != streamErr {
+		t.Error("the error should be correct:", err)
+	}
+	if len(ids) != 1 {
+		t.Error("the streaming should be stopped:", ids)
+	}
+}
+
 func eventsToString(events []eh.Event) string {
 	parts := make([]string, len(events))
 	for i, e := range events {
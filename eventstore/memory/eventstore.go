@@ -16,8 +16,8 @@ package memory
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -26,7 +26,10 @@ import (
 )
 
 // ErrCouldNotSaveAggregate is when an aggregate could not be saved.
-var ErrCouldNotSaveAggregate = errors.New("could not save aggregate")
+//
+// Deprecated: Save returns eh.ErrConcurrencyConflict on version mismatches,
+// which this is an alias of.
+var ErrCouldNotSaveAggregate = eh.ErrConcurrencyConflict
 
 // EventStore implements EventStore as an in memory structure.
 type EventStore struct {
@@ -86,6 +89,13 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 
 	// Either insert a new aggregate or append to an existing.
 	if originalVersion == 0 {
+		if _, ok := s.db[ns][aggregateID]; ok {
+			return eh.EventStoreError{
+				Err:       eh.ErrConcurrencyConflict,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+
 		aggregate := aggregateRecord{
 			AggregateID: aggregateID,
 			Version:     len(dbEvents),
@@ -97,19 +107,18 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 		// Increment aggregate version on insert of new event record, and
 		// only insert if version of aggregate is matching (ie not changed
 		// since loading the aggregate).
-		if aggregate, ok := s.db[ns][aggregateID]; ok {
-			if aggregate.Version != originalVersion {
-				return eh.EventStoreError{
-					Err:       ErrCouldNotSaveAggregate,
-					Namespace: eh.NamespaceFromContext(ctx),
-				}
+		aggregate, ok := s.db[ns][aggregateID]
+		if !ok || aggregate.Version != originalVersion {
+			return eh.EventStoreError{
+				Err:       eh.ErrConcurrencyConflict,
+				Namespace: eh.NamespaceFromContext(ctx),
 			}
+		}
 
-			aggregate.Version += len(dbEvents)
-			aggregate.Events = append(aggregate.Events, dbEvents...)
+		aggregate.Version += len(dbEvents)
+		aggregate.Events = append(aggregate.Events, dbEvents...)
 
-			s.db[ns][aggregateID] = aggregate
-		}
+		s.db[ns][aggregateID] = aggregate
 	}
 
 	return nil
@@ -138,6 +147,38 @@ func (s *EventStore) Load(ctx context.Context, id uuid.UUID) ([]eh.Event, error)
 	return events, nil
 }
 
+// StreamEvents implements the StreamEvents method of the eventhorizon.EventStoreStreamer interface.
+func (s *EventStore) StreamEvents(ctx context.Context, after uuid.UUID, f func(context.Context, []eh.Event) error) error {
+	// Ensure that the namespace exists.
+	ns := s.namespace(ctx)
+
+	s.dbMu.RLock()
+	ids := make([]string, 0, len(s.db[ns]))
+	for id := range s.db[ns] {
+		if after == uuid.Nil || id.String() > after.String() {
+			ids = append(ids, id.String())
+		}
+	}
+	s.dbMu.RUnlock()
+	sort.Strings(ids)
+
+	for _, idStr := range ids {
+		id, _ := uuid.Parse(idStr)
+		events, err := s.Load(ctx, id)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 {
+			continue
+		}
+		if err := f(ctx, events); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Replace implements the Replace method of the eventhorizon.EventStore interface.
 func (s *EventStore) Replace(ctx context.Context, event eh.Event) error {
 	// Ensure that the namespace exists.
@@ -39,4 +39,8 @@ func TestEventStore(t *testing.T) {
 
 	t.Log("event store maintainer")
 	eventstore.MaintainerAcceptanceTest(t, context.Background(), store)
+
+	t.Log("event store streamer")
+	ctx = eh.NewContextWithNamespace(context.Background(), "streamer")
+	eventstore.StreamerAcceptanceTest(t, ctx, store)
 }
@@ -132,7 +132,13 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 			Events:      dbEvents,
 		}
 
-		if err := sess.DB(s.dbName(ctx)).C("events").Insert(aggregate); err != nil {
+		if err := sess.DB(s.dbName(ctx)).C("events").Insert(aggregate); mgo.IsDup(err) {
+			return eh.EventStoreError{
+				BaseErr:   err,
+				Err:       eh.ErrConcurrencyConflict,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		} else if err != nil {
 			return eh.EventStoreError{
 				BaseErr:   err,
 				Err:       ErrCouldNotSaveAggregate,
@@ -152,7 +158,13 @@ func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersio
 				"$push": bson.M{"events": bson.M{"$each": dbEvents}},
 				"$inc":  bson.M{"version": len(dbEvents)},
 			},
-		); err != nil {
+		); err == mgo.ErrNotFound {
+			return eh.EventStoreError{
+				BaseErr:   err,
+				Err:       eh.ErrConcurrencyConflict,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		} else if err != nil {
 			return eh.EventStoreError{
 				BaseErr:   err,
 				Err:       ErrCouldNotSaveAggregate,
@@ -181,6 +193,50 @@ func (s *EventStore) Load(ctx context.Context, id uuid.UUID) ([]eh.Event, error)
 		}
 	}
 
+	return s.events(ctx, aggregate)
+}
+
+// StreamEvents implements the StreamEvents method of the eventhorizon.EventStoreStreamer interface.
+func (s *EventStore) StreamEvents(ctx context.Context, after uuid.UUID, f func(context.Context, []eh.Event) error) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	query := bson.M{}
+	if after != uuid.Nil {
+		query["_id"] = bson.M{"$gt": after.String()}
+	}
+	iter := sess.DB(s.dbName(ctx)).C("events").Find(query).Sort("_id").Iter()
+
+	var aggregate aggregateRecord
+	for iter.Next(&aggregate) {
+		events, err := s.events(ctx, aggregate)
+		if err != nil {
+			iter.Close()
+			return err
+		}
+		aggregate = aggregateRecord{}
+		// Skip aggregates without events, for example if all have been removed.
+		if len(events) == 0 {
+			continue
+		}
+		if err := f(ctx, events); err != nil {
+			iter.Close()
+			return err
+		}
+	}
+	if err := iter.Close(); err != nil {
+		return eh.EventStoreError{
+			BaseErr:   err,
+			Err:       ErrCouldNotLoadAggregate,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return nil
+}
+
+// events creates the events of an aggregate record.
+func (s *EventStore) events(ctx context.Context, aggregate aggregateRecord) ([]eh.Event, error) {
 	events := make([]eh.Event, len(aggregate.Events))
 	for i, dbEvent := range aggregate.Events {
 		// Create an event of the correct type.
@@ -19,6 +19,8 @@ import (
 	"os"
 	"testing"
 
+	"github.com/google/uuid"
+
 	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/eventstore"
 )
@@ -41,6 +43,7 @@ func TestEventStore(t *testing.T) {
 	}
 
 	ctx := eh.NewContextWithNamespace(context.Background(), "ns")
+	streamerCtx := eh.NewContextWithNamespace(context.Background(), "streamer")
 
 	defer store.Close()
 	defer func() {
@@ -51,6 +54,9 @@ func TestEventStore(t *testing.T) {
 		if err = store.Clear(ctx); err != nil {
 			t.Fatal("there should be no error:", err)
 		}
+		if err = store.Clear(streamerCtx); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
 	}()
 
 	// Run the actual test suite.
@@ -63,4 +69,29 @@ func TestEventStore(t *testing.T) {
 
 	t.Log("event store maintainer")
 	eventstore.MaintainerAcceptanceTest(t, context.Background(), store)
+
+	t.Log("event store streamer")
+	eventstore.StreamerAcceptanceTest(t, streamerCtx, store)
+
+	t.Log("skip aggregates without events when streaming")
+	sess := store.session.Copy()
+	defer sess.Close()
+	if err := sess.DB(store.dbName(streamerCtx)).C("events").Insert(aggregateRecord{
+		AggregateID: uuid.New().String(),
+	}); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	n := 0
+	if err := store.StreamEvents(streamerCtx, uuid.Nil, func(ctx context.Context, events []eh.Event) error {
+		if len(events) == 0 {
+			t.Error("there should be events")
+		}
+		n++
+		return nil
+	}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if n != 3 {
+		t.Error("only aggregates with events should be streamed:", n)
+	}
 }
@@ -16,7 +16,7 @@ package domain
 
 import (
 	"context"
-	"sync"
+	"errors"
 
 	"github.com/google/uuid"
 	eh "github.com/looplab/eventhorizon"
@@ -26,55 +26,77 @@ import (
 // ResponseSagaType is the type of the saga.
 const ResponseSagaType saga.Type = "ResponseSaga"
 
+// ResponseSagaState is the state of the ResponseSaga for an event, with the
+// accepted guests.
+type ResponseSagaState struct {
+	saga.BaseState `bson:",inline"`
+	AcceptedGuests []uuid.UUID `json:"accepted_guests" bson:"accepted_guests"`
+}
+
 // ResponseSaga is a saga that confirmes all accepted invites until a guest
 // limit has been reached.
 type ResponseSaga struct {
-	acceptedGuests   map[uuid.UUID]bool
-	acceptedGuestsMu sync.RWMutex
-	guestLimit       int
+	eventID    uuid.UUID
+	guestLimit int
 }
 
-// NewResponseSaga returns a new ResponseSage with a guest limit.
-func NewResponseSaga(guestLimit int) *ResponseSaga {
+// NewResponseSaga returns a new ResponseSage for an event with a guest limit.
+func NewResponseSaga(eventID uuid.UUID, guestLimit int) *ResponseSaga {
 	return &ResponseSaga{
-		acceptedGuests: map[uuid.UUID]bool{},
-		guestLimit:     guestLimit,
+		eventID:    eventID,
+		guestLimit: guestLimit,
 	}
 }
 
-// SagaType implements the SagaType method of the Saga interface.
+// SagaType implements the SagaType method of the StatefulSaga interface.
 func (s *ResponseSaga) SagaType() saga.Type {
 	return ResponseSagaType
 }
 
-// RunSaga implements the Run saga method of the Saga interface.
-func (s *ResponseSaga) RunSaga(ctx context.Context, event eh.Event) []eh.Command {
+// CorrelationID implements the CorrelationID method of the StatefulSaga
+// interface. All invites are for the same event.
+func (s *ResponseSaga) CorrelationID(ctx context.Context, event eh.Event) uuid.UUID {
+	return s.eventID
+}
+
+// NewState implements the NewState method of the StatefulSaga interface.
+func (s *ResponseSaga) NewState(id uuid.UUID) saga.State {
+	return &ResponseSagaState{
+		BaseState: saga.BaseState{ID: id},
+	}
+}
+
+// RunSaga implements the Run saga method of the StatefulSaga interface.
+func (s *ResponseSaga) RunSaga(ctx context.Context, event eh.Event, state saga.State) ([]eh.Command, error) {
+	st, ok := state.(*ResponseSagaState)
+	if !ok {
+		return nil, errors.New("invalid state")
+	}
+
 	switch event.EventType() {
 	case InviteAcceptedEvent:
-		// Do nothing for already accepted guests.
-		s.acceptedGuestsMu.RLock()
-		ok, _ := s.acceptedGuests[event.AggregateID()]
-		s.acceptedGuestsMu.RUnlock()
-		if ok {
-			return nil
+		// Do nothing for already accepted guests, their confirmations are
+		// kept as pending commands with the state until they are handled.
+		for _, id := range st.AcceptedGuests {
+			if id == event.AggregateID() {
+				return nil, nil
+			}
 		}
 
 		// Deny the invite if the guest list is full.
-		if len(s.acceptedGuests) >= s.guestLimit {
+		if len(st.AcceptedGuests) >= s.guestLimit {
 			return []eh.Command{
 				&DenyInvite{ID: event.AggregateID()},
-			}
+			}, nil
 		}
 
 		// Confirm the invite when there is space left.
-		s.acceptedGuestsMu.Lock()
-		s.acceptedGuests[event.AggregateID()] = true
-		s.acceptedGuestsMu.Unlock()
+		st.AcceptedGuests = append(st.AcceptedGuests, event.AggregateID())
 
 		return []eh.Command{
 			&ConfirmInvite{ID: event.AggregateID()},
-		}
+		}, nil
 	}
 
-	return nil
+	return nil, nil
 }
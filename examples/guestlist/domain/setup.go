@@ -31,7 +31,7 @@ func Setup(
 	eventStore eh.EventStore,
 	eventBus eh.EventBus,
 	commandBus *bus.CommandHandler,
-	invitationRepo, guestListRepo eh.ReadWriteRepo,
+	invitationRepo, guestListRepo, responseSagaRepo eh.ReadWriteRepo,
 	eventID uuid.UUID) {
 
 	// Add a logger as an observer.
@@ -43,17 +43,16 @@ func Setup(
 		log.Fatalf("could not create aggregate store: %s", err)
 	}
 
-	// Create the aggregate command handler and register the commands it handles.
+	// Create the aggregate command handler and route all commands for the
+	// aggregate type to it.
 	invitationHandler, err := aggregate.NewCommandHandler(InvitationAggregateType, aggregateStore)
 	if err != nil {
 		log.Fatalf("could not create command handler: %s", err)
 	}
 	commandHandler := eh.UseCommandHandlerMiddleware(invitationHandler, LoggingMiddleware)
-	commandBus.SetHandler(commandHandler, CreateInviteCommand)
-	commandBus.SetHandler(commandHandler, AcceptInviteCommand)
-	commandBus.SetHandler(commandHandler, DeclineInviteCommand)
-	commandBus.SetHandler(commandHandler, ConfirmInviteCommand)
-	commandBus.SetHandler(commandHandler, DenyInviteCommand)
+	if err := commandBus.SetAggregateHandler(commandHandler, InvitationAggregateType); err != nil {
+		log.Fatalf("could not set command handler: %s", err)
+	}
 
 	// Create and register a read model for individual invitations.
 	invitationProjector := projector.NewEventHandler(
@@ -77,7 +76,9 @@ func Setup(
 	), guestListProjector)
 
 	// Setup the saga that responds to the accepted guests and limits the total
-	// amount of guests, responding with a confirmation or denial.
-	responseSaga := saga.NewEventHandler(NewResponseSaga(2), commandBus)
+	// amount of guests, responding with a confirmation or denial. The accepted
+	// guests are kept in the saga repo.
+	responseSaga := saga.NewStatefulEventHandler(
+		NewResponseSaga(eventID, 2), responseSagaRepo, commandBus)
 	eventBus.AddHandler(eh.MatchEvent(InviteAcceptedEvent), responseSaga)
 }
@@ -49,6 +49,7 @@ func Example() {
 	// Create the read repositories.
 	invitationRepo := repo.NewRepo()
 	guestListRepo := repo.NewRepo()
+	responseSagaRepo := repo.NewRepo()
 
 	// Setup the domain.
 	eventID := uuid.New()
@@ -56,7 +57,7 @@ func Example() {
 		eventStore,
 		eventBus,
 		commandBus,
-		invitationRepo, guestListRepo,
+		invitationRepo, guestListRepo, responseSagaRepo,
 		eventID,
 	)
 
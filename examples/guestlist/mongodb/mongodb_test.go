@@ -72,6 +72,11 @@ func Example() {
 		log.Fatalf("could not create guest list repository: %s", err)
 	}
 	guestListRepo.SetEntityFactory(func() eh.Entity { return &domain.GuestList{} })
+	responseSagaRepo, err := repo.NewRepo(url, "demo", "response_sagas")
+	if err != nil {
+		log.Fatalf("could not create response saga repository: %s", err)
+	}
+	responseSagaRepo.SetEntityFactory(func() eh.Entity { return &domain.ResponseSagaState{} })
 
 	// Setup the domain.
 	eventID := uuid.New()
@@ -79,7 +84,7 @@ func Example() {
 		eventStore,
 		eventBus,
 		commandBus,
-		invitationVersionRepo, guestListRepo,
+		invitationVersionRepo, guestListRepo, responseSagaRepo,
 		eventID,
 	)
 
@@ -90,6 +95,7 @@ func Example() {
 	eventStore.Clear(ctx)
 	invitationRepo.Clear(ctx)
 	guestListRepo.Clear(ctx)
+	responseSagaRepo.Clear(ctx)
 
 	// --- Execute commands on the domain --------------------------------------
 
@@ -26,6 +26,7 @@ import (
 	eh "github.com/looplab/eventhorizon"
 	"github.com/looplab/eventhorizon/aggregatestore/events"
 	"github.com/looplab/eventhorizon/commandhandler/aggregate"
+	"github.com/looplab/eventhorizon/commandhandler/bus"
 	eventbus "github.com/looplab/eventhorizon/eventbus/local"
 	"github.com/looplab/eventhorizon/eventhandler/projector"
 	eventstore "github.com/looplab/eventhorizon/eventstore/mongodb"
@@ -99,6 +100,16 @@ func NewHandler() (*Handler, error) {
 		return nil, fmt.Errorf("could not create command handler: %s", err)
 	}
 
+	// Create the command bus and route all commands of the aggregate to the
+	// aggregate command handler.
+	commandBus := bus.NewCommandHandler()
+	if err := commandBus.SetAggregateHandler(aggregateCommandHandler, domain.AggregateType); err != nil {
+		return nil, fmt.Errorf("could not add aggregate handler: %s", err)
+	}
+	if err := commandBus.CheckRoutes(); err != nil {
+		return nil, fmt.Errorf("could not route commands: %s", err)
+	}
+
 	// Create a tiny logging middleware for the command handler.
 	commandHandlerLogger := func(h eh.CommandHandler) eh.CommandHandler {
 		return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
@@ -106,7 +117,7 @@ func NewHandler() (*Handler, error) {
 			return h.HandleCommand(ctx, cmd)
 		})
 	}
-	commandHandler := eh.UseCommandHandlerMiddleware(aggregateCommandHandler, commandHandlerLogger)
+	commandHandler := eh.UseCommandHandlerMiddleware(commandBus, commandHandlerLogger)
 
 	// Create the repository and wrap in a version repository.
 	repo, err := repo.NewRepo(dbURL, "todomvc", "todos")
@@ -127,7 +127,7 @@ func TestCreate(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Error("the status should be correct:", w.Code)
 	}
-	if string(w.Body.Bytes()) != `` {
+	if string(w.Body.Bytes()) != `{"aggregate_id":"`+id.String()+`","version":1,"events":[{"event_type":"todolist:created","aggregate_type":"todolist","aggregate_id":"`+id.String()+`","version":1,"timestamp":"`+domain.TimeNow().Format(time.RFC3339Nano)+`"}]}` {
 		t.Error("the body should be correct:", string(w.Body.Bytes()))
 	}
 
@@ -190,7 +190,7 @@ func TestDelete(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Error("the status should be correct:", w.Code)
 	}
-	if string(w.Body.Bytes()) != `` {
+	if string(w.Body.Bytes()) != `{"aggregate_id":"`+id.String()+`","version":2,"events":[{"event_type":"todolist:deleted","aggregate_type":"todolist","aggregate_id":"`+id.String()+`","version":2,"timestamp":"`+domain.TimeNow().Format(time.RFC3339Nano)+`"}]}` {
 		t.Error("the body should be correct:", string(w.Body.Bytes()))
 	}
 
@@ -238,7 +238,7 @@ func TestAddItem(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Error("the status should be correct:", w.Code)
 	}
-	if string(w.Body.Bytes()) != `` {
+	if string(w.Body.Bytes()) != `{"aggregate_id":"`+id.String()+`","version":2,"events":[{"event_type":"todolist:item_added","aggregate_type":"todolist","aggregate_id":"`+id.String()+`","version":2,"timestamp":"`+domain.TimeNow().Format(time.RFC3339Nano)+`","data":{"item_id":0,"description":"desc"}}]}` {
 		t.Error("the body should be correct:", string(w.Body.Bytes()))
 	}
 
@@ -312,7 +312,7 @@ func TestRemoveItem(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Error("the status should be correct:", w.Code)
 	}
-	if string(w.Body.Bytes()) != `` {
+	if string(w.Body.Bytes()) != `{"aggregate_id":"`+id.String()+`","version":3,"events":[{"event_type":"todolist:item_removed","aggregate_type":"todolist","aggregate_id":"`+id.String()+`","version":3,"timestamp":"`+domain.TimeNow().Format(time.RFC3339Nano)+`","data":{"item_id":0}}]}` {
 		t.Error("the body should be correct:", string(w.Body.Bytes()))
 	}
 
@@ -394,7 +394,7 @@ func TestRemoveCompleted(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Error("the status should be correct:", w.Code)
 	}
-	if string(w.Body.Bytes()) != `` {
+	if string(w.Body.Bytes()) != `{"aggregate_id":"`+id.String()+`","version":5,"events":[{"event_type":"todolist:item_removed","aggregate_type":"todolist","aggregate_id":"`+id.String()+`","version":5,"timestamp":"`+domain.TimeNow().Format(time.RFC3339Nano)+`","data":{"item_id":1}}]}` {
 		t.Error("the body should be correct:", string(w.Body.Bytes()))
 	}
 
@@ -470,7 +470,7 @@ func TestSetItemDesc(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Error("the status should be correct:", w.Code)
 	}
-	if string(w.Body.Bytes()) != `` {
+	if string(w.Body.Bytes()) != `{"aggregate_id":"`+id.String()+`","version":3,"events":[{"event_type":"todolist:item_description_set","aggregate_type":"todolist","aggregate_id":"`+id.String()+`","version":3,"timestamp":"`+domain.TimeNow().Format(time.RFC3339Nano)+`","data":{"item_id":0,"description":"new desc"}}]}` {
 		t.Error("the body should be correct:", string(w.Body.Bytes()))
 	}
 
@@ -550,7 +550,7 @@ func TestCheckItem(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Error("the status should be correct:", w.Code)
 	}
-	if string(w.Body.Bytes()) != `` {
+	if string(w.Body.Bytes()) != `{"aggregate_id":"`+id.String()+`","version":4,"events":[{"event_type":"todolist:item_checked","aggregate_type":"todolist","aggregate_id":"`+id.String()+`","version":4,"timestamp":"`+domain.TimeNow().Format(time.RFC3339Nano)+`","data":{"item_id":1,"checked":true}}]}` {
 		t.Error("the body should be correct:", string(w.Body.Bytes()))
 	}
 
@@ -635,7 +635,7 @@ func TestCheckAllItems(t *testing.T) {
 	if w.Code != http.StatusOK {
 		t.Error("the status should be correct:", w.Code)
 	}
-	if string(w.Body.Bytes()) != `` {
+	if string(w.Body.Bytes()) != `{"aggregate_id":"`+id.String()+`","version":5,"events":[{"event_type":"todolist:item_checked","aggregate_type":"todolist","aggregate_id":"`+id.String()+`","version":4,"timestamp":"`+domain.TimeNow().Format(time.RFC3339Nano)+`","data":{"item_id":0,"checked":true}},{"event_type":"todolist:item_checked","aggregate_type":"todolist","aggregate_id":"`+id.String()+`","version":5,"timestamp":"`+domain.TimeNow().Format(time.RFC3339Nano)+`","data":{"item_id":1,"checked":true}}]}` {
 		t.Error("the body should be correct:", string(w.Body.Bytes()))
 	}
 
@@ -1,25 +1,47 @@
 module github.com/looplab/eventhorizon
 
+go 1.27.1
+
 require (
 	cloud.google.com/go v0.26.0
-	contrib.go.opencensus.io/exporter/stackdriver v0.6.0 // indirect
+	github.com/alicebob/miniredis/v2 v2.23.0
 	github.com/globalsign/mgo v0.0.0-20180828104044-6f9f54af1356
-	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b // indirect
-	github.com/golang/protobuf v1.2.0 // indirect
-	github.com/google/go-cmp v0.2.0 // indirect
+	github.com/go-redis/redis v6.15.9+incompatible
 	github.com/google/uuid v1.1.0
-	github.com/googleapis/gax-go v2.0.0+incompatible // indirect
 	github.com/gorhill/cronexpr v0.0.0-20180427100037-88b0669f7d75
 	github.com/gorilla/websocket v1.4.0
 	github.com/jpillora/backoff v0.0.0-20170918002102-8eab2debe79d
 	github.com/kr/pretty v0.1.0
-	go.opencensus.io v0.15.0 // indirect
-	golang.org/x/net v0.0.0-20180826012351-8a410e7b638d // indirect
+	github.com/segmentio/kafka-go v0.4.8
+	go.opencensus.io v0.15.0
+	google.golang.org/api v0.0.0-20180904000447-0ad5a633fea1
+)
+
+require (
+	contrib.go.opencensus.io/exporter/stackdriver v0.6.0 // indirect
+	github.com/alicebob/gopher-json v0.0.0-20200520072559-a9ecdc9d1d3a // indirect
+	github.com/chzyer/logex v1.1.10 // indirect
+	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e // indirect
+	github.com/chzyer/test v0.0.0-20180213035817-a1ea475d72b1 // indirect
+	github.com/eapache/go-xerial-snappy v0.0.0-20180814174437-776d5712da21 // indirect
+	github.com/golang/glog v0.0.0-20160126235308-23def4e6c14b // indirect
+	github.com/golang/protobuf v1.2.0 // indirect
+	github.com/golang/snappy v0.0.1 // indirect
+	github.com/google/go-cmp v0.2.0 // indirect
+	github.com/googleapis/gax-go v2.0.0+incompatible // indirect
+	github.com/klauspost/compress v1.9.8 // indirect
+	github.com/kr/pty v1.1.1 // indirect
+	github.com/kr/text v0.1.0 // indirect
+	github.com/pierrec/lz4 v2.0.5+incompatible // indirect
+	github.com/xdg/scram v0.0.0-20180814205039-7eeb5667e42c // indirect
+	github.com/xdg/stringprep v1.0.0 // indirect
+	github.com/yuin/gopher-lua v0.0.0-20210529063254-f4c35e4016d9 // indirect
+	golang.org/x/crypto v0.0.0-20190506204251-e1dfcc566284 // indirect
+	golang.org/x/net v0.0.0-20190404232315-eb5bcb51f2a3 // indirect
 	golang.org/x/oauth2 v0.0.0-20180821212333-d2e6202438be // indirect
 	golang.org/x/sync v0.0.0-20180314180146-1d60e4601c6f // indirect
-	golang.org/x/sys v0.0.0-20180903190138-2b024373dcd9 // indirect
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
 	golang.org/x/text v0.3.0 // indirect
-	google.golang.org/api v0.0.0-20180904000447-0ad5a633fea1
 	google.golang.org/appengine v1.1.0 // indirect
 	google.golang.org/genproto v0.0.0-20180831171423-11092d34479b // indirect
 	google.golang.org/grpc v1.14.0 // indirect
@@ -15,17 +15,23 @@
 package httputils
 
 import (
-	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
+	"time"
 
+	"github.com/google/uuid"
 	eh "github.com/looplab/eventhorizon"
 )
 
 // CommandHandler is a HTTP handler for eventhorizon.Commands. Commands must be
 // registered with eventhorizon.RegisterCommand(). It expects a POST with a JSON
-// body that will be unmarshalled into the command.
+// body that will be unmarshalled into the command. The result of the command is
+// returned as JSON, with the aggregate version that can be used to read the
+// changes and the created events. Commands with fields that fail
+// eventhorizon.CheckCommand are rejected with 400 and the fields as JSON.
+// Commands that fail with an error that has a Forbidden method returning true,
+// like the errors of the authorization middleware, are rejected with 403.
 func CommandHandler(commandHandler eh.CommandHandler, commandType eh.CommandType) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != "POST" {
@@ -51,13 +57,105 @@ func CommandHandler(commandHandler eh.CommandHandler, commandType eh.CommandType
 
 		// NOTE: Use a new context when handling, else it will be cancelled with
 		// the HTTP request which will cause projectors etc to fail if they run
-		// async in goroutines past the request.
-		ctx := context.Background()
-		if err := commandHandler.HandleCommand(ctx, cmd); err != nil {
+		// async in goroutines past the request. The values that can be
+		// marshaled, like the namespace and principal, are kept.
+		ctx := eh.UnmarshalContext(eh.MarshalContext(r.Context()))
+		result, err := eh.HandleCommandWithResult(ctx, commandHandler, cmd)
+		if f, ok := err.(eh.CommandFieldError); ok {
+			writeFieldErrors(w, f.Fields())
+			return
+		} else if f, ok := err.(forbiddenError); ok && f.Forbidden() {
+			http.Error(w, "could not handle command: "+err.Error(), http.StatusForbidden)
+			return
+		} else if err != nil {
 			http.Error(w, "could not handle command: "+err.Error(), http.StatusBadRequest)
 			return
 		}
 
+		b, err = json.Marshal(newCommandResult(result))
+		if err != nil {
+			http.Error(w, "could not encode result: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
+		w.Write(b)
 	})
 }
+
+// forbiddenError is an error that can tell if it is because the command is not
+// allowed.
+type forbiddenError interface {
+	error
+	Forbidden() bool
+}
+
+// commandResult is the JSON representation of a eventhorizon.CommandResult.
+type commandResult struct {
+	AggregateID string        `json:"aggregate_id,omitempty"`
+	Version     int           `json:"version,omitempty"`
+	Events      []resultEvent `json:"events,omitempty"`
+	Payload     interface{}   `json:"payload,omitempty"`
+}
+
+// resultEvent is the JSON representation of an event in a command result.
+type resultEvent struct {
+	EventType     eh.EventType     `json:"event_type"`
+	AggregateType eh.AggregateType `json:"aggregate_type"`
+	AggregateID   string           `json:"aggregate_id"`
+	Version       int              `json:"version"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Data          eh.EventData     `json:"data,omitempty"`
+}
+
+func newCommandResult(r *eh.CommandResult) commandResult {
+	var res commandResult
+	if r.AggregateID != uuid.Nil {
+		res.AggregateID = r.AggregateID.String()
+	}
+	res.Version = r.Version
+	res.Payload = r.Payload
+	for _, e := range r.Events {
+		res.Events = append(res.Events, resultEvent{
+			EventType:     e.EventType(),
+			AggregateType: e.AggregateType(),
+			AggregateID:   e.AggregateID().String(),
+			Version:       e.Version(),
+			Timestamp:     e.Timestamp(),
+			Data:          e.Data(),
+		})
+	}
+	return res
+}
+
+// fieldErrors is the JSON representation of eventhorizon.CommandFieldErrors.
+type fieldErrors struct {
+	Error  string       `json:"error"`
+	Fields []fieldError `json:"fields"`
+}
+
+// fieldError is the JSON representation of a eventhorizon.CommandFieldError.
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+func writeFieldErrors(w http.ResponseWriter, errs eh.CommandFieldErrors) {
+	res := fieldErrors{Error: "invalid command"}
+	for _, e := range errs {
+		res.Fields = append(res.Fields, fieldError{
+			Field:   e.Field,
+			Rule:    e.Rule,
+			Message: e.Error(),
+		})
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, "could not encode errors: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(b)
+}
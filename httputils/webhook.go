@@ -0,0 +1,127 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httputils
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"path"
+
+	"github.com/google/uuid"
+
+	"github.com/looplab/eventhorizon/eventhandler/webhook"
+)
+
+// WebhookHandler is a HTTP handler for administrating the webhooks of a
+// webhook.EventHandler. A GET to the root path lists all webhooks and a POST
+// registers a new webhook from a JSON body. A GET with an ID as the last part
+// of the path returns one webhook and a DELETE unregisters it. Secrets are
+// never returned.
+func WebhookHandler(h *webhook.EventHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, idStr := path.Split(r.URL.Path)
+
+		var data interface{}
+		switch {
+		case r.Method == "GET" && idStr == "":
+			webhooks := h.Webhooks()
+			for i := range webhooks {
+				webhooks[i].Secret = ""
+			}
+			data = webhooks
+		case r.Method == "POST" && idStr == "":
+			b, err := ioutil.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "could not read webhook: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			var wh webhook.Webhook
+			if err := json.Unmarshal(b, &wh); err != nil {
+				http.Error(w, "could not decode webhook: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if wh, err = h.Register(wh); err != nil {
+				http.Error(w, "could not register webhook: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			wh.Secret = ""
+			data = wh
+		case r.Method == "GET" || r.Method == "DELETE":
+			id, err := uuid.Parse(idStr)
+			if err != nil {
+				http.Error(w, "could not parse ID: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			if r.Method == "DELETE" {
+				err = h.Unregister(id)
+			} else {
+				var wh webhook.Webhook
+				wh, err = h.Webhook(id)
+				wh.Secret = ""
+				data = wh
+			}
+			if err == webhook.ErrWebhookNotFound {
+				http.Error(w, "could not find webhook", http.StatusNotFound)
+				return
+			} else if err != nil {
+				http.Error(w, "could not handle webhook: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+			if data == nil {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		default:
+			http.Error(w, "unsuported method: "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+
+		b, err := json.Marshal(data)
+		if err != nil {
+			http.Error(w, "could not encode result: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(b)
+	})
+}
+
+// WebhookDeliveryHandler returns the delivery log of a webhook.EventHandler.
+// The log for a single webhook is returned if the last part of the path is
+// its ID, otherwise the log for all webhooks.
+func WebhookDeliveryHandler(h *webhook.EventHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, "unsuported method: "+r.Method, http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := uuid.Nil
+		if _, idStr := path.Split(r.URL.Path); idStr != "" {
+			var err error
+			if id, err = uuid.Parse(idStr); err != nil {
+				http.Error(w, "could not parse ID: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+
+		b, err := json.Marshal(h.Deliveries(id))
+		if err != nil {
+			http.Error(w, "could not encode result: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write(b)
+	})
+}
@@ -0,0 +1,195 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+// StoreAcceptanceTest is the acceptance test that all implementations of
+// Store should pass. It should manually be called from a test case in each
+// implementation:
+//
+//   func TestStore(t *testing.T) {
+//       store := NewStore()
+//       async.StoreAcceptanceTest(t, store)
+//   }
+//
+func StoreAcceptanceTest(t *testing.T, store Store) {
+	ctx := context.Background()
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	t.Log("get and claim with no commands")
+	if _, err := store.Command(ctx, uuid.New()); err != ErrCommandNotFound {
+		t.Error("there should be a command not found error:", err)
+	}
+	cmds, err := store.ClaimCommands(ctx, now, time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(cmds) != 0 {
+		t.Error("there should be no commands:", cmds)
+	}
+
+	t.Log("enqueue commands")
+	newCmd := func(content string, runAt time.Time) QueuedCommand {
+		return QueuedCommand{
+			ID:          uuid.New(),
+			CommandType: mocks.CommandType,
+			RawCommand:  []byte(`{"Content":"` + content + `"}`),
+			Context:     map[string]interface{}{"key": "value"},
+			Status:      StatusPending,
+			RunAt:       runAt,
+			CreatedAt:   now.Add(-time.Hour),
+		}
+	}
+	cmd1 := newCmd("cmd1", now.Add(-2*time.Second))
+	cmd2 := newCmd("cmd2", now.Add(-time.Second))
+	cmd3 := newCmd("cmd3", now.Add(time.Hour))
+	for _, cmd := range []QueuedCommand{cmd3, cmd2, cmd1} {
+		if err := store.EnqueueCommand(ctx, cmd); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	cmd, err := store.Command(ctx, cmd1.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmd, cmd1) {
+		t.Error("the command should be correct:", cmd)
+	}
+
+	t.Log("claim due commands in order")
+	cmds, err = store.ClaimCommands(ctx, now, time.Minute, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	cmd1.Status = StatusRunning
+	if len(cmds) == 1 {
+		if cmds[0].Claim == uuid.Nil {
+			t.Error("the command should have a claim:", cmds[0])
+		}
+		cmd1.Claim = cmds[0].Claim
+	}
+	if !reflect.DeepEqual(cmds, []QueuedCommand{cmd1}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+	cmds, err = store.ClaimCommands(ctx, now, time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	cmd2.Status = StatusRunning
+	if len(cmds) == 1 {
+		cmd2.Claim = cmds[0].Claim
+	}
+	if !reflect.DeepEqual(cmds, []QueuedCommand{cmd2}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+	cmd, err = store.Command(ctx, cmd2.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmd, cmd2) {
+		t.Error("the command should be correct:", cmd)
+	}
+
+	t.Log("update commands")
+	cmd1.Status = StatusDone
+	cmd1.Attempts = 1
+	cmd2.Status = StatusPending
+	cmd2.Attempts = 1
+	cmd2.Err = "command error"
+	cmd2.RunAt = now.Add(time.Minute)
+	for _, cmd := range []QueuedCommand{cmd1, cmd2} {
+		if err := store.UpdateCommand(ctx, cmd); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	cmd, err = store.Command(ctx, cmd1.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmd, cmd1) {
+		t.Error("the command should be correct:", cmd)
+	}
+	cmds, err = store.ClaimCommands(ctx, now.Add(30*time.Second), time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(cmds) != 0 {
+		t.Error("there should be no commands:", cmds)
+	}
+
+	t.Log("claim a retried command")
+	cmds, err = store.ClaimCommands(ctx, now.Add(2*time.Minute), time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	cmd2.Status = StatusRunning
+	if len(cmds) == 1 {
+		if cmds[0].Claim == cmd2.Claim {
+			t.Error("the command should have a new claim:", cmds[0])
+		}
+		cmd2.Claim = cmds[0].Claim
+	}
+	if !reflect.DeepEqual(cmds, []QueuedCommand{cmd2}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+	cmds, err = store.ClaimCommands(ctx, now.Add(150*time.Second), time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(cmds) != 0 {
+		t.Error("there should be no commands:", cmds)
+	}
+
+	t.Log("claim a command again after the lease")
+	cmds, err = store.ClaimCommands(ctx, now.Add(4*time.Minute), time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	staleCmd := cmd2
+	if len(cmds) == 1 {
+		cmd2.Claim = cmds[0].Claim
+	}
+	if !reflect.DeepEqual(cmds, []QueuedCommand{cmd2}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+
+	t.Log("update a command with a lost claim")
+	staleCmd.Status = StatusDone
+	if err := store.UpdateCommand(ctx, staleCmd); err != ErrClaimLost {
+		t.Error("there should be a claim lost error:", err)
+	}
+	cmd, err = store.Command(ctx, cmd2.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmd, cmd2) {
+		t.Error("the command should be correct:", cmd)
+	}
+
+	t.Log("update an unknown command")
+	if err := store.UpdateCommand(ctx, newCmd("cmd4", now)); err != ErrCommandNotFound {
+		t.Error("there should be a command not found error:", err)
+	}
+}
@@ -22,13 +22,13 @@ import (
 )
 
 // NewMiddleware returns a new async handling middleware that returns any errors
-// on a error channel.
+// on a error channel. No command results are collected after the async handoff.
 func NewMiddleware() (eh.CommandHandlerMiddleware, chan Error) {
 	errCh := make(chan Error, 20)
 	return eh.CommandHandlerMiddleware(func(h eh.CommandHandler) eh.CommandHandler {
 		return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
 			go func() {
-				if err := h.HandleCommand(ctx, cmd); err != nil {
+				if err := h.HandleCommand(eh.NewContextWithoutCommandResult(ctx), cmd); err != nil {
 					// Always try to deliver errors.
 					errCh <- Error{err, ctx, cmd}
 				}
@@ -47,5 +47,8 @@ type Error struct {
 
 // Error implements the Error method of the error interface.
 func (e Error) Error() string {
+	if e.Command == nil {
+		return e.Err.Error()
+	}
 	return fmt.Sprintf("%s (%s): %s", e.Command.CommandType(), e.Command.AggregateID(), e.Err.Error())
 }
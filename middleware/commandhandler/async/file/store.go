@@ -0,0 +1,285 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/looplab/eventhorizon/middleware/commandhandler/async"
+)
+
+// DefaultRetention is the default time that done and failed commands are kept
+// before they are purged.
+var DefaultRetention = 24 * time.Hour
+
+// purgeInterval is the min interval between purges of finished commands.
+const purgeInterval = time.Minute
+
+// Store implements async.Store with a JSON file per command in a directory.
+// Done and failed commands are moved to the "finished" sub directory, which is
+// not read when claiming commands, and are purged after the retention. The
+// files are written atomically, but the store must only be used by one process
+// at a time. Numbers in the marshaled contexts are read back as float64.
+type Store struct {
+	dir       string
+	retention time.Duration
+	lastPurge time.Time
+	cmdsMu    sync.Mutex
+}
+
+var _ = async.Store(&Store{})
+
+// fileCommand is the file representation of a queued command.
+type fileCommand struct {
+	async.QueuedCommand
+	ClaimedUntil time.Time
+}
+
+// NewStore creates a new Store using the directory as storage, which is
+// created if needed.
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "finished"), 0755); err != nil {
+		return nil, err
+	}
+
+	s := &Store{
+		dir:       dir,
+		retention: DefaultRetention,
+	}
+	return s, nil
+}
+
+// SetRetention sets the time that done and failed commands are kept.
+func (s *Store) SetRetention(retention time.Duration) {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	s.retention = retention
+}
+
+// EnqueueCommand implements the EnqueueCommand method of the async.Store interface.
+func (s *Store) EnqueueCommand(ctx context.Context, c async.QueuedCommand) error {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	return s.write(fileCommand{QueuedCommand: c})
+}
+
+// UpdateCommand implements the UpdateCommand method of the async.Store interface.
+func (s *Store) UpdateCommand(ctx context.Context, c async.QueuedCommand) error {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	fc, err := s.find(c.ID)
+	if err != nil {
+		return err
+	}
+	if fc.Claim != c.Claim {
+		return async.ErrClaimLost
+	}
+	fc.QueuedCommand = c
+	return s.write(fc)
+}
+
+// Command implements the Command method of the async.Store interface.
+func (s *Store) Command(ctx context.Context, id uuid.UUID) (async.QueuedCommand, error) {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	fc, err := s.find(id)
+	if err != nil {
+		return async.QueuedCommand{}, err
+	}
+	return fc.QueuedCommand, nil
+}
+
+// ClaimCommands implements the ClaimCommands method of the async.Store interface.
+// Finished commands that are older than the retention are purged.
+func (s *Store) ClaimCommands(ctx context.Context, now time.Time, lease time.Duration, max int) ([]async.QueuedCommand, error) {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	if err := s.purge(); err != nil {
+		return nil, err
+	}
+
+	files, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var due []fileCommand
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") {
+			continue
+		}
+		fc, err := s.read(filepath.Join(s.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if (fc.Status == async.StatusPending && !fc.RunAt.After(now)) ||
+			(fc.Status == async.StatusRunning && !fc.ClaimedUntil.After(now)) {
+			due = append(due, fc)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].RunAt.Before(due[j].RunAt)
+	})
+	if len(due) > max {
+		due = due[:max]
+	}
+
+	cmds := []async.QueuedCommand{}
+	for _, fc := range due {
+		fc.Status = async.StatusRunning
+		fc.ClaimedUntil = now.Add(lease)
+		fc.Claim = uuid.New()
+		if err := s.write(fc); err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, fc.QueuedCommand)
+	}
+	return cmds, nil
+}
+
+// Clear removes all commands.
+func (s *Store) Clear(ctx context.Context) error {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	for _, dir := range []string{s.dir, filepath.Join(s.dir, "finished")} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+		if err != nil {
+			return err
+		}
+		for _, f := range files {
+			if err := os.Remove(f); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// purge removes finished commands that were written before the retention, at
+// most once per purge interval. The time of the files is used to not have to
+// read them.
+func (s *Store) purge() error {
+	if time.Since(s.lastPurge) < purgeInterval {
+		return nil
+	}
+	s.lastPurge = time.Now()
+
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, "finished"))
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".json") ||
+			time.Since(f.ModTime()) < s.retention {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.dir, "finished", f.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// path is the path of a command, finished commands are in a sub directory.
+func (s *Store) path(id uuid.UUID, finished bool) string {
+	if finished {
+		return filepath.Join(s.dir, "finished", id.String()+".json")
+	}
+	return filepath.Join(s.dir, id.String()+".json")
+}
+
+// find reads a command that is either queued or finished.
+func (s *Store) find(id uuid.UUID) (fileCommand, error) {
+	fc, err := s.read(s.path(id, false))
+	if err == async.ErrCommandNotFound {
+		return s.read(s.path(id, true))
+	}
+	return fc, err
+}
+
+func (s *Store) read(path string) (fileCommand, error) {
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return fileCommand{}, async.ErrCommandNotFound
+	} else if err != nil {
+		return fileCommand{}, err
+	}
+
+	var fc fileCommand
+	if err := json.Unmarshal(b, &fc); err != nil {
+		return fileCommand{}, err
+	}
+	fc.RunAt = fc.RunAt.UTC()
+	fc.CreatedAt = fc.CreatedAt.UTC()
+	fc.ClaimedUntil = fc.ClaimedUntil.UTC()
+	return fc, nil
+}
+
+// write writes the command to a temporary file which is then renamed, to not
+// leave partially written commands. Done and failed commands are moved to the
+// finished sub directory.
+func (s *Store) write(fc fileCommand) error {
+	b, err := json.Marshal(fc)
+	if err != nil {
+		return err
+	}
+
+	f, err := ioutil.TempFile(s.dir, "tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+
+	finished := fc.Status == async.StatusDone || fc.Status == async.StatusFailed
+	if err := os.Rename(f.Name(), s.path(fc.ID, finished)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if finished {
+		if err := os.Remove(s.path(fc.ID, false)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
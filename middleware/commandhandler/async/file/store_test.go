@@ -0,0 +1,115 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package file
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/looplab/eventhorizon/middleware/commandhandler/async"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventhorizon")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+
+	async.StoreAcceptanceTest(t, store)
+}
+
+func TestStore_Retention(t *testing.T) {
+	dir, err := ioutil.TempDir("", "eventhorizon")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	store.SetRetention(time.Hour)
+
+	ctx := context.Background()
+	now := time.Now()
+	newCmd := func() async.QueuedCommand {
+		return async.QueuedCommand{
+			ID:          uuid.New(),
+			CommandType: mocks.CommandType,
+			RawCommand:  []byte(`{"Content":"content"}`),
+			Status:      async.StatusPending,
+			RunAt:       now,
+			CreatedAt:   now,
+		}
+	}
+	oldCmd, newerCmd := newCmd(), newCmd()
+	for _, c := range []async.QueuedCommand{oldCmd, newerCmd} {
+		if err := store.EnqueueCommand(ctx, c); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	cmds, err := store.ClaimCommands(ctx, now, time.Minute, 10)
+	if err != nil || len(cmds) != 2 {
+		t.Fatal("the commands should be claimed:", cmds, err)
+	}
+	for _, c := range cmds {
+		c.Status = async.StatusDone
+		if err := store.UpdateCommand(ctx, c); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	// Finished commands should be moved out of the queue.
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 0 {
+		t.Error("there should be no queued files:", files)
+	}
+	if _, err := store.Command(ctx, oldCmd.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// Finished commands older than the retention should be purged.
+	old := now.Add(-2 * time.Hour)
+	if err := os.Chtimes(store.path(oldCmd.ID, true), old, old); err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	store.lastPurge = time.Time{}
+	if _, err := store.ClaimCommands(ctx, now, time.Minute, 10); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if _, err := store.Command(ctx, oldCmd.ID); err != async.ErrCommandNotFound {
+		t.Error("there should be a command not found error:", err)
+	}
+	if _, err := store.Command(ctx, newerCmd.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/looplab/eventhorizon/middleware/commandhandler/async"
+)
+
+// Store implements async.Store as an in memory structure. The commands are
+// lost on restart, use a durable store to keep them.
+type Store struct {
+	cmds   map[uuid.UUID]*entry
+	cmdsMu sync.Mutex
+}
+
+var _ = async.Store(&Store{})
+
+type entry struct {
+	async.QueuedCommand
+	claimedUntil time.Time
+}
+
+// NewStore creates a new Store using memory as storage.
+func NewStore() *Store {
+	return &Store{
+		cmds: map[uuid.UUID]*entry{},
+	}
+}
+
+// EnqueueCommand implements the EnqueueCommand method of the async.Store interface.
+func (s *Store) EnqueueCommand(ctx context.Context, c async.QueuedCommand) error {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	s.cmds[c.ID] = &entry{QueuedCommand: c}
+	return nil
+}
+
+// UpdateCommand implements the UpdateCommand method of the async.Store interface.
+func (s *Store) UpdateCommand(ctx context.Context, c async.QueuedCommand) error {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	e, ok := s.cmds[c.ID]
+	if !ok {
+		return async.ErrCommandNotFound
+	}
+	if e.Claim != c.Claim {
+		return async.ErrClaimLost
+	}
+	e.QueuedCommand = c
+	return nil
+}
+
+// Command implements the Command method of the async.Store interface.
+func (s *Store) Command(ctx context.Context, id uuid.UUID) (async.QueuedCommand, error) {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	e, ok := s.cmds[id]
+	if !ok {
+		return async.QueuedCommand{}, async.ErrCommandNotFound
+	}
+	return e.QueuedCommand, nil
+}
+
+// ClaimCommands implements the ClaimCommands method of the async.Store interface.
+func (s *Store) ClaimCommands(ctx context.Context, now time.Time, lease time.Duration, max int) ([]async.QueuedCommand, error) {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	var due []*entry
+	for _, e := range s.cmds {
+		if (e.Status == async.StatusPending && !e.RunAt.After(now)) ||
+			(e.Status == async.StatusRunning && !e.claimedUntil.After(now)) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].RunAt.Before(due[j].RunAt)
+	})
+	if len(due) > max {
+		due = due[:max]
+	}
+
+	cmds := []async.QueuedCommand{}
+	for _, e := range due {
+		e.Status = async.StatusRunning
+		e.claimedUntil = now.Add(lease)
+		e.Claim = uuid.New()
+		cmds = append(cmds, e.QueuedCommand)
+	}
+	return cmds, nil
+}
@@ -0,0 +1,235 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/middleware/commandhandler/async"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// Store implements an async.Store for MongoDB. The commands of all namespaces
+// are stored in the "queued_commands" collection in the DB with the DB prefix
+// as name. Commands are claimed atomically, so several queues can share the
+// store.
+type Store struct {
+	session *mgo.Session
+	dbName  string
+}
+
+var _ = async.Store(&Store{})
+
+// NewStore creates a new Store.
+func NewStore(url, dbPrefix string) (*Store, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewStoreWithSession(session, dbPrefix)
+}
+
+// NewStoreWithSession creates a new Store with a session.
+func NewStoreWithSession(session *mgo.Session, dbPrefix string) (*Store, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &Store{
+		session: session,
+		dbName:  dbPrefix,
+	}
+
+	return s, nil
+}
+
+// EnqueueCommand implements the EnqueueCommand method of the async.Store interface.
+func (s *Store) EnqueueCommand(ctx context.Context, c async.QueuedCommand) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	if err := sess.DB(s.dbName).C("queued_commands").Insert(newDBCommand(c)); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// UpdateCommand implements the UpdateCommand method of the async.Store interface.
+func (s *Store) UpdateCommand(ctx context.Context, c async.QueuedCommand) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.dbName).C("queued_commands").Update(bson.M{
+		"_id":   c.ID.String(),
+		"claim": c.Claim.String(),
+	}, bson.M{
+		"$set": bson.M{
+			"status":   c.Status,
+			"attempts": c.Attempts,
+			"err":      c.Err,
+			"run_at":   c.RunAt,
+		},
+	})
+	if err == mgo.ErrNotFound {
+		// Check if the command exists with another claim.
+		n, err := sess.DB(s.dbName).C("queued_commands").FindId(c.ID.String()).Count()
+		if err != nil {
+			return err
+		} else if n > 0 {
+			return async.ErrClaimLost
+		}
+		return async.ErrCommandNotFound
+	}
+	return err
+}
+
+// Command implements the Command method of the async.Store interface.
+func (s *Store) Command(ctx context.Context, id uuid.UUID) (async.QueuedCommand, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	var c dbCommand
+	err := sess.DB(s.dbName).C("queued_commands").FindId(id.String()).One(&c)
+	if err == mgo.ErrNotFound {
+		return async.QueuedCommand{}, async.ErrCommandNotFound
+	} else if err != nil {
+		return async.QueuedCommand{}, err
+	}
+
+	return c.command()
+}
+
+// ClaimCommands implements the ClaimCommands method of the async.Store interface.
+func (s *Store) ClaimCommands(ctx context.Context, now time.Time, lease time.Duration, max int) ([]async.QueuedCommand, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	query := bson.M{
+		"$or": []bson.M{
+			{"status": async.StatusPending, "run_at": bson.M{"$lte": now}},
+			{"status": async.StatusRunning, "claimed_until": bson.M{"$lte": now}},
+		},
+	}
+
+	cmds := []async.QueuedCommand{}
+	for len(cmds) < max {
+		change := mgo.Change{
+			Update: bson.M{"$set": bson.M{
+				"status":        async.StatusRunning,
+				"claimed_until": now.Add(lease),
+				"claim":         uuid.New().String(),
+			}},
+			ReturnNew: true,
+		}
+
+		var c dbCommand
+		_, err := sess.DB(s.dbName).C("queued_commands").Find(query).Sort("run_at").Apply(change, &c)
+		if err == mgo.ErrNotFound {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		cmd, err := c.command()
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds, nil
+}
+
+// Clear clears the command storage.
+func (s *Store) Clear(ctx context.Context) error {
+	return s.session.DB(s.dbName).C("queued_commands").DropCollection()
+}
+
+// Close closes the database session.
+func (s *Store) Close() {
+	s.session.Close()
+}
+
+// dbCommand is the DB representation of a queued command.
+type dbCommand struct {
+	ID           string                 `bson:"_id"`
+	CommandType  eh.CommandType         `bson:"command_type"`
+	RawCommand   []byte                 `bson:"command"`
+	Context      map[string]interface{} `bson:"context"`
+	Status       async.Status           `bson:"status"`
+	Attempts     int                    `bson:"attempts"`
+	Err          string                 `bson:"err"`
+	RunAt        time.Time              `bson:"run_at"`
+	CreatedAt    time.Time              `bson:"created_at"`
+	ClaimedUntil time.Time              `bson:"claimed_until"`
+	Claim        string                 `bson:"claim"`
+}
+
+func newDBCommand(c async.QueuedCommand) dbCommand {
+	return dbCommand{
+		ID:          c.ID.String(),
+		CommandType: c.CommandType,
+		RawCommand:  c.RawCommand,
+		Context:     c.Context,
+		Status:      c.Status,
+		Attempts:    c.Attempts,
+		Err:         c.Err,
+		RunAt:       c.RunAt,
+		CreatedAt:   c.CreatedAt,
+		Claim:       c.Claim.String(),
+	}
+}
+
+func (c dbCommand) command() (async.QueuedCommand, error) {
+	id, err := uuid.Parse(c.ID)
+	if err != nil {
+		return async.QueuedCommand{}, err
+	}
+	var claim uuid.UUID
+	if c.Claim != "" {
+		if claim, err = uuid.Parse(c.Claim); err != nil {
+			return async.QueuedCommand{}, err
+		}
+	}
+	return async.QueuedCommand{
+		ID:          id,
+		CommandType: c.CommandType,
+		RawCommand:  c.RawCommand,
+		Context:     c.Context,
+		Status:      c.Status,
+		Attempts:    c.Attempts,
+		Err:         c.Err,
+		RunAt:       c.RunAt.UTC(),
+		CreatedAt:   c.CreatedAt.UTC(),
+		Claim:       claim,
+	}, nil
+}
@@ -0,0 +1,347 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Status is the status of a queued command.
+type Status string
+
+const (
+	// StatusPending is when a command is waiting to be handled.
+	StatusPending Status = "pending"
+	// StatusRunning is when a command is being handled.
+	StatusRunning Status = "running"
+	// StatusDone is when a command has been handled.
+	StatusDone Status = "done"
+	// StatusFailed is when a command has failed all attempts.
+	StatusFailed Status = "failed"
+)
+
+// QueuedCommand is a command that is stored by a Queue, to be handled by a
+// worker.
+type QueuedCommand struct {
+	ID          uuid.UUID
+	CommandType eh.CommandType
+	// RawCommand is the command serialized as JSON, it is created again with
+	// eh.CreateCommand when handled.
+	RawCommand []byte
+	// Context is the marshaled context that the command was queued with.
+	Context map[string]interface{}
+	Status  Status
+	// Attempts is the number of times the command has been handled.
+	Attempts int
+	// Err is the error of the last attempt.
+	Err string
+	// RunAt is the time when the command should be handled next.
+	RunAt     time.Time
+	CreatedAt time.Time
+	// Claim is a unique token for each time the command is claimed by
+	// ClaimCommands, only the latest claim can update the command.
+	Claim uuid.UUID
+}
+
+// Command returns the deserialized command.
+func (c QueuedCommand) Command() (eh.Command, error) {
+	cmd, err := eh.CreateCommand(c.CommandType)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(c.RawCommand, cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// Store is a durable store of queued commands.
+type Store interface {
+	// EnqueueCommand saves a new command.
+	EnqueueCommand(ctx context.Context, c QueuedCommand) error
+
+	// UpdateCommand saves the status of a command, if it still has the same
+	// claim as the command. Returns ErrClaimLost if it has been claimed again,
+	// or ErrCommandNotFound.
+	UpdateCommand(ctx context.Context, c QueuedCommand) error
+
+	// Command returns a command, or ErrCommandNotFound.
+	Command(ctx context.Context, id uuid.UUID) (QueuedCommand, error)
+
+	// ClaimCommands returns up to max pending commands with a run time before
+	// now, ordered by run time, and claims them as running until now plus the
+	// lease with a new claim, so that other workers skip them. Running
+	// commands that are not updated before the lease ends are returned again.
+	ClaimCommands(ctx context.Context, now time.Time, lease time.Duration, max int) ([]QueuedCommand, error)
+}
+
+// ErrCommandNotFound is when a queued command could not be found.
+var ErrCommandNotFound = errors.New("queued command not found")
+
+// ErrClaimLost is when a command is updated after it has been claimed again,
+// because the lease ended before it was handled.
+var ErrClaimLost = errors.New("claim of queued command lost")
+
+// ErrHandlerNotSet is when a queue is used before its middleware.
+var ErrHandlerNotSet = errors.New("handler not set")
+
+// DefaultPollInterval is the default interval that idle workers poll the
+// store with.
+var DefaultPollInterval = time.Second
+
+// DefaultLease is the default time that commands are claimed by a worker,
+// before they can be handled again by any worker.
+var DefaultLease = time.Minute
+
+// DefaultMaxAttempts is the default number of times a failing command is
+// handled before it is marked as failed.
+var DefaultMaxAttempts = 3
+
+// DefaultRetryBackoff is the default wait before the first retry of a failed
+// command, it is doubled for each retry.
+var DefaultRetryBackoff = time.Second
+
+// Queue is a durable alternative to the middleware from NewMiddleware. Commands
+// are serialized and saved in a store, and handled by a pool of workers with
+// the marshaled context of the caller. The commands must be registered with
+// eh.RegisterCommand and be JSON serializable. Commands that fail are retried
+// with a backoff, and the status of a command can be queried with its ID.
+// Several queues can share a store, if the store supports claiming commands
+// across instances.
+type Queue struct {
+	store     Store
+	workers   int
+	handler   eh.CommandHandler
+	handlerMu sync.RWMutex
+
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	backoff      time.Duration
+
+	errCh   chan Error
+	dropped uint64
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+}
+
+// NewQueue creates a new Queue with a number of workers. Use Middleware as a
+// command handler middleware and call Start to start the workers.
+func NewQueue(store Store, workers int) *Queue {
+	if workers < 1 {
+		workers = 1
+	}
+	return &Queue{
+		store:        store,
+		workers:      workers,
+		pollInterval: DefaultPollInterval,
+		lease:        DefaultLease,
+		maxAttempts:  DefaultMaxAttempts,
+		backoff:      DefaultRetryBackoff,
+		errCh:        make(chan Error, 100),
+	}
+}
+
+// SetRetries sets the max number of attempts for a command and the wait
+// before the first retry.
+func (q *Queue) SetRetries(maxAttempts int, backoff time.Duration) {
+	q.maxAttempts = maxAttempts
+	q.backoff = backoff
+}
+
+// Middleware is a command handler middleware that queues all commands, the
+// handler is used by the workers to handle them. The ID of the queued command
+// is set as the payload of the command result, see eh.HandleCommandWithResult.
+func (q *Queue) Middleware(h eh.CommandHandler) eh.CommandHandler {
+	q.handlerMu.Lock()
+	q.handler = h
+	q.handlerMu.Unlock()
+
+	return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		id, err := q.EnqueueCommand(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		if r, ok := eh.CommandResultFromContext(ctx); ok {
+			r.AggregateID = cmd.AggregateID()
+			r.Payload = id
+		}
+		return nil
+	})
+}
+
+// EnqueueCommand queues a command and returns the ID of the queued command.
+func (q *Queue) EnqueueCommand(ctx context.Context, cmd eh.Command) (uuid.UUID, error) {
+	if err := eh.CheckCommand(cmd); err != nil {
+		return uuid.Nil, err
+	}
+	if _, err := eh.CreateCommand(cmd.CommandType()); err != nil {
+		return uuid.Nil, err
+	}
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	now := time.Now()
+	c := QueuedCommand{
+		ID:          uuid.New(),
+		CommandType: cmd.CommandType(),
+		RawCommand:  raw,
+		Context:     eh.MarshalContext(ctx),
+		Status:      StatusPending,
+		RunAt:       now,
+		CreatedAt:   now,
+	}
+	if err := q.store.EnqueueCommand(ctx, c); err != nil {
+		return uuid.Nil, err
+	}
+
+	return c.ID, nil
+}
+
+// Status returns a queued command with its status.
+func (q *Queue) Status(ctx context.Context, id uuid.UUID) (QueuedCommand, error) {
+	return q.store.Command(ctx, id)
+}
+
+// Start starts the workers in the background.
+func (q *Queue) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	q.cancel = cancel
+
+	for i := 0; i < q.workers; i++ {
+		q.wg.Add(1)
+		go func() {
+			defer q.wg.Done()
+
+			for {
+				n, err := q.poll(ctx, 1)
+				if err != nil {
+					q.error(Error{Err: err, Ctx: ctx})
+				}
+				if n > 0 {
+					continue
+				}
+
+				select {
+				case <-time.After(q.pollInterval):
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Close stops the workers after the commands that are being handled.
+func (q *Queue) Close() {
+	if q.cancel == nil {
+		return
+	}
+	q.cancel()
+	q.wg.Wait()
+}
+
+// Errors returns the error channel, with errors from commands that have failed
+// all attempts and from the store. Errors are dropped when the channel is full,
+// which is counted by DroppedErrors.
+func (q *Queue) Errors() <-chan Error {
+	return q.errCh
+}
+
+// DroppedErrors returns the number of errors that has been dropped because the
+// error channel was full.
+func (q *Queue) DroppedErrors() uint64 {
+	return atomic.LoadUint64(&q.dropped)
+}
+
+// Poll claims and handles as many commands as there are workers once, in
+// parallel. It is used by the workers, and can also be used to poll manually.
+func (q *Queue) Poll(ctx context.Context) error {
+	_, err := q.poll(ctx, q.workers)
+	return err
+}
+
+func (q *Queue) poll(ctx context.Context, max int) (int, error) {
+	q.handlerMu.RLock()
+	h := q.handler
+	q.handlerMu.RUnlock()
+	if h == nil {
+		return 0, ErrHandlerNotSet
+	}
+
+	cmds, err := q.store.ClaimCommands(ctx, time.Now(), q.lease, max)
+	if err != nil {
+		return 0, err
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range cmds {
+		wg.Add(1)
+		go func(c QueuedCommand) {
+			defer wg.Done()
+			q.handle(h, c)
+		}(c)
+	}
+	wg.Wait()
+
+	return len(cmds), nil
+}
+
+// handle handles a claimed command and updates its status.
+func (q *Queue) handle(h eh.CommandHandler, c QueuedCommand) {
+	ctx := eh.UnmarshalContext(c.Context)
+	cmd, err := c.Command()
+	if err == nil {
+		err = h.HandleCommand(ctx, cmd)
+	}
+
+	c.Attempts++
+	if err == nil {
+		c.Status = StatusDone
+		c.Err = ""
+	} else {
+		c.Err = err.Error()
+		if c.Attempts < q.maxAttempts {
+			c.Status = StatusPending
+			c.RunAt = time.Now().Add(q.backoff << uint(c.Attempts-1))
+		} else {
+			c.Status = StatusFailed
+			q.error(Error{Err: err, Ctx: ctx, Command: cmd})
+		}
+	}
+
+	if err := q.store.UpdateCommand(ctx, c); err != nil {
+		q.error(Error{Err: err, Ctx: ctx, Command: cmd})
+	}
+}
+
+func (q *Queue) error(err Error) {
+	select {
+	case q.errCh <- err:
+	default:
+		atomic.AddUint64(&q.dropped, 1)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package async
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestQueue(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	store := &testQueueStore{cmds: map[uuid.UUID]QueuedCommand{}}
+	q := NewQueue(store, 2)
+	if err := q.Poll(context.Background()); err != ErrHandlerNotSet {
+		t.Error("there should be a handler not set error:", err)
+	}
+
+	inner := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(inner, q.Middleware)
+
+	t.Log("queue a command")
+	ctx := eh.NewContextWithNamespace(context.Background(), "ns")
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	result, err := eh.HandleCommandWithResult(ctx, h, cmd)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(inner.Commands) != 0 {
+		t.Error("the command should not be handled yet:", inner.Commands)
+	}
+	id, ok := result.Payload.(uuid.UUID)
+	if !ok {
+		t.Fatal("the result should have the ID:", result.Payload)
+	}
+	c, err := q.Status(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if c.Status != StatusPending {
+		t.Error("the status should be pending:", c.Status)
+	}
+
+	t.Log("handle the command")
+	if err := q.Poll(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(inner.Commands, []eh.Command{cmd}) {
+		t.Error("the command should have been handled:", inner.Commands)
+	}
+	if ns := eh.NamespaceFromContext(inner.Context); ns != "ns" {
+		t.Error("the namespace should be correct:", ns)
+	}
+	c, err = q.Status(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if c.Status != StatusDone || c.Attempts != 1 {
+		t.Error("the command should be done:", c)
+	}
+
+	t.Log("retry a failing command")
+	inner.Commands = nil
+	handlingErr := errors.New("handling error")
+	inner.Err = handlingErr
+	q.SetRetries(2, 0)
+	id, err = q.EnqueueCommand(ctx, cmd)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := q.Poll(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	c, err = q.Status(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if c.Status != StatusPending || c.Attempts != 1 || c.Err != "handling error" {
+		t.Error("the command should be retried:", c)
+	}
+	if err := q.Poll(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	c, err = q.Status(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if c.Status != StatusFailed || c.Attempts != 2 {
+		t.Error("the command should have failed:", c)
+	}
+	select {
+	case err := <-q.Errors():
+		if err.Err != handlingErr {
+			t.Error("the error should be correct:", err.Err)
+		}
+		if !reflect.DeepEqual(err.Command, cmd) {
+			t.Error("the command should be correct:", err.Command)
+		}
+	default:
+		t.Error("there should be an error")
+	}
+
+	t.Log("count dropped errors")
+	for i := 0; i < cap(q.errCh)+1; i++ {
+		q.error(Error{Err: handlingErr})
+	}
+	if n := q.DroppedErrors(); n != 1 {
+		t.Error("there should be one dropped error:", n)
+	}
+	for len(q.errCh) > 0 {
+		<-q.errCh
+	}
+
+	t.Log("handle commands with workers")
+	inner.Err = nil
+	q.pollInterval = time.Millisecond
+	q.Start()
+	defer q.Close()
+	id, err = q.EnqueueCommand(ctx, cmd)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	timeout := time.After(time.Second)
+	for {
+		c, err = q.Status(ctx, id)
+		if err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+		if c.Status == StatusDone {
+			break
+		}
+		select {
+		case <-time.After(time.Millisecond):
+		case <-timeout:
+			t.Fatal("the command should be handled:", c)
+		}
+	}
+}
+
+type testQueueStore struct {
+	cmds map[uuid.UUID]QueuedCommand
+	mu   sync.Mutex
+}
+
+func (s *testQueueStore) EnqueueCommand(ctx context.Context, c QueuedCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cmds[c.ID] = c
+	return nil
+}
+
+func (s *testQueueStore) UpdateCommand(ctx context.Context, c QueuedCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.cmds[c.ID]; !ok {
+		return ErrCommandNotFound
+	}
+	s.cmds[c.ID] = c
+	return nil
+}
+
+func (s *testQueueStore) Command(ctx context.Context, id uuid.UUID) (QueuedCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, ok := s.cmds[id]
+	if !ok {
+		return QueuedCommand{}, ErrCommandNotFound
+	}
+	return c, nil
+}
+
+func (s *testQueueStore) ClaimCommands(ctx context.Context, now time.Time, lease time.Duration, max int) ([]QueuedCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var cmds []QueuedCommand
+	for id, c := range s.cmds {
+		if len(cmds) < max && c.Status == StatusPending && !c.RunAt.After(now) {
+			c.Status = StatusRunning
+			s.cmds[id] = c
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds, nil
+}
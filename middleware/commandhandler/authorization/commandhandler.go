@@ -0,0 +1,181 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrNoPrincipal is when there is no principal in the context.
+var ErrNoPrincipal = errors.New("no principal")
+
+// ErrNotAllowed is when a policy does not allow the command.
+var ErrNotAllowed = errors.New("not allowed")
+
+// Error is an error when a command is not authorized.
+type Error struct {
+	// Err is the reason for the error, ErrNoPrincipal or ErrNotAllowed.
+	Err error
+	// Principal is the principal that issued the command, if any.
+	Principal Principal
+	// Command is the command that was not authorized.
+	Command eh.Command
+}
+
+// Error implements the Error method of the error interface.
+func (e Error) Error() string {
+	errStr := "unauthorized: " + e.Err.Error()
+	if e.Principal.ID != "" {
+		errStr += " for " + e.Principal.ID
+	}
+	if e.Command != nil {
+		errStr += " (" + string(e.Command.CommandType()) + ", " + e.Command.AggregateID().String() + ")"
+	}
+	return errStr
+}
+
+// Forbidden returns true, it is used by transports like httputils to detect
+// authorization errors without depending on this package.
+func (e Error) Forbidden() bool {
+	return true
+}
+
+// Policy is a function that returns true if the principal may issue the
+// command. The principal is nil if there is none in the context.
+type Policy func(ctx context.Context, p *Principal, cmd eh.Command) bool
+
+// AllowAll is a policy that allows all commands.
+func AllowAll(ctx context.Context, p *Principal, cmd eh.Command) bool {
+	return true
+}
+
+// RequirePrincipal is a policy that allows commands from any principal.
+func RequirePrincipal(ctx context.Context, p *Principal, cmd eh.Command) bool {
+	return p != nil
+}
+
+// RequireRole returns a policy that allows commands from principals with any
+// of the roles.
+func RequireRole(roles ...string) Policy {
+	return func(ctx context.Context, p *Principal, cmd eh.Command) bool {
+		if p == nil {
+			return false
+		}
+		for _, r := range roles {
+			if p.HasRole(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Authorizer authorizes commands with policies per command type and per
+// aggregate type. A command must be allowed by both the policy for its command
+// type and the policy for its aggregate type, if they are set. Commands
+// without any policy are handled by the default policy, which denies all
+// commands if not set.
+type Authorizer struct {
+	commandPolicies   map[eh.CommandType]Policy
+	aggregatePolicies map[eh.AggregateType]Policy
+	defaultPolicy     Policy
+	policiesMu        sync.RWMutex
+}
+
+// NewAuthorizer creates a new Authorizer without policies.
+func NewAuthorizer() *Authorizer {
+	return &Authorizer{
+		commandPolicies:   map[eh.CommandType]Policy{},
+		aggregatePolicies: map[eh.AggregateType]Policy{},
+	}
+}
+
+// SetCommandPolicy sets the policy for a command type.
+func (a *Authorizer) SetCommandPolicy(commandType eh.CommandType, p Policy) {
+	a.policiesMu.Lock()
+	defer a.policiesMu.Unlock()
+	a.commandPolicies[commandType] = p
+}
+
+// SetAggregatePolicy sets the policy for all commands of an aggregate type.
+func (a *Authorizer) SetAggregatePolicy(aggregateType eh.AggregateType, p Policy) {
+	a.policiesMu.Lock()
+	defer a.policiesMu.Unlock()
+	a.aggregatePolicies[aggregateType] = p
+}
+
+// SetDefaultPolicy sets the policy for commands without other policies.
+func (a *Authorizer) SetDefaultPolicy(p Policy) {
+	a.policiesMu.Lock()
+	defer a.policiesMu.Unlock()
+	a.defaultPolicy = p
+}
+
+// Authorize returns an Error if the principal in the context is not allowed
+// to issue the command.
+func (a *Authorizer) Authorize(ctx context.Context, cmd eh.Command) error {
+	a.policiesMu.RLock()
+	var policies []Policy
+	if p, ok := a.commandPolicies[cmd.CommandType()]; ok {
+		policies = append(policies, p)
+	}
+	if p, ok := a.aggregatePolicies[cmd.AggregateType()]; ok {
+		policies = append(policies, p)
+	}
+	if len(policies) == 0 && a.defaultPolicy != nil {
+		policies = append(policies, a.defaultPolicy)
+	}
+	a.policiesMu.RUnlock()
+
+	var principal *Principal
+	if p, ok := PrincipalFromContext(ctx); ok {
+		principal = &p
+	}
+
+	allowed := len(policies) > 0
+	for _, p := range policies {
+		if !p(ctx, principal, cmd) {
+			allowed = false
+			break
+		}
+	}
+	if allowed {
+		return nil
+	}
+
+	err := Error{Err: ErrNotAllowed, Command: cmd}
+	if principal == nil {
+		err.Err = ErrNoPrincipal
+	} else {
+		err.Principal = *principal
+	}
+	return err
+}
+
+// Middleware is a command handler middleware that only handles the commands
+// that are authorized.
+func (a *Authorizer) Middleware(h eh.CommandHandler) eh.CommandHandler {
+	return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		if err := a.Authorize(ctx, cmd); err != nil {
+			return err
+		}
+
+		return h.HandleCommand(ctx, cmd)
+	})
+}
@@ -0,0 +1,86 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestAuthorizer(t *testing.T) {
+	a := NewAuthorizer()
+	inner := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(inner, a.Middleware)
+
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	admin := Principal{ID: "admin", Roles: []string{"admin"}}
+	user := Principal{ID: "user", Roles: []string{"user"}}
+	adminCtx := NewContextWithPrincipal(context.Background(), admin)
+	userCtx := NewContextWithPrincipal(context.Background(), user)
+
+	t.Log("deny commands without policies")
+	err := h.HandleCommand(adminCtx, cmd)
+	if !reflect.DeepEqual(err, Error{Err: ErrNotAllowed, Principal: admin, Command: cmd}) {
+		t.Error("there should be a not allowed error:", err)
+	}
+	if len(inner.Commands) != 0 {
+		t.Error("the command should not be handled:", inner.Commands)
+	}
+
+	t.Log("allow commands with the default policy")
+	a.SetDefaultPolicy(RequirePrincipal)
+	if err := h.HandleCommand(userCtx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	err = h.HandleCommand(context.Background(), cmd)
+	if !reflect.DeepEqual(err, Error{Err: ErrNoPrincipal, Command: cmd}) {
+		t.Error("there should be a no principal error:", err)
+	}
+
+	t.Log("use the command policy")
+	a.SetCommandPolicy(mocks.CommandType, RequireRole("admin"))
+	if err := h.HandleCommand(adminCtx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h.HandleCommand(userCtx, cmd); err == nil {
+		t.Error("there should be an error")
+	}
+
+	t.Log("use both the command and aggregate policy")
+	a.SetAggregatePolicy(mocks.AggregateType, func(ctx context.Context, p *Principal, c eh.Command) bool {
+		return c.AggregateID() != cmd.ID
+	})
+	if err := h.HandleCommand(adminCtx, cmd); err == nil {
+		t.Error("there should be an error")
+	}
+	otherCmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	if err := h.HandleCommand(adminCtx, otherCmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	if !reflect.DeepEqual(inner.Commands, []eh.Command{cmd, cmd, otherCmd}) {
+		t.Error("the commands should be handled:", inner.Commands)
+	}
+	if err := (Error{Err: ErrNotAllowed, Principal: user, Command: cmd}).Error(); err !=
+		"unauthorized: not allowed for user ("+string(mocks.CommandType)+", "+cmd.ID.String()+")" {
+		t.Error("the error string should be correct:", err)
+	}
+}
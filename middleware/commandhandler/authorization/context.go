@@ -0,0 +1,87 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"context"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+func init() {
+	// Register the principal context.
+	eh.RegisterContextMarshaler(func(ctx context.Context, vals map[string]interface{}) {
+		if p, ok := PrincipalFromContext(ctx); ok {
+			vals[principalIDKeyStr] = p.ID
+			vals[principalRolesKeyStr] = p.Roles
+		}
+	})
+	eh.RegisterContextUnmarshaler(func(ctx context.Context, vals map[string]interface{}) context.Context {
+		id, ok := vals[principalIDKeyStr].(string)
+		if !ok {
+			return ctx
+		}
+		p := Principal{ID: id}
+		switch roles := vals[principalRolesKeyStr].(type) {
+		case []string:
+			p.Roles = roles
+		case []interface{}:
+			// Roles that have been decoded from JSON or BSON.
+			for _, r := range roles {
+				if r, ok := r.(string); ok {
+					p.Roles = append(p.Roles, r)
+				}
+			}
+		}
+		return NewContextWithPrincipal(ctx, p)
+	})
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+// Strings used to marshal context values.
+const (
+	principalIDKeyStr    = "eh_principal_id"
+	principalRolesKeyStr = "eh_principal_roles"
+)
+
+// Principal is the user or service that issues commands.
+type Principal struct {
+	ID    string
+	Roles []string
+}
+
+// HasRole returns true if the principal has the role.
+func (p Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// PrincipalFromContext returns the principal from the context.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey).(Principal)
+	return p, ok
+}
+
+// NewContextWithPrincipal sets the principal to use when authorizing commands.
+func NewContextWithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey, p)
+}
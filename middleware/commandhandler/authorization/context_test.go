@@ -0,0 +1,58 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+func TestContextPrincipal(t *testing.T) {
+	ctx := context.Background()
+
+	if p, ok := PrincipalFromContext(ctx); ok {
+		t.Error("there should be no principal:", p)
+	}
+
+	principal := Principal{ID: "user", Roles: []string{"admin", "user"}}
+	ctx = NewContextWithPrincipal(ctx, principal)
+	if p, ok := PrincipalFromContext(ctx); !ok || !reflect.DeepEqual(p, principal) {
+		t.Error("the principal should be correct:", p)
+	}
+
+	vals := eh.MarshalContext(ctx)
+	if id, ok := vals[principalIDKeyStr].(string); !ok || id != "user" {
+		t.Error("the marshaled principal ID shoud be correct:", id)
+	}
+	b, err := json.Marshal(vals)
+	if err != nil {
+		t.Error("could not marshal JSON:", err)
+	}
+
+	// Marshal via JSON to get more realistic testing.
+
+	vals = map[string]interface{}{}
+	if err := json.Unmarshal(b, &vals); err != nil {
+		t.Error("could not unmarshal JSON:", err)
+	}
+	ctx = eh.UnmarshalContext(vals)
+	if p, ok := PrincipalFromContext(ctx); !ok || !reflect.DeepEqual(p, principal) {
+		t.Error("the principal should be correct:", p)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"context"
+	"encoding/json"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+func init() {
+	// Keep authorization errors when handling commands remotely, and don't let
+	// remote clients set the principal unless trusted, for example with
+	// remote.WithTrustedKeys("eh_principal_id", "eh_principal_roles").
+	eh.RegisterErrorCodec("unauthorized", errorCodec{})
+	eh.RegisterProtectedContextKey(principalIDKeyStr)
+	eh.RegisterProtectedContextKey(principalRolesKeyStr)
+}
+
+// errorCodec is the eventhorizon.ErrorCodec for Error.
+type errorCodec struct{}
+
+// encodedError is the encoded form of an Error, the principal and command are
+// taken from the receiving side.
+type encodedError struct {
+	NoPrincipal bool `json:"no_principal,omitempty"`
+}
+
+// EncodeError implements the EncodeError method of the eventhorizon.ErrorCodec interface.
+func (errorCodec) EncodeError(err error) ([]byte, bool) {
+	e, ok := err.(Error)
+	if !ok {
+		return nil, false
+	}
+	b, err := json.Marshal(encodedError{NoPrincipal: e.Err == ErrNoPrincipal})
+	if err != nil {
+		return nil, false
+	}
+	return b, true
+}
+
+// DecodeError implements the DecodeError method of the eventhorizon.ErrorCodec interface.
+func (errorCodec) DecodeError(ctx context.Context, cmd eh.Command, details []byte) error {
+	var r encodedError
+	if err := json.Unmarshal(details, &r); err != nil {
+		return err
+	}
+	e := Error{Err: ErrNotAllowed, Command: cmd}
+	if r.NoPrincipal {
+		e.Err = ErrNoPrincipal
+	}
+	e.Principal, _ = PrincipalFromContext(ctx)
+	return e
+}
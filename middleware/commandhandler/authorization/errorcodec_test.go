@@ -0,0 +1,81 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package authorization
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/commandhandler/remote"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func init() {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+}
+
+func TestErrorCodec(t *testing.T) {
+	a := NewAuthorizer()
+	a.SetDefaultPolicy(RequireRole("admin"))
+	inner := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(inner, a.Middleware)
+
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	admin := Principal{ID: "admin", Roles: []string{"admin"}}
+	adminCtx := NewContextWithPrincipal(context.Background(), admin)
+
+	t.Log("drop the principal from the client")
+	server := httptest.NewServer(remote.NewServer(h))
+	c := remote.NewClient(server.URL, nil)
+	err := c.HandleCommand(adminCtx, cmd)
+	if !reflect.DeepEqual(err, Error{Err: ErrNoPrincipal, Principal: admin, Command: cmd}) {
+		t.Error("there should be a no principal error:", err)
+	}
+	if len(inner.Commands) != 0 {
+		t.Error("the command should not be handled:", inner.Commands)
+	}
+	server.Close()
+
+	t.Log("set the principal on the server")
+	server = httptest.NewServer(remote.NewServer(h, remote.WithContext(
+		func(r *http.Request, ctx context.Context) context.Context {
+			return NewContextWithPrincipal(ctx, Principal{ID: r.Header.Get("X-User")})
+		},
+	)))
+	c = remote.NewClient(server.URL, nil)
+	err = c.HandleCommand(adminCtx, cmd)
+	if !reflect.DeepEqual(err, Error{Err: ErrNotAllowed, Principal: admin, Command: cmd}) {
+		t.Error("there should be a not allowed error:", err)
+	}
+	server.Close()
+
+	t.Log("trust the principal from the client")
+	server = httptest.NewServer(remote.NewServer(h,
+		remote.WithTrustedKeys(principalIDKeyStr, principalRolesKeyStr)))
+	defer server.Close()
+	c = remote.NewClient(server.URL, nil)
+	if err := c.HandleCommand(adminCtx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(inner.Commands, []eh.Command{cmd}) {
+		t.Error("the command should be handled:", inner.Commands)
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// StoreAcceptanceTest is the acceptance test that all implementations of
+// Store should pass. It should manually be called from a test case in each
+// implementation:
+//
+//   func TestStore(t *testing.T) {
+//       store := NewStore()
+//       idempotency.StoreAcceptanceTest(t, store)
+//   }
+//
+func StoreAcceptanceTest(t *testing.T, store Store) {
+	ctx := context.Background()
+	otherCtx := eh.NewContextWithNamespace(ctx, "other")
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+
+	t.Log("begin a new command")
+	r, err := store.BeginCommand(ctx, id, now, now.Add(time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if r != nil {
+		t.Error("there should be no record:", r)
+	}
+
+	t.Log("begin a command in progress")
+	r, err = store.BeginCommand(ctx, id, now.Add(time.Minute), now.Add(time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected := &Record{
+		ID:        id,
+		ExpiresAt: now.Add(time.Hour),
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Error("the record should be correct:", r)
+	}
+
+	t.Log("begin the command in another namespace")
+	r, err = store.BeginCommand(otherCtx, id, now, now.Add(time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if r != nil {
+		t.Error("there should be no record:", r)
+	}
+
+	t.Log("finish the command")
+	finished := Record{
+		ID:        id,
+		Done:      true,
+		Result:    []byte(`{"version":1}`),
+		ExpiresAt: now.Add(2 * time.Hour),
+	}
+	if err := store.FinishCommand(ctx, finished); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	r, err = store.BeginCommand(ctx, id, now.Add(time.Minute), now.Add(time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(r, &finished) {
+		t.Error("the record should be correct:", r)
+	}
+
+	t.Log("release a command")
+	if err := store.ReleaseCommand(otherCtx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	r, err = store.BeginCommand(otherCtx, id, now.Add(time.Minute), now.Add(time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if r != nil {
+		t.Error("there should be no record:", r)
+	}
+	if err := store.ReleaseCommand(otherCtx, uuid.New()); err != nil {
+		t.Error("there should be no error for a missing record:", err)
+	}
+
+	t.Log("begin an expired command")
+	r, err = store.BeginCommand(ctx, id, now.Add(3*time.Hour), now.Add(4*time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if r != nil {
+		t.Error("there should be no record:", r)
+	}
+	r, err = store.BeginCommand(ctx, id, now.Add(3*time.Hour), now.Add(4*time.Hour))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	expected = &Record{
+		ID:        id,
+		ExpiresAt: now.Add(4 * time.Hour),
+	}
+	if !reflect.DeepEqual(r, expected) {
+		t.Error("the record should be correct:", r)
+	}
+}
@@ -0,0 +1,225 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+func init() {
+	eh.RegisterErrorCode("command_in_progress", ErrCommandInProgress)
+}
+
+// ErrCommandInProgress is when a command with the same ID is still being
+// handled.
+var ErrCommandInProgress = errors.New("command in progress")
+
+// InProgressLease is how long a command is recorded as in progress while it is
+// handled. If the handling process crashes the command can be handled again
+// after the lease, instead of after the full TTL.
+var InProgressLease = time.Minute
+
+// NewMiddleware returns a new middleware that handles commands with IDs only
+// once. The result of each successful command is recorded in the store for the
+// TTL and a duplicate command returns the original result, see
+// eh.HandleCommandWithResult, without being handled again. Failed commands are
+// not recorded, so that they can be retried with the same ID, and the original
+// error is returned. Commands without IDs are handled as usual.
+//
+// A command is never reported as failed once it has been handled. If the
+// result can not be stored the command is recorded as done without it, and
+// duplicates only get the aggregate ID and version. If the store fails to
+// record it at all, the command can be handled again after InProgressLease.
+func NewMiddleware(store Store, ttl time.Duration) eh.CommandHandlerMiddleware {
+	return eh.CommandHandlerMiddleware(func(h eh.CommandHandler) eh.CommandHandler {
+		return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+			c, ok := cmd.(Command)
+			if !ok || c.CommandID() == uuid.Nil {
+				return h.HandleCommand(ctx, cmd)
+			}
+
+			now := time.Now()
+			r, err := store.BeginCommand(ctx, c.CommandID(), now, now.Add(InProgressLease))
+			if err != nil {
+				return err
+			} else if r != nil {
+				return replay(ctx, r)
+			}
+
+			result, err := eh.HandleCommandWithResult(ctx, h, cmd)
+			if err != nil {
+				// Release the command so that it can be retried, the error
+				// from handling is more important than any release error.
+				store.ReleaseCommand(ctx, c.CommandID())
+				return err
+			}
+
+			if r, ok := eh.CommandResultFromContext(ctx); ok {
+				*r = *result
+			}
+
+			record := Record{
+				ID:        c.CommandID(),
+				Done:      true,
+				ExpiresAt: time.Now().Add(ttl),
+			}
+			if record.Result, err = marshalResult(result); err == nil {
+				if err = store.FinishCommand(ctx, record); err == nil {
+					return nil
+				}
+			}
+
+			// Record the command as done without the full result, which can
+			// fail to be encoded or be too large for the store.
+			record.Result, _ = marshalResult(&eh.CommandResult{
+				AggregateID: result.AggregateID,
+				Version:     result.Version,
+			})
+			store.FinishCommand(ctx, record)
+			return nil
+		})
+	})
+}
+
+// Command is a command with an ID, which is used to detect duplicates.
+type Command interface {
+	eh.Command
+
+	// CommandID returns the ID of the command.
+	CommandID() uuid.UUID
+}
+
+// CommandWithID returns a wrapped command with an ID.
+func CommandWithID(cmd eh.Command, id uuid.UUID) Command {
+	return &command{Command: cmd, id: id}
+}
+
+// private implementation to wrap ordinary commands and add an ID.
+type command struct {
+	eh.Command
+	id uuid.UUID
+}
+
+// CommandID implements the CommandID method of the Command interface.
+func (c *command) CommandID() uuid.UUID {
+	return c.id
+}
+
+// replay returns the original outcome of a command.
+func replay(ctx context.Context, r *Record) error {
+	if !r.Done {
+		return ErrCommandInProgress
+	}
+
+	if res, ok := eh.CommandResultFromContext(ctx); ok {
+		result, err := unmarshalResult(r.Result)
+		if err != nil {
+			return err
+		}
+		*res = *result
+	}
+
+	return nil
+}
+
+// result is the stored form of a eh.CommandResult.
+type result struct {
+	AggregateID uuid.UUID       `json:"aggregate_id"`
+	Version     int             `json:"version"`
+	Events      []event         `json:"events,omitempty"`
+	Payload     json.RawMessage `json:"payload,omitempty"`
+}
+
+// event is the stored form of an event in a result.
+type event struct {
+	EventType     eh.EventType     `json:"event_type"`
+	AggregateType eh.AggregateType `json:"aggregate_type"`
+	AggregateID   uuid.UUID        `json:"aggregate_id"`
+	Version       int              `json:"version"`
+	Timestamp     time.Time        `json:"timestamp"`
+	Data          json.RawMessage  `json:"data,omitempty"`
+}
+
+func marshalResult(r *eh.CommandResult) ([]byte, error) {
+	res := result{
+		AggregateID: r.AggregateID,
+		Version:     r.Version,
+	}
+	if r.Payload != nil {
+		b, err := json.Marshal(r.Payload)
+		if err != nil {
+			return nil, err
+		}
+		res.Payload = b
+	}
+	for _, e := range r.Events {
+		ev := event{
+			EventType:     e.EventType(),
+			AggregateType: e.AggregateType(),
+			AggregateID:   e.AggregateID(),
+			Version:       e.Version(),
+			Timestamp:     e.Timestamp(),
+		}
+		if e.Data() != nil {
+			b, err := json.Marshal(e.Data())
+			if err != nil {
+				return nil, err
+			}
+			ev.Data = b
+		}
+		res.Events = append(res.Events, ev)
+	}
+	return json.Marshal(res)
+}
+
+// unmarshalResult recreates a result, the event data is created with
+// eh.CreateEventData and the payload is kept as a json.RawMessage.
+func unmarshalResult(b []byte) (*eh.CommandResult, error) {
+	var res result
+	if err := json.Unmarshal(b, &res); err != nil {
+		return nil, err
+	}
+
+	r := &eh.CommandResult{
+		AggregateID: res.AggregateID,
+		Version:     res.Version,
+	}
+	if len(res.Payload) > 0 {
+		r.Payload = res.Payload
+	}
+	for _, e := range res.Events {
+		var data eh.EventData
+		if len(e.Data) > 0 {
+			var err error
+			if data, err = eh.CreateEventData(e.EventType); err != nil {
+				return nil, err
+			}
+			if err := json.Unmarshal(e.Data, data); err != nil {
+				return nil, err
+			}
+		}
+		r.Events = append(r.Events, eh.NewEventForAggregate(e.EventType, data,
+			e.Timestamp, e.AggregateType, e.AggregateID, e.Version))
+	}
+
+	return r, nil
+}
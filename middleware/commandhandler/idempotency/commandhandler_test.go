@@ -0,0 +1,224 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	store := &testStore{records: map[uuid.UUID]Record{}}
+	id := uuid.New()
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event"},
+		timestamp, mocks.AggregateType, id, 2)
+	var handled []eh.Command
+	var handlerErr error
+	var payload interface{} = map[string]string{"key": "value"}
+	inner := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		handled = append(handled, cmd)
+		if handlerErr != nil {
+			return handlerErr
+		}
+		if r, ok := eh.CommandResultFromContext(ctx); ok {
+			r.AggregateID = id
+			r.Version = 2
+			r.Events = []eh.Event{event}
+			r.Payload = payload
+		}
+		return nil
+	})
+	h := eh.UseCommandHandlerMiddleware(inner, NewMiddleware(store, time.Hour))
+
+	t.Log("handle commands without ID")
+	cmd := &mocks.Command{ID: id, Content: "content"}
+	if err := h.HandleCommand(context.Background(), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h.HandleCommand(context.Background(), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 2 {
+		t.Error("the commands should be handled:", handled)
+	}
+	if len(store.records) != 0 {
+		t.Error("there should be no records:", store.records)
+	}
+
+	t.Log("handle a command with ID")
+	handled = nil
+	cmdWithID := CommandWithID(cmd, uuid.New())
+	result, err := eh.HandleCommandWithResult(context.Background(), h, cmdWithID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result.Version != 2 || !reflect.DeepEqual(result.Events, []eh.Event{event}) {
+		t.Error("the result should be correct:", result)
+	}
+	if len(handled) != 1 {
+		t.Error("the command should be handled:", handled)
+	}
+
+	t.Log("handle a duplicate command")
+	duplicate, err := eh.HandleCommandWithResult(context.Background(), h, cmdWithID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 1 {
+		t.Error("the command should not be handled again:", handled)
+	}
+	if duplicate.AggregateID != id || duplicate.Version != 2 ||
+		!reflect.DeepEqual(duplicate.Events, []eh.Event{event}) {
+		t.Error("the result should be correct:", duplicate)
+	}
+	if payload, ok := duplicate.Payload.(json.RawMessage); !ok || string(payload) != `{"key":"value"}` {
+		t.Error("the payload should be correct:", duplicate.Payload)
+	}
+
+	t.Log("retry a failed command")
+	handlerErr = eh.EventStoreError{Err: eh.ErrConcurrencyConflict, Namespace: "ns"}
+	failedCmd := CommandWithID(cmd, uuid.New())
+	if err := h.HandleCommand(context.Background(), failedCmd); err != handlerErr {
+		t.Error("there should be the original command error:", err)
+	}
+	handlerErr = nil
+	if err := h.HandleCommand(context.Background(), failedCmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 3 {
+		t.Error("the command should be handled again:", handled)
+	}
+	if err := h.HandleCommand(context.Background(), failedCmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 3 {
+		t.Error("the successful command should not be handled again:", handled)
+	}
+
+	t.Log("handle a command in progress")
+	inProgressCmd := CommandWithID(cmd, uuid.New())
+	if _, err := store.BeginCommand(context.Background(), inProgressCmd.CommandID(),
+		time.Now(), time.Now().Add(time.Hour)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h.HandleCommand(context.Background(), inProgressCmd); err != ErrCommandInProgress {
+		t.Error("there should be a command in progress error:", err)
+	}
+	if len(handled) != 3 {
+		t.Error("the command should not be handled:", handled)
+	}
+
+	t.Log("handle a command after the in progress lease")
+	crashedCmd := CommandWithID(cmd, uuid.New())
+	if _, err := store.BeginCommand(context.Background(), crashedCmd.CommandID(),
+		time.Now().Add(-time.Hour), time.Now().Add(-time.Second)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h.HandleCommand(context.Background(), crashedCmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 4 {
+		t.Error("the command should be handled:", handled)
+	}
+	if r := store.records[crashedCmd.CommandID()]; !r.Done || time.Until(r.ExpiresAt) < 59*time.Minute {
+		t.Error("the record should be kept for the TTL:", r)
+	}
+
+	t.Log("handle a command with a result that can not be encoded")
+	payload = make(chan int)
+	unencodableCmd := CommandWithID(cmd, uuid.New())
+	result, err = eh.HandleCommandWithResult(context.Background(), h, unencodableCmd)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if result.Payload != payload {
+		t.Error("the result should be correct:", result)
+	}
+	duplicate, err = eh.HandleCommandWithResult(context.Background(), h, unencodableCmd)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(handled) != 5 {
+		t.Error("the command should not be handled again:", handled)
+	}
+	if duplicate.AggregateID != id || duplicate.Version != 2 ||
+		len(duplicate.Events) != 0 || duplicate.Payload != nil {
+		t.Error("the result should be correct:", duplicate)
+	}
+	payload = map[string]string{"key": "value"}
+
+	t.Log("handle a command with a result that can not be stored")
+	store.finishFailures = 1
+	unstorableCmd := CommandWithID(cmd, uuid.New())
+	if err := h.HandleCommand(context.Background(), unstorableCmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if r := store.records[unstorableCmd.CommandID()]; !r.Done {
+		t.Error("the command should be recorded as done:", r)
+	}
+
+	t.Log("handle a command that can not be recorded")
+	store.finishFailures = 2
+	unrecordedCmd := CommandWithID(cmd, uuid.New())
+	if err := h.HandleCommand(context.Background(), unrecordedCmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+type testStore struct {
+	records map[uuid.UUID]Record
+	// Used to fail the next number of FinishCommand calls.
+	finishFailures int
+	mu             sync.Mutex
+}
+
+func (s *testStore) BeginCommand(ctx context.Context, id uuid.UUID, now, expiresAt time.Time) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if r, ok := s.records[id]; ok && r.ExpiresAt.After(now) {
+		return &r, nil
+	}
+	s.records[id] = Record{ID: id, ExpiresAt: expiresAt}
+	return nil, nil
+}
+
+func (s *testStore) FinishCommand(ctx context.Context, r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.finishFailures > 0 {
+		s.finishFailures--
+		return errors.New("store error")
+	}
+	s.records[r.ID] = r
+	return nil
+}
+
+func (s *testStore) ReleaseCommand(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, id)
+	return nil
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/middleware/commandhandler/idempotency"
+)
+
+// Store implements idempotency.Store as an in memory structure. Expired
+// records are removed when new commands are begun.
+type Store struct {
+	records   map[string]map[uuid.UUID]idempotency.Record
+	recordsMu sync.Mutex
+}
+
+var _ = idempotency.Store(&Store{})
+
+// NewStore creates a new Store using memory as storage.
+func NewStore() *Store {
+	return &Store{
+		records: map[string]map[uuid.UUID]idempotency.Record{},
+	}
+}
+
+// BeginCommand implements the BeginCommand method of the idempotency.Store interface.
+func (s *Store) BeginCommand(ctx context.Context, id uuid.UUID, now, expiresAt time.Time) (*idempotency.Record, error) {
+	s.recordsMu.Lock()
+	defer s.recordsMu.Unlock()
+
+	ns := eh.NamespaceFromContext(ctx)
+	records, ok := s.records[ns]
+	if !ok {
+		records = map[uuid.UUID]idempotency.Record{}
+		s.records[ns] = records
+	}
+
+	for recordID, r := range records {
+		if !r.ExpiresAt.After(now) {
+			delete(records, recordID)
+		}
+	}
+
+	if r, ok := records[id]; ok {
+		return &r, nil
+	}
+	records[id] = idempotency.Record{
+		ID:        id,
+		ExpiresAt: expiresAt,
+	}
+
+	return nil, nil
+}
+
+// FinishCommand implements the FinishCommand method of the idempotency.Store interface.
+func (s *Store) FinishCommand(ctx context.Context, r idempotency.Record) error {
+	s.recordsMu.Lock()
+	defer s.recordsMu.Unlock()
+
+	ns := eh.NamespaceFromContext(ctx)
+	if _, ok := s.records[ns]; !ok {
+		s.records[ns] = map[uuid.UUID]idempotency.Record{}
+	}
+	s.records[ns][r.ID] = r
+
+	return nil
+}
+
+// ReleaseCommand implements the ReleaseCommand method of the idempotency.Store interface.
+func (s *Store) ReleaseCommand(ctx context.Context, id uuid.UUID) error {
+	s.recordsMu.Lock()
+	defer s.recordsMu.Unlock()
+
+	delete(s.records[eh.NamespaceFromContext(ctx)], id)
+
+	return nil
+}
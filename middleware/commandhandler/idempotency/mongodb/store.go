@@ -0,0 +1,185 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/middleware/commandhandler/idempotency"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// Store implements an idempotency.Store for MongoDB. The records of all
+// namespaces are stored in the "command_records" collection in the DB with the
+// DB prefix as name. Expired records are removed by a TTL index.
+type Store struct {
+	session *mgo.Session
+	dbName  string
+}
+
+var _ = idempotency.Store(&Store{})
+
+// NewStore creates a new Store.
+func NewStore(url, dbPrefix string) (*Store, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewStoreWithSession(session, dbPrefix)
+}
+
+// NewStoreWithSession creates a new Store with a session.
+func NewStoreWithSession(session *mgo.Session, dbPrefix string) (*Store, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &Store{
+		session: session,
+		dbName:  dbPrefix,
+	}
+
+	if err := s.session.DB(s.dbName).C("command_records").EnsureIndex(mgo.Index{
+		Key:         []string{"expires_at"},
+		ExpireAfter: time.Second,
+	}); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// BeginCommand implements the BeginCommand method of the idempotency.Store interface.
+func (s *Store) BeginCommand(ctx context.Context, id uuid.UUID, now, expiresAt time.Time) (*idempotency.Record, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	// The upsert fails with a duplicate key if there is a record that has not
+	// expired, as the query will not match the existing document.
+	key := recordKey(ctx, id)
+	change := mgo.Change{
+		Update: bson.M{"$set": dbRecord{
+			ID:        key,
+			Namespace: eh.NamespaceFromContext(ctx),
+			CommandID: id.String(),
+			ExpiresAt: expiresAt,
+		}},
+		Upsert: true,
+	}
+	_, err := sess.DB(s.dbName).C("command_records").Find(bson.M{
+		"_id":        key,
+		"expires_at": bson.M{"$lte": now},
+	}).Apply(change, &bson.M{})
+	if err == nil {
+		return nil, nil
+	} else if !mgo.IsDup(err) {
+		return nil, err
+	}
+
+	var r dbRecord
+	if err := sess.DB(s.dbName).C("command_records").FindId(key).One(&r); err != nil {
+		return nil, err
+	}
+	return r.record()
+}
+
+// FinishCommand implements the FinishCommand method of the idempotency.Store interface.
+func (s *Store) FinishCommand(ctx context.Context, r idempotency.Record) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	key := recordKey(ctx, r.ID)
+	if _, err := sess.DB(s.dbName).C("command_records").UpsertId(key, dbRecord{
+		ID:        key,
+		Namespace: eh.NamespaceFromContext(ctx),
+		CommandID: r.ID.String(),
+		Done:      r.Done,
+		Result:    r.Result,
+		ExpiresAt: r.ExpiresAt,
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ReleaseCommand implements the ReleaseCommand method of the idempotency.Store interface.
+func (s *Store) ReleaseCommand(ctx context.Context, id uuid.UUID) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	if err := sess.DB(s.dbName).C("command_records").RemoveId(recordKey(ctx, id)); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+
+	return nil
+}
+
+// Clear clears the record storage.
+func (s *Store) Clear(ctx context.Context) error {
+	return s.session.DB(s.dbName).C("command_records").DropCollection()
+}
+
+// Close closes the database session.
+func (s *Store) Close() {
+	s.session.Close()
+}
+
+// recordKey is the key of a record, unique for the namespace and command ID.
+func recordKey(ctx context.Context, id uuid.UUID) string {
+	return eh.NamespaceFromContext(ctx) + ":" + id.String()
+}
+
+// dbRecord is the DB representation of a record.
+type dbRecord struct {
+	ID        string    `bson:"_id"`
+	Namespace string    `bson:"namespace"`
+	CommandID string    `bson:"command_id"`
+	Done      bool      `bson:"done"`
+	Result    []byte    `bson:"result"`
+	ExpiresAt time.Time `bson:"expires_at"`
+}
+
+func (r dbRecord) record() (*idempotency.Record, error) {
+	id, err := uuid.Parse(r.CommandID)
+	if err != nil {
+		return nil, err
+	}
+	record := &idempotency.Record{
+		ID:        id,
+		Done:      r.Done,
+		ExpiresAt: r.ExpiresAt.UTC(),
+	}
+	if len(r.Result) > 0 {
+		record.Result = r.Result
+	}
+	return record, nil
+}
@@ -0,0 +1,49 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Record is the recorded outcome of a command with an ID.
+type Record struct {
+	ID uuid.UUID
+	// Done is false while the command is handled.
+	Done bool
+	// Result is the JSON encoded result of the command.
+	Result []byte
+	// ExpiresAt is the time when the record can be removed.
+	ExpiresAt time.Time
+}
+
+// Store is a store for command records. The records are kept per namespace,
+// which is taken from the context.
+type Store interface {
+	// BeginCommand records a command as in progress until expiresAt, unless
+	// there already is a record that has not expired at now. Returns the
+	// existing record, or nil if the command was recorded.
+	BeginCommand(ctx context.Context, id uuid.UUID, now, expiresAt time.Time) (*Record, error)
+
+	// FinishCommand saves the outcome of a command that was begun.
+	FinishCommand(ctx context.Context, r Record) error
+
+	// ReleaseCommand removes the record of a command that was begun, so that
+	// it can be handled again.
+	ReleaseCommand(ctx context.Context, id uuid.UUID) error
+}
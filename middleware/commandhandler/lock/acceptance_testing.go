@@ -0,0 +1,79 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// LockerAcceptanceTest is the acceptance test that all implementations of
+// Locker should pass. It should manually be called from a test case in each
+// implementation:
+//
+//   func TestLocker(t *testing.T) {
+//       locker := NewLocker()
+//       lock.LockerAcceptanceTest(t, locker)
+//   }
+//
+func LockerAcceptanceTest(t *testing.T, locker Locker) {
+	ctx := context.Background()
+	id := uuid.New()
+
+	t.Log("lock an aggregate")
+	if err := locker.Lock(ctx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("lock a locked aggregate with a deadline")
+	timeoutCtx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := locker.Lock(timeoutCtx, id); err != context.DeadlineExceeded {
+		t.Error("there should be a deadline exceeded error:", err)
+	}
+
+	t.Log("wait for an unlock")
+	locked := make(chan error, 1)
+	go func() {
+		locked <- locker.Lock(ctx, id)
+	}()
+	select {
+	case err := <-locked:
+		t.Fatal("the lock should wait:", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := locker.Unlock(ctx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	select {
+	case err := <-locked:
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the lock should be acquired")
+	}
+
+	t.Log("unlock an aggregate")
+	if err := locker.Unlock(ctx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := locker.Unlock(ctx, id); err != ErrNotLocked {
+		t.Error("there should be a not locked error:", err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"errors"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrNotLocked is when an aggregate that is not locked is unlocked.
+var ErrNotLocked = errors.New("not locked")
+
+// Locker is a lock per aggregate, the namespace is taken from the context.
+type Locker interface {
+	// Lock locks the aggregate, waiting until it is unlocked. Returns the
+	// error of the context if it is done before the lock is acquired.
+	Lock(ctx context.Context, id uuid.UUID) error
+
+	// Unlock unlocks the aggregate. Returns ErrNotLocked if it is not locked.
+	Unlock(ctx context.Context, id uuid.UUID) error
+}
+
+type contextKey int
+
+const ownerKey contextKey = iota
+
+// NewContextWithOwner returns a context with a new unique lock owner. Lockers
+// that can lose a lock, like when a lease expires, use it to only unlock locks
+// that are held by the same owner. The middleware adds an owner per command.
+func NewContextWithOwner(ctx context.Context) context.Context {
+	return context.WithValue(ctx, ownerKey, uuid.New())
+}
+
+// OwnerFromContext returns the lock owner of the context.
+func OwnerFromContext(ctx context.Context) (uuid.UUID, bool) {
+	owner, ok := ctx.Value(ownerKey).(uuid.UUID)
+	return owner, ok
+}
+
+// NewMiddleware returns a new middleware that serializes the handling of
+// commands per aggregate with a locker. Use a LocalLocker for commands in one
+// process, and add a distributed locker after it for multiple processes. If
+// the lock is lost while handling the command, like when a lease expires, the
+// error of the unlock is returned.
+//
+// The locks are not reentrant, a command that is handled while handling
+// another command for the same aggregate, like a command from a saga that is
+// run synchronously, waits until the context is done.
+func NewMiddleware(locker Locker) eh.CommandHandlerMiddleware {
+	return eh.CommandHandlerMiddleware(func(h eh.CommandHandler) eh.CommandHandler {
+		return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) (err error) {
+			ctx = NewContextWithOwner(ctx)
+			if err := locker.Lock(ctx, cmd.AggregateID()); err != nil {
+				return err
+			}
+			defer func() {
+				if unlockErr := locker.Unlock(ctx, cmd.AggregateID()); err == nil {
+					err = unlockErr
+				}
+			}()
+
+			return h.HandleCommand(ctx, cmd)
+		})
+	})
+}
@@ -0,0 +1,124 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestCommandHandler(t *testing.T) {
+	var mu sync.Mutex
+	running, maxRunning, handled := 0, 0, 0
+	inner := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		mu.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mu.Unlock()
+
+		time.Sleep(5 * time.Millisecond)
+
+		mu.Lock()
+		running--
+		handled++
+		mu.Unlock()
+		return nil
+	})
+	locker := NewLocalLocker()
+	h := eh.UseCommandHandlerMiddleware(inner, NewMiddleware(locker))
+
+	t.Log("serialize commands for the same aggregate")
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := h.HandleCommand(context.Background(), cmd); err != nil {
+				t.Error("there should be no error:", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if handled != 10 {
+		t.Error("all commands should be handled:", handled)
+	}
+	if maxRunning != 1 {
+		t.Error("the commands should be serialized:", maxRunning)
+	}
+
+	t.Log("respect the context deadline")
+	if err := locker.Lock(context.Background(), cmd.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.HandleCommand(ctx, cmd); err != context.DeadlineExceeded {
+		t.Error("there should be a deadline exceeded error:", err)
+	}
+	if handled != 10 {
+		t.Error("the command should not be handled:", handled)
+	}
+	if err := locker.Unlock(context.Background(), cmd.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+func TestCommandHandler_Owner(t *testing.T) {
+	owners := []uuid.UUID{}
+	inner := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		owner, ok := OwnerFromContext(ctx)
+		if !ok {
+			t.Error("there should be a lock owner")
+		}
+		owners = append(owners, owner)
+		return nil
+	})
+	h := eh.UseCommandHandlerMiddleware(inner, NewMiddleware(NewLocalLocker()))
+
+	// Each command should have its own owner.
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	for i := 0; i < 2; i++ {
+		if err := h.HandleCommand(context.Background(), cmd); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if len(owners) != 2 || owners[0] == owners[1] {
+		t.Error("the owners should be unique:", owners)
+	}
+}
+
+func TestCommandHandler_LostLock(t *testing.T) {
+	locker := NewLocalLocker()
+	inner := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		// Simulate a lock that is lost while handling the command.
+		return locker.Unlock(ctx, cmd.AggregateID())
+	})
+	h := eh.UseCommandHandlerMiddleware(inner, NewMiddleware(locker))
+
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	if err := h.HandleCommand(context.Background(), cmd); err != ErrNotLocked {
+		t.Error("there should be a not locked error:", err)
+	}
+}
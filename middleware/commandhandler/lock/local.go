@@ -0,0 +1,101 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// LocalLocker is a Locker for one process, with a lock per aggregate. Only
+// commands for the same aggregate wait for each other, the locks are removed
+// when they are no longer used.
+type LocalLocker struct {
+	locks   map[string]*localLock
+	locksMu sync.Mutex
+}
+
+var _ = Locker(&LocalLocker{})
+
+// localLock is the lock of an aggregate, refs is the number of holders and
+// waiters.
+type localLock struct {
+	ch   chan struct{}
+	refs int
+}
+
+// NewLocalLocker creates a new LocalLocker.
+func NewLocalLocker() *LocalLocker {
+	return &LocalLocker{
+		locks: map[string]*localLock{},
+	}
+}
+
+// Lock implements the Lock method of the Locker interface.
+func (l *LocalLocker) Lock(ctx context.Context, id uuid.UUID) error {
+	key := eh.NamespaceFromContext(ctx) + ":" + id.String()
+
+	l.locksMu.Lock()
+	lock, ok := l.locks[key]
+	if !ok {
+		lock = &localLock{ch: make(chan struct{}, 1)}
+		l.locks[key] = lock
+	}
+	lock.refs++
+	l.locksMu.Unlock()
+
+	select {
+	case lock.ch <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		l.locksMu.Lock()
+		l.release(key, lock)
+		l.locksMu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Unlock implements the Unlock method of the Locker interface.
+func (l *LocalLocker) Unlock(ctx context.Context, id uuid.UUID) error {
+	key := eh.NamespaceFromContext(ctx) + ":" + id.String()
+
+	l.locksMu.Lock()
+	defer l.locksMu.Unlock()
+
+	lock, ok := l.locks[key]
+	if !ok {
+		return ErrNotLocked
+	}
+	select {
+	case <-lock.ch:
+		l.release(key, lock)
+		return nil
+	default:
+		return ErrNotLocked
+	}
+}
+
+// release removes a reference to a lock, and the lock when it is unused. It
+// must be called with the locks mutex held.
+func (l *LocalLocker) release(key string, lock *localLock) {
+	lock.refs--
+	if lock.refs == 0 {
+		delete(l.locks, key)
+	}
+}
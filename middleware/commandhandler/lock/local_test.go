@@ -0,0 +1,50 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lock
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestLocalLocker(t *testing.T) {
+	locker := NewLocalLocker()
+	LockerAcceptanceTest(t, locker)
+
+	if len(locker.locks) != 0 {
+		t.Error("the locks should be removed:", locker.locks)
+	}
+
+	t.Log("lock different aggregates")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	ids := []uuid.UUID{uuid.New(), uuid.New()}
+	for _, id := range ids {
+		if err := locker.Lock(ctx, id); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	for _, id := range ids {
+		if err := locker.Unlock(ctx, id); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if len(locker.locks) != 0 {
+		t.Error("the locks should be removed:", locker.locks)
+	}
+}
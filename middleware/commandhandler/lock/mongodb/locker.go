@@ -0,0 +1,250 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/middleware/commandhandler/lock"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// DefaultLease is the default time that a lock is held before it expires, if it
+// is not renewed. Locks are renewed every third of the lease while held, so it
+// only expires when the process holding it stops or can not reach the DB.
+var DefaultLease = 30 * time.Second
+
+// DefaultPollInterval is the default interval for retrying a locked aggregate.
+var DefaultPollInterval = 50 * time.Millisecond
+
+// Locker implements a lock.Locker for MongoDB, which can be used by several
+// processes. The locks are lease documents in the "aggregate_locks" collection
+// in the DB with the DB prefix as name, which expire if they are not unlocked
+// within the lease. Held locks are renewed in the background until they are
+// unlocked, if a lock is lost anyway Unlock returns lock.ErrNotLocked, which
+// fails the command in the lock middleware. A lock is only unlocked by its
+// owner, as set with lock.NewContextWithOwner, or the locker itself for
+// contexts without one.
+type Locker struct {
+	session      *mgo.Session
+	dbName       string
+	lease        time.Duration
+	pollInterval time.Duration
+	owner        uuid.UUID
+
+	renewals   map[string]chan struct{}
+	renewalsMu sync.Mutex
+}
+
+var _ = lock.Locker(&Locker{})
+
+// NewLocker creates a new Locker.
+func NewLocker(url, dbPrefix string) (*Locker, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewLockerWithSession(session, dbPrefix)
+}
+
+// NewLockerWithSession creates a new Locker with a session.
+func NewLockerWithSession(session *mgo.Session, dbPrefix string) (*Locker, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	l := &Locker{
+		session:      session,
+		dbName:       dbPrefix,
+		lease:        DefaultLease,
+		pollInterval: DefaultPollInterval,
+		owner:        uuid.New(),
+		renewals:     map[string]chan struct{}{},
+	}
+
+	return l, nil
+}
+
+// Lock implements the Lock method of the lock.Locker interface.
+func (l *Locker) Lock(ctx context.Context, id uuid.UUID) error {
+	key := lockKey(ctx, id)
+	token := l.token(ctx)
+
+	for {
+		ok, err := l.acquire(key, token)
+		if err != nil {
+			return err
+		} else if ok {
+			l.startRenewal(key, token)
+			return nil
+		}
+
+		select {
+		case <-time.After(l.pollInterval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Unlock implements the Unlock method of the lock.Locker interface.
+func (l *Locker) Unlock(ctx context.Context, id uuid.UUID) error {
+	key := lockKey(ctx, id)
+	token := l.token(ctx)
+	l.stopRenewal(key, token)
+
+	sess := l.session.Copy()
+	defer sess.Close()
+
+	err := sess.DB(l.dbName).C("aggregate_locks").Remove(bson.M{
+		"_id":   key,
+		"owner": token,
+	})
+	if err == mgo.ErrNotFound {
+		// Not locked, or the lease has expired and the lock is taken by
+		// someone else.
+		return lock.ErrNotLocked
+	}
+	return err
+}
+
+// token is the owner of the locks taken with the context.
+func (l *Locker) token(ctx context.Context) string {
+	if owner, ok := lock.OwnerFromContext(ctx); ok {
+		return owner.String()
+	}
+	return l.owner.String()
+}
+
+// acquire acquires the lock if it is free or has expired.
+func (l *Locker) acquire(key, token string) (bool, error) {
+	sess := l.session.Copy()
+	defer sess.Close()
+
+	// The upsert fails with a duplicate key if the lock is held, as the query
+	// will not match the existing document.
+	now := time.Now()
+	change := mgo.Change{
+		Update: bson.M{"$set": bson.M{
+			"owner": token,
+			"until": now.Add(l.lease),
+		}},
+		Upsert: true,
+	}
+	_, err := sess.DB(l.dbName).C("aggregate_locks").Find(bson.M{
+		"_id":   key,
+		"until": bson.M{"$lte": now},
+	}).Apply(change, &bson.M{})
+	if mgo.IsDup(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// startRenewal renews a held lock every third of the lease, until it is
+// stopped or the lock is lost.
+func (l *Locker) startRenewal(key, token string) {
+	done := make(chan struct{})
+	l.renewalsMu.Lock()
+	l.renewals[key+"/"+token] = done
+	l.renewalsMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(l.lease / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				// Errors are retried on the next tick, as the lease may
+				// still be valid.
+				if err := l.renew(key, token); err == mgo.ErrNotFound {
+					return
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// stopRenewal stops renewing a lock.
+func (l *Locker) stopRenewal(key, token string) {
+	l.renewalsMu.Lock()
+	defer l.renewalsMu.Unlock()
+
+	if done, ok := l.renewals[key+"/"+token]; ok {
+		close(done)
+		delete(l.renewals, key+"/"+token)
+	}
+}
+
+// renew extends the lease of a held lock, or returns mgo.ErrNotFound if it has
+// been lost.
+func (l *Locker) renew(key, token string) error {
+	sess := l.session.Copy()
+	defer sess.Close()
+
+	now := time.Now()
+	return sess.DB(l.dbName).C("aggregate_locks").Update(bson.M{
+		"_id":   key,
+		"owner": token,
+		"until": bson.M{"$gt": now},
+	}, bson.M{"$set": bson.M{
+		"until": now.Add(l.lease),
+	}})
+}
+
+// Clear clears the lock storage.
+func (l *Locker) Clear(ctx context.Context) error {
+	return l.session.DB(l.dbName).C("aggregate_locks").DropCollection()
+}
+
+// Close stops renewing the held locks and closes the database session.
+func (l *Locker) Close() {
+	l.renewalsMu.Lock()
+	for key, done := range l.renewals {
+		close(done)
+		delete(l.renewals, key)
+	}
+	l.renewalsMu.Unlock()
+
+	l.session.Close()
+}
+
+// lockKey is the key of a lock, unique for the namespace and aggregate ID.
+func lockKey(ctx context.Context, id uuid.UUID) string {
+	return eh.NamespaceFromContext(ctx) + ":" + id.String()
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/looplab/eventhorizon/middleware/commandhandler/lock"
+)
+
+func TestLocker(t *testing.T) {
+	// Local Mongo testing with Docker
+	url := os.Getenv("MONGO_HOST")
+
+	if url == "" {
+		// Default to localhost
+		url = "localhost:27017"
+	}
+
+	locker, err := NewLocker(url, "test")
+	if err != nil {
+		t.Fatal("there should be no error:", err)
+	}
+	if locker == nil {
+		t.Fatal("there should be a locker")
+	}
+	defer locker.Close()
+
+	defer func() {
+		t.Log("clearing db")
+		if err = locker.Clear(context.Background()); err != nil {
+			t.Fatal("there should be no error:", err)
+		}
+	}()
+	lock.LockerAcceptanceTest(t, locker)
+
+	t.Log("renew held locks")
+	locker.lease = 30 * time.Millisecond
+	id := uuid.New()
+	ctx1 := lock.NewContextWithOwner(context.Background())
+	ctx2 := lock.NewContextWithOwner(context.Background())
+	if err := locker.Lock(ctx1, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	timeoutCtx, cancel := context.WithTimeout(ctx2, 50*time.Millisecond)
+	defer cancel()
+	if err := locker.Lock(timeoutCtx, id); err != context.DeadlineExceeded {
+		t.Error("there should be a deadline exceeded error:", err)
+	}
+
+	t.Log("only unlock locks of the same owner")
+	locker.stopRenewal(lockKey(ctx1, id), locker.token(ctx1))
+	time.Sleep(50 * time.Millisecond)
+	if err := locker.Lock(ctx2, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := locker.Unlock(ctx1, id); err != lock.ErrNotLocked {
+		t.Error("there should be a not locked error:", err)
+	}
+	if err := locker.Unlock(ctx2, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
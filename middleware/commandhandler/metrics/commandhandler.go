@@ -0,0 +1,161 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// DefaultBuckets are the upper bounds, in seconds, of the latency histogram
+// buckets used if none are set.
+var DefaultBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics records the number of handled commands, the number of errors and
+// the latency of handling per command type. The metrics are exposed in the
+// Prometheus text format by ServeHTTP.
+type Metrics struct {
+	buckets    []float64
+	commands   map[eh.CommandType]*commandMetrics
+	commandsMu sync.RWMutex
+	// now is used to measure latency, can be changed in tests.
+	now func() time.Time
+}
+
+// commandMetrics is the metrics for a single command type.
+type commandMetrics struct {
+	count   uint64
+	errors  uint64
+	sum     float64
+	buckets []uint64
+}
+
+// NewMetrics creates a Metrics with latency histogram buckets as upper bounds
+// in seconds, DefaultBuckets is used if the buckets are nil.
+func NewMetrics(buckets []float64) *Metrics {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	b := make([]float64, len(buckets))
+	copy(b, buckets)
+	sort.Float64s(b)
+
+	return &Metrics{
+		buckets:  b,
+		commands: make(map[eh.CommandType]*commandMetrics),
+		now:      time.Now,
+	}
+}
+
+// Middleware returns a command handler middleware that records the metrics
+// for all handled commands.
+func (m *Metrics) Middleware() eh.CommandHandlerMiddleware {
+	return eh.CommandHandlerMiddleware(func(h eh.CommandHandler) eh.CommandHandler {
+		return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+			start := m.now()
+			err := h.HandleCommand(ctx, cmd)
+			m.record(cmd.CommandType(), m.now().Sub(start), err)
+			return err
+		})
+	})
+}
+
+func (m *Metrics) record(t eh.CommandType, d time.Duration, err error) {
+	m.commandsMu.Lock()
+	defer m.commandsMu.Unlock()
+
+	c, ok := m.commands[t]
+	if !ok {
+		c = &commandMetrics{buckets: make([]uint64, len(m.buckets))}
+		m.commands[t] = c
+	}
+
+	c.count++
+	if err != nil {
+		c.errors++
+	}
+	s := d.Seconds()
+	c.sum += s
+	for i, b := range m.buckets {
+		if s <= b {
+			c.buckets[i]++
+		}
+	}
+}
+
+// ServeHTTP implements the ServeHTTP method of the http.Handler interface, it
+// writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.Write(m.text())
+}
+
+func (m *Metrics) text() []byte {
+	m.commandsMu.RLock()
+	defer m.commandsMu.RUnlock()
+
+	types := make([]string, 0, len(m.commands))
+	for t := range m.commands {
+		types = append(types, string(t))
+	}
+	sort.Strings(types)
+
+	var b bytes.Buffer
+	b.WriteString("# HELP eventhorizon_commands_total The number of handled commands.\n")
+	b.WriteString("# TYPE eventhorizon_commands_total counter\n")
+	for _, t := range types {
+		c := m.commands[eh.CommandType(t)]
+		fmt.Fprintf(&b, "eventhorizon_commands_total{command_type=\"%s\"} %d\n",
+			escape(t), c.count)
+	}
+
+	b.WriteString("# HELP eventhorizon_command_errors_total The number of commands that failed.\n")
+	b.WriteString("# TYPE eventhorizon_command_errors_total counter\n")
+	for _, t := range types {
+		c := m.commands[eh.CommandType(t)]
+		fmt.Fprintf(&b, "eventhorizon_command_errors_total{command_type=\"%s\"} %d\n",
+			escape(t), c.errors)
+	}
+
+	b.WriteString("# HELP eventhorizon_command_duration_seconds The latency of handling commands.\n")
+	b.WriteString("# TYPE eventhorizon_command_duration_seconds histogram\n")
+	for _, t := range types {
+		c := m.commands[eh.CommandType(t)]
+		for i, le := range m.buckets {
+			fmt.Fprintf(&b, "eventhorizon_command_duration_seconds_bucket{command_type=\"%s\",le=\"%s\"} %d\n",
+				escape(t), strconv.FormatFloat(le, 'g', -1, 64), c.buckets[i])
+		}
+		fmt.Fprintf(&b, "eventhorizon_command_duration_seconds_bucket{command_type=\"%s\",le=\"+Inf\"} %d\n",
+			escape(t), c.count)
+		fmt.Fprintf(&b, "eventhorizon_command_duration_seconds_sum{command_type=\"%s\"} %s\n",
+			escape(t), strconv.FormatFloat(c.sum, 'g', -1, 64))
+		fmt.Fprintf(&b, "eventhorizon_command_duration_seconds_count{command_type=\"%s\"} %d\n",
+			escape(t), c.count)
+	}
+
+	return b.Bytes()
+}
+
+// escape escapes a label value in the Prometheus text format.
+var escape = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace
@@ -0,0 +1,95 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestMetrics(t *testing.T) {
+	m := NewMetrics([]float64{0.1, 1})
+
+	// Let each command take the next latency.
+	latencies := []time.Duration{50 * time.Millisecond, 500 * time.Millisecond, 2 * time.Second}
+	now := time.Now()
+	calls := 0
+	m.now = func() time.Time {
+		if calls%2 == 1 {
+			now = now.Add(latencies[calls/2])
+		}
+		calls++
+		return now
+	}
+
+	inner := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(inner, m.Middleware())
+	cmd := mocks.Command{ID: uuid.New(), Content: "content"}
+	if err := h.HandleCommand(context.Background(), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := h.HandleCommand(context.Background(), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	inner.Err = errors.New("error")
+	other := mocks.CommandOther{ID: uuid.New(), Content: "content"}
+	if err := h.HandleCommand(context.Background(), other); err != inner.Err {
+		t.Error("there should be an error:", err)
+	}
+
+	r := httptest.NewRequest("GET", "/metrics", nil)
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, r)
+	if w.Header().Get("Content-Type") != "text/plain; version=0.0.4" {
+		t.Error("the content type should be correct:", w.Header().Get("Content-Type"))
+	}
+	expected := `# HELP eventhorizon_commands_total The number of handled commands.
+# TYPE eventhorizon_commands_total counter
+eventhorizon_commands_total{command_type="Command"} 2
+eventhorizon_commands_total{command_type="CommandOther"} 1
+# HELP eventhorizon_command_errors_total The number of commands that failed.
+# TYPE eventhorizon_command_errors_total counter
+eventhorizon_command_errors_total{command_type="Command"} 0
+eventhorizon_command_errors_total{command_type="CommandOther"} 1
+# HELP eventhorizon_command_duration_seconds The latency of handling commands.
+# TYPE eventhorizon_command_duration_seconds histogram
+eventhorizon_command_duration_seconds_bucket{command_type="Command",le="0.1"} 1
+eventhorizon_command_duration_seconds_bucket{command_type="Command",le="1"} 2
+eventhorizon_command_duration_seconds_bucket{command_type="Command",le="+Inf"} 2
+eventhorizon_command_duration_seconds_sum{command_type="Command"} 0.55
+eventhorizon_command_duration_seconds_count{command_type="Command"} 2
+eventhorizon_command_duration_seconds_bucket{command_type="CommandOther",le="0.1"} 0
+eventhorizon_command_duration_seconds_bucket{command_type="CommandOther",le="1"} 0
+eventhorizon_command_duration_seconds_bucket{command_type="CommandOther",le="+Inf"} 1
+eventhorizon_command_duration_seconds_sum{command_type="CommandOther"} 2
+eventhorizon_command_duration_seconds_count{command_type="CommandOther"} 1
+`
+	if w.Body.String() != expected {
+		t.Error("the metrics should be correct:", w.Body.String())
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if s := escape("a\"b\\c\nd"); s != `a\"b\\c\nd` {
+		t.Error("the label should be escaped:", s)
+	}
+}
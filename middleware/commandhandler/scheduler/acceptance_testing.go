@@ -0,0 +1,210 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+// StoreAcceptanceTest is the acceptance test that all implementations of
+// Store should pass. It should manually be called from a test case in each
+// implementation:
+//
+//   func TestStore(t *testing.T) {
+//       store := NewStore()
+//       scheduler.StoreAcceptanceTest(t, store)
+//   }
+//
+func StoreAcceptanceTest(t *testing.T, store Store) {
+	ctx := context.Background()
+	otherCtx := eh.NewContextWithNamespace(ctx, "other")
+	now := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+
+	t.Log("list and claim with no commands")
+	cmds, err := store.Commands(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(cmds) != 0 {
+		t.Error("there should be no commands:", cmds)
+	}
+	cmds, err = store.ClaimDueCommands(ctx, now, time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(cmds) != 0 {
+		t.Error("there should be no commands:", cmds)
+	}
+
+	t.Log("save commands")
+	cmd1 := ScheduledCommand{
+		ID:          uuid.New(),
+		Namespace:   eh.NamespaceFromContext(ctx),
+		CommandType: mocks.CommandType,
+		RawCommand:  []byte(`{"Content":"cmd1"}`),
+		ExecuteAt:   now.Add(-time.Second),
+		Context:     map[string]interface{}{"key": "value"},
+	}
+	cmd2 := ScheduledCommand{
+		ID:          uuid.New(),
+		Namespace:   eh.NamespaceFromContext(ctx),
+		CommandType: mocks.CommandType,
+		RawCommand:  []byte(`{"Content":"cmd2"}`),
+		ExecuteAt:   now.Add(time.Hour),
+		Context:     map[string]interface{}{},
+	}
+	cmd3 := ScheduledCommand{
+		ID:          uuid.New(),
+		Namespace:   eh.NamespaceFromContext(otherCtx),
+		CommandType: mocks.CommandType,
+		RawCommand:  []byte(`{"Content":"cmd3"}`),
+		ExecuteAt:   now.Add(-time.Minute),
+		Context:     map[string]interface{}{},
+	}
+	for _, cmd := range []ScheduledCommand{cmd2, cmd1, cmd3} {
+		if err := store.SaveCommand(ctx, cmd); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	t.Log("list commands per namespace")
+	cmds, err = store.Commands(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmds, []ScheduledCommand{cmd1, cmd2}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+	cmds, err = store.Commands(otherCtx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmds, []ScheduledCommand{cmd3}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+
+	t.Log("claim due commands in all namespaces, up to the max")
+	cmds, err = store.ClaimDueCommands(ctx, now, time.Minute, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmds, []ScheduledCommand{cmd3}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+	cmds, err = store.ClaimDueCommands(ctx, now, time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmds, []ScheduledCommand{cmd1}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+
+	t.Log("claimed commands should be skipped")
+	cmds, err = store.ClaimDueCommands(ctx, now.Add(30*time.Second), time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(cmds) != 0 {
+		t.Error("there should be no commands:", cmds)
+	}
+
+	t.Log("commands should be claimed again after the lease")
+	cmds, err = store.ClaimDueCommands(ctx, now.Add(2*time.Minute), time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmds, []ScheduledCommand{cmd3, cmd1}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+
+	t.Log("update commands")
+	cmd1.Attempts = 1
+	cmd1.Err = "error"
+	if err := store.UpdateCommand(ctx, cmd1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	cmd3.Attempts = 3
+	cmd3.Err = "error"
+	cmd3.Failed = true
+	if err := store.UpdateCommand(ctx, cmd3); err != ErrCommandNotFound {
+		t.Error("there should be a command not found error:", err)
+	}
+	if err := store.UpdateCommand(otherCtx, cmd3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	cmds, err = store.Commands(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmds, []ScheduledCommand{cmd1, cmd2}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+	cmds, err = store.Commands(otherCtx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmds, []ScheduledCommand{cmd3}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+
+	t.Log("updated commands should keep the claim")
+	cmds, err = store.ClaimDueCommands(ctx, now.Add(2*time.Minute), time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(cmds) != 0 {
+		t.Error("there should be no commands:", cmds)
+	}
+
+	t.Log("failed commands should be skipped")
+	cmds, err = store.ClaimDueCommands(ctx, now.Add(4*time.Minute), time.Minute, 10)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(cmds, []ScheduledCommand{cmd1}) {
+		t.Error("the commands should be correct:", cmds)
+	}
+
+	t.Log("remove commands per namespace")
+	if err := store.RemoveCommand(ctx, cmd3.ID); err != ErrCommandNotFound {
+		t.Error("there should be a command not found error:", err)
+	}
+	for _, cmd := range []ScheduledCommand{cmd1, cmd2} {
+		if err := store.RemoveCommand(ctx, cmd.ID); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if err := store.RemoveCommand(otherCtx, cmd3.ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := store.RemoveCommand(ctx, cmd1.ID); err != ErrCommandNotFound {
+		t.Error("there should be a command not found error:", err)
+	}
+	cmds, err = store.Commands(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(cmds) != 0 {
+		t.Error("there should be no commands:", cmds)
+	}
+}
@@ -23,7 +23,8 @@ import (
 )
 
 // NewMiddleware returns a new async handling middleware that returns any errors
-// on a error channel.
+// on a error channel. The scheduled commands are kept in memory and are lost on
+// restart, use a Scheduler to schedule commands durably.
 func NewMiddleware() (eh.CommandHandlerMiddleware, chan Error) {
 	errCh := make(chan Error, 20)
 	return eh.CommandHandlerMiddleware(func(h eh.CommandHandler) eh.CommandHandler {
@@ -39,7 +40,7 @@ func NewMiddleware() (eh.CommandHandlerMiddleware, chan Error) {
 					case <-ctx.Done():
 						err = ctx.Err()
 					case <-t.C:
-						err = h.HandleCommand(ctx, cmd)
+						err = h.HandleCommand(eh.NewContextWithoutCommandResult(ctx), cmd)
 					}
 
 					if err != nil {
@@ -89,5 +90,8 @@ type Error struct {
 
 // Error implements the Error method of the error interface.
 func (e Error) Error() string {
+	if e.Command == nil {
+		return e.Err.Error()
+	}
 	return fmt.Sprintf("%s (%s): %s", e.Command.CommandType(), e.Command.AggregateID(), e.Err.Error())
 }
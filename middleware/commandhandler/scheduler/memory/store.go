@@ -0,0 +1,134 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/middleware/commandhandler/scheduler"
+)
+
+// Store implements scheduler.Store as an in memory structure.
+type Store struct {
+	cmds   map[uuid.UUID]*entry
+	cmdsMu sync.Mutex
+}
+
+var _ = scheduler.Store(&Store{})
+
+type entry struct {
+	scheduler.ScheduledCommand
+	claimedUntil time.Time
+}
+
+// NewStore creates a new Store using memory as storage.
+func NewStore() *Store {
+	return &Store{
+		cmds: map[uuid.UUID]*entry{},
+	}
+}
+
+// SaveCommand implements the SaveCommand method of the scheduler.Store interface.
+func (s *Store) SaveCommand(ctx context.Context, c scheduler.ScheduledCommand) error {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	s.cmds[c.ID] = &entry{ScheduledCommand: c}
+	return nil
+}
+
+// RemoveCommand implements the RemoveCommand method of the scheduler.Store interface.
+func (s *Store) RemoveCommand(ctx context.Context, id uuid.UUID) error {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	if c, ok := s.cmds[id]; !ok || c.Namespace != eh.NamespaceFromContext(ctx) {
+		return scheduler.ErrCommandNotFound
+	}
+	delete(s.cmds, id)
+	return nil
+}
+
+// UpdateCommand implements the UpdateCommand method of the scheduler.Store interface.
+func (s *Store) UpdateCommand(ctx context.Context, c scheduler.ScheduledCommand) error {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	e, ok := s.cmds[c.ID]
+	if !ok || e.Namespace != eh.NamespaceFromContext(ctx) {
+		return scheduler.ErrCommandNotFound
+	}
+	e.Attempts = c.Attempts
+	e.Err = c.Err
+	e.Failed = c.Failed
+	return nil
+}
+
+// Commands implements the Commands method of the scheduler.Store interface.
+func (s *Store) Commands(ctx context.Context) ([]scheduler.ScheduledCommand, error) {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	ns := eh.NamespaceFromContext(ctx)
+	cmds := []scheduler.ScheduledCommand{}
+	for _, c := range s.cmds {
+		if c.Namespace == ns {
+			cmds = append(cmds, c.ScheduledCommand)
+		}
+	}
+	sortCommands(cmds)
+
+	return cmds, nil
+}
+
+// ClaimDueCommands implements the ClaimDueCommands method of the scheduler.Store interface.
+func (s *Store) ClaimDueCommands(ctx context.Context, now time.Time, lease time.Duration, max int) ([]scheduler.ScheduledCommand, error) {
+	s.cmdsMu.Lock()
+	defer s.cmdsMu.Unlock()
+
+	due := []*entry{}
+	for _, c := range s.cmds {
+		if c.Failed || c.ExecuteAt.After(now) || c.claimedUntil.After(now) {
+			continue
+		}
+		due = append(due, c)
+	}
+	sort.Slice(due, func(i, j int) bool {
+		return due[i].ExecuteAt.Before(due[j].ExecuteAt)
+	})
+	if len(due) > max {
+		due = due[:max]
+	}
+
+	cmds := []scheduler.ScheduledCommand{}
+	for _, c := range due {
+		c.claimedUntil = now.Add(lease)
+		cmds = append(cmds, c.ScheduledCommand)
+	}
+
+	return cmds, nil
+}
+
+func sortCommands(cmds []scheduler.ScheduledCommand) {
+	sort.Slice(cmds, func(i, j int) bool {
+		return cmds[i].ExecuteAt.Before(cmds[j].ExecuteAt)
+	})
+}
@@ -0,0 +1,229 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/middleware/commandhandler/scheduler"
+)
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// Store implements a scheduler.Store for MongoDB. The commands of all
+// namespaces are stored in the "scheduled_commands" collection in the DB with
+// the DB prefix as name. Commands are claimed atomically, so several
+// schedulers can share the store.
+type Store struct {
+	session *mgo.Session
+	dbName  string
+}
+
+var _ = scheduler.Store(&Store{})
+
+// NewStore creates a new Store.
+func NewStore(url, dbPrefix string) (*Store, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewStoreWithSession(session, dbPrefix)
+}
+
+// NewStoreWithSession creates a new Store with a session.
+func NewStoreWithSession(session *mgo.Session, dbPrefix string) (*Store, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &Store{
+		session: session,
+		dbName:  dbPrefix,
+	}
+
+	return s, nil
+}
+
+// SaveCommand implements the SaveCommand method of the scheduler.Store interface.
+func (s *Store) SaveCommand(ctx context.Context, c scheduler.ScheduledCommand) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	if _, err := sess.DB(s.dbName).C("scheduled_commands").UpsertId(c.ID.String(), dbCommand{
+		ID:          c.ID.String(),
+		Namespace:   c.Namespace,
+		CommandType: c.CommandType,
+		RawCommand:  c.RawCommand,
+		ExecuteAt:   c.ExecuteAt,
+		Context:     c.Context,
+		Attempts:    c.Attempts,
+		Err:         c.Err,
+		Failed:      c.Failed,
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// RemoveCommand implements the RemoveCommand method of the scheduler.Store interface.
+func (s *Store) RemoveCommand(ctx context.Context, id uuid.UUID) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.dbName).C("scheduled_commands").Remove(bson.M{
+		"_id":       id.String(),
+		"namespace": eh.NamespaceFromContext(ctx),
+	})
+	if err == mgo.ErrNotFound {
+		return scheduler.ErrCommandNotFound
+	}
+	return err
+}
+
+// UpdateCommand implements the UpdateCommand method of the scheduler.Store interface.
+func (s *Store) UpdateCommand(ctx context.Context, c scheduler.ScheduledCommand) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	err := sess.DB(s.dbName).C("scheduled_commands").Update(bson.M{
+		"_id":       c.ID.String(),
+		"namespace": eh.NamespaceFromContext(ctx),
+	}, bson.M{"$set": bson.M{
+		"attempts": c.Attempts,
+		"err":      c.Err,
+		"failed":   c.Failed,
+	}})
+	if err == mgo.ErrNotFound {
+		return scheduler.ErrCommandNotFound
+	}
+	return err
+}
+
+// Commands implements the Commands method of the scheduler.Store interface.
+func (s *Store) Commands(ctx context.Context) ([]scheduler.ScheduledCommand, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	var dbCmds []dbCommand
+	if err := sess.DB(s.dbName).C("scheduled_commands").Find(bson.M{
+		"namespace": eh.NamespaceFromContext(ctx),
+	}).Sort("execute_at").All(&dbCmds); err != nil {
+		return nil, err
+	}
+
+	cmds := make([]scheduler.ScheduledCommand, 0, len(dbCmds))
+	for _, c := range dbCmds {
+		cmd, err := c.command()
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds, nil
+}
+
+// ClaimDueCommands implements the ClaimDueCommands method of the scheduler.Store interface.
+func (s *Store) ClaimDueCommands(ctx context.Context, now time.Time, lease time.Duration, max int) ([]scheduler.ScheduledCommand, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	query := bson.M{
+		"execute_at":    bson.M{"$lte": now},
+		"claimed_until": bson.M{"$lte": now},
+		"failed":        bson.M{"$ne": true},
+	}
+	change := mgo.Change{
+		Update:    bson.M{"$set": bson.M{"claimed_until": now.Add(lease)}},
+		ReturnNew: true,
+	}
+
+	cmds := []scheduler.ScheduledCommand{}
+	for len(cmds) < max {
+		var c dbCommand
+		_, err := sess.DB(s.dbName).C("scheduled_commands").Find(query).Sort("execute_at").Apply(change, &c)
+		if err == mgo.ErrNotFound {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		cmd, err := c.command()
+		if err != nil {
+			return nil, err
+		}
+		cmds = append(cmds, cmd)
+	}
+
+	return cmds, nil
+}
+
+// Clear clears the command storage.
+func (s *Store) Clear(ctx context.Context) error {
+	return s.session.DB(s.dbName).C("scheduled_commands").DropCollection()
+}
+
+// Close closes the database session.
+func (s *Store) Close() {
+	s.session.Close()
+}
+
+// dbCommand is the DB representation of a scheduled command.
+type dbCommand struct {
+	ID           string                 `bson:"_id"`
+	Namespace    string                 `bson:"namespace"`
+	CommandType  eh.CommandType         `bson:"command_type"`
+	RawCommand   []byte                 `bson:"command"`
+	ExecuteAt    time.Time              `bson:"execute_at"`
+	Context      map[string]interface{} `bson:"context"`
+	ClaimedUntil time.Time              `bson:"claimed_until"`
+	Attempts     int                    `bson:"attempts"`
+	Err          string                 `bson:"err"`
+	Failed       bool                   `bson:"failed"`
+}
+
+func (c dbCommand) command() (scheduler.ScheduledCommand, error) {
+	id, err := uuid.Parse(c.ID)
+	if err != nil {
+		return scheduler.ScheduledCommand{}, err
+	}
+	return scheduler.ScheduledCommand{
+		ID:          id,
+		Namespace:   c.Namespace,
+		CommandType: c.CommandType,
+		RawCommand:  c.RawCommand,
+		ExecuteAt:   c.ExecuteAt.UTC(),
+		Context:     c.Context,
+		Attempts:    c.Attempts,
+		Err:         c.Err,
+		Failed:      c.Failed,
+	}, nil
+}
@@ -0,0 +1,314 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ScheduledCommand is a command that is stored by a Scheduler, to be executed
+// at a later time.
+type ScheduledCommand struct {
+	ID          uuid.UUID
+	Namespace   string
+	CommandType eh.CommandType
+	// RawCommand is the command serialized as JSON, it is created again with
+	// eh.CreateCommand when executed.
+	RawCommand []byte
+	ExecuteAt  time.Time
+	// Context is the marshaled context that the command was scheduled with.
+	Context map[string]interface{}
+	// Attempts is the number of times the command has failed.
+	Attempts int
+	// Err is the error of the last failed attempt.
+	Err string
+	// Failed is set when the command has failed all attempts, or could not be
+	// created. Failed commands are kept in the store but not executed again.
+	Failed bool
+}
+
+// Command returns the deserialized command.
+func (c ScheduledCommand) Command() (eh.Command, error) {
+	cmd, err := eh.CreateCommand(c.CommandType)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(c.RawCommand, cmd); err != nil {
+		return nil, err
+	}
+	return cmd, nil
+}
+
+// Store is a durable store of scheduled commands. The commands of all
+// namespaces are stored together.
+type Store interface {
+	// SaveCommand saves a scheduled command.
+	SaveCommand(ctx context.Context, c ScheduledCommand) error
+
+	// UpdateCommand saves the attempts, error and failed state of a scheduled
+	// command in the namespace of the context, without changing its claim, or
+	// returns ErrCommandNotFound.
+	UpdateCommand(ctx context.Context, c ScheduledCommand) error
+
+	// RemoveCommand removes a scheduled command in the namespace of the
+	// context, or returns ErrCommandNotFound.
+	RemoveCommand(ctx context.Context, id uuid.UUID) error
+
+	// Commands returns the scheduled commands in the namespace of the
+	// context, ordered by execution time.
+	Commands(ctx context.Context) ([]ScheduledCommand, error)
+
+	// ClaimDueCommands returns up to max commands with an execution time
+	// before now that are not claimed or failed, ordered by execution time, and
+	// claims them until now plus the lease, so that other schedulers skip them.
+	// Claimed commands that are not removed before the lease ends are returned
+	// again.
+	ClaimDueCommands(ctx context.Context, now time.Time, lease time.Duration, max int) ([]ScheduledCommand, error)
+}
+
+// ErrCommandNotFound is when a scheduled command could not be found.
+var ErrCommandNotFound = errors.New("scheduled command not found")
+
+// ErrHandlerNotSet is when a scheduler is used before its middleware.
+var ErrHandlerNotSet = errors.New("handler not set")
+
+// DefaultPollInterval is the default interval that the Scheduler polls the
+// store with.
+var DefaultPollInterval = time.Second
+
+// DefaultLease is the default time that due commands are claimed by a
+// Scheduler, before they can be executed again by any scheduler.
+var DefaultLease = time.Minute
+
+// DefaultMaxAttempts is the default number of times a failing command is
+// executed before it is marked as failed.
+var DefaultMaxAttempts = 3
+
+// DefaultMaxClaimed is the default max number of due commands that are claimed
+// at once by a Scheduler. It should be low enough for the commands to be
+// executed within the lease.
+var DefaultMaxClaimed = 10
+
+// Scheduler is a durable alternative to the middleware from NewMiddleware.
+// Commands that have an execution time are serialized and saved in a store,
+// and executed by a poller when they are due. The commands must be registered
+// with eh.RegisterCommand and be JSON serializable. Commands are executed at
+// least once, they are removed from the store after being handled without
+// error and are otherwise retried after the lease, up to DefaultMaxAttempts
+// times before they are marked as failed. Several schedulers can share a
+// store, if the store supports claiming commands across instances.
+type Scheduler struct {
+	store     Store
+	handler   eh.CommandHandler
+	handlerMu sync.RWMutex
+
+	pollInterval time.Duration
+	lease        time.Duration
+	maxAttempts  int
+	maxClaimed   int
+
+	errCh  chan Error
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewScheduler creates a new Scheduler. Use Middleware as a command handler
+// middleware and call Start to start executing due commands.
+func NewScheduler(store Store) *Scheduler {
+	return &Scheduler{
+		store:        store,
+		pollInterval: DefaultPollInterval,
+		lease:        DefaultLease,
+		maxAttempts:  DefaultMaxAttempts,
+		maxClaimed:   DefaultMaxClaimed,
+		errCh:        make(chan Error, 100),
+	}
+}
+
+// SetMaxAttempts sets the max number of times a failing command is executed
+// before it is marked as failed.
+func (s *Scheduler) SetMaxAttempts(maxAttempts int) {
+	s.maxAttempts = maxAttempts
+}
+
+// Middleware is a command handler middleware that schedules commands with an
+// execution time, the handler is used to execute the commands when they are
+// due. Other commands are handled immediately.
+func (s *Scheduler) Middleware(h eh.CommandHandler) eh.CommandHandler {
+	s.handlerMu.Lock()
+	s.handler = h
+	s.handlerMu.Unlock()
+
+	return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		if c, ok := cmd.(Command); ok && !c.ExecuteAt().IsZero() {
+			_, err := s.ScheduleCommand(ctx, cmd, c.ExecuteAt())
+			return err
+		}
+
+		return h.HandleCommand(ctx, cmd)
+	})
+}
+
+// ScheduleCommand schedules a command to be executed at a time, and returns
+// the ID of the scheduled command.
+func (s *Scheduler) ScheduleCommand(ctx context.Context, cmd eh.Command, t time.Time) (uuid.UUID, error) {
+	// Store the command without the wrapper from CommandWithExecuteTime.
+	if c, ok := cmd.(*command); ok {
+		cmd = c.Command
+	}
+
+	if err := eh.CheckCommand(cmd); err != nil {
+		return uuid.Nil, err
+	}
+	if _, err := eh.CreateCommand(cmd.CommandType()); err != nil {
+		return uuid.Nil, err
+	}
+	raw, err := json.Marshal(cmd)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	c := ScheduledCommand{
+		ID:          uuid.New(),
+		Namespace:   eh.NamespaceFromContext(ctx),
+		CommandType: cmd.CommandType(),
+		RawCommand:  raw,
+		ExecuteAt:   t,
+		Context:     eh.MarshalContext(ctx),
+	}
+	if err := s.store.SaveCommand(ctx, c); err != nil {
+		return uuid.Nil, err
+	}
+
+	return c.ID, nil
+}
+
+// Commands returns the scheduled commands in the namespace of the context,
+// including failed commands.
+func (s *Scheduler) Commands(ctx context.Context) ([]ScheduledCommand, error) {
+	return s.store.Commands(ctx)
+}
+
+// CancelCommand cancels a scheduled command in the namespace of the context,
+// it can also be used to remove failed commands.
+func (s *Scheduler) CancelCommand(ctx context.Context, id uuid.UUID) error {
+	return s.store.RemoveCommand(ctx, id)
+}
+
+// Start starts executing due commands in the background.
+func (s *Scheduler) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+
+	go func() {
+		defer close(s.done)
+
+		ticker := time.NewTicker(s.pollInterval)
+		defer ticker.Stop()
+		for {
+			if err := s.Poll(ctx); err != nil {
+				s.error(Error{Err: err, Ctx: ctx})
+			}
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Close stops executing commands.
+func (s *Scheduler) Close() {
+	if s.cancel == nil {
+		return
+	}
+	s.cancel()
+	<-s.done
+}
+
+// Errors returns the error channel, with errors from executing commands.
+func (s *Scheduler) Errors() <-chan Error {
+	return s.errCh
+}
+
+// Poll claims and executes due commands once, up to DefaultMaxClaimed. It is
+// used by Start, and can also be used to poll manually. Claimed commands that
+// are not executed before the lease ends are left to be claimed again.
+func (s *Scheduler) Poll(ctx context.Context) error {
+	s.handlerMu.RLock()
+	h := s.handler
+	s.handlerMu.RUnlock()
+	if h == nil {
+		return ErrHandlerNotSet
+	}
+
+	now := time.Now()
+	cmds, err := s.store.ClaimDueCommands(ctx, now, s.lease, s.maxClaimed)
+	if err != nil {
+		return err
+	}
+
+	for _, c := range cmds {
+		if time.Since(now) >= s.lease {
+			break
+		}
+		s.execute(h, c)
+	}
+
+	return nil
+}
+
+// execute executes a claimed command, and removes it or records the failure.
+func (s *Scheduler) execute(h eh.CommandHandler, c ScheduledCommand) {
+	ctx := eh.NewContextWithNamespace(eh.UnmarshalContext(c.Context), c.Namespace)
+	cmd, err := c.Command()
+	if err != nil {
+		// Commands that can not be created will never succeed.
+		c.Failed = true
+	} else if err = h.HandleCommand(ctx, cmd); err == nil {
+		if err := s.store.RemoveCommand(ctx, c.ID); err != nil && err != ErrCommandNotFound {
+			s.error(Error{Err: err, Ctx: ctx, Command: cmd})
+		}
+		return
+	}
+	s.error(Error{Err: err, Ctx: ctx, Command: cmd})
+
+	c.Attempts++
+	c.Err = err.Error()
+	if c.Attempts >= s.maxAttempts {
+		c.Failed = true
+	}
+	if err := s.store.UpdateCommand(ctx, c); err != nil && err != ErrCommandNotFound {
+		s.error(Error{Err: err, Ctx: ctx, Command: cmd})
+	}
+}
+
+func (s *Scheduler) error(err Error) {
+	select {
+	case s.errCh <- err:
+	default:
+	}
+}
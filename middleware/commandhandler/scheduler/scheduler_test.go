@@ -0,0 +1,307 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestScheduler(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	store := &testStore{}
+	s := NewScheduler(store)
+	if err := s.Poll(context.Background()); err != ErrHandlerNotSet {
+		t.Error("there should be a handler not set error:", err)
+	}
+
+	inner := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(inner, s.Middleware)
+
+	// Immediate commands.
+	ctx := eh.NewContextWithNamespace(context.Background(), "ns")
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	if err := h.HandleCommand(ctx, cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(inner.Commands, []eh.Command{cmd}) {
+		t.Error("the command should have been handled:", inner.Commands)
+	}
+
+	// Scheduled commands.
+	inner.Commands = nil
+	executeAt := time.Now().Add(-time.Second)
+	if err := h.HandleCommand(ctx, CommandWithExecuteTime(cmd, executeAt)); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(inner.Commands) != 0 {
+		t.Error("the command should not have been handled yet:", inner.Commands)
+	}
+	cmds, err := s.Commands(ctx)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(cmds) != 1 || cmds[0].CommandType != mocks.CommandType ||
+		!cmds[0].ExecuteAt.Equal(executeAt) || cmds[0].Namespace != "ns" {
+		t.Error("the scheduled commands should be correct:", cmds)
+	}
+
+	// The commands should be executed by another scheduler, after a restart.
+	s = NewScheduler(store)
+	h = eh.UseCommandHandlerMiddleware(inner, s.Middleware)
+	if err := s.Poll(context.Background()); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(inner.Commands, []eh.Command{cmd}) {
+		t.Error("the command should have been handled:", inner.Commands)
+	}
+	if ns := eh.NamespaceFromContext(inner.Context); ns != "ns" {
+		t.Error("the namespace should be correct:", ns)
+	}
+	if cmds, _ := s.Commands(ctx); len(cmds) != 0 {
+		t.Error("the command should be removed:", cmds)
+	}
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	s := NewScheduler(&testStore{})
+	inner := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(inner, s.Middleware)
+
+	ctx := context.Background()
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	id, err := s.ScheduleCommand(ctx, cmd, time.Now().Add(-time.Second))
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	otherCtx := eh.NewContextWithNamespace(ctx, "other")
+	if err := s.CancelCommand(otherCtx, id); err != ErrCommandNotFound {
+		t.Error("there should be a command not found error:", err)
+	}
+	if err := s.CancelCommand(ctx, id); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := s.CancelCommand(ctx, id); err != ErrCommandNotFound {
+		t.Error("there should be a command not found error:", err)
+	}
+	if err := s.Poll(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(inner.Commands) != 0 {
+		t.Error("the command should not have been handled:", inner.Commands)
+	}
+
+	// Commands that are not registered can not be scheduled.
+	other := &mocks.CommandOther{ID: uuid.New(), Content: "content"}
+	err = h.HandleCommand(ctx, CommandWithExecuteTime(other, time.Now()))
+	if err != eh.ErrCommandNotRegistered {
+		t.Error("there should be a command not registered error:", err)
+	}
+}
+
+func TestScheduler_Errors(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	store := &testStore{}
+	s := NewScheduler(store)
+	handlerErr := errors.New("handler error")
+	inner := &mocks.CommandHandler{Err: handlerErr}
+	h := eh.UseCommandHandlerMiddleware(inner, s.Middleware)
+
+	ctx := context.Background()
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	if err := h.HandleCommand(ctx, CommandWithExecuteTime(cmd, time.Now())); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if err := s.Poll(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	select {
+	case err := <-s.Errors():
+		if err.Err != handlerErr || !reflect.DeepEqual(err.Command, cmd) {
+			t.Error("the error should be correct:", err)
+		}
+	default:
+		t.Error("there should be an error")
+	}
+
+	// The command should be kept to be retried.
+	cmds, _ := s.Commands(ctx)
+	if len(cmds) != 1 || cmds[0].Attempts != 1 ||
+		cmds[0].Err != handlerErr.Error() || cmds[0].Failed {
+		t.Error("the command should be kept:", cmds)
+	}
+
+	// The command should be marked as failed after the max attempts.
+	for i := 0; i < 2; i++ {
+		if err := s.Poll(ctx); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		<-s.Errors()
+	}
+	cmds, _ = s.Commands(ctx)
+	if len(cmds) != 1 || cmds[0].Attempts != 3 || !cmds[0].Failed {
+		t.Error("the command should be failed:", cmds)
+	}
+	inner.Commands = nil
+	if err := s.Poll(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(inner.Commands) != 0 {
+		t.Error("the failed command should not be handled:", inner.Commands)
+	}
+	if err := s.CancelCommand(ctx, cmds[0].ID); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// Commands that can not be created should fail at once.
+	if err := h.HandleCommand(ctx, CommandWithExecuteTime(cmd, time.Now())); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	eh.UnregisterCommand(mocks.CommandType)
+	if err := s.Poll(ctx); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	select {
+	case err := <-s.Errors():
+		if err.Err != eh.ErrCommandNotRegistered {
+			t.Error("the error should be correct:", err)
+		}
+	default:
+		t.Error("there should be an error")
+	}
+	cmds, _ = s.Commands(ctx)
+	if len(cmds) != 1 || cmds[0].Attempts != 1 || !cmds[0].Failed {
+		t.Error("the command should be failed:", cmds)
+	}
+
+	// Store errors.
+	store.err = errors.New("store error")
+	if _, err := s.ScheduleCommand(ctx, cmd, time.Now()); err != store.err {
+		t.Error("there should be a store error:", err)
+	}
+	if err := s.Poll(ctx); err != store.err {
+		t.Error("there should be a store error:", err)
+	}
+}
+
+func TestScheduler_Start(t *testing.T) {
+	eh.RegisterCommand(func() eh.Command { return &mocks.Command{} })
+	defer eh.UnregisterCommand(mocks.CommandType)
+
+	cmdCh := make(chan eh.Command, 1)
+	inner := eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+		cmdCh <- cmd
+		return nil
+	})
+	s := NewScheduler(&testStore{})
+	s.pollInterval = 10 * time.Millisecond
+	h := eh.UseCommandHandlerMiddleware(inner, s.Middleware)
+	s.Start()
+	defer s.Close()
+
+	cmd := &mocks.Command{ID: uuid.New(), Content: "content"}
+	c := CommandWithExecuteTime(cmd, time.Now().Add(20*time.Millisecond))
+	if err := h.HandleCommand(context.Background(), c); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	select {
+	case handled := <-cmdCh:
+		if !reflect.DeepEqual(handled, cmd) {
+			t.Error("the command should be correct:", handled)
+		}
+	case <-time.After(time.Second):
+		t.Error("the command should be handled")
+	}
+}
+
+// testStore is a minimal store, the real ones can not be used here as they
+// import this package.
+type testStore struct {
+	cmds []ScheduledCommand
+	err  error
+	mu   sync.Mutex
+}
+
+func (s *testStore) SaveCommand(ctx context.Context, c ScheduledCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.cmds = append(s.cmds, c)
+	return nil
+}
+
+func (s *testStore) UpdateCommand(ctx context.Context, c ScheduledCommand) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.cmds {
+		if s.cmds[i].ID == c.ID && s.cmds[i].Namespace == eh.NamespaceFromContext(ctx) {
+			s.cmds[i] = c
+			return nil
+		}
+	}
+	return ErrCommandNotFound
+}
+
+func (s *testStore) RemoveCommand(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, c := range s.cmds {
+		if c.ID == id && c.Namespace == eh.NamespaceFromContext(ctx) {
+			s.cmds = append(s.cmds[:i], s.cmds[i+1:]...)
+			return nil
+		}
+	}
+	return ErrCommandNotFound
+}
+
+func (s *testStore) Commands(ctx context.Context) ([]ScheduledCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ScheduledCommand{}, s.cmds...), nil
+}
+
+func (s *testStore) ClaimDueCommands(ctx context.Context, now time.Time, lease time.Duration, max int) ([]ScheduledCommand, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return nil, s.err
+	}
+	cmds := []ScheduledCommand{}
+	for _, c := range s.cmds {
+		if !c.Failed && !c.ExecuteAt.After(now) && len(cmds) < max {
+			cmds = append(cmds, c)
+		}
+	}
+	return cmds, nil
+}
@@ -21,10 +21,21 @@ import (
 )
 
 // NewMiddleware returns a new async handling middleware that validate commands
-// with its own validation method.
+// with the rules in their "eh" tags, see eventhorizon.CheckCommand, and with
+// its own validation method.
 func NewMiddleware() eh.CommandHandlerMiddleware {
 	return eh.CommandHandlerMiddleware(func(h eh.CommandHandler) eh.CommandHandler {
 		return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+			// Check the fields of the command without the wrapper from
+			// CommandWithValidation.
+			c := cmd
+			if w, ok := cmd.(*command); ok {
+				c = w.Command
+			}
+			if err := eh.CheckCommand(c); err != nil {
+				return err
+			}
+
 			// Call the validation method if it exists
 			if c, ok := cmd.(Command); ok {
 				err := c.Validate()
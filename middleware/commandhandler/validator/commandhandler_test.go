@@ -75,3 +75,20 @@ func TestCommandHandler_WithValidationNoError(t *testing.T) {
 		t.Error("the command should have been handled:", inner.Commands)
 	}
 }
+
+func TestCommandHandler_WithFieldError(t *testing.T) {
+	inner := &mocks.CommandHandler{}
+	m := NewMiddleware()
+	h := eh.UseCommandHandlerMiddleware(inner, m)
+	cmd := &mocks.Command{
+		ID: uuid.New(),
+	}
+	c := CommandWithValidation(cmd, func() error { return nil })
+	err := h.HandleCommand(context.Background(), c)
+	if err == nil || err.Error() != "missing field: Content" {
+		t.Error("there should be a field error:", err)
+	}
+	if len(inner.Commands) != 0 {
+		t.Error("the command should not have been handled:", inner.Commands)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// StoreAcceptanceTest is the acceptance test that all implementations of
+// Store should pass. It should manually be called from a test case in each
+// implementation:
+//
+//   func TestStore(t *testing.T) {
+//       store := NewStore()
+//       dedupe.StoreAcceptanceTest(t, store)
+//   }
+//
+func StoreAcceptanceTest(t *testing.T, store Store) {
+	ctx := context.Background()
+	otherCtx := eh.NewContextWithNamespace(ctx, "other")
+	id := uuid.New()
+
+	t.Log("check an event that is not handled")
+	handled, err := store.IsHandled(ctx, "handler", id, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if handled {
+		t.Error("the event should not be handled")
+	}
+
+	t.Log("set an event as handled")
+	if err := store.SetHandled(ctx, "handler", id, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	handled, err = store.IsHandled(ctx, "handler", id, 1)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !handled {
+		t.Error("the event should be handled")
+	}
+
+	t.Log("set an event as handled again")
+	if err := store.SetHandled(ctx, "handler", id, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	t.Log("check other versions, handlers, aggregates and namespaces")
+	testCases := map[string]struct {
+		ctx         context.Context
+		handlerType eh.EventHandlerType
+		id          uuid.UUID
+		version     int
+	}{
+		"version":   {ctx, "handler", id, 2},
+		"handler":   {ctx, "other", id, 1},
+		"aggregate": {ctx, "handler", uuid.New(), 1},
+		"namespace": {otherCtx, "handler", id, 1},
+	}
+	for name, tc := range testCases {
+		handled, err := store.IsHandled(tc.ctx, tc.handlerType, tc.id, tc.version)
+		if err != nil {
+			t.Error("there should be no error:", name, err)
+		}
+		if handled {
+			t.Error("the event should not be handled:", name)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"context"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// NewMiddleware returns a new dedupe middleware that only lets each event
+// through to the handler once, as identified by the aggregate ID and version
+// of the event. Events are set as handled in the store when the handler
+// returns without an error, so failed events can be handled again.
+func NewMiddleware(store Store) eh.EventHandlerMiddleware {
+	return eh.EventHandlerMiddleware(func(h eh.EventHandler) eh.EventHandler {
+		return &eventHandler{h, store}
+	})
+}
+
+// eventHandler is an event handler that skips handled events, keeping the
+// handler type of the wrapped handler.
+type eventHandler struct {
+	eh.EventHandler
+	store Store
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler
+// interface.
+func (h *eventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	handled, err := h.store.IsHandled(ctx, h.HandlerType(), event.AggregateID(), event.Version())
+	if err != nil {
+		return err
+	}
+	if handled {
+		return nil
+	}
+
+	if err := h.EventHandler.HandleEvent(ctx, event); err != nil {
+		return err
+	}
+
+	return h.store.SetHandled(ctx, h.HandlerType(), event.AggregateID(), event.Version())
+}
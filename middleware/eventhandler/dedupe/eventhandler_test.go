@@ -0,0 +1,104 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	id := uuid.New()
+	event1 := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		time.Now(), mocks.AggregateType, id, 1)
+	event2 := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event2"},
+		time.Now(), mocks.AggregateType, id, 2)
+
+	store := &testStore{handled: map[string]bool{}}
+	inner := mocks.NewEventHandler("test")
+	h := eh.UseEventHandlerMiddleware(inner, NewMiddleware(store))
+	if h.HandlerType() != inner.HandlerType() {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+
+	ctx := context.Background()
+	for _, e := range []eh.Event{event1, event1, event2, event1} {
+		if err := h.HandleEvent(ctx, e); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if !reflect.DeepEqual(inner.Events, []eh.Event{event1, event2}) {
+		t.Error("the events should only be handled once:", inner.Events)
+	}
+
+	// Failed events should be handled again.
+	event3 := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event3"},
+		time.Now(), mocks.AggregateType, id, 3)
+	handlingErr := errors.New("handling error")
+	inner.Err = handlingErr
+	if err := h.HandleEvent(ctx, event3); err != handlingErr {
+		t.Error("there should be a handling error:", err)
+	}
+	inner.Err = nil
+	if err := h.HandleEvent(ctx, event3); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(inner.Events, []eh.Event{event1, event2, event3}) {
+		t.Error("the failed event should be handled again:", inner.Events)
+	}
+
+	// Store errors.
+	storeErr := errors.New("store error")
+	store.err = storeErr
+	if err := h.HandleEvent(ctx, event1); err != storeErr {
+		t.Error("there should be a store error:", err)
+	}
+}
+
+// testStore is a Store for testing, as the store implementations can't be
+// imported here.
+type testStore struct {
+	handled map[string]bool
+	err     error
+	mu      sync.Mutex
+}
+
+func (s *testStore) IsHandled(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return false, s.err
+	}
+	return s.handled[fmt.Sprint(handlerType, id, version)], nil
+}
+
+func (s *testStore) SetHandled(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	s.handled[fmt.Sprint(handlerType, id, version)] = true
+	return nil
+}
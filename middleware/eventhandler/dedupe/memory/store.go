@@ -0,0 +1,86 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/middleware/eventhandler/dedupe"
+)
+
+// DefaultSize is the number of handled events to keep if not set.
+var DefaultSize = 10000
+
+// Store implements dedupe.Store as an in memory structure. Only the most
+// recently handled events are kept, up to the size of the store.
+type Store struct {
+	handled   map[string]struct{}
+	keys      []string
+	next      int
+	handledMu sync.Mutex
+}
+
+var _ = dedupe.Store(&Store{})
+
+// NewStore creates a new Store using memory as storage, that keeps up to size
+// handled events. DefaultSize is used if the size is not positive.
+func NewStore(size int) *Store {
+	if size <= 0 {
+		size = DefaultSize
+	}
+	return &Store{
+		handled: map[string]struct{}{},
+		keys:    make([]string, size),
+	}
+}
+
+// IsHandled implements the IsHandled method of the dedupe.Store interface.
+func (s *Store) IsHandled(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) (bool, error) {
+	s.handledMu.Lock()
+	defer s.handledMu.Unlock()
+
+	_, ok := s.handled[key(ctx, handlerType, id, version)]
+	return ok, nil
+}
+
+// SetHandled implements the SetHandled method of the dedupe.Store interface.
+func (s *Store) SetHandled(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) error {
+	s.handledMu.Lock()
+	defer s.handledMu.Unlock()
+
+	k := key(ctx, handlerType, id, version)
+	if _, ok := s.handled[k]; ok {
+		return nil
+	}
+
+	// Replace the oldest key.
+	delete(s.handled, s.keys[s.next])
+	s.keys[s.next] = k
+	s.next = (s.next + 1) % len(s.keys)
+	s.handled[k] = struct{}{}
+
+	return nil
+}
+
+// key is the key of a handled event, unique for the namespace.
+func key(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) string {
+	return eh.NamespaceFromContext(ctx) + ":" + string(handlerType) + ":" +
+		id.String() + ":" + strconv.Itoa(version)
+}
@@ -0,0 +1,54 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package memory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+
+	"github.com/looplab/eventhorizon/middleware/eventhandler/dedupe"
+)
+
+func TestStore(t *testing.T) {
+	store := NewStore(0)
+	if store == nil {
+		t.Fatal("there should be a store")
+	}
+	dedupe.StoreAcceptanceTest(t, store)
+}
+
+func TestStore_Bounded(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(2)
+	id := uuid.New()
+	for v := 1; v <= 3; v++ {
+		if err := store.SetHandled(ctx, "handler", id, v); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+
+	// The oldest event should have been removed.
+	for v, expected := range map[int]bool{1: false, 2: true, 3: true} {
+		handled, err := store.IsHandled(ctx, "handler", id, v)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if handled != expected {
+			t.Error("the event should be handled:", v, expected)
+		}
+	}
+}
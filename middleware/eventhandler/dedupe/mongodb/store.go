@@ -0,0 +1,145 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mongodb
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/globalsign/mgo"
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/middleware/eventhandler/dedupe"
+)
+
+// DefaultRetention is how long handled events are kept before they are removed
+// by a TTL index. It is used when creating a store, and should be longer than
+// the time that an event can be delivered again by the event bus.
+var DefaultRetention = 7 * 24 * time.Hour
+
+// ErrCouldNotDialDB is when the database could not be dialed.
+var ErrCouldNotDialDB = errors.New("could not dial database")
+
+// ErrNoDBSession is when no database session is set.
+var ErrNoDBSession = errors.New("no database session")
+
+// Store implements a dedupe.Store for MongoDB. The handled events of all
+// namespaces are stored in the "handled_events" collection in the DB with the
+// DB prefix as name. Handled events are removed by a TTL index after the
+// DefaultRetention.
+type Store struct {
+	session *mgo.Session
+	dbName  string
+}
+
+var _ = dedupe.Store(&Store{})
+
+// NewStore creates a new Store.
+func NewStore(url, dbPrefix string) (*Store, error) {
+	session, err := mgo.Dial(url)
+	if err != nil {
+		return nil, ErrCouldNotDialDB
+	}
+
+	session.SetMode(mgo.Strong, true)
+	session.SetSafe(&mgo.Safe{W: 1})
+
+	return NewStoreWithSession(session, dbPrefix)
+}
+
+// NewStoreWithSession creates a new Store with a session.
+func NewStoreWithSession(session *mgo.Session, dbPrefix string) (*Store, error) {
+	if session == nil {
+		return nil, ErrNoDBSession
+	}
+
+	s := &Store{
+		session: session,
+		dbName:  dbPrefix,
+	}
+
+	if err := s.session.DB(s.dbName).C("handled_events").EnsureIndex(mgo.Index{
+		Key:         []string{"handled_at"},
+		ExpireAfter: DefaultRetention,
+	}); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// IsHandled implements the IsHandled method of the dedupe.Store interface.
+func (s *Store) IsHandled(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) (bool, error) {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	n, err := sess.DB(s.dbName).C("handled_events").FindId(key(ctx, handlerType, id, version)).Count()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// SetHandled implements the SetHandled method of the dedupe.Store interface.
+func (s *Store) SetHandled(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) error {
+	sess := s.session.Copy()
+	defer sess.Close()
+
+	k := key(ctx, handlerType, id, version)
+	if _, err := sess.DB(s.dbName).C("handled_events").UpsertId(k, dbHandledEvent{
+		ID:          k,
+		Namespace:   eh.NamespaceFromContext(ctx),
+		HandlerType: string(handlerType),
+		AggregateID: id.String(),
+		Version:     version,
+		HandledAt:   time.Now(),
+	}); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Clear clears the handled events, the TTL index is kept.
+func (s *Store) Clear(ctx context.Context) error {
+	if _, err := s.session.DB(s.dbName).C("handled_events").RemoveAll(nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Close closes the database session.
+func (s *Store) Close() {
+	s.session.Close()
+}
+
+// key is the key of a handled event, unique for the namespace.
+func key(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) string {
+	return eh.NamespaceFromContext(ctx) + ":" + string(handlerType) + ":" +
+		id.String() + ":" + strconv.Itoa(version)
+}
+
+// dbHandledEvent is the DB representation of a handled event.
+type dbHandledEvent struct {
+	ID          string    `bson:"_id"`
+	Namespace   string    `bson:"namespace"`
+	HandlerType string    `bson:"handler_type"`
+	AggregateID string    `bson:"aggregate_id"`
+	Version     int       `bson:"version"`
+	HandledAt   time.Time `bson:"handled_at"`
+}
@@ -0,0 +1,34 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package dedupe
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Store is a store for the events that have been handled, identified by the
+// handler type, the aggregate ID and the version of the event. The namespace
+// is taken from the context.
+type Store interface {
+	// IsHandled returns true if the event has been handled by the handler type.
+	IsHandled(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) (bool, error)
+
+	// SetHandled sets the event as handled by the handler type.
+	SetHandled(ctx context.Context, handlerType eh.EventHandlerType, id uuid.UUID, version int) error
+}
@@ -0,0 +1,50 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespace
+
+import (
+	"context"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// NewMiddleware returns a new namespace filter middleware that only lets events
+// in the namespaces through to the handler, as set in the context with
+// eventhorizon.NewContextWithNamespace. Events in other namespaces are ignored.
+func NewMiddleware(namespaces ...string) eh.EventHandlerMiddleware {
+	allowed := make(map[string]bool, len(namespaces))
+	for _, ns := range namespaces {
+		allowed[ns] = true
+	}
+	return eh.EventHandlerMiddleware(func(h eh.EventHandler) eh.EventHandler {
+		return &eventHandler{h, allowed}
+	})
+}
+
+// eventHandler is an event handler with a namespace filter, keeping the handler
+// type of the wrapped handler.
+type eventHandler struct {
+	eh.EventHandler
+	namespaces map[string]bool
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler
+// interface.
+func (h *eventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	if !h.namespaces[eh.NamespaceFromContext(ctx)] {
+		return nil
+	}
+	return h.EventHandler.HandleEvent(ctx, event)
+}
@@ -0,0 +1,52 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package namespace
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		time.Now(), mocks.AggregateType, uuid.New(), 1)
+
+	inner := mocks.NewEventHandler("test")
+	h := eh.UseEventHandlerMiddleware(inner, NewMiddleware("ns1", eh.DefaultNamespace))
+	if h.HandlerType() != inner.HandlerType() {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+
+	testCases := map[string]bool{
+		"ns1":               true,
+		eh.DefaultNamespace: true,
+		"ns2":               false,
+	}
+	for ns, handled := range testCases {
+		inner.Reset()
+		ctx := eh.NewContextWithNamespace(context.Background(), ns)
+		if err := h.HandleEvent(ctx, event); err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if (len(inner.Events) == 1) != handled {
+			t.Error("the event should be handled:", ns, handled)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// NewMiddleware returns a new panic recovery middleware that returns panics in
+// the handler as errors, instead of crashing the goroutine of the event bus
+// that called the handler.
+func NewMiddleware() eh.EventHandlerMiddleware {
+	return eh.EventHandlerMiddleware(func(h eh.EventHandler) eh.EventHandler {
+		return &eventHandler{h}
+	})
+}
+
+// Error is an error from a panic when handling an event.
+type Error struct {
+	// Value is the value that the handler panicked with.
+	Value interface{}
+	// Stack is the stack trace of the panic.
+	Stack []byte
+	// Event is the event that was handled.
+	Event eh.Event
+}
+
+// Error implements the Error method of the error interface.
+func (e Error) Error() string {
+	return fmt.Sprintf("%s: panic: %v", e.Event.String(), e.Value)
+}
+
+// eventHandler is an event handler that recovers from panics, keeping the
+// handler type of the wrapped handler.
+type eventHandler struct {
+	eh.EventHandler
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler
+// interface.
+func (h *eventHandler) HandleEvent(ctx context.Context, event eh.Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = Error{
+				Value: r,
+				Stack: debug.Stack(),
+				Event: event,
+			}
+		}
+	}()
+
+	return h.EventHandler.HandleEvent(ctx, event)
+}
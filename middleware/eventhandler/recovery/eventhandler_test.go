@@ -0,0 +1,59 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package recovery
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		time.Now(), mocks.AggregateType, uuid.New(), 1)
+
+	inner := mocks.NewEventHandler("test")
+	h := eh.UseEventHandlerMiddleware(inner, NewMiddleware())
+	if h.HandlerType() != inner.HandlerType() {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(inner.Events, []eh.Event{event}) {
+		t.Error("the event should have been handled:", inner.Events)
+	}
+
+	// Panic handling.
+	h = eh.UseEventHandlerMiddleware(eh.EventHandlerFunc(func(ctx context.Context, e eh.Event) error {
+		panic("handler panic")
+	}), NewMiddleware())
+	err := h.HandleEvent(context.Background(), event)
+	pErr, ok := err.(Error)
+	if !ok {
+		t.Fatal("there should be a panic error:", err)
+	}
+	if pErr.Value != "handler panic" || pErr.Event != event || len(pErr.Stack) == 0 {
+		t.Error("the panic error should be correct:", pErr)
+	}
+	if pErr.Error() != event.String()+": panic: handler panic" {
+		t.Error("the error message should be correct:", pErr.Error())
+	}
+}
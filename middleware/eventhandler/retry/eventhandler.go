@@ -0,0 +1,74 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"time"
+
+	"github.com/jpillora/backoff"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// NewMiddleware returns a new retry middleware that handles an event again
+// when the handler returns an error, up to a total of maxAttempts times. The
+// wait between the attempts starts at minBackoff and is doubled up to
+// maxBackoff. The error from the last attempt is returned, or the error of
+// the context if it is done while waiting.
+func NewMiddleware(maxAttempts int, minBackoff, maxBackoff time.Duration) eh.EventHandlerMiddleware {
+	return eh.EventHandlerMiddleware(func(h eh.EventHandler) eh.EventHandler {
+		return &eventHandler{
+			EventHandler: h,
+			maxAttempts:  maxAttempts,
+			minBackoff:   minBackoff,
+			maxBackoff:   maxBackoff,
+		}
+	})
+}
+
+// eventHandler is an event handler that retries, keeping the handler type of
+// the wrapped handler.
+type eventHandler struct {
+	eh.EventHandler
+	maxAttempts int
+	minBackoff  time.Duration
+	maxBackoff  time.Duration
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler
+// interface.
+func (h *eventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	delay := &backoff.Backoff{
+		Min: h.minBackoff,
+		Max: h.maxBackoff,
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = h.EventHandler.HandleEvent(ctx, event); err == nil {
+			return nil
+		}
+
+		if attempt >= h.maxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay.Duration()):
+		}
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		time.Now(), mocks.AggregateType, uuid.New(), 1)
+
+	inner := mocks.NewEventHandler("test")
+	m := NewMiddleware(3, time.Millisecond, 10*time.Millisecond)
+	h := eh.UseEventHandlerMiddleware(inner, m)
+	if h.HandlerType() != inner.HandlerType() {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// Succeed on the last attempt.
+	handlingErr := errors.New("handling error")
+	attempts := 0
+	h = eh.UseEventHandlerMiddleware(eh.EventHandlerFunc(func(ctx context.Context, e eh.Event) error {
+		attempts++
+		if attempts < 3 {
+			return handlingErr
+		}
+		return nil
+	}), m)
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if attempts != 3 {
+		t.Error("there should be 3 attempts:", attempts)
+	}
+
+	// Fail all attempts.
+	attempts = -10
+	if err := h.HandleEvent(context.Background(), event); err != handlingErr {
+		t.Error("there should be a handling error:", err)
+	}
+	if attempts != -7 {
+		t.Error("there should be 3 attempts:", attempts+10)
+	}
+
+	// Cancelled while waiting.
+	attempts = -10
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.HandleEvent(ctx, event); err != context.Canceled {
+		t.Error("there should be a cancelled error:", err)
+	}
+	if attempts != -9 {
+		t.Error("there should be 1 attempt:", attempts+10)
+	}
+}
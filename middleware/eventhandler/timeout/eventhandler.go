@@ -0,0 +1,58 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeout
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	eh "github.com/looplab/eventhorizon"
+)
+
+// ErrTimeout is when an event was not handled within the timeout.
+var ErrTimeout = errors.New("event handling timed out")
+
+// NewMiddleware returns a new timeout middleware that handles the event with a
+// context that is cancelled after the timeout, and returns ErrTimeout if the
+// handler fails after the timeout. The handler is run in the caller's
+// goroutine, which means that it must respect the context to be stopped, but
+// also that it is never left running after returning, for example when
+// combined with the retry middleware.
+func NewMiddleware(timeout time.Duration) eh.EventHandlerMiddleware {
+	return eh.EventHandlerMiddleware(func(h eh.EventHandler) eh.EventHandler {
+		return &eventHandler{h, timeout}
+	})
+}
+
+// eventHandler is an event handler with a timeout, keeping the handler type of
+// the wrapped handler.
+type eventHandler struct {
+	eh.EventHandler
+	timeout time.Duration
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler
+// interface.
+func (h *eventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	timeoutCtx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	err := h.EventHandler.HandleEvent(timeoutCtx, event)
+	if err != nil && ctx.Err() == nil && timeoutCtx.Err() == context.DeadlineExceeded {
+		return ErrTimeout
+	}
+	return err
+}
@@ -0,0 +1,101 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package timeout
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/middleware/eventhandler/retry"
+	"github.com/looplab/eventhorizon/mocks"
+)
+
+func TestEventHandler(t *testing.T) {
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		time.Now(), mocks.AggregateType, uuid.New(), 1)
+
+	inner := mocks.NewEventHandler("test")
+	h := eh.UseEventHandlerMiddleware(inner, NewMiddleware(time.Second))
+	if h.HandlerType() != inner.HandlerType() {
+		t.Error("the handler type should be kept:", h.HandlerType())
+	}
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if len(inner.Events) != 1 {
+		t.Error("the event should have been handled:", inner.Events)
+	}
+
+	// Handler errors.
+	handlingErr := errors.New("handling error")
+	inner.Err = handlingErr
+	if err := h.HandleEvent(context.Background(), event); err != handlingErr {
+		t.Error("there should be a handling error:", err)
+	}
+
+	// Timeout.
+	h = eh.UseEventHandlerMiddleware(eh.EventHandlerFunc(func(ctx context.Context, e eh.Event) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), NewMiddleware(10*time.Millisecond))
+	if err := h.HandleEvent(context.Background(), event); err != ErrTimeout {
+		t.Error("there should be a timeout error:", err)
+	}
+
+	// Cancelled context.
+	h = eh.UseEventHandlerMiddleware(eh.EventHandlerFunc(func(ctx context.Context, e eh.Event) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}), NewMiddleware(time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.HandleEvent(ctx, event); err != context.Canceled {
+		t.Error("there should be a cancelled error:", err)
+	}
+}
+
+func TestEventHandler_Retry(t *testing.T) {
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event1"},
+		time.Now(), mocks.AggregateType, uuid.New(), 1)
+
+	// Attempts that time out should be done before the next attempt.
+	var running, attempts int32
+	inner := eh.EventHandlerFunc(func(ctx context.Context, e eh.Event) error {
+		if atomic.AddInt32(&running, 1) > 1 {
+			t.Error("the attempts should not run concurrently")
+		}
+		defer atomic.AddInt32(&running, -1)
+		if atomic.AddInt32(&attempts, 1) < 3 {
+			<-ctx.Done()
+			return ctx.Err()
+		}
+		return nil
+	})
+	h := eh.UseEventHandlerMiddleware(inner,
+		retry.NewMiddleware(3, time.Millisecond, time.Millisecond),
+		NewMiddleware(10*time.Millisecond),
+	)
+	if err := h.HandleEvent(context.Background(), event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if attempts != 3 {
+		t.Error("the event should be handled 3 times:", attempts)
+	}
+}
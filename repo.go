@@ -71,6 +71,29 @@ type WriteRepo interface {
 	Remove(context.Context, uuid.UUID) error
 }
 
+// BatchWriteRepo is a write repository that can save and remove several
+// entities in one request. It is optional for repos to implement.
+type BatchWriteRepo interface {
+	WriteRepo
+
+	// SaveBatch saves and removes entities in one request. Removing entities
+	// that does not exist is not an error. The batch is not guaranteed to be
+	// atomic, see the docs of each implementation, but saving and removing is
+	// idempotent which means that a failed batch can be retried as a whole.
+	SaveBatch(ctx context.Context, save []Entity, remove []uuid.UUID) error
+}
+
+// VersionedWriteRepo is a write repository that can save entities with
+// optimistic concurrency control. It is optional for repos to implement.
+type VersionedWriteRepo interface {
+	WriteRepo
+
+	// SaveVersioned saves a versionable entity if the version of the stored
+	// entity is the expected version, use 0 for entities that should be new.
+	// An error with ErrIncorrectEntityVersion is returned otherwise.
+	SaveVersioned(ctx context.Context, entity Entity, expectedVersion int) error
+}
+
 // ReadWriteRepo is a combined read and write repo, mainly useful for testing.
 type ReadWriteRepo interface {
 	ReadRepo
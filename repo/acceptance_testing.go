@@ -157,3 +157,115 @@ func AcceptanceTest(t *testing.T, ctx context.Context, repo eh.ReadWriteRepo) {
 		t.Error("there should be a ErrEntityNotFound error:", err)
 	}
 }
+
+// BatchAcceptanceTest is the acceptance test that all implementations of
+// eventhorizon.BatchWriteRepo should pass, in addition to AcceptanceTest.
+func BatchAcceptanceTest(t *testing.T, ctx context.Context, repo interface {
+	eh.ReadRepo
+	eh.BatchWriteRepo
+}) {
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	entity1 := &mocks.Model{ID: uuid.New(), Version: 1, Content: "entity1", CreatedAt: timestamp}
+	entity2 := &mocks.Model{ID: uuid.New(), Version: 1, Content: "entity2", CreatedAt: timestamp}
+
+	// Save batch with entity without ID.
+	err := repo.SaveBatch(ctx, []eh.Entity{entity1, &mocks.Model{Content: "missing"}}, nil)
+	if rrErr, ok := err.(eh.RepoError); !ok || rrErr.Err != eh.ErrCouldNotSaveEntity {
+		t.Error("there should be a ErrCouldNotSaveEntity error:", err)
+	}
+	if _, err := repo.Find(ctx, entity1.ID); err == nil {
+		t.Error("the entity should not be saved")
+	}
+
+	// Save batch.
+	if err := repo.SaveBatch(ctx, []eh.Entity{entity1, entity2}, nil); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	for _, e := range []*mocks.Model{entity1, entity2} {
+		entity, err := repo.Find(ctx, e.ID)
+		if err != nil {
+			t.Error("there should be no error:", err)
+		}
+		if !reflect.DeepEqual(entity, e) {
+			t.Error("the item should be correct:", entity)
+		}
+	}
+
+	// Save and remove in the same batch, including non-existing items.
+	entity1Alt := &mocks.Model{ID: entity1.ID, Version: 2, Content: "entity1Alt", CreatedAt: timestamp}
+	if err := repo.SaveBatch(ctx, []eh.Entity{entity1Alt}, []uuid.UUID{entity2.ID, uuid.New()}); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	entity, err := repo.Find(ctx, entity1.ID)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(entity, entity1Alt) {
+		t.Error("the item should be correct:", entity)
+	}
+	_, err = repo.Find(ctx, entity2.ID)
+	if rrErr, ok := err.(eh.RepoError); !ok || rrErr.Err != eh.ErrEntityNotFound {
+		t.Error("there should be a ErrEntityNotFound error:", err)
+	}
+
+	// Empty batch.
+	if err := repo.SaveBatch(ctx, nil, nil); err != nil {
+		t.Error("there should be no error:", err)
+	}
+}
+
+// VersionedAcceptanceTest is the acceptance test that all implementations of
+// eventhorizon.VersionedWriteRepo should pass, in addition to AcceptanceTest.
+func VersionedAcceptanceTest(t *testing.T, ctx context.Context, repo interface {
+	eh.ReadRepo
+	eh.VersionedWriteRepo
+}) {
+	timestamp := time.Date(2009, time.November, 10, 23, 0, 0, 0, time.UTC)
+	id := uuid.New()
+
+	// Save without version.
+	err := repo.SaveVersioned(ctx, &mocks.SimpleModel{ID: id, Content: "simple"}, 0)
+	if rrErr, ok := err.(eh.RepoError); !ok || rrErr.Err != eh.ErrEntityHasNoVersion {
+		t.Error("there should be a ErrEntityHasNoVersion error:", err)
+	}
+
+	// Save new entity.
+	entity1 := &mocks.Model{ID: id, Version: 1, Content: "entity1", CreatedAt: timestamp}
+	if err := repo.SaveVersioned(ctx, entity1, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	entity, err := repo.Find(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(entity, entity1) {
+		t.Error("the item should be correct:", entity)
+	}
+
+	// Save new entity that already exists.
+	entity1Dup := &mocks.Model{ID: id, Version: 1, Content: "entity1Dup", CreatedAt: timestamp}
+	err = repo.SaveVersioned(ctx, entity1Dup, 0)
+	if rrErr, ok := err.(eh.RepoError); !ok || rrErr.Err != eh.ErrIncorrectEntityVersion {
+		t.Error("there should be a ErrIncorrectEntityVersion error:", err)
+	}
+
+	// Save with correct version.
+	entity2 := &mocks.Model{ID: id, Version: 2, Content: "entity2", CreatedAt: timestamp}
+	if err := repo.SaveVersioned(ctx, entity2, 1); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	// Save with old version.
+	entity2Alt := &mocks.Model{ID: id, Version: 2, Content: "entity2Alt", CreatedAt: timestamp}
+	err = repo.SaveVersioned(ctx, entity2Alt, 1)
+	if rrErr, ok := err.(eh.RepoError); !ok || rrErr.Err != eh.ErrIncorrectEntityVersion {
+		t.Error("there should be a ErrIncorrectEntityVersion error:", err)
+	}
+	entity, err = repo.Find(ctx, id)
+	if err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if !reflect.DeepEqual(entity, entity2) {
+		t.Error("the item should be correct:", entity)
+	}
+}
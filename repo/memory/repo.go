@@ -33,13 +33,19 @@ type Repo struct {
 	// A list of all item ids, only the order is used.
 	// The outer map is for the namespace.
 	ids map[namespace][]uuid.UUID
+
+	// The saved versions of versionable entities, kept separately as the
+	// saved entities can be modified in place by the users of the repo.
+	// The outer map is for the namespace.
+	versions map[namespace]map[uuid.UUID]int
 }
 
 // NewRepo creates a new Repo.
 func NewRepo() *Repo {
 	r := &Repo{
-		ids: map[namespace][]uuid.UUID{},
-		db:  map[namespace]map[uuid.UUID]eh.Entity{},
+		ids:      map[namespace][]uuid.UUID{},
+		db:       map[namespace]map[uuid.UUID]eh.Entity{},
+		versions: map[namespace]map[uuid.UUID]int{},
 	}
 	return r
 }
@@ -96,11 +102,7 @@ func (r *Repo) Save(ctx context.Context, entity eh.Entity) error {
 
 	r.dbMu.Lock()
 	defer r.dbMu.Unlock()
-	id := entity.EntityID()
-	if _, ok := r.db[ns][id]; !ok {
-		r.ids[ns] = append(r.ids[ns], id)
-	}
-	r.db[ns][id] = entity
+	r.save(ns, entity)
 
 	return nil
 }
@@ -113,6 +115,7 @@ func (r *Repo) Remove(ctx context.Context, id uuid.UUID) error {
 	defer r.dbMu.Unlock()
 	if _, ok := r.db[ns][id]; ok {
 		delete(r.db[ns], id)
+		delete(r.versions[ns], id)
 
 		index := -1
 		for i, d := range r.ids[ns] {
@@ -132,6 +135,88 @@ func (r *Repo) Remove(ctx context.Context, id uuid.UUID) error {
 	}
 }
 
+// SaveBatch implements the SaveBatch method of the eventhorizon.BatchWriteRepo interface.
+// All entities are saved and removed while holding the lock.
+func (r *Repo) SaveBatch(ctx context.Context, save []eh.Entity, remove []uuid.UUID) error {
+	ns := r.namespace(ctx)
+
+	for _, entity := range save {
+		if entity.EntityID() == uuid.Nil {
+			return eh.RepoError{
+				Err:       eh.ErrCouldNotSaveEntity,
+				BaseErr:   eh.ErrMissingEntityID,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+	}
+
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+	for _, entity := range save {
+		r.save(ns, entity)
+	}
+	for _, id := range remove {
+		if _, ok := r.db[ns][id]; !ok {
+			continue
+		}
+		delete(r.db[ns], id)
+		delete(r.versions[ns], id)
+		for i, d := range r.ids[ns] {
+			if id == d {
+				r.ids[ns] = append(r.ids[ns][:i], r.ids[ns][i+1:]...)
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// SaveVersioned implements the SaveVersioned method of the eventhorizon.VersionedWriteRepo interface.
+func (r *Repo) SaveVersioned(ctx context.Context, entity eh.Entity, expectedVersion int) error {
+	ns := r.namespace(ctx)
+
+	if entity.EntityID() == uuid.Nil {
+		return eh.RepoError{
+			Err:       eh.ErrCouldNotSaveEntity,
+			BaseErr:   eh.ErrMissingEntityID,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+	if _, ok := entity.(eh.Versionable); !ok {
+		return eh.RepoError{
+			Err:       eh.ErrEntityHasNoVersion,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	r.dbMu.Lock()
+	defer r.dbMu.Unlock()
+	if r.versions[ns][entity.EntityID()] != expectedVersion {
+		return eh.RepoError{
+			Err:       eh.ErrIncorrectEntityVersion,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+	r.save(ns, entity)
+
+	return nil
+}
+
+// save saves an entity, the lock must be held.
+func (r *Repo) save(ns namespace, entity eh.Entity) {
+	id := entity.EntityID()
+	if _, ok := r.db[ns][id]; !ok {
+		r.ids[ns] = append(r.ids[ns], id)
+	}
+	r.db[ns][id] = entity
+	if v, ok := entity.(eh.Versionable); ok {
+		r.versions[ns][id] = v.AggregateVersion()
+	} else {
+		delete(r.versions[ns], id)
+	}
+}
+
 // Helper to get the namespace and ensure that its data exists.
 func (r *Repo) namespace(ctx context.Context) namespace {
 	ns := namespace(eh.NamespaceFromContext(ctx))
@@ -141,6 +226,7 @@ func (r *Repo) namespace(ctx context.Context) namespace {
 	if _, ok := r.db[ns]; !ok {
 		r.db[ns] = map[uuid.UUID]eh.Entity{}
 		r.ids[ns] = []uuid.UUID{}
+		r.versions[ns] = map[uuid.UUID]int{}
 	}
 
 	return ns
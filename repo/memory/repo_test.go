@@ -34,10 +34,14 @@ func TestReadRepo(t *testing.T) {
 
 	// Repo with default namespace.
 	repo.AcceptanceTest(t, context.Background(), r)
+	repo.BatchAcceptanceTest(t, context.Background(), r)
+	repo.VersionedAcceptanceTest(t, context.Background(), r)
 
 	// Repo with other namespace
 	ctx := eh.NewContextWithNamespace(context.Background(), "ns")
 	repo.AcceptanceTest(t, ctx, r)
+	repo.BatchAcceptanceTest(t, ctx, r)
+	repo.VersionedAcceptanceTest(t, ctx, r)
 
 }
 
@@ -19,6 +19,7 @@ import (
 	"errors"
 
 	"github.com/globalsign/mgo"
+	"github.com/globalsign/mgo/bson"
 	"github.com/google/uuid"
 
 	eh "github.com/looplab/eventhorizon"
@@ -269,6 +270,93 @@ func (r *Repo) Remove(ctx context.Context, id uuid.UUID) error {
 	return nil
 }
 
+// SaveBatch implements the SaveBatch method of the eventhorizon.BatchWriteRepo interface.
+// The entities are saved and removed with one ordered bulk operation, which is
+// not atomic. If an operation fails the bulk is stopped, the operations before
+// it are kept and the rest are not done. The whole batch can be retried, as
+// saving and removing is idempotent.
+func (r *Repo) SaveBatch(ctx context.Context, save []eh.Entity, remove []uuid.UUID) error {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if len(save) == 0 && len(remove) == 0 {
+		return nil
+	}
+
+	bulk := sess.DB(r.dbName(ctx)).C(r.collection).Bulk()
+	for _, entity := range save {
+		if entity.EntityID() == uuid.Nil {
+			return eh.RepoError{
+				Err:       eh.ErrCouldNotSaveEntity,
+				BaseErr:   eh.ErrMissingEntityID,
+				Namespace: eh.NamespaceFromContext(ctx),
+			}
+		}
+		bulk.Upsert(bson.M{"_id": entity.EntityID()}, entity)
+	}
+	for _, id := range remove {
+		bulk.Remove(bson.M{"_id": id})
+	}
+
+	if _, err := bulk.Run(); err != nil {
+		return eh.RepoError{
+			Err:       eh.ErrCouldNotSaveEntity,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+	return nil
+}
+
+// SaveVersioned implements the SaveVersioned method of the eventhorizon.VersionedWriteRepo interface.
+// The version of the entity must be stored in a field named "version".
+func (r *Repo) SaveVersioned(ctx context.Context, entity eh.Entity, expectedVersion int) error {
+	sess := r.session.Copy()
+	defer sess.Close()
+
+	if entity.EntityID() == uuid.Nil {
+		return eh.RepoError{
+			Err:       eh.ErrCouldNotSaveEntity,
+			BaseErr:   eh.ErrMissingEntityID,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+	if _, ok := entity.(eh.Versionable); !ok {
+		return eh.RepoError{
+			Err:       eh.ErrEntityHasNoVersion,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	c := sess.DB(r.dbName(ctx)).C(r.collection)
+	var err error
+	if expectedVersion == 0 {
+		err = c.Insert(entity)
+		if mgo.IsDup(err) {
+			err = eh.ErrIncorrectEntityVersion
+		}
+	} else {
+		err = c.Update(bson.M{"_id": entity.EntityID(), "version": expectedVersion}, entity)
+		if err == mgo.ErrNotFound {
+			err = eh.ErrIncorrectEntityVersion
+		}
+	}
+	if err == eh.ErrIncorrectEntityVersion {
+		return eh.RepoError{
+			Err:       eh.ErrIncorrectEntityVersion,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	} else if err != nil {
+		return eh.RepoError{
+			Err:       eh.ErrCouldNotSaveEntity,
+			BaseErr:   err,
+			Namespace: eh.NamespaceFromContext(ctx),
+		}
+	}
+
+	return nil
+}
+
 // Collection lets the function do custom actions on the collection.
 func (r *Repo) Collection(ctx context.Context, f func(*mgo.Collection) error) error {
 	sess := r.session.Copy()
@@ -62,6 +62,8 @@ func TestReadRepo(t *testing.T) {
 		}
 	}()
 	repo.AcceptanceTest(t, context.Background(), r)
+	repo.BatchAcceptanceTest(t, context.Background(), r)
+	repo.VersionedAcceptanceTest(t, context.Background(), r)
 	extraRepoTests(t, context.Background(), r)
 
 	// Repo with other namespace.
@@ -73,6 +75,8 @@ func TestReadRepo(t *testing.T) {
 		}
 	}()
 	repo.AcceptanceTest(t, ctx, r)
+	repo.BatchAcceptanceTest(t, ctx, r)
+	repo.VersionedAcceptanceTest(t, ctx, r)
 	extraRepoTests(t, ctx, r)
 
 }
@@ -0,0 +1,93 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swap
+
+import (
+	"context"
+	"sync"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+)
+
+// Repo is a middleware that delegates to a repository that can be swapped
+// while in use. It is useful to switch traffic to a rebuilt read model, for
+// example after replaying events to a shadow repository.
+type Repo struct {
+	repo   eh.ReadWriteRepo
+	repoMu sync.RWMutex
+}
+
+// NewRepo creates a new Repo.
+func NewRepo(repo eh.ReadWriteRepo) *Repo {
+	return &Repo{
+		repo: repo,
+	}
+}
+
+// Swap switches to a new repository and returns the old one.
+func (r *Repo) Swap(repo eh.ReadWriteRepo) eh.ReadWriteRepo {
+	r.repoMu.Lock()
+	defer r.repoMu.Unlock()
+
+	old := r.repo
+	r.repo = repo
+	return old
+}
+
+// Parent implements the Parent method of the eventhorizon.ReadRepo interface.
+// It returns the current repository.
+func (r *Repo) Parent() eh.ReadRepo {
+	return r.current()
+}
+
+// Find implements the Find method of the eventhorizon.ReadRepo interface.
+func (r *Repo) Find(ctx context.Context, id uuid.UUID) (eh.Entity, error) {
+	return r.current().Find(ctx, id)
+}
+
+// FindAll implements the FindAll method of the eventhorizon.ReadRepo interface.
+func (r *Repo) FindAll(ctx context.Context) ([]eh.Entity, error) {
+	return r.current().FindAll(ctx)
+}
+
+// Save implements the Save method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Save(ctx context.Context, entity eh.Entity) error {
+	return r.current().Save(ctx, entity)
+}
+
+// Remove implements the Remove method of the eventhorizon.WriteRepo interface.
+func (r *Repo) Remove(ctx context.Context, id uuid.UUID) error {
+	return r.current().Remove(ctx, id)
+}
+
+func (r *Repo) current() eh.ReadWriteRepo {
+	r.repoMu.RLock()
+	defer r.repoMu.RUnlock()
+	return r.repo
+}
+
+// Repository returns a parent ReadRepo if there is one.
+func Repository(repo eh.ReadRepo) *Repo {
+	if repo == nil {
+		return nil
+	}
+
+	if r, ok := repo.(*Repo); ok {
+		return r
+	}
+
+	return Repository(repo.Parent())
+}
@@ -0,0 +1,89 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package swap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"github.com/looplab/eventhorizon/repo"
+	"github.com/looplab/eventhorizon/repo/memory"
+)
+
+func TestReadRepo(t *testing.T) {
+	baseRepo := memory.NewRepo()
+	r := NewRepo(baseRepo)
+	if r == nil {
+		t.Error("there should be a repository")
+	}
+	if parent := r.Parent(); parent != baseRepo {
+		t.Error("the parent repo should be correct:", parent)
+	}
+
+	// Read repository with default namespace.
+	repo.AcceptanceTest(t, context.Background(), r)
+
+	// Read repository with other namespace.
+	ctx := eh.NewContextWithNamespace(context.Background(), "ns")
+	repo.AcceptanceTest(t, ctx, r)
+}
+
+func TestSwap(t *testing.T) {
+	ctx := context.Background()
+	oldRepo := memory.NewRepo()
+	r := NewRepo(oldRepo)
+
+	entity := &mocks.SimpleModel{
+		ID:      uuid.New(),
+		Content: "entity",
+	}
+	if err := r.Save(ctx, entity); err != nil {
+		t.Error("there should be no error:", err)
+	}
+
+	newRepo := memory.NewRepo()
+	if old := r.Swap(newRepo); old != oldRepo {
+		t.Error("the old repo should be returned:", old)
+	}
+	if parent := r.Parent(); parent != newRepo {
+		t.Error("the parent repo should be correct:", parent)
+	}
+	if _, err := r.Find(ctx, entity.ID); err == nil {
+		t.Error("the entity should not be found in the new repo")
+	}
+	if e, err := oldRepo.Find(ctx, entity.ID); err != nil || e != entity {
+		t.Error("the entity should still be in the old repo:", e, err)
+	}
+}
+
+func TestRepository(t *testing.T) {
+	if r := Repository(nil); r != nil {
+		t.Error("the parent repository should be nil:", r)
+	}
+
+	inner := &mocks.Repo{}
+	if r := Repository(inner); r != nil {
+		t.Error("the parent repository should be nil:", r)
+	}
+
+	swapRepo := NewRepo(inner)
+	outer := &mocks.Repo{ParentRepo: swapRepo}
+	if r := Repository(outer); r != swapRepo {
+		t.Error("the parent repository should be correct:", r)
+	}
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+
+	eh "github.com/looplab/eventhorizon"
+	"go.opencensus.io/trace"
+)
+
+// NewCommandHandlerMiddleware returns a command handler middleware that adds
+// a span for handling each command, with the command and aggregate type and
+// the aggregate ID as attributes.
+func NewCommandHandlerMiddleware() eh.CommandHandlerMiddleware {
+	return eh.CommandHandlerMiddleware(func(h eh.CommandHandler) eh.CommandHandler {
+		return eh.CommandHandlerFunc(func(ctx context.Context, cmd eh.Command) error {
+			ctx, span := startSpan(ctx, "eh.HandleCommand "+string(cmd.CommandType()))
+			span.AddAttributes(
+				trace.StringAttribute(commandTypeAttr, string(cmd.CommandType())),
+				trace.StringAttribute(aggregateTypeAttr, string(cmd.AggregateType())),
+				trace.StringAttribute(aggregateIDAttr, cmd.AggregateID().String()),
+				trace.StringAttribute(namespaceAttr, eh.NamespaceFromContext(ctx)),
+			)
+
+			err := h.HandleCommand(ctx, cmd)
+			endSpan(span, err)
+			return err
+		})
+	})
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"go.opencensus.io/trace"
+)
+
+func TestCommandHandlerMiddleware(t *testing.T) {
+	e, unregister := record()
+	defer unregister()
+
+	inner := &mocks.CommandHandler{}
+	h := eh.UseCommandHandlerMiddleware(inner, NewCommandHandlerMiddleware())
+	cmd := mocks.Command{ID: uuid.New(), Content: "content"}
+	if err := h.HandleCommand(context.Background(), cmd); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	if trace.FromContext(inner.Context) == nil {
+		t.Error("the span should be in the context")
+	}
+
+	inner.Err = errors.New("error")
+	if err := h.HandleCommand(context.Background(), cmd); err != inner.Err {
+		t.Error("there should be an error:", err)
+	}
+
+	spans := e.Spans()
+	if len(spans) != 2 {
+		t.Fatal("there should be two spans:", spans)
+	}
+	if spans[0].Name != "eh.HandleCommand Command" {
+		t.Error("the span name should be correct:", spans[0].Name)
+	}
+	if spans[0].Attributes[commandTypeAttr] != "Command" ||
+		spans[0].Attributes[aggregateTypeAttr] != "Aggregate" ||
+		spans[0].Attributes[aggregateIDAttr] != cmd.ID.String() {
+		t.Error("the span attributes should be correct:", spans[0].Attributes)
+	}
+	if spans[0].Code != trace.StatusCodeOK {
+		t.Error("the span status should be OK:", spans[0].Status)
+	}
+	if spans[1].Code != trace.StatusCodeUnknown || spans[1].Message != "error" {
+		t.Error("the span status should be an error:", spans[1].Status)
+	}
+}
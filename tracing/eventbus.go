@@ -0,0 +1,75 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+
+	eh "github.com/looplab/eventhorizon"
+	"go.opencensus.io/trace"
+)
+
+// NewEventBusMiddleware returns an event bus middleware that adds a span for
+// publishing each event, and for handling each event by the handlers and
+// observers that are added to the bus.
+func NewEventBusMiddleware() eh.EventBusMiddleware {
+	publish := eh.PublishEventMiddleware(func(p eh.PublishEventFunc) eh.PublishEventFunc {
+		return func(ctx context.Context, event eh.Event) error {
+			ctx, span := startSpan(ctx, "eh.PublishEvent "+string(event.EventType()))
+			span.AddAttributes(eventAttributes(ctx, event)...)
+
+			err := p(ctx, event)
+			endSpan(span, err)
+			return err
+		}
+	})
+	return eh.NewEventBusMiddleware(publish, NewEventHandlerMiddleware())
+}
+
+// NewEventHandlerMiddleware returns an event handler middleware that adds a
+// span for handling each event, with the handler type and the event as
+// attributes.
+func NewEventHandlerMiddleware() eh.EventHandlerMiddleware {
+	return eh.EventHandlerMiddleware(func(h eh.EventHandler) eh.EventHandler {
+		return &eventHandler{h}
+	})
+}
+
+// eventHandler is an event handler that adds spans, keeping the handler type.
+type eventHandler struct {
+	eh.EventHandler
+}
+
+// HandleEvent implements the HandleEvent method of the eventhorizon.EventHandler
+// interface.
+func (h *eventHandler) HandleEvent(ctx context.Context, event eh.Event) error {
+	ctx, span := startSpan(ctx, "eh.HandleEvent "+string(event.EventType()))
+	span.AddAttributes(eventAttributes(ctx, event)...)
+	span.AddAttributes(trace.StringAttribute(handlerTypeAttr, string(h.HandlerType())))
+
+	err := h.EventHandler.HandleEvent(ctx, event)
+	endSpan(span, err)
+	return err
+}
+
+func eventAttributes(ctx context.Context, event eh.Event) []trace.Attribute {
+	return []trace.Attribute{
+		trace.StringAttribute(eventTypeAttr, string(event.EventType())),
+		trace.StringAttribute(aggregateTypeAttr, string(event.AggregateType())),
+		trace.StringAttribute(aggregateIDAttr, event.AggregateID().String()),
+		trace.Int64Attribute(versionAttr, int64(event.Version())),
+		trace.StringAttribute(namespaceAttr, eh.NamespaceFromContext(ctx)),
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"go.opencensus.io/trace"
+)
+
+func TestEventBusMiddleware(t *testing.T) {
+	e, unregister := record()
+	defer unregister()
+
+	bus := &testBus{}
+	b := eh.UseEventBusMiddleware(bus, NewEventBusMiddleware())
+	handler := mocks.NewEventHandler("handler")
+	b.AddHandler(eh.MatchAny(), handler)
+
+	id := uuid.New()
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event"},
+		time.Now(), mocks.AggregateType, id, 1)
+	ctx, span := trace.StartSpan(context.Background(), "parent")
+	if err := b.PublishEvent(ctx, event); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	span.End()
+
+	// Let the mocked bus hand over the published event with the marshaled
+	// context, as a remote bus would.
+	if len(bus.Events) != 1 {
+		t.Fatal("the event should have been published:", bus.Events)
+	}
+	ctx = eh.UnmarshalContext(eh.MarshalContext(bus.Context))
+	for _, h := range bus.Handlers {
+		if err := h.HandleEvent(ctx, bus.Events[0]); err != nil {
+			t.Error("there should be no error:", err)
+		}
+	}
+	if bus.Handlers[0].HandlerType() != handler.HandlerType() {
+		t.Error("the handler type should be kept:", bus.Handlers[0].HandlerType())
+	}
+
+	spans := e.Spans()
+	if len(spans) != 3 {
+		t.Fatal("there should be three spans:", spans)
+	}
+	publish, parent, handle := spans[0], spans[1], spans[2]
+	if publish.Name != "eh.PublishEvent Event" || publish.ParentSpanID != parent.SpanID {
+		t.Error("the publish span should be correct:", publish)
+	}
+	if publish.Attributes[eventTypeAttr] != "Event" ||
+		publish.Attributes[aggregateIDAttr] != id.String() ||
+		publish.Attributes[versionAttr] != int64(1) {
+		t.Error("the publish span attributes should be correct:", publish.Attributes)
+	}
+	if handle.Name != "eh.HandleEvent Event" || handle.ParentSpanID != publish.SpanID ||
+		handle.TraceID != parent.TraceID || !handle.HasRemoteParent {
+		t.Error("the handle span should be correct:", handle)
+	}
+	if handle.Attributes[handlerTypeAttr] != "handler" {
+		t.Error("the handle span attributes should be correct:", handle.Attributes)
+	}
+}
+
+// testBus is an event bus that keeps the published events and added handlers.
+type testBus struct {
+	mocks.EventBus
+	Handlers []eh.EventHandler
+}
+
+// AddHandler implements the AddHandler method of the eventhorizon.EventBus interface.
+func (b *testBus) AddHandler(m eh.EventMatcher, h eh.EventHandler) {
+	b.Handlers = append(b.Handlers, h)
+}
@@ -0,0 +1,73 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"go.opencensus.io/trace"
+)
+
+// EventStore wraps an EventStore and adds spans for saving and loading events.
+type EventStore struct {
+	eh.EventStore
+}
+
+// NewEventStore creates a new EventStore.
+func NewEventStore(eventStore eh.EventStore) *EventStore {
+	if eventStore == nil {
+		return nil
+	}
+
+	return &EventStore{
+		EventStore: eventStore,
+	}
+}
+
+// Save implements the Save method of the eventhorizon.EventStore interface.
+func (s *EventStore) Save(ctx context.Context, events []eh.Event, originalVersion int) error {
+	ctx, span := startSpan(ctx, "eh.EventStore.Save")
+	if len(events) > 0 {
+		span.AddAttributes(
+			trace.StringAttribute(aggregateTypeAttr, string(events[0].AggregateType())),
+			trace.StringAttribute(aggregateIDAttr, events[0].AggregateID().String()),
+		)
+	}
+	span.AddAttributes(
+		trace.Int64Attribute(versionAttr, int64(originalVersion)),
+		trace.Int64Attribute(eventsAttr, int64(len(events))),
+		trace.StringAttribute(namespaceAttr, eh.NamespaceFromContext(ctx)),
+	)
+
+	err := s.EventStore.Save(ctx, events, originalVersion)
+	endSpan(span, err)
+	return err
+}
+
+// Load implements the Load method of the eventhorizon.EventStore interface.
+func (s *EventStore) Load(ctx context.Context, id uuid.UUID) ([]eh.Event, error) {
+	ctx, span := startSpan(ctx, "eh.EventStore.Load")
+	span.AddAttributes(
+		trace.StringAttribute(aggregateIDAttr, id.String()),
+		trace.StringAttribute(namespaceAttr, eh.NamespaceFromContext(ctx)),
+	)
+
+	events, err := s.EventStore.Load(ctx, id)
+	span.AddAttributes(trace.Int64Attribute(eventsAttr, int64(len(events))))
+	endSpan(span, err)
+	return events, err
+}
@@ -0,0 +1,64 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	eh "github.com/looplab/eventhorizon"
+	"github.com/looplab/eventhorizon/mocks"
+	"go.opencensus.io/trace"
+)
+
+func TestEventStore(t *testing.T) {
+	if NewEventStore(nil) != nil {
+		t.Error("there should be no event store")
+	}
+
+	e, unregister := record()
+	defer unregister()
+
+	inner := &mocks.EventStore{}
+	store := NewEventStore(inner)
+	id := uuid.New()
+	event := eh.NewEventForAggregate(mocks.EventType, &mocks.EventData{Content: "event"},
+		time.Now(), mocks.AggregateType, id, 1)
+	if err := store.Save(context.Background(), []eh.Event{event}, 0); err != nil {
+		t.Error("there should be no error:", err)
+	}
+	inner.Err = errors.New("error")
+	if _, err := store.Load(context.Background(), id); err != inner.Err {
+		t.Error("there should be an error:", err)
+	}
+
+	spans := e.Spans()
+	if len(spans) != 2 {
+		t.Fatal("there should be two spans:", spans)
+	}
+	if spans[0].Name != "eh.EventStore.Save" ||
+		spans[0].Attributes[aggregateIDAttr] != id.String() ||
+		spans[0].Attributes[eventsAttr] != int64(1) {
+		t.Error("the save span should be correct:", spans[0])
+	}
+	if spans[1].Name != "eh.EventStore.Load" ||
+		spans[1].Attributes[aggregateIDAttr] != id.String() ||
+		spans[1].Code != trace.StatusCodeUnknown {
+		t.Error("the load span should be correct:", spans[1])
+	}
+}
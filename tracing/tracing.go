@@ -0,0 +1,127 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracing adds OpenCensus tracing spans when handling commands, when
+// publishing and handling events and when saving and loading events in the
+// event store. The spans are propagated through the context, the span context
+// is also marshaled with the context so that spans continue across event
+// busses and other transports that use eventhorizon.MarshalContext.
+package tracing
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	eh "github.com/looplab/eventhorizon"
+	"go.opencensus.io/trace"
+)
+
+func init() {
+	// Register the span context.
+	eh.RegisterContextMarshaler(func(ctx context.Context, vals map[string]interface{}) {
+		if sc, ok := spanContext(ctx); ok {
+			vals[spanContextKeyStr] = formatSpanContext(sc)
+		}
+	})
+	eh.RegisterContextUnmarshaler(func(ctx context.Context, vals map[string]interface{}) context.Context {
+		if s, ok := vals[spanContextKeyStr].(string); ok {
+			if sc, ok := parseSpanContext(s); ok {
+				return context.WithValue(ctx, remoteParentKey, sc)
+			}
+		}
+		return ctx
+	})
+}
+
+type contextKey int
+
+// Context key for the span context of a remote parent.
+const (
+	remoteParentKey contextKey = iota
+)
+
+// String used to marshal the span context.
+const spanContextKeyStr = "eh_trace"
+
+// Attribute keys used for spans.
+const (
+	commandTypeAttr   = "eh.command_type"
+	aggregateTypeAttr = "eh.aggregate_type"
+	aggregateIDAttr   = "eh.aggregate_id"
+	eventTypeAttr     = "eh.event_type"
+	versionAttr       = "eh.version"
+	handlerTypeAttr   = "eh.handler_type"
+	namespaceAttr     = "eh.namespace"
+	eventsAttr        = "eh.events"
+)
+
+// startSpan starts a span as a child of the span in the context, or of the
+// remote parent that was unmarshaled with the context if there is none.
+func startSpan(ctx context.Context, name string) (context.Context, *trace.Span) {
+	if trace.FromContext(ctx) == nil {
+		if sc, ok := ctx.Value(remoteParentKey).(trace.SpanContext); ok {
+			return trace.StartSpanWithRemoteParent(ctx, name, sc)
+		}
+	}
+	return trace.StartSpan(ctx, name)
+}
+
+// endSpan ends a span with the status of the error.
+func endSpan(span *trace.Span, err error) {
+	if err != nil {
+		span.SetStatus(trace.Status{Code: trace.StatusCodeUnknown, Message: err.Error()})
+	}
+	span.End()
+}
+
+// spanContext returns the span context of the span in the context, or of the
+// remote parent.
+func spanContext(ctx context.Context) (trace.SpanContext, bool) {
+	if span := trace.FromContext(ctx); span != nil {
+		return span.SpanContext(), true
+	}
+	sc, ok := ctx.Value(remoteParentKey).(trace.SpanContext)
+	return sc, ok
+}
+
+// formatSpanContext formats a span context as "traceid-spanid-options".
+func formatSpanContext(sc trace.SpanContext) string {
+	return fmt.Sprintf("%s-%s-%02x", sc.TraceID, sc.SpanID, uint32(sc.TraceOptions))
+}
+
+func parseSpanContext(s string) (trace.SpanContext, bool) {
+	var sc trace.SpanContext
+	parts := strings.Split(s, "-")
+	if len(parts) != 3 {
+		return sc, false
+	}
+	traceID, err := hex.DecodeString(parts[0])
+	if err != nil || len(traceID) != len(sc.TraceID) {
+		return sc, false
+	}
+	spanID, err := hex.DecodeString(parts[1])
+	if err != nil || len(spanID) != len(sc.SpanID) {
+		return sc, false
+	}
+	options, err := hex.DecodeString(parts[2])
+	if err != nil || len(options) != 1 {
+		return sc, false
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.TraceOptions = trace.TraceOptions(options[0])
+	return sc, true
+}
@@ -0,0 +1,102 @@
+// Copyright (c) 2018 - The Event Horizon authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	eh "github.com/looplab/eventhorizon"
+	"go.opencensus.io/trace"
+)
+
+func init() {
+	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+}
+
+// exporter is a trace exporter that keeps the exported spans.
+type exporter struct {
+	spans []*trace.SpanData
+	mu    sync.Mutex
+}
+
+// record registers a new exporter, which is unregistered by the returned func.
+func record() (*exporter, func()) {
+	e := &exporter{}
+	trace.RegisterExporter(e)
+	return e, func() { trace.UnregisterExporter(e) }
+}
+
+// ExportSpan implements the ExportSpan method of the trace.Exporter interface.
+func (e *exporter) ExportSpan(s *trace.SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, s)
+}
+
+func (e *exporter) Spans() []*trace.SpanData {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return append([]*trace.SpanData{}, e.spans...)
+}
+
+func TestContextMarshaler(t *testing.T) {
+	ctx, span := trace.StartSpan(context.Background(), "test")
+	defer span.End()
+
+	vals := eh.MarshalContext(ctx)
+	sc := span.SpanContext()
+	if vals[spanContextKeyStr] != formatSpanContext(sc) {
+		t.Error("the marshaled span context should be correct:", vals)
+	}
+
+	ctx = eh.UnmarshalContext(vals)
+	if remote, ok := spanContext(ctx); !ok || remote != sc {
+		t.Error("the unmarshaled span context should be correct:", remote)
+	}
+
+	// Spans should continue from the remote parent.
+	e, unregister := record()
+	defer unregister()
+	_, child := startSpan(ctx, "child")
+	child.End()
+	spans := e.Spans()
+	if len(spans) != 1 {
+		t.Fatal("there should be one span:", spans)
+	}
+	if spans[0].TraceID != sc.TraceID || spans[0].ParentSpanID != sc.SpanID || !spans[0].HasRemoteParent {
+		t.Error("the span should have the remote parent:", spans[0])
+	}
+}
+
+func TestParseSpanContext(t *testing.T) {
+	testCases := map[string]bool{
+		"0102030405060708090a0b0c0d0e0f10-0102030405060708-01": true,
+		"0102030405060708090a0b0c0d0e0f10-0102030405060708":    false,
+		"0102-0102030405060708-01":                             false,
+		"0102030405060708090a0b0c0d0e0f10-01020304-01":         false,
+		"0102030405060708090a0b0c0d0e0f10-0102030405060708-xx": false,
+	}
+	for s, valid := range testCases {
+		sc, ok := parseSpanContext(s)
+		if ok != valid {
+			t.Error("the span context should be parsed correctly:", s)
+		}
+		if ok && formatSpanContext(sc) != s {
+			t.Error("the span context should be formatted correctly:", formatSpanContext(sc))
+		}
+	}
+}